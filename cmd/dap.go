@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/bradford-hamilton/apple-1/internal/dap"
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+	"github.com/spf13/cobra"
+)
+
+// dapAddr is the address the debug adapter listens on
+var dapAddr string
+
+// dapCmd serves the Debug Adapter Protocol so editors can debug programs in the emulator
+var dapCmd = &cobra.Command{
+	Use:   "dap [path/to/program]",
+	Short: "serve the Debug Adapter Protocol for editors such as VS Code",
+	Long: `Listen for Debug Adapter Protocol clients, such as VS Code with a debugServer setting.
+Clients can launch a program with the arguments program, loadAddress, symbols, lineMap,
+cpu, clockSpeed and stopOnEntry, or attach to the program given on the command line.
+
+Breakpoints can be set on source lines when a line map is loaded, and on labels, addresses
+and instructions otherwise. Conditions use the --break-when expression language. The Apple 1
+display appears in the debug console, and typing a quoted string there, e.g. "280R\r",
+types it on the Apple 1 keyboard.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		srv := &dap.Server{}
+		if len(args) == 1 {
+			machine, lines, err := loadDebuggee(args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(exitError)
+			}
+			srv.Machine, srv.Lines = machine, lines
+		}
+		if err := srv.ListenAndServe(dapAddr); err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
+		}
+	},
+}
+
+func init() {
+	dapCmd.Flags().StringVar(&dapAddr, "listen", "127.0.0.1:4711", "address to listen on")
+	dapCmd.Flags().StringVar(&loadAddr, "load-addr", "$0280", "address the program is loaded at and started from")
+	dapCmd.Flags().StringArrayVar(&symbolFiles, "symbols", nil, "load labels from a VICE label file or ld65 map file (repeatable)")
+	dapCmd.Flags().StringVar(&lineMapPath, "line-map", "", "file mapping instruction addresses to source lines, e.g. '$0280 hello.s:12'")
+}
+
+// loadDebuggee loads the program at path for clients to attach to
+func loadDebuggee(path string) (*vm.VM, vm.LineMap, error) {
+	program, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	addr, err := parseAddr(loadAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	machine := vm.New()
+	for _, path := range symbolFiles {
+		if err := machine.LoadSymbols(path); err != nil {
+			return nil, nil, err
+		}
+	}
+	var lines vm.LineMap
+	if lineMapPath != "" {
+		if lines, err = vm.LoadLineMap(lineMapPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	machine.Load(addr, program)
+	regs := machine.Registers()
+	regs.PC = addr
+	machine.SetRegisters(regs)
+	return machine, lines, nil
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bradford-hamilton/apple-1/internal/script"
+	"github.com/bradford-hamilton/apple-1/internal/term"
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// expectPollInterval is how often a headless run checks the display for the --expect pattern
+const expectPollInterval = 10 * time.Millisecond
+
+var (
+	// headless runs the vm without a terminal, for scripts and CI
+	headless bool
+
+	// inputPath is the file of keystrokes typed during a headless run, - for stdin
+	inputPath string
+
+	// timeout stops a headless run after this much wall clock time, 0 for never
+	timeout time.Duration
+
+	// maxCycles stops a headless run after this many cycles, 0 for never
+	maxCycles uint64
+
+	// expect is a regular expression that stops a headless run successfully once it matches
+	// the display output
+	expect string
+
+	// scriptPath is an interaction script run against the program instead of --input
+	scriptPath string
+)
+
+// capture records the display output of a headless run as plain text so it can be searched
+// while the vm writes to it
+type capture struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Write(p)
+}
+
+func (c *capture) match(re *regexp.Regexp) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return re.Match(c.buf.Bytes())
+}
+
+// runHeadless runs machine without touching the terminal. Keystrokes come from --input and
+// the display is copied to stdout as plain text. The run stops when --expect matches the
+// display, after --timeout or --max-cycles, or on a signal, fault or breakpoint. It returns
+// the exit code: exitOK if the expectation was met, or if there was none and the run ended
+// on its timeout or cycle budget.
+func runHeadless(ctx context.Context, machine *vm.VM, sig <-chan syscall.Signal) int {
+	if scriptPath != "" && (inputPath != "" || expect != "") {
+		fmt.Println("--script can't be combined with --input or --expect")
+		return exitError
+	}
+
+	var re *regexp.Regexp
+	if expect != "" {
+		var err error
+		if re, err = regexp.Compile(expect); err != nil {
+			fmt.Printf("invalid --expect pattern: %v\n", err)
+			return exitError
+		}
+	}
+
+	if inputPath != "" {
+		in, err := openInput(inputPath)
+		if err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+		defer in.Close()
+		go feedKeys(machine, in)
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if maxCycles > 0 {
+		machine.SetCycleLimit(machine.Cycles() + maxCycles)
+	}
+
+	if scriptPath != "" {
+		return runScript(ctx, machine, sig)
+	}
+
+	screen := &capture{}
+	setDisplay(machine, term.NewTextDisplay(io.MultiWriter(os.Stdout, screen)))
+
+	matched := make(chan struct{})
+	if re != nil {
+		go func() {
+			ticker := time.NewTicker(expectPollInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if screen.match(re) {
+						close(matched)
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	err := runVM(ctx, machine)
+	fmt.Println()
+
+	switch e := err.(type) {
+	case *vm.Exit:
+		return e.Code
+	case *vm.Halt, *vm.Fault:
+		fmt.Fprintf(os.Stderr, "%v\n%s", err, machine.DumpState())
+		if _, ok := err.(*vm.Fault); ok {
+			return exitFault
+		}
+		return exitHalted
+	}
+	select {
+	case s := <-sig:
+		return exitSignal + int(s)
+	default:
+	}
+
+	// The pattern may have appeared after the last poll
+	if re != nil {
+		select {
+		case <-matched:
+			return exitOK
+		default:
+		}
+		if screen.match(re) {
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "%v before the display matched %q\n", stopReason(err), expect)
+		return exitUnmet
+	}
+	return exitOK
+}
+
+// runScript runs the interaction script from --script against machine. It returns exitOK if
+// every command in the script succeeded, exitHalted if a breakpoint or watchpoint stopped it
+// and exitUnmet if a command failed.
+func runScript(ctx context.Context, machine *vm.VM, sig <-chan syscall.Signal) int {
+	s, err := script.Load(scriptPath)
+	if err != nil {
+		fmt.Println(err)
+		return exitError
+	}
+
+	err = s.Run(ctx, machine, term.NewTextDisplay(os.Stdout))
+	fmt.Println()
+	if err == nil {
+		return exitOK
+	}
+
+	var exit *vm.Exit
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+	var fault *vm.Fault
+	if errors.As(err, &fault) {
+		fmt.Fprintf(os.Stderr, "%v\n%s", err, machine.DumpState())
+		return exitFault
+	}
+	var halt *vm.Halt
+	if errors.As(err, &halt) {
+		fmt.Fprintf(os.Stderr, "%v\n%s", err, machine.DumpState())
+		return exitHalted
+	}
+	select {
+	case s := <-sig:
+		return exitSignal + int(s)
+	default:
+	}
+	fmt.Fprintln(os.Stderr, err)
+	return exitUnmet
+}
+
+// stopReason describes why a headless run stopped
+func stopReason(err error) string {
+	switch err {
+	case vm.ErrCycleLimit:
+		return fmt.Sprintf("cycle budget of %d exhausted", maxCycles)
+	case context.DeadlineExceeded:
+		return fmt.Sprintf("timed out after %v", timeout)
+	}
+	return fmt.Sprintf("stopped (%v)", err)
+}
+
+// openInput opens the keystroke file for a headless run, - meaning stdin
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
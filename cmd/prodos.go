@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bradford-hamilton/apple-1/internal/prodos"
+	"github.com/spf13/cobra"
+)
+
+// Options for the prodos subcommands
+var (
+	volumeName   string
+	volumeBlocks int
+	fileType     string
+	auxType      string
+)
+
+// prodosCmd groups the commands working on ProDOS disk images
+var prodosCmd = &cobra.Command{
+	Use:   "prodos",
+	Short: "create ProDOS disk images and copy files in and out of them",
+	Long: `Work with ProDOS volumes in disk images, such as the CF card used by the cffa1 card, to
+move programs between the host and the Apple 1. Images are ProDOS order (.po, .hdv) or 2IMG
+(.2mg). Paths inside an image are separated by slashes, e.g. GAMES/LIFE, and may start with
+the volume name, e.g. /CFFA1/GAMES/LIFE.
+
+  appleone prodos create cf.po --name CFFA1
+  appleone prodos put cf.po hello.bin HELLO --type BIN --aux '$0280'
+  appleone prodos ls cf.po
+  appleone prodos get cf.po HELLO hello.bin
+  appleone prodos rm cf.po HELLO`,
+}
+
+var prodosCreateCmd = &cobra.Command{
+	Use:   "create IMAGE",
+	Short: "create an empty ProDOS volume",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := prodos.Create(args[0], volumeName, volumeBlocks); err != nil {
+			exitWith(err)
+		}
+	},
+}
+
+var prodosLsCmd = &cobra.Command{
+	Use:   "ls IMAGE [DIRECTORY]",
+	Short: "list the files in a ProDOS volume",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vol := openVolume(args[0])
+		defer vol.Close()
+
+		dir := ""
+		if len(args) == 2 {
+			dir = args[1]
+		}
+		entries, err := vol.List(dir)
+		if err != nil {
+			exitWith(err)
+		}
+		fmt.Printf("/%s\n\n", strings.Trim(vol.Name+"/"+strings.ToUpper(strings.Trim(dir, "/")), "/"))
+		fmt.Printf(" %-15s %-4s %6s  %-15s %8s  %s\n", "NAME", "TYPE", "BLOCKS", "MODIFIED", "ENDFILE", "SUBTYPE")
+		for _, e := range entries {
+			modified := "<NO DATE>"
+			if !e.Modified.IsZero() {
+				modified = strings.ToUpper(e.Modified.Format("02-Jan-06 15:04"))
+			}
+			fmt.Printf(" %-15s %-4s %6d  %-15s %8d  $%04X\n", e.Name, prodos.TypeName(e.Type), e.Blocks, modified, e.Size, e.Aux)
+		}
+		free := vol.FreeBlocks()
+		fmt.Printf("\nBLOCKS FREE: %d  BLOCKS USED: %d  TOTAL BLOCKS: %d\n", free, vol.Blocks-free, vol.Blocks)
+	},
+}
+
+var prodosGetCmd = &cobra.Command{
+	Use:   "get IMAGE PATH [FILE]",
+	Short: "copy a file out of a ProDOS volume, to FILE or - for stdout",
+	Args:  cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		vol := openVolume(args[0])
+		defer vol.Close()
+
+		data, e, err := vol.ReadFile(args[1])
+		if err != nil {
+			exitWith(err)
+		}
+		out := strings.ToLower(e.Name)
+		if len(args) == 3 {
+			out = args[2]
+		}
+		if out == "-" {
+			_, err = os.Stdout.Write(data)
+		} else {
+			err = ioutil.WriteFile(out, data, 0644)
+		}
+		if err != nil {
+			exitWith(err)
+		}
+		if out != "-" {
+			fmt.Printf("%s: %d bytes, type %s, aux $%04X\n", out, len(data), prodos.TypeName(e.Type), e.Aux)
+		}
+	},
+}
+
+var prodosPutCmd = &cobra.Command{
+	Use:   "put IMAGE FILE [PATH]",
+	Short: "copy a file into a ProDOS volume, replacing any file with the same name",
+	Long: `Copy FILE into the volume as PATH, which defaults to FILE's name in upper case without
+its extension. Programs are BIN files by default, with their load address as the aux type.
+Unless --aux is given, BIN files load at $0280, SYS files at $2000, and other types get 0.
+
+  appleone prodos put cf.po basic.bin BASIC --type BIN --aux '$E000'`,
+	Args: cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		t, err := prodos.ParseType(fileType)
+		if err != nil {
+			exitWith(err)
+		}
+		aux := prodos.DefaultAux(t)
+		if cmd.Flags().Changed("aux") {
+			if aux, err = parseAddr(auxType); err != nil {
+				exitWith(err)
+			}
+		}
+		data, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			exitWith(err)
+		}
+
+		path := strings.TrimSuffix(filepath.Base(args[1]), filepath.Ext(args[1]))
+		if len(args) == 3 {
+			path = args[2]
+		}
+		vol := openVolume(args[0])
+		defer vol.Close()
+		if err := vol.WriteFile(path, data, t, aux); err != nil {
+			exitWith(err)
+		}
+	},
+}
+
+var prodosRmCmd = &cobra.Command{
+	Use:   "rm IMAGE PATH",
+	Short: "delete a file, or an empty directory, from a ProDOS volume",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vol := openVolume(args[0])
+		defer vol.Close()
+		if err := vol.Remove(args[1]); err != nil {
+			exitWith(err)
+		}
+	},
+}
+
+func init() {
+	prodosCreateCmd.Flags().StringVar(&volumeName, "name", "APPLE1", "volume name")
+	prodosCreateCmd.Flags().IntVar(&volumeBlocks, "blocks", prodos.MaxBlocks, "size in 512 byte blocks, 65535 makes the largest (32MiB) volume")
+	prodosPutCmd.Flags().StringVar(&fileType, "type", "BIN", "file type, as a name (TXT, BIN, INT, BAS, SYS) or hex such as $F1")
+	prodosPutCmd.Flags().StringVar(&auxType, "aux", "", "aux type, the load address of BIN files (default $0280 for BIN, $2000 for SYS, otherwise 0)")
+
+	prodosCmd.AddCommand(prodosCreateCmd)
+	prodosCmd.AddCommand(prodosLsCmd)
+	prodosCmd.AddCommand(prodosGetCmd)
+	prodosCmd.AddCommand(prodosPutCmd)
+	prodosCmd.AddCommand(prodosRmCmd)
+}
+
+// openVolume opens the ProDOS volume in an image, exiting if it can't
+func openVolume(path string) *prodos.Volume {
+	vol, err := prodos.Open(path)
+	if err != nil {
+		exitWith(err)
+	}
+	return vol
+}
+
+// exitWith prints err and exits with exitError
+func exitWith(err error) {
+	fmt.Println(err)
+	os.Exit(exitError)
+}
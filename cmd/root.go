@@ -28,7 +28,11 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
+	rootCmd.AddCommand(dapCmd)
+	rootCmd.AddCommand(prodosCmd)
 	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(testCmd)
 	rootCmd.AddCommand(versionCmd)
 }
 
@@ -1,28 +1,551 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 
+	"github.com/bradford-hamilton/apple-1/internal/card"
+	"github.com/bradford-hamilton/apple-1/internal/diff"
+	"github.com/bradford-hamilton/apple-1/internal/profile"
+	"github.com/bradford-hamilton/apple-1/internal/telnet"
+	"github.com/bradford-hamilton/apple-1/internal/term"
+	"github.com/bradford-hamilton/apple-1/internal/vicemon"
 	"github.com/bradford-hamilton/apple-1/internal/vm"
 	"github.com/spf13/cobra"
 )
 
-// runCmd runs the appleone virtual machine and waits for a shutdown signal to exit
+// Exit codes returned by `appleone run`
+const (
+	exitOK     = 0   // the vm was shut down cleanly
+	exitError  = 1   // bad arguments, or the program couldn't be loaded
+	exitFault  = 2   // the cpu faulted
+	exitHalted = 3   // a breakpoint halted the vm
+	exitUnmet  = 4   // a headless run stopped before the display matched --expect, or its script failed
+	exitGolden = 5   // the final screen differed from the --golden file
+	exitSignal = 128 // plus the number of the signal that interrupted the vm
+)
+
+var (
+	// breakWhen holds the conditional breakpoints provided with --break-when
+	breakWhen []string
+
+	// breakAt holds the addresses or labels provided with --break
+	breakAt []string
+
+	// symbolFiles holds the VICE label or ld65 map files provided with --symbols
+	symbolFiles []string
+
+	// trace enables writing each executed instruction to stderr
+	trace bool
+
+	// loadAddr is where the program is loaded and started
+	loadAddr string
+
+	// clockSpeed is the emulated clock speed in Hz
+	clockSpeed int
+
+	// screenOut is where the final screen is written when the run ends
+	screenOut string
+
+	// golden is a file holding the screen the run is expected to end with
+	golden string
+
+	// profilePath is where a pprof profile of the run is written
+	profilePath string
+
+	// cdlPath is where the code/data log of the run is written
+	cdlPath string
+
+	// lcovPath is where an lcov coverage report of the run is written
+	lcovPath string
+
+	// lineMapPath maps addresses to source lines for the lcov report
+	lineMapPath string
+
+	// machineName is the built-in profile or profile file given with --machine
+	machineName string
+
+	// machineProfile is the profile loaded from machineName
+	machineProfile *profile.Profile
+
+	// cardSpecs are the expansion cards given with --card, each a name and key=value options
+	cardSpecs []string
+
+	// memoryMapPath is a file describing the RAM, ROM, PIA and unmapped regions
+	memoryMapPath string
+
+	// binmonAddr is the address a VICE binary monitor listens on, if any
+	binmonAddr string
+
+	// monitor controls the run when --binmon is given
+	monitor *vicemon.Server
+
+	// telnetAddr is the address the telnet console listens on, if any
+	telnetAddr string
+
+	// console shares the keyboard and display over telnet when --telnet is given
+	console *telnet.Server
+)
+
+// runCmd runs the appleone virtual machine until it is interrupted, halts or faults
 var runCmd = &cobra.Command{
 	Use:   "run `path/to/program`",
 	Short: "run the Apple 1 emulator",
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Load a program into the Apple 1 and run it, with the keyboard and display attached to
+this terminal. Ctrl-C or SIGTERM shut the emulator down and restore the terminal.
+
+With --headless the terminal is left alone: keystrokes are read from --input, the display is
+written to stdout as plain text, and the run stops once the display matches --expect, or
+after --timeout or --max-cycles. Headless runs are unthrottled unless --clock is given.
+
+  appleone run --headless --input keys.txt --expect 'HELLO' --timeout 10s prog.bin
+
+Instead of --input and --expect, --script runs an expect-style script that types, waits for
+output and checks the screen, passing if every command in it succeeds:
+
+  type "10 PRINT 1\r"
+  wait "READY"
+  wait-cycles 50000
+  snapshot out.txt
+  assert-screen line 3 "HELLO"
+
+--profile counts the cycles spent in each subroutine, following JSR and RTS, and writes them
+as a pprof profile when the run ends. Load labels with --symbols to see routines by name:
+
+  go tool pprof -top out.pb.gz
+
+--cdl writes a code/data log: one byte per address of memory, with bit 0 set if it was
+executed as an opcode, bit 1 if fetched as an operand, bit 2 if read as data and bit 3 if
+written. --lcov writes how often each source line ran, given a --line-map file that lists an
+address and the source line assembled there on each line, e.g. '$0280 hello.s:12'.
+
+--binmon listens for debuggers that speak the VICE binary monitor protocol, e.g. on
+127.0.0.1:6502. Any command from a client stops the machine until the client sends exit;
+clients can read and write memory and registers, set checkpoints, and step.
+
+--telnet shares the keyboard and display over TCP, so the machine can be reached with e.g.
+'telnet localhost 6502'. Several clients can watch; the one connected longest types.
+
+--machine configures the machine from a built-in profile (apple1-4k, apple1-8k-basic or replica1)
+or a TOML or JSON profile file giving the cpu, clock speed, memory map, images to load and
+frontend options. Flags given alongside it take precedence:
+
+  cpu = "65c02"
+  clock = 1_000_000
+  memory = ["ram $0000-$7FFF", "pia $D000-$DFFF", "rom $FF00-$FFFF wozmon"]
+
+  [[load]]
+  file = "basic.bin"
+  addr = "$E000"
+
+  [frontend]
+  telnet = "127.0.0.1:6502"
+
+--card plugs a card into the expansion slot, given by name and key=value options. A profile
+lists cards as [[card]] tables with a name key. The available cards and their options are:
+
+%s
+--memory-map replaces the default 64KiB of RAM with regions read from a file, one per line,
+that mustn't overlap. ROM files are found relative to the map, writes to ROM are ignored,
+unmapped addresses read back the last value on the data bus, and the PIA is mirrored
+wherever A4 is set, as on a stock Apple 1:
+
+  ram      $0000-$0FFF
+  pia      $D000-$DFFF
+  rom      $FF00-$FFFF wozmon
+
+When the run ends --screen-out saves the 40x24 screen as text, and --golden compares it with
+a stored expectation line by line, printing a unified diff if they differ. CRLF line endings
+and a missing final new line in the golden file are ignored.
+
+Exit codes:
+  0    shut down cleanly, or a headless run met its expectation
+  1    bad arguments, or the program couldn't be loaded
+  2    the cpu faulted
+  3    a breakpoint halted the vm
+  4    a headless run stopped before the display matched --expect, or its script failed
+  5    the final screen differed from --golden
+  128+ interrupted by the signal with that number, e.g. 130 for SIGINT
+A program writing a byte to a debugport card's exit register exits with that byte as the code.`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) != 1 {
 			fmt.Println("The run command takes one argument: a `path/to/program`")
-			os.Exit(1)
+			os.Exit(exitError)
 		}
-		pathToProgram := os.Args[2]
-		fmt.Println("path to program:", pathToProgram)
-
-		vm := vm.New()
-		go vm.Run()
-		<-vm.ShutdownC
+		if machineName != "" {
+			p, err := profile.Find(machineName)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(exitError)
+			}
+			machineProfile = p
+			applyProfileFlags(cmd, p)
+		}
+		if headless && !cmd.Flags().Changed("clock") && (machineProfile == nil || machineProfile.Clock == nil) {
+			clockSpeed = 0
+		}
+		os.Exit(runProgram(args[0]))
 	},
 }
+
+func init() {
+	var usage strings.Builder
+	for _, line := range strings.SplitAfter(card.Usage(), "\n") {
+		if line != "" {
+			usage.WriteString("  " + line)
+		}
+	}
+	runCmd.Long = fmt.Sprintf(runCmd.Long, usage.String())
+
+	runCmd.Flags().StringArrayVar(
+		&symbolFiles,
+		"symbols",
+		nil,
+		"load labels from a VICE label file or ld65 map file (repeatable)",
+	)
+	runCmd.Flags().StringArrayVar(
+		&breakAt,
+		"break",
+		nil,
+		"halt and dump the vm state when execution reaches an address or label, e.g. GETLINE (repeatable)",
+	)
+	runCmd.Flags().StringArrayVar(
+		&breakWhen,
+		"break-when",
+		nil,
+		"halt and dump the vm state once the expression holds, e.g. 'A == $8D && X > 3' (repeatable)",
+	)
+	runCmd.Flags().BoolVar(&trace, "trace", false, "write each executed instruction to stderr")
+	runCmd.Flags().StringVar(&loadAddr, "load-addr", "$0280", "address the program is loaded at and started from")
+	runCmd.Flags().IntVar(&clockSpeed, "clock", vm.DefaultClockSpeed, "clock speed in Hz, 0 runs as fast as possible")
+	runCmd.Flags().BoolVar(&headless, "headless", false, "run without a terminal, for scripts and CI")
+	runCmd.Flags().StringVar(&inputPath, "input", "", "file of keystrokes typed during a headless run, - for stdin")
+	runCmd.Flags().DurationVar(&timeout, "timeout", 0, "stop a headless run after this long, e.g. 30s")
+	runCmd.Flags().Uint64Var(&maxCycles, "max-cycles", 0, "stop a headless run after this many cycles")
+	runCmd.Flags().StringVar(&expect, "expect", "", "regular expression the display must match for a headless run to pass")
+	runCmd.Flags().StringVar(&scriptPath, "script", "", "interaction script to run against the program in headless mode")
+	runCmd.Flags().StringVar(&screenOut, "screen-out", "", "write the final 40x24 screen to this file")
+	runCmd.Flags().StringVar(&profilePath, "profile", "", "write a pprof profile of the cycles spent in each subroutine to this file, e.g. out.pb.gz")
+	runCmd.Flags().StringVar(&cdlPath, "cdl", "", "write a code/data log marking how each byte of memory was used to this file")
+	runCmd.Flags().StringVar(&lcovPath, "lcov", "", "write an lcov coverage report to this file, requires --line-map")
+	runCmd.Flags().StringVar(&lineMapPath, "line-map", "", "file mapping instruction addresses to source lines, e.g. '$0280 hello.s:12'")
+	runCmd.Flags().StringVar(&machineName, "machine", "", "built-in profile or profile file describing the machine, e.g. apple1-4k")
+	runCmd.Flags().StringArrayVar(&cardSpecs, "card", nil, "plug a card into the expansion slot, e.g. 'ram start=$2000 end=$7FFF' (repeatable)")
+	runCmd.Flags().StringVar(&memoryMapPath, "memory-map", "", "file describing the RAM, ROM, PIA and unmapped regions of memory")
+	runCmd.Flags().StringVar(&binmonAddr, "binmon", "", "listen for VICE binary monitor clients on this address, e.g. 127.0.0.1:6502")
+	runCmd.Flags().StringVar(&telnetAddr, "telnet", "", "serve the keyboard and display to telnet clients on this address, e.g. 127.0.0.1:6502")
+	runCmd.Flags().StringVar(&golden, "golden", "", "compare the final screen with this file, printing a unified diff if they differ")
+}
+
+// applyProfileFlags takes the clock speed and frontend options a profile sets, unless they
+// were given as flags
+func applyProfileFlags(cmd *cobra.Command, p *profile.Profile) {
+	if !cmd.Flags().Changed("clock") && p.Clock != nil {
+		clockSpeed = *p.Clock
+	}
+	if !cmd.Flags().Changed("headless") {
+		headless = p.Frontend.Headless
+	}
+	if !cmd.Flags().Changed("telnet") {
+		telnetAddr = p.Frontend.Telnet
+	}
+	if !cmd.Flags().Changed("binmon") {
+		binmonAddr = p.Frontend.Binmon
+	}
+}
+
+// runProgram runs the program at path until the vm stops and returns the exit code. It
+// returns rather than exiting so the terminal is always restored.
+func runProgram(path string) int {
+	program, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Println(err)
+		return exitError
+	}
+	addr, err := parseAddr(loadAddr)
+	if err != nil {
+		fmt.Println(err)
+		return exitError
+	}
+
+	// The keyboard reads stdin unless a headless run takes its keystrokes from a file
+	if !headless || inputPath == "-" {
+		card.ClaimStdin()
+	}
+	machine := vm.New()
+	if machineProfile != nil {
+		if err := machineProfile.Apply(machine); err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+	}
+	if memoryMapPath != "" {
+		m, err := vm.LoadMemoryMap(memoryMapPath)
+		if err == nil {
+			err = machine.SetMemoryMap(m)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+	}
+	for _, spec := range cardSpecs {
+		c, err := card.Parse(spec)
+		if err == nil {
+			err = machine.InsertCard(c)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+	}
+	for _, path := range symbolFiles {
+		if err := machine.LoadSymbols(path); err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+	}
+	for _, loc := range breakAt {
+		if err := machine.AddPCBreakpoint(loc); err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+	}
+	for _, cond := range breakWhen {
+		if err := machine.AddBreakpoint(cond); err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+	}
+	if trace {
+		machine.SetTrace(os.Stderr)
+	}
+	machine.SetClockSpeed(clockSpeed)
+	machine.Load(addr, program)
+	regs := machine.Registers()
+	regs.PC = addr
+	machine.SetRegisters(regs)
+	if profilePath != "" {
+		machine.StartProfile()
+	}
+	var lines vm.LineMap
+	if lcovPath != "" {
+		if lineMapPath == "" {
+			fmt.Println("--lcov needs a --line-map to know which source lines instructions came from")
+			return exitError
+		}
+		if lines, err = vm.LoadLineMap(lineMapPath); err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+	}
+	if cdlPath != "" || lcovPath != "" {
+		machine.StartCoverage()
+	}
+
+	if binmonAddr != "" {
+		if scriptPath != "" {
+			fmt.Println("--binmon can't be combined with --script")
+			return exitError
+		}
+		monitor = vicemon.New(machine)
+		if err := monitor.Listen(binmonAddr); err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+		defer monitor.Close()
+	}
+
+	if telnetAddr != "" {
+		if scriptPath != "" {
+			fmt.Println("--telnet can't be combined with --script")
+			return exitError
+		}
+		console = telnet.New(machine)
+		if err := console.Listen(telnetAddr); err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+		defer console.Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := cancelOnSignal(ctx, cancel)
+
+	var code int
+	if headless {
+		code = runHeadless(ctx, machine, sig)
+	} else {
+		code = runInteractive(ctx, machine, sig)
+	}
+	reports := []struct {
+		path  string
+		write func(w io.Writer) error
+	}{
+		{profilePath, machine.WriteProfile},
+		{cdlPath, machine.WriteCDL},
+		{lcovPath, func(w io.Writer) error { return machine.WriteLCOV(w, lines) }},
+	}
+	for _, r := range reports {
+		if r.path == "" {
+			continue
+		}
+		if err := writeReport(r.path, r.write); err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+	}
+	return checkScreen(machine, code)
+}
+
+// runInteractive runs machine with its keyboard and display attached to the terminal, and
+// returns the exit code
+func runInteractive(ctx context.Context, machine *vm.VM, sig <-chan syscall.Signal) int {
+	stdin := int(os.Stdin.Fd())
+	if term.IsTerminal(stdin) {
+		restore, err := term.MakeRaw(stdin)
+		if err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+		defer restore()
+	}
+	setDisplay(machine, term.NewDisplay(os.Stdout))
+	go feedKeys(machine, os.Stdin)
+
+	err := runVM(ctx, machine)
+	fmt.Println()
+
+	switch e := err.(type) {
+	case *vm.Exit:
+		return e.Code
+	case *vm.Halt, *vm.Fault:
+		fmt.Printf("%v\n%s", err, machine.DumpState())
+		if _, ok := err.(*vm.Fault); ok {
+			return exitFault
+		}
+		return exitHalted
+	}
+	select {
+	case s := <-sig:
+		return exitSignal + int(s)
+	default:
+		return exitOK
+	}
+}
+
+// setDisplay sends machine's display to d, and to the telnet console with --telnet
+func setDisplay(machine *vm.VM, d io.Writer) {
+	if console != nil {
+		d = io.MultiWriter(d, console)
+	}
+	machine.SetDisplay(d)
+}
+
+// runVM runs machine until it stops, under the control of the binary monitor with --binmon.
+// A monitor client quitting counts as a clean shutdown.
+func runVM(ctx context.Context, machine *vm.VM) error {
+	if monitor == nil {
+		return machine.Run(ctx)
+	}
+	err := monitor.Run(ctx)
+	if err == vicemon.ErrQuit {
+		return nil
+	}
+	return err
+}
+
+// checkScreen saves the final screen to --screen-out and compares it with --golden, returning
+// exitGolden if it differs and the run otherwise succeeded. Otherwise code is returned as is.
+func checkScreen(machine *vm.VM, code int) int {
+	text := machine.ScreenText()
+	if screenOut != "" {
+		if err := ioutil.WriteFile(screenOut, []byte(text), 0644); err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+	}
+	if golden == "" {
+		return code
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		fmt.Println(err)
+		return exitError
+	}
+	if d := diff.Unified(golden, "screen", string(want), text); d != "" {
+		fmt.Print(d)
+		if code == exitOK {
+			return exitGolden
+		}
+	}
+	return code
+}
+
+// writeReport creates the file at path and writes a report of the run to it
+func writeReport(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// cancelOnSignal cancels ctx on SIGINT or SIGTERM, and sends the signal that did it on the
+// returned channel
+func cancelOnSignal(ctx context.Context, cancel context.CancelFunc) <-chan syscall.Signal {
+	caught := make(chan syscall.Signal, 1)
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		defer signal.Stop(sigC)
+		select {
+		case s := <-sigC:
+			caught <- s.(syscall.Signal)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return caught
+}
+
+// feedKeys forwards everything typed on r to the Apple 1 keyboard until r is closed
+func feedKeys(machine *vm.VM, r io.Reader) {
+	buf := make([]byte, 256)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if k, ok := term.Key(b); ok {
+				machine.KeyPress(k)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// parseAddr parses a 16-bit address written in hex, with an optional $ or 0x prefix
+func parseAddr(s string) (uint16, error) {
+	hex := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "$"), "0x")
+	addr, err := strconv.ParseUint(hex, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q, expected hex such as $0280", s)
+	}
+	return uint16(addr), nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+	"github.com/bradford-hamilton/apple-1/internal/web"
+	"github.com/spf13/cobra"
+)
+
+// serveAddr is the address the web frontend listens on
+var serveAddr string
+
+// serveCmd runs the Apple 1 in the background and serves it to browsers
+var serveCmd = &cobra.Command{
+	Use:   "serve [path/to/program]",
+	Short: "run the Apple 1 emulator in a web browser",
+	Long: `Run the Apple 1 and serve a page showing its display, which forwards keys typed on it to
+the Apple 1's keyboard. The page has buttons for the RESET and CLEAR SCREEN switches, for
+loading a program at an address and jumping to it, and for downloading and restoring save
+states. Without a program the Apple 1 starts in the Woz Monitor.
+
+  appleone serve --addr 127.0.0.1:8080 prog.bin`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(serve(args))
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "127.0.0.1:8080", "address to serve the web frontend on")
+	serveCmd.Flags().StringVar(&loadAddr, "load-addr", "$0280", "address the program is loaded at and started from")
+	serveCmd.Flags().IntVar(&clockSpeed, "clock", vm.DefaultClockSpeed, "clock speed in Hz, 0 runs as fast as possible")
+}
+
+// serve runs the web frontend until it is interrupted and returns the exit code
+func serve(args []string) int {
+	var machine *vm.VM
+	if len(args) == 1 {
+		var err error
+		if machine, _, err = loadDebuggee(args[0]); err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+	} else {
+		machine = vm.New()
+		machine.Reset()
+	}
+	machine.SetClockSpeed(clockSpeed)
+
+	l, err := net.Listen("tcp", serveAddr)
+	if err != nil {
+		fmt.Println(err)
+		return exitError
+	}
+	srv := web.New(machine)
+	httpServer := &http.Server{Handler: srv.Handler()}
+	go httpServer.Serve(l)
+	log.Printf("serving the Apple 1 on http://%s", l.Addr())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := cancelOnSignal(ctx, cancel)
+
+	srv.Run(ctx)
+	httpServer.Close()
+	select {
+	case s := <-sig:
+		return exitSignal + int(s)
+	default:
+		return exitOK
+	}
+}
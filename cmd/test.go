@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bradford-hamilton/apple-1/internal/card"
+	"github.com/bradford-hamilton/apple-1/internal/profile"
+	"github.com/bradford-hamilton/apple-1/internal/suite"
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// testMaxCycles is the cycle budget for each test
+	testMaxCycles uint64
+
+	// passAddr and failAddr end a test when execution reaches them
+	passAddr string
+	failAddr string
+
+	// debugPortAddr is where each test's debug port is inserted
+	debugPortAddr string
+
+	// junitPath is where the JUnit XML report is written
+	junitPath string
+)
+
+// testCmd runs a directory of test programs
+var testCmd = &cobra.Command{
+	Use:   "test [path/to/tests]",
+	Short: "run a directory of 6502 test programs and report which passed",
+	Long: `Run every binary (.bin) and hex dump (.hex) in a directory and its subdirectories, each
+on a fresh machine with a debugport card, and report which passed. Binaries are loaded and
+started at --load-addr, and hex dumps are written the way the Woz Monitor takes them, with
+an optional start address:
+
+  0280: A9 00 8D 01 C3
+  0280R
+
+A test passes when it writes 0 to the debug port's exit register or reaches --pass-addr, and
+fails when it exits with any other code, reaches --fail-addr, faults or uses up its cycle
+budget. A test that traps in an instruction jumping to itself, e.g. JMP *, fails unless it
+trapped at --pass-addr. Without a pass address, a trap instead ends the test for its memory
+to be checked.
+
+A test with an assertion file (.mem) of the same name must also leave memory holding the
+bytes it lists, written like a hex dump without a start address:
+
+  0200: 01 02 03 04  # the sorted array
+
+Output written to the display and the debug console is shown for failing tests. The exit
+code is 0 if every test passed and 1 otherwise.
+
+  appleone test --junit results.xml --max-cycles 1000000 tests/`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(runTests(args[0]))
+	},
+}
+
+func init() {
+	testCmd.Flags().Uint64Var(&testMaxCycles, "max-cycles", 10000000, "cycle budget for each test")
+	testCmd.Flags().StringVar(&loadAddr, "load-addr", "$0280", "address binaries are loaded at and started from")
+	testCmd.Flags().StringVar(&passAddr, "pass-addr", "", "address that passes a test when execution reaches it")
+	testCmd.Flags().StringVar(&failAddr, "fail-addr", "", "address that fails a test when execution reaches it")
+	testCmd.Flags().StringVar(&debugPortAddr, "debug-port", "$C300", "address of each test's debug port")
+	testCmd.Flags().StringVar(&junitPath, "junit", "", "write a JUnit XML report to this file")
+	testCmd.Flags().StringVar(&machineName, "machine", "", "built-in profile or profile file describing the machine, e.g. apple1-4k")
+	testCmd.Flags().StringArrayVar(&cardSpecs, "card", nil, "plug a card into the expansion slot, e.g. 'ram start=$2000 end=$7FFF' (repeatable)")
+}
+
+// runTests runs the tests in dir and returns the exit code
+func runTests(dir string) int {
+	opts, err := testOptions()
+	if err != nil {
+		fmt.Println(err)
+		return exitError
+	}
+	tests, err := suite.Load(dir)
+	if err != nil {
+		fmt.Println(err)
+		return exitError
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := cancelOnSignal(ctx, cancel)
+
+	started := time.Now()
+	var results []suite.Result
+	passed, failed, errored := 0, 0, 0
+	for _, t := range tests {
+		r := t.Run(ctx, opts)
+		results = append(results, r)
+		switch {
+		case r.Passed:
+			passed++
+			fmt.Printf("PASS  %s (%d cycles)\n", t.Name, r.Cycles)
+			continue
+		case r.Error:
+			errored++
+			fmt.Printf("ERROR %s: %s\n", t.Name, r.Reason)
+		default:
+			failed++
+			fmt.Printf("FAIL  %s: %s\n", t.Name, r.Reason)
+		}
+		if out := strings.TrimRight(r.Output, "\n"); out != "" {
+			fmt.Printf("      %s\n", strings.Replace(out, "\n", "\n      ", -1))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	fmt.Printf("\n%d passed, %d failed, %d errors in %v\n", passed, failed, errored, time.Since(started).Round(time.Millisecond))
+
+	if junitPath != "" {
+		name := filepath.Base(filepath.Clean(dir))
+		err := writeReport(junitPath, func(w io.Writer) error {
+			return suite.WriteJUnit(w, name, started, results)
+		})
+		if err != nil {
+			fmt.Println(err)
+			return exitError
+		}
+	}
+
+	select {
+	case s := <-sig:
+		return exitSignal + int(s)
+	default:
+	}
+	if failed > 0 || errored > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// testOptions builds the options for running tests from the flags
+func testOptions() (suite.Options, error) {
+	opts := suite.Options{MaxCycles: testMaxCycles}
+	var err error
+	if opts.LoadAddr, err = parseAddr(loadAddr); err != nil {
+		return opts, err
+	}
+	if opts.DebugPort, err = parseAddr(debugPortAddr); err != nil {
+		return opts, err
+	}
+	for _, a := range []struct {
+		flag string
+		addr **uint16
+	}{{passAddr, &opts.PassAddr}, {failAddr, &opts.FailAddr}} {
+		if a.flag == "" {
+			continue
+		}
+		addr, err := parseAddr(a.flag)
+		if err != nil {
+			return opts, err
+		}
+		*a.addr = &addr
+	}
+
+	var p *profile.Profile
+	if machineName != "" {
+		if p, err = profile.Find(machineName); err != nil {
+			return opts, err
+		}
+	}
+	opts.Machine = func() (*vm.VM, error) {
+		machine := vm.New()
+		if p != nil {
+			if err := p.Apply(machine); err != nil {
+				return nil, err
+			}
+		}
+		for _, spec := range cardSpecs {
+			c, err := card.Parse(spec)
+			if err == nil {
+				err = machine.InsertCard(c)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return machine, nil
+	}
+	return opts, nil
+}
@@ -0,0 +1,242 @@
+package card
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bradford-hamilton/apple-1/internal/prodos"
+)
+
+// sectorSize is the size of an ATA sector, which is also a ProDOS block
+const sectorSize = 512
+
+// ATA status register bits
+const (
+	ataBusy         = 0x80
+	ataReady        = 0x40
+	ataSeekComplete = 0x10
+	ataDataRequest  = 0x08
+	ataError        = 0x01
+)
+
+// ataAborted is the error register's bit for a command the drive rejected
+const ataAborted = 0x04
+
+// ATA commands
+const (
+	ataReadSectors    = 0x20
+	ataReadSectorsNR  = 0x21
+	ataWriteSectors   = 0x30
+	ataWriteSectorsNR = 0x31
+	ataInitParams     = 0x91
+	ataFlushCache     = 0xE7
+	ataIdentify       = 0xEC
+	ataSetFeatures    = 0xEF
+)
+
+// ataHeadLBA is the head register bit selecting LBA addressing
+const ataHeadLBA = 0x40
+
+// ataDrive is a CompactFlash card in true IDE mode, speaking ATA PIO to the host with LBA
+// addressing. Sectors are stored in an image file, and writes go straight to the file.
+type ataDrive struct {
+	file    *os.File
+	offset  int64  // where sector 0 starts in the file, after any 2IMG header
+	sectors uint32 // capacity
+
+	err     byte // error register
+	count   byte // sector count register
+	lba     [3]byte
+	head    byte
+	status  byte
+	command byte // command transferring data
+
+	buf       [sectorSize]byte
+	pos       int    // next byte of buf to transfer
+	remaining int    // sectors left in the command, including the one in buf
+	sector    uint32 // sector in buf
+}
+
+// openATADrive opens the image at path as a drive. ProDOS order images (.po, .hdv) are used
+// as is, and only the disk data of 2IMG images (.2mg) is used, not their header or comment.
+func openATADrive(path string) (*ataDrive, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	d := &ataDrive{file: f, status: ataReady | ataSeekComplete}
+	offset, size, err := prodos.ImageData(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	d.offset = offset
+	if size < sectorSize {
+		f.Close()
+		return nil, fmt.Errorf("%s is too small to be a disk image", path)
+	}
+	d.sectors = uint32(size / sectorSize)
+	return d, nil
+}
+
+// reset returns the drive to idle, abandoning any transfer
+func (d *ataDrive) reset() {
+	d.status = ataReady | ataSeekComplete
+	d.err = 0
+	d.remaining = 0
+	d.count = 1
+}
+
+// address returns the LBA sector addressed by the task file
+func (d *ataDrive) address() uint32 {
+	return uint32(d.head&0x0F)<<24 | uint32(d.lba[2])<<16 | uint32(d.lba[1])<<8 | uint32(d.lba[0])
+}
+
+// execute starts a command written to the command register
+func (d *ataDrive) execute(cmd byte) {
+	d.err = 0
+	d.status = ataReady | ataSeekComplete
+	d.command = cmd
+
+	n := int(d.count)
+	if n == 0 {
+		n = 256
+	}
+
+	switch cmd {
+	case ataReadSectors, ataReadSectorsNR, ataWriteSectors, ataWriteSectorsNR:
+		if d.head&ataHeadLBA == 0 || d.address()+uint32(n) > d.sectors {
+			d.abort()
+			return
+		}
+		d.sector, d.remaining, d.pos = d.address(), n, 0
+		if cmd == ataReadSectors || cmd == ataReadSectorsNR {
+			d.load()
+			return
+		}
+		d.status |= ataDataRequest
+	case ataIdentify:
+		d.identify()
+		d.remaining, d.pos = 1, 0
+		d.status |= ataDataRequest
+	case ataSetFeatures, ataInitParams, ataFlushCache:
+		// Nothing to do: the image is always in sync and the firmware's features are fine
+	default:
+		d.abort()
+	}
+}
+
+func (d *ataDrive) abort() {
+	d.err = ataAborted
+	d.status = ataReady | ataSeekComplete | ataError
+	d.remaining = 0
+}
+
+// load reads the next sector of a read command into the buffer
+func (d *ataDrive) load() {
+	if _, err := d.file.ReadAt(d.buf[:], d.offset+int64(d.sector)*sectorSize); err != nil && err != io.EOF {
+		d.abort()
+		return
+	}
+	d.pos = 0
+	d.status |= ataDataRequest
+}
+
+// read returns the next byte of data from the drive, advancing to the next sector once the
+// buffer has been read
+func (d *ataDrive) read() byte {
+	if d.status&ataDataRequest == 0 || d.writing() {
+		return 0xFF
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	if d.pos == sectorSize {
+		d.status &^= ataDataRequest
+		d.remaining--
+		d.sector++
+		d.advance()
+		if d.remaining > 0 && d.command != ataIdentify {
+			d.load()
+		}
+	}
+	return b
+}
+
+// write stores the next byte of data for the drive, writing the buffer to the image once it
+// holds a whole sector
+func (d *ataDrive) write(b byte) {
+	if d.status&ataDataRequest == 0 || !d.writing() {
+		return
+	}
+	d.buf[d.pos] = b
+	d.pos++
+	if d.pos == sectorSize {
+		if _, err := d.file.WriteAt(d.buf[:], d.offset+int64(d.sector)*sectorSize); err != nil {
+			d.abort()
+			return
+		}
+		d.pos = 0
+		d.remaining--
+		d.sector++
+		d.advance()
+		if d.remaining == 0 {
+			d.status &^= ataDataRequest
+		}
+	}
+}
+
+// writing reports whether the command transferring data takes it from the host
+func (d *ataDrive) writing() bool {
+	return d.command == ataWriteSectors || d.command == ataWriteSectorsNR
+}
+
+// advance updates the task file to the sector after a transfer, as drives do
+func (d *ataDrive) advance() {
+	d.lba[0], d.lba[1], d.lba[2] = byte(d.sector), byte(d.sector>>8), byte(d.sector>>16)
+	d.head = d.head&0xF0 | byte(d.sector>>24)&0x0F
+	d.count = byte(d.remaining)
+}
+
+// identify fills the buffer with the drive's IDENTIFY DEVICE data
+func (d *ataDrive) identify() {
+	for i := range d.buf {
+		d.buf[i] = 0
+	}
+	word := func(i int, v uint16) {
+		binary.LittleEndian.PutUint16(d.buf[i*2:], v)
+	}
+	// ATA strings are stored with the bytes of each word swapped
+	text := func(i, words int, s string) {
+		for n := 0; n < words*2; n++ {
+			c := byte(' ')
+			if n < len(s) {
+				c = s[n]
+			}
+			d.buf[i*2+(n^1)] = c
+		}
+	}
+
+	cylinders, heads, perTrack := uint32(16383), uint32(16), uint32(63)
+	if d.sectors < cylinders*heads*perTrack {
+		cylinders = d.sectors / (heads * perTrack)
+	}
+	word(0, 0x848A) // CompactFlash signature
+	word(1, uint16(cylinders))
+	word(3, uint16(heads))
+	word(6, uint16(perTrack))
+	text(10, 10, "APPLEONE0001")
+	text(23, 4, "1.0")
+	text(27, 20, "APPLEONE EMULATED CF")
+	word(47, 1)    // one sector per interrupt
+	word(49, 1<<9) // LBA supported
+	word(60, uint16(d.sectors))
+	word(61, uint16(d.sectors>>16))
+}
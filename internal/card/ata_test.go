@@ -0,0 +1,235 @@
+package card
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testSectors is the size of the test disk images
+const testSectors = 8
+
+// newImage writes a disk image whose sectors are each filled with their own number, between
+// header and trailer, and returns a CFFA1 using it
+func newImage(t *testing.T, name string, header, trailer []byte) (*cffa1, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "ata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	data := append([]byte(nil), header...)
+	for i := 0; i < testSectors; i++ {
+		data = append(data, bytes.Repeat([]byte{byte(i)}, sectorSize)...)
+	}
+	data = append(data, trailer...)
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New("cffa1", map[string]interface{}{"image": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.(*cffa1), path
+}
+
+func (c *cffa1) reg(r uint16) byte {
+	return c.Read(cffa1IOStart + r)
+}
+
+func (c *cffa1) setReg(r uint16, b byte) {
+	c.Write(cffa1IOStart+r, b)
+}
+
+// command sets up the task file for count sectors from lba and issues cmd
+func (c *cffa1) command(cmd byte, lba uint32, count byte) {
+	c.setReg(regSector, byte(lba))
+	c.setReg(regCylinderLow, byte(lba>>8))
+	c.setReg(regCylinderHigh, byte(lba>>16))
+	c.setReg(regHead, 0xE0|byte(lba>>24)&0x0F)
+	c.setReg(regSectorCount, count)
+	c.setReg(regStatus, cmd)
+}
+
+// readData reads n bytes through the 16-bit data register
+func (c *cffa1) readData(n int) []byte {
+	var data []byte
+	for len(data) < n {
+		data = append(data, c.reg(regData), c.reg(regDataHigh))
+	}
+	return data
+}
+
+func TestATARead(t *testing.T) {
+	c, _ := newImage(t, "disk.po", nil, nil)
+
+	c.command(ataReadSectors, 2, 2)
+	if status := c.reg(regStatus); status != ataReady|ataSeekComplete|ataDataRequest {
+		t.Fatalf("status $%02X after the command, want ready with data", status)
+	}
+	data := c.readData(2 * sectorSize)
+	want := append(bytes.Repeat([]byte{2}, sectorSize), bytes.Repeat([]byte{3}, sectorSize)...)
+	if !bytes.Equal(data, want) {
+		t.Error("read the wrong data for sectors 2 and 3")
+	}
+
+	// The transfer is over and the task file points past it
+	if status := c.reg(regStatus); status != ataReady|ataSeekComplete {
+		t.Errorf("status $%02X after the transfer, want ready", status)
+	}
+	if lba, count := c.reg(regSector), c.reg(regSectorCount); lba != 4 || count != 0 {
+		t.Errorf("task file at sector %d with %d left, want 4 and 0", lba, count)
+	}
+	if b := c.reg(regData); b != 0xFF {
+		t.Errorf("data register read $%02X with no transfer, want $FF", b)
+	}
+}
+
+func TestATAWrite(t *testing.T) {
+	c, path := newImage(t, "disk.po", nil, nil)
+
+	c.command(ataWriteSectors, 5, 1)
+	for i := 0; i < sectorSize; i += 2 {
+		c.setReg(regDataHigh, byte(i+1))
+		c.setReg(regData, byte(i))
+	}
+	if status := c.reg(regStatus); status != ataReady|ataSeekComplete {
+		t.Errorf("status $%02X after the transfer, want ready", status)
+	}
+
+	image, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range image[5*sectorSize : 6*sectorSize] {
+		if b != byte(i) {
+			t.Fatalf("sector 5 byte %d is $%02X, want $%02X", i, b, byte(i))
+		}
+	}
+	if image[6*sectorSize] != 6 || image[5*sectorSize-1] != 4 {
+		t.Error("the write spilled into the neighbouring sectors")
+	}
+}
+
+func TestATA2IMG(t *testing.T) {
+	header := make([]byte, 64)
+	copy(header, "2IMG")
+	binary.LittleEndian.PutUint32(header[0x18:], 64)
+	binary.LittleEndian.PutUint32(header[0x1C:], testSectors*sectorSize)
+	comment := bytes.Repeat([]byte("a comment that isn't part of the disk "), 20)
+	c, _ := newImage(t, "disk.2mg", header, comment)
+
+	if c.drive.sectors != testSectors {
+		t.Errorf("drive has %d sectors, want %d without the comment", c.drive.sectors, testSectors)
+	}
+	c.command(ataReadSectors, 1, 1)
+	if data := c.readData(sectorSize); !bytes.Equal(data, bytes.Repeat([]byte{1}, sectorSize)) {
+		t.Error("read the wrong data for sector 1 past the header")
+	}
+	c.command(ataReadSectors, testSectors, 1)
+	if status := c.reg(regStatus); status&ataError == 0 {
+		t.Error("read the comment as a sector")
+	}
+}
+
+func TestATAIdentify(t *testing.T) {
+	c, _ := newImage(t, "disk.po", nil, nil)
+
+	c.command(ataIdentify, 0, 1)
+	data := c.readData(sectorSize)
+	word := func(i int) uint16 { return binary.LittleEndian.Uint16(data[i*2:]) }
+	if word(0) != 0x848A {
+		t.Errorf("signature $%04X, want $848A", word(0))
+	}
+	if n := uint32(word(61))<<16 | uint32(word(60)); n != testSectors {
+		t.Errorf("identifies %d sectors, want %d", n, testSectors)
+	}
+	// Strings have the bytes of each word swapped
+	model := make([]byte, 20)
+	for i := range model {
+		model[i] = data[54+(i^1)]
+	}
+	if string(model) != "APPLEONE EMULATED CF" {
+		t.Errorf("model %q, want APPLEONE EMULATED CF", model)
+	}
+	if status := c.reg(regStatus); status&ataDataRequest != 0 {
+		t.Error("still requesting data after the identify data was read")
+	}
+}
+
+func TestATAErrors(t *testing.T) {
+	c, _ := newImage(t, "disk.po", nil, nil)
+	aborted := func(what string) {
+		t.Helper()
+		if status, err := c.reg(regStatus), c.reg(regError); status != ataReady|ataSeekComplete|ataError || err != ataAborted {
+			t.Errorf("%s: status $%02X error $%02X, want the command aborted", what, status, err)
+		}
+	}
+
+	c.command(ataReadSectors, testSectors-1, 2)
+	aborted("reading past the end")
+	c.command(0x50, 0, 1)
+	aborted("unknown command")
+	c.setReg(regHead, 0x00)
+	c.setReg(regStatus, ataReadSectors)
+	aborted("CHS addressing")
+
+	// A good command clears the error
+	c.command(ataSetFeatures, 0, 1)
+	if status, err := c.reg(regStatus), c.reg(regError); status != ataReady|ataSeekComplete || err != 0 {
+		t.Errorf("status $%02X error $%02X after a good command", status, err)
+	}
+
+	// Resetting abandons a transfer
+	c.command(ataReadSectors, 0, 1)
+	c.setReg(regDevCtrl, devCtrlReset)
+	if status := c.reg(regStatus); status != ataReady|ataSeekComplete {
+		t.Errorf("status $%02X after a reset, want ready", status)
+	}
+	if count := c.reg(regSectorCount); count != 1 {
+		t.Errorf("sector count %d after a reset, want 1", count)
+	}
+}
+
+func TestATATransferDirection(t *testing.T) {
+	c, path := newImage(t, "disk.po", nil, nil)
+
+	// Writing the data register during a read leaves the sector being read and the image alone
+	c.command(ataReadSectors, 3, 1)
+	for i := 0; i < sectorSize; i += 2 {
+		c.setReg(regDataHigh, 0xAA)
+		c.setReg(regData, 0xAA)
+	}
+	if data := c.readData(sectorSize); !bytes.Equal(data, bytes.Repeat([]byte{3}, sectorSize)) {
+		t.Error("writes during a read changed the data read")
+	}
+
+	// Reading it during a write gets nothing and doesn't use up the sector
+	c.command(ataWriteSectors, 4, 1)
+	if b := c.reg(regData); b != 0xFF {
+		t.Errorf("data register read $%02X during a write, want $FF", b)
+	}
+	for i := 0; i < sectorSize; i += 2 {
+		c.setReg(regDataHigh, 0x55)
+		c.setReg(regData, 0x55)
+	}
+	if status := c.reg(regStatus); status != ataReady|ataSeekComplete {
+		t.Errorf("status $%02X after the write, want ready", status)
+	}
+
+	image, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(image[3*sectorSize:4*sectorSize], bytes.Repeat([]byte{3}, sectorSize)) {
+		t.Error("sector 3 was written by a read")
+	}
+	if !bytes.Equal(image[4*sectorSize:5*sectorSize], bytes.Repeat([]byte{0x55}, sectorSize)) {
+		t.Error("sector 4 doesn't hold what was written")
+	}
+}
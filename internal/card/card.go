@@ -0,0 +1,172 @@
+// Package card holds the expansion cards that can be plugged into the Apple 1's slot, and a
+// registry so they can be chosen by name from the command line or a machine profile. Each
+// card registers itself from an init function in its own file.
+//
+// A card is described by its name followed by key=value options, e.g.
+// "ram start=$2000 end=$7FFF".
+package card
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// Factory creates a card from its options
+type Factory func(opts *Options) (vm.Card, error)
+
+// registration is a card in the registry
+type registration struct {
+	usage   string
+	keys    map[string]bool // options the card accepts
+	factory Factory
+}
+
+var registry = make(map[string]registration)
+
+// Register makes a card available by name. usage lists its options as key=example, for help
+// messages and to check the options a card is given before creating it.
+func Register(name, usage string, f Factory) {
+	if _, dup := registry[name]; dup {
+		panic("card: " + name + " registered twice")
+	}
+	keys := make(map[string]bool)
+	for _, field := range strings.Fields(usage) {
+		eq := strings.IndexByte(field, '=')
+		if eq < 1 {
+			panic("card: " + name + " usage " + strconv.Quote(field) + " isn't key=example")
+		}
+		keys[field[:eq]] = true
+	}
+	registry[name] = registration{usage: usage, keys: keys, factory: f}
+}
+
+// Names returns the registered cards in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Usage returns a line per registered card giving its name and options
+func Usage() string {
+	var b strings.Builder
+	for _, name := range Names() {
+		fmt.Fprintf(&b, "%s %s\n", name, registry[name].usage)
+	}
+	return b.String()
+}
+
+// New creates the card called name with the given options. Values are strings as typed on
+// the command line, or from a machine profile also numbers and booleans, which only options
+// expecting them accept.
+func New(name string, values map[string]interface{}) (vm.Card, error) {
+	reg, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown card %q, the available cards are %s", name, strings.Join(Names(), ", "))
+	}
+	// Mistyped options are caught before the card opens files or listens for connections
+	for key := range values {
+		if !reg.keys[key] {
+			return nil, fmt.Errorf("card %s: unknown option %q, usage: %s %s", name, key, name, reg.usage)
+		}
+	}
+	c, err := reg.factory(&Options{values: values})
+	if err != nil {
+		return nil, fmt.Errorf("card %s: %v", name, err)
+	}
+	return c, nil
+}
+
+// Parse creates a card from a name followed by key=value options
+func Parse(spec string) (vm.Card, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty card description, the available cards are %s", strings.Join(Names(), ", "))
+	}
+	values := make(map[string]interface{})
+	for _, f := range fields[1:] {
+		eq := strings.IndexByte(f, '=')
+		if eq < 1 {
+			return nil, fmt.Errorf("card %s: expected key=value, got %q", fields[0], f)
+		}
+		values[f[:eq]] = f[eq+1:]
+	}
+	return New(fields[0], values)
+}
+
+// Options are the key=value settings a card is created with
+type Options struct {
+	values map[string]interface{}
+}
+
+// String returns the option key, or def if it isn't set
+func (o *Options) String(key, def string) string {
+	if v, ok := o.values[key]; ok {
+		return fmt.Sprint(v)
+	}
+	return def
+}
+
+// Addr returns the option key as a hex address with an optional $ or 0x prefix, or def if it
+// isn't set. Numbers are refused rather than guessing whether they were meant as hex.
+func (o *Options) Addr(key string, def uint16) (uint16, error) {
+	value, ok := o.values[key]
+	if !ok {
+		return def, nil
+	}
+	v, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid %s address %v, expected a hex string such as \"$C000\"", key, value)
+	}
+	hex := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(v), "$"), "0x")
+	addr, err := strconv.ParseUint(hex, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s address %q, expected hex such as $C000", key, v)
+	}
+	return uint16(addr), nil
+}
+
+// Int returns the option key as a decimal integer, or def if it isn't set
+func (o *Options) Int(key string, def int) (int, error) {
+	value, ok := o.values[key]
+	if !ok {
+		return def, nil
+	}
+	switch v := value.(type) {
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, nil
+		}
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case int:
+		return v, nil
+	}
+	return 0, fmt.Errorf("invalid %s %q, expected a number", key, fmt.Sprint(value))
+}
+
+// Bool returns the option key as true or false, or def if it isn't set
+func (o *Options) Bool(key string, def bool) (bool, error) {
+	value, ok := o.values[key]
+	if !ok {
+		return def, nil
+	}
+	switch v := value.(type) {
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, nil
+		}
+	case bool:
+		return v, nil
+	}
+	return false, fmt.Errorf("invalid %s %q, expected true or false", key, fmt.Sprint(value))
+}
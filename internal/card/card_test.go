@@ -0,0 +1,84 @@
+package card
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse("ram start=$1000 end=0x1FFF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := c.(*ram)
+	if r.start != 0x1000 || len(r.mem) != 0x1000 {
+		t.Errorf("got RAM at $%04X of %d bytes, want $1000 of 4096", r.start, len(r.mem))
+	}
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"", "empty card description, the available cards are cffa1, debugport, hostfs, ram, serial"},
+		{"rom", `unknown card "rom"`},
+		{"ram start", `card ram: expected key=value, got "start"`},
+		{"ram =$2000", `card ram: expected key=value, got "=$2000"`},
+		{"ram size=4096", `card ram: unknown option "size", usage: ram start=$2000 end=$7FFF`},
+		{"ram start=nowhere", `card ram: invalid start address "nowhere", expected hex such as $C000`},
+		{"ram start=$2080", "card ram: $2080-$7FFF must cover whole pages"},
+		{"cffa1", "card cffa1: image=path is required"},
+		// Typos are reported before the card opens anything, so not the missing image
+		{"cffa1 image=/nonexistent/disk.po imgae=disk.po", `card cffa1: unknown option "imgae"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got error %v, want %s", tt.spec, err, tt.want)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	opts := &Options{
+		values: map[string]interface{}{
+			"addr":   "$C000",
+			"number": 8192.0,
+			"count":  "12",
+			"flag":   true,
+			"yes":    "true",
+			"bad":    "maybe",
+			"frac":   1.5,
+		},
+	}
+
+	if addr, err := opts.Addr("addr", 0); err != nil || addr != 0xC000 {
+		t.Errorf("addr = $%04X, %v, want $C000", addr, err)
+	}
+	if addr, err := opts.Addr("missing", 0xC100); err != nil || addr != 0xC100 {
+		t.Errorf("missing addr = $%04X, %v, want the default $C100", addr, err)
+	}
+	if _, err := opts.Addr("number", 0); err == nil {
+		t.Error("expected a number given as an address to be refused")
+	}
+	if n, err := opts.Int("count", 0); err != nil || n != 12 {
+		t.Errorf("count = %d, %v, want 12", n, err)
+	}
+	if n, err := opts.Int("number", 0); err != nil || n != 8192 {
+		t.Errorf("number = %d, %v, want 8192", n, err)
+	}
+	if _, err := opts.Int("frac", 0); err == nil {
+		t.Error("expected a fraction to be refused as an integer")
+	}
+	if b, err := opts.Bool("flag", false); err != nil || !b {
+		t.Errorf("flag = %t, %v, want true", b, err)
+	}
+	if b, err := opts.Bool("yes", false); err != nil || !b {
+		t.Errorf("yes = %t, %v, want true", b, err)
+	}
+	if _, err := opts.Bool("bad", false); err == nil {
+		t.Error("expected maybe to be refused as a boolean")
+	}
+	if s := opts.String("number", ""); s != "8192" {
+		t.Errorf("number as a string = %q, want 8192", s)
+	}
+}
@@ -0,0 +1,184 @@
+package card
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+func init() {
+	Register("cffa1", "image=disk.po rom=cffa1.rom ram=true", newCFFA1)
+}
+
+// Where the CFFA1 decodes
+const (
+	cffa1RAMStart uint16 = 0x1000 // 32KiB of RAM, $1000-$8FFF
+	cffa1RAMEnd   uint16 = 0x8FFF
+	cffa1ROMStart uint16 = 0x9000 // 8KiB firmware ROM, $9000-$AFFF
+	cffa1ROMEnd   uint16 = 0xAFFF
+	cffa1IOStart  uint16 = 0xAFE0 // IDE registers, overlaying the end of the ROM
+	cffa1IOEnd    uint16 = 0xAFEF
+)
+
+// CFFA1 IDE registers, offsets from cffa1IOStart
+const (
+	regDataHigh     = 0x0 // high byte of the 16-bit data register, latched
+	regSetCSMask    = 0x1 // chip select masking, a workaround the emulated card doesn't need
+	regClearCSMask  = 0x2
+	regDevCtrl      = 0x6 // device control when written, alternate status when read
+	regData         = 0x8 // low byte of the 16-bit data register
+	regError        = 0x9
+	regSectorCount  = 0xA
+	regSector       = 0xB // LBA bits 0-7
+	regCylinderLow  = 0xC // LBA bits 8-15
+	regCylinderHigh = 0xD // LBA bits 16-23
+	regHead         = 0xE // LBA bits 24-27 and the LBA mode bit
+	regStatus       = 0xF // status when read, command when written
+)
+
+// devCtrlReset is the device control register's software reset bit
+const devCtrlReset = 0x04
+
+// cffa1 is Rich Dreher's CFFA1, a CompactFlash interface for the Apple 1 with 32KiB of RAM.
+// The CF card is a drive whose sectors are ProDOS blocks, stored in a disk image. The firmware
+// ROM, which provides the CFFA1 API and menu, isn't included and is read from a file.
+//
+// The card transfers 16 bits at a time: reading the data register returns the low byte and
+// latches the high byte for regDataHigh, and writing it sends the latched high byte with it.
+type cffa1 struct {
+	rom   [int(cffa1ROMEnd-cffa1ROMStart) + 1]byte
+	ram   []byte
+	drive *ataDrive
+	high  byte // latched high byte of the data register
+}
+
+func newCFFA1(opts *Options) (vm.Card, error) {
+	image := opts.String("image", "")
+	if image == "" {
+		return nil, errors.New("image=path is required, giving the disk image holding the CF card")
+	}
+	withRAM, err := opts.Bool("ram", true)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cffa1{}
+	if path := opts.String("rom", ""); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > len(c.rom) {
+			return nil, fmt.Errorf("firmware %s is %d bytes, more than the %d byte ROM", path, len(data), len(c.rom))
+		}
+		copy(c.rom[:], data)
+	}
+	if withRAM {
+		c.ram = make([]byte, int(cffa1RAMEnd-cffa1RAMStart)+1)
+	}
+	if c.drive, err = openATADrive(image); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *cffa1) Ranges() []vm.Range {
+	ranges := []vm.Range{{Start: cffa1ROMStart, End: cffa1ROMEnd}}
+	if c.ram != nil {
+		ranges = append(ranges, vm.Range{Start: cffa1RAMStart, End: cffa1RAMEnd})
+	}
+	return ranges
+}
+
+func (c *cffa1) Read(addr uint16) byte {
+	switch {
+	case addr < cffa1ROMStart:
+		return c.ram[addr-cffa1RAMStart]
+	case addr >= cffa1IOStart && addr <= cffa1IOEnd:
+		return c.readRegister(addr - cffa1IOStart)
+	}
+	return c.rom[addr-cffa1ROMStart]
+}
+
+// Peek reads registers without transferring data
+func (c *cffa1) Peek(addr uint16) byte {
+	if addr == cffa1IOStart+regData {
+		return c.drive.buf[c.drive.pos%sectorSize]
+	}
+	return c.Read(addr)
+}
+
+func (c *cffa1) readRegister(reg uint16) byte {
+	d := c.drive
+	switch reg {
+	case regDataHigh:
+		return c.high
+	case regData:
+		low := d.read()
+		c.high = d.read()
+		return low
+	case regError:
+		return d.err
+	case regSectorCount:
+		return d.count
+	case regSector:
+		return d.lba[0]
+	case regCylinderLow:
+		return d.lba[1]
+	case regCylinderHigh:
+		return d.lba[2]
+	case regHead:
+		return d.head
+	case regStatus, regDevCtrl:
+		return d.status
+	}
+	return 0xFF
+}
+
+func (c *cffa1) Write(addr uint16, b byte) {
+	switch {
+	case addr < cffa1ROMStart:
+		c.ram[addr-cffa1RAMStart] = b
+	case addr >= cffa1IOStart && addr <= cffa1IOEnd:
+		c.writeRegister(addr-cffa1IOStart, b)
+	}
+}
+
+func (c *cffa1) writeRegister(reg uint16, b byte) {
+	d := c.drive
+	switch reg {
+	case regDataHigh:
+		c.high = b
+	case regData:
+		d.write(b)
+		d.write(c.high)
+	case regDevCtrl:
+		if b&devCtrlReset != 0 {
+			d.reset()
+		}
+	case regSectorCount:
+		d.count = b
+	case regSector:
+		d.lba[0] = b
+	case regCylinderLow:
+		d.lba[1] = b
+	case regCylinderHigh:
+		d.lba[2] = b
+	case regHead:
+		d.head = b
+	case regStatus:
+		d.execute(b)
+	}
+}
+
+func (c *cffa1) Reset() {
+	c.drive.reset()
+}
+
+func (c *cffa1) Tick(cycles int) {}
+
+func (c *cffa1) IRQ() bool {
+	return false
+}
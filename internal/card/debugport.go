@@ -0,0 +1,103 @@
+package card
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+func init() {
+	Register("debugport", "addr=$C300", newDebugPort)
+}
+
+// Debug port registers, offsets from the card's address
+const (
+	debugConsole = 0 // a byte written is copied to stdout
+	debugExit    = 1 // a byte written exits the emulator with it as the exit code
+	debugCycles  = 2 // four bytes of cycle counter, least significant first
+	debugRegs    = 8
+)
+
+// debugPort is a paravirtual device for test programs. They can print to the host's stdout
+// without going through the display, report a result by exiting with a code, and time code
+// with a 32-bit counter of the cycles run before the current instruction.
+//
+// Reading the counter's low byte latches the other three, so a program reading the four
+// bytes in order sees a consistent value.
+type debugPort struct {
+	base    uint16
+	console io.Writer
+	cycles  uint32
+	latch   uint32
+	exit    int
+	exited  bool
+}
+
+func newDebugPort(opts *Options) (vm.Card, error) {
+	base, err := opts.Addr("addr", 0xC300)
+	if err != nil {
+		return nil, err
+	}
+	return NewDebugPort(base, os.Stdout)
+}
+
+// NewDebugPort creates a debug port at base, sending what programs write to its console
+// register to console
+func NewDebugPort(base uint16, console io.Writer) (vm.Card, error) {
+	if base&(debugRegs-1) != 0 {
+		return nil, fmt.Errorf("$%04X must be a multiple of %d", base, debugRegs)
+	}
+	return &debugPort{base: base, console: console}, nil
+}
+
+func (d *debugPort) Ranges() []vm.Range {
+	return []vm.Range{{Start: d.base, End: d.base + debugRegs - 1}}
+}
+
+func (d *debugPort) Read(addr uint16) byte {
+	reg := addr - d.base
+	if reg == debugCycles {
+		d.latch = d.cycles
+	}
+	return d.Peek(addr)
+}
+
+// Peek reads the counter without latching it
+func (d *debugPort) Peek(addr uint16) byte {
+	reg := addr - d.base
+	switch {
+	case reg == debugCycles:
+		return byte(d.cycles)
+	case reg > debugCycles && reg < debugCycles+4:
+		return byte(d.latch >> (8 * (reg - debugCycles)))
+	}
+	return 0
+}
+
+func (d *debugPort) Write(addr uint16, b byte) {
+	switch addr - d.base {
+	case debugConsole:
+		d.console.Write([]byte{b})
+	case debugExit:
+		d.exit, d.exited = int(b), true
+	}
+}
+
+func (d *debugPort) ExitRequested() (int, bool) {
+	exited := d.exited
+	d.exited = false
+	return d.exit, exited
+}
+
+func (d *debugPort) Reset() {}
+
+// Tick counts cycles, wrapping after 2^32
+func (d *debugPort) Tick(cycles int) {
+	d.cycles += uint32(cycles)
+}
+
+func (d *debugPort) IRQ() bool {
+	return false
+}
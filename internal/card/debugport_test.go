@@ -0,0 +1,80 @@
+package card
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+func TestDebugPort(t *testing.T) {
+	var console bytes.Buffer
+	c, err := NewDebugPort(0xC300, &console)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.(*debugPort)
+
+	d.Write(0xC300, 'H')
+	d.Write(0xC300, 'I')
+	if console.String() != "HI" {
+		t.Errorf("console got %q, want HI", console.String())
+	}
+
+	// Reading the low byte latches the rest, so a carry between reads doesn't tear the value
+	d.Tick(0x123456FF)
+	low := d.Read(0xC300 + debugCycles)
+	d.Tick(1)
+	value := uint32(low) | uint32(d.Read(0xC303))<<8 | uint32(d.Read(0xC304))<<16 | uint32(d.Read(0xC305))<<24
+	if value != 0x123456FF {
+		t.Errorf("read cycle count $%08X, want $123456FF", value)
+	}
+	if peek := d.Peek(0xC300 + debugCycles); peek != 0x00 {
+		t.Errorf("peeked low byte $%02X, want the current $00", peek)
+	}
+
+	if _, ok := d.ExitRequested(); ok {
+		t.Error("exit requested before the program asked")
+	}
+	d.Write(0xC301, 7)
+	if code, ok := d.ExitRequested(); !ok || code != 7 {
+		t.Errorf("exit %d, %t, want 7", code, ok)
+	}
+	if _, ok := d.ExitRequested(); ok {
+		t.Error("exit reported twice")
+	}
+
+	if _, err := NewDebugPort(0xC304, &console); err == nil {
+		t.Error("expected an error for an unaligned address")
+	}
+}
+
+func TestDebugPortExit(t *testing.T) {
+	var console bytes.Buffer
+	c, err := NewDebugPort(0xC300, &console)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := vm.New()
+	machine.SetClockSpeed(0)
+	if err := machine.InsertCard(c); err != nil {
+		t.Fatal(err)
+	}
+	// LDA #'K'; STA $C300; LDA #3; STA $C301; JMP *
+	machine.Load(0x0300, []byte{0xA9, 'K', 0x8D, 0x00, 0xC3, 0xA9, 0x03, 0x8D, 0x01, 0xC3, 0x4C, 0x0A, 0x03})
+	regs := machine.Registers()
+	regs.PC = 0x0300
+	machine.SetRegisters(regs)
+
+	exit, ok := machine.Run(context.Background()).(*vm.Exit)
+	if !ok || exit.Code != 3 {
+		t.Fatalf("Run returned %v, want exit code 3", exit)
+	}
+	if pc := machine.Registers().PC; pc != 0x030A {
+		t.Errorf("exited at $%04X, want straight after the store at $030A", pc)
+	}
+	if console.String() != "K" {
+		t.Errorf("console got %q, want K", console.String())
+	}
+}
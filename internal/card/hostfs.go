@@ -0,0 +1,209 @@
+package card
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+func init() {
+	Register("hostfs", "addr=$C100 dir=.", newHostFS)
+}
+
+// hostfs registers, offsets from the card's address. Addresses are little endian.
+const (
+	hostfsName    = 0 // pointer to the file name
+	hostfsStart   = 2 // where in memory the file is loaded or saved from
+	hostfsLength  = 4 // bytes to transfer, set to the bytes transferred
+	hostfsCommand = 6 // writing an operation performs it
+	hostfsStatus  = 7 // the result of the last operation
+	hostfsRegs    = 8
+)
+
+// hostfs operations
+const (
+	hostfsLoad = 0x01 // read the file into memory, all of it if the length is 0
+	hostfsSave = 0x02 // write length bytes of memory to the file
+	hostfsSize = 0x03 // set the length to the file's size
+)
+
+// hostfs status codes
+const (
+	hostfsOK         = 0x00
+	hostfsNotFound   = 0x01
+	hostfsBadName    = 0x02 // empty, too long, or trying to leave the directory
+	hostfsIOError    = 0x03
+	hostfsBadCommand = 0x04
+	hostfsTooLarge   = 0x05 // the file doesn't fit in the address space
+)
+
+// hostfsMaxName is the longest file name read from memory
+const hostfsMaxName = 64
+
+// hostFS is a paravirtual device giving programs fast access to files in a host directory,
+// for loading freshly assembled code without a cassette round trip. A program fills in the
+// command block with a file name, start address and length, and writing an operation to the
+// command register transfers the whole file at once.
+//
+// File names end with a NUL or carriage return, and have their high bits stripped so Apple 1
+// strings work as is. Names may only use letters, digits, '.', '-' and '_', so files outside
+// the directory can't be reached. A load of a name that isn't found is retried in lower case,
+// since the Apple 1 keyboard can't type it.
+type hostFS struct {
+	base uint16
+	dir  string
+	bus  vm.Device
+	regs [hostfsRegs]byte
+}
+
+func newHostFS(opts *Options) (vm.Card, error) {
+	base, err := opts.Addr("addr", 0xC100)
+	if err != nil {
+		return nil, err
+	}
+	if base&(hostfsRegs-1) != 0 {
+		return nil, fmt.Errorf("$%04X must be a multiple of %d", base, hostfsRegs)
+	}
+	dir := opts.String("dir", ".")
+	if info, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s isn't a directory", dir)
+	}
+	return &hostFS{base: base, dir: dir}, nil
+}
+
+func (h *hostFS) SetBus(bus vm.Device) {
+	h.bus = bus
+}
+
+func (h *hostFS) Ranges() []vm.Range {
+	return []vm.Range{{Start: h.base, End: h.base + hostfsRegs - 1}}
+}
+
+func (h *hostFS) Read(addr uint16) byte {
+	return h.regs[addr-h.base]
+}
+
+func (h *hostFS) Write(addr uint16, b byte) {
+	reg := addr - h.base
+	switch reg {
+	case hostfsStatus:
+	case hostfsCommand:
+		h.regs[reg] = b
+		h.regs[hostfsStatus] = h.execute(b)
+	default:
+		h.regs[reg] = b
+	}
+}
+
+func (h *hostFS) word(reg int) uint16 {
+	return uint16(h.regs[reg]) | uint16(h.regs[reg+1])<<8
+}
+
+func (h *hostFS) setWord(reg int, v uint16) {
+	h.regs[reg], h.regs[reg+1] = byte(v), byte(v>>8)
+}
+
+// execute performs an operation and returns its status
+func (h *hostFS) execute(op byte) byte {
+	name, ok := h.fileName()
+	if !ok {
+		return hostfsBadName
+	}
+	path := filepath.Join(h.dir, name)
+	start, length := h.word(hostfsStart), int(h.word(hostfsLength))
+
+	switch op {
+	case hostfsLoad, hostfsSize:
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) && strings.ToLower(name) != name {
+			data, err = ioutil.ReadFile(filepath.Join(h.dir, strings.ToLower(name)))
+		}
+		if err != nil {
+			return fileStatus(err)
+		}
+		if op == hostfsSize {
+			if len(data) > 0xFFFF {
+				return hostfsTooLarge
+			}
+			h.setWord(hostfsLength, uint16(len(data)))
+			return hostfsOK
+		}
+		if length == 0 || length > len(data) {
+			length = len(data)
+		}
+		if int(start)+length > 0x10000 {
+			return hostfsTooLarge
+		}
+		for i, b := range data[:length] {
+			h.bus.Write(start+uint16(i), b)
+		}
+		h.setWord(hostfsLength, uint16(length))
+	case hostfsSave:
+		if int(start)+length > 0x10000 {
+			return hostfsTooLarge
+		}
+		data := make([]byte, length)
+		for i := range data {
+			data[i] = h.peek(start + uint16(i))
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return fileStatus(err)
+		}
+	default:
+		return hostfsBadCommand
+	}
+	return hostfsOK
+}
+
+// fileName reads the file name from memory, reporting false if it isn't a plain name
+func (h *hostFS) fileName() (string, bool) {
+	var name []byte
+	for addr := h.word(hostfsName); len(name) <= hostfsMaxName; addr++ {
+		c := h.peek(addr) & 0x7F
+		if c == 0 || c == '\r' {
+			break
+		}
+		name = append(name, c)
+	}
+	if len(name) == 0 || len(name) > hostfsMaxName || name[0] == '.' {
+		return "", false
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return "", false
+		}
+	}
+	return string(name), true
+}
+
+// peek reads memory as debuggers do where the bus allows it, so saving a range that covers
+// the PIA or another card doesn't take a key press or clear a status flag
+func (h *hostFS) peek(addr uint16) byte {
+	if p, ok := h.bus.(vm.Peeker); ok {
+		return p.Peek(addr)
+	}
+	return h.bus.Read(addr)
+}
+
+// fileStatus returns the status code for a file error
+func fileStatus(err error) byte {
+	if os.IsNotExist(err) {
+		return hostfsNotFound
+	}
+	return hostfsIOError
+}
+
+// Reset leaves the command block alone so a program can repeat its last operation
+func (h *hostFS) Reset() {}
+
+func (h *hostFS) Tick(cycles int) {}
+
+func (h *hostFS) IRQ() bool {
+	return false
+}
@@ -0,0 +1,161 @@
+package card
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// nameAddr is where test file names are put in memory
+const nameAddr uint16 = 0x0300
+
+// newHostFSMachine returns a machine with a hostfs card serving a temporary directory
+func newHostFSMachine(t *testing.T) (*vm.VM, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "hostfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	c, err := New("hostfs", map[string]interface{}{"dir": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := vm.New()
+	if err := machine.InsertCard(c); err != nil {
+		t.Fatal(err)
+	}
+	return machine, dir
+}
+
+// hostfsOp fills in the command block, performs op and returns the status and length
+func hostfsOp(machine *vm.VM, name []byte, start, length uint16, op byte) (byte, uint16) {
+	machine.Load(nameAddr, append(name, 0))
+	regs := []byte{byte(nameAddr & 0xFF), byte(nameAddr >> 8), byte(start), byte(start >> 8), byte(length), byte(length >> 8)}
+	for i, b := range regs {
+		machine.Write(0xC100+uint16(i), b)
+	}
+	machine.Write(0xC100+hostfsCommand, op)
+	return machine.Read(0xC100 + hostfsStatus), uint16(machine.Read(0xC100+hostfsLength)) | uint16(machine.Read(0xC100+hostfsLength+1))<<8
+}
+
+func TestHostFSSaveAndLoad(t *testing.T) {
+	machine, dir := newHostFSMachine(t)
+	machine.Load(0x0400, []byte("HELLO"))
+
+	if status, _ := hostfsOp(machine, []byte("TEST.BIN"), 0x0400, 5, hostfsSave); status != hostfsOK {
+		t.Fatalf("save status $%02X", status)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "TEST.BIN"))
+	if err != nil || string(data) != "HELLO" {
+		t.Fatalf("saved %q, %v, want HELLO", data, err)
+	}
+
+	if status, length := hostfsOp(machine, []byte("TEST.BIN"), 0, 0, hostfsSize); status != hostfsOK || length != 5 {
+		t.Errorf("size status $%02X length %d, want 5", status, length)
+	}
+
+	// Loading with length 0 loads the whole file, and a shorter length part of it
+	if status, length := hostfsOp(machine, []byte("TEST.BIN"), 0x0500, 0, hostfsLoad); status != hostfsOK || length != 5 {
+		t.Errorf("load status $%02X length %d, want 5", status, length)
+	}
+	if status, length := hostfsOp(machine, []byte("TEST.BIN"), 0x0600, 2, hostfsLoad); status != hostfsOK || length != 2 {
+		t.Errorf("partial load status $%02X length %d, want 2", status, length)
+	}
+	for addr, want := range map[uint16]string{0x0500: "HELLO", 0x0600: "HE\x00"} {
+		got := make([]byte, len(want))
+		for i := range got {
+			got[i] = machine.Peek(addr + uint16(i))
+		}
+		if string(got) != want {
+			t.Errorf("$%04X holds %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestHostFSSaveLeavesDevicesAlone(t *testing.T) {
+	machine, dir := newHostFSMachine(t)
+	machine.KeyPress('A')
+
+	// Saving the PIA's registers doesn't take the key waiting in them
+	if status, _ := hostfsOp(machine, []byte("PIA"), 0xD010, 2, hostfsSave); status != hostfsOK {
+		t.Fatalf("save status $%02X", status)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "PIA")); err != nil || len(data) != 2 {
+		t.Errorf("saved % X, %v, want two bytes", data, err)
+	}
+	if n := machine.KeysPending(); n != 1 {
+		t.Errorf("%d keys pending after the save, want 1", n)
+	}
+	if key := machine.Read(0xD010); key != 'A'|0x80 {
+		t.Errorf("read key $%02X after the save, want A", key)
+	}
+}
+
+func TestHostFSNames(t *testing.T) {
+	machine, dir := newHostFSMachine(t)
+	for name, contents := range map[string]string{"lower.txt": "lower", "secret": "secret"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	apple := func(s string) []byte {
+		b := []byte(s + "\r")
+		for i := range b {
+			b[i] |= 0x80
+		}
+		return b
+	}
+
+	tests := []struct {
+		name []byte
+		want byte
+	}{
+		{[]byte("LOWER.TXT"), hostfsOK},       // retried in lower case
+		{apple("LOWER.TXT"), hostfsOK},        // high bits set and ending in a carriage return
+		{[]byte("Lower.txt"), hostfsOK},       // mixed case is retried too
+		{[]byte("MISSING"), hostfsNotFound},   // no lower case file either
+		{[]byte("../secret"), hostfsBadName},  // leaving the directory
+		{[]byte("sub/secret"), hostfsBadName}, // path separators
+		{[]byte(".hidden"), hostfsBadName},
+		{[]byte(".."), hostfsBadName},
+		{[]byte(""), hostfsBadName},
+		{[]byte("A B"), hostfsBadName},
+		{[]byte(strings.Repeat("A", hostfsMaxName)), hostfsNotFound},
+		{[]byte(strings.Repeat("A", hostfsMaxName+1)), hostfsBadName},
+	}
+	for _, tt := range tests {
+		if status, _ := hostfsOp(machine, tt.name, 0x0400, 0, hostfsLoad); status != tt.want {
+			t.Errorf("%q: status $%02X, want $%02X", tt.name, status, tt.want)
+		}
+	}
+
+	// Saving never writes outside the directory
+	if status, _ := hostfsOp(machine, []byte("../escaped"), 0x0400, 1, hostfsSave); status != hostfsBadName {
+		t.Errorf("saving ../escaped: status $%02X, want $%02X", status, hostfsBadName)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "..", "escaped")); !os.IsNotExist(err) {
+		t.Error("a file was written outside the directory")
+	}
+}
+
+func TestHostFSErrors(t *testing.T) {
+	machine, dir := newHostFSMachine(t)
+	if err := ioutil.WriteFile(filepath.Join(dir, "FILE"), []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := hostfsOp(machine, []byte("FILE"), 0xFFFE, 0, hostfsLoad); status != hostfsTooLarge {
+		t.Errorf("loading past $FFFF: status $%02X, want $%02X", status, hostfsTooLarge)
+	}
+	if status, _ := hostfsOp(machine, []byte("FILE"), 0xFFFE, 5, hostfsSave); status != hostfsTooLarge {
+		t.Errorf("saving past $FFFF: status $%02X, want $%02X", status, hostfsTooLarge)
+	}
+	if status, _ := hostfsOp(machine, []byte("FILE"), 0x0400, 0, 0x7F); status != hostfsBadCommand {
+		t.Errorf("unknown command: status $%02X, want $%02X", status, hostfsBadCommand)
+	}
+}
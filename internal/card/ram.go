@@ -0,0 +1,53 @@
+package card
+
+import (
+	"fmt"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+func init() {
+	Register("ram", "start=$2000 end=$7FFF", newRAM)
+}
+
+// ram is a memory expansion card, adding RAM wherever it is strapped to decode
+type ram struct {
+	start uint16
+	mem   []byte
+}
+
+func newRAM(opts *Options) (vm.Card, error) {
+	start, err := opts.Addr("start", 0x2000)
+	if err != nil {
+		return nil, err
+	}
+	end, err := opts.Addr("end", 0x7FFF)
+	if err != nil {
+		return nil, err
+	}
+	if start&0xFF != 0 || end&0xFF != 0xFF || end < start {
+		return nil, fmt.Errorf("$%04X-$%04X must cover whole pages", start, end)
+	}
+	return &ram{start: start, mem: make([]byte, int(end)-int(start)+1)}, nil
+}
+
+func (r *ram) Ranges() []vm.Range {
+	return []vm.Range{{Start: r.start, End: r.start + uint16(len(r.mem)-1)}}
+}
+
+func (r *ram) Read(addr uint16) byte {
+	return r.mem[addr-r.start]
+}
+
+func (r *ram) Write(addr uint16, b byte) {
+	r.mem[addr-r.start] = b
+}
+
+// Reset leaves memory alone, like real RAM
+func (r *ram) Reset() {}
+
+func (r *ram) Tick(cycles int) {}
+
+func (r *ram) IRQ() bool {
+	return false
+}
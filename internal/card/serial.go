@@ -0,0 +1,280 @@
+package card
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/bradford-hamilton/apple-1/internal/term"
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+func init() {
+	Register("serial", "addr=$C200 port=stdio|pty|unix:/path/to/socket", newSerial)
+}
+
+// 6551 ACIA registers, selected by the low two address bits
+const (
+	aciaData    = 0 // transmit when written, receive when read
+	aciaStatus  = 1 // status when read, programmed reset when written
+	aciaCommand = 2
+	aciaControl = 3
+)
+
+// ACIA status register bits
+const (
+	aciaOverrun = 0x04
+	aciaRxFull  = 0x08
+	aciaTxEmpty = 0x10
+	aciaIRQ     = 0x80
+)
+
+// ACIA command register bits
+const (
+	aciaCommandDTR    = 0x01 // enables the receiver and interrupts
+	aciaCommandNoRxIR = 0x02 // disables the receive interrupt
+	aciaCommandTx     = 0x0C // transmitter control bits
+	aciaCommandTxIRQ  = 0x04 // transmitter control value enabling the transmit interrupt
+)
+
+// aciaBaud is the baud rate selected by the low four bits of the control register. Zero uses
+// an external 16x clock, which is taken to be 115200 baud.
+var aciaBaud = [16]int{115200, 50, 75, 110, 135, 150, 300, 600, 1200, 1800, 2400, 3600, 4800, 7200, 9600, 19200}
+
+// stdinClaimed is set once the keyboard reads stdin, leaving nothing for a serial card
+var stdinClaimed bool
+
+// ClaimStdin tells serial cards created from then on that stdin belongs to the keyboard, so
+// port=stdio is refused rather than having the two take turns at what's typed
+func ClaimStdin() {
+	stdinClaimed = true
+}
+
+// serialBuffer is how many bytes are buffered each way between the card and the host
+const serialBuffer = 4096
+
+// serial is a serial interface card built around a 6551 ACIA, connected to the host's stdin
+// and stdout, a pseudo-terminal (on Linux and macOS) or a Unix socket.
+//
+// Characters take as long to send and receive as they would at the baud rate set in the
+// control register, counted in cycles of the Apple 1's 1MHz clock. Received bytes wait on
+// the host until the program has read the previous one, as if the line had flow control, so
+// the overrun flag is never set.
+type serial struct {
+	base    uint16
+	rx      chan byte
+	tx      chan byte
+	out     io.Writer // written directly instead of through tx
+	data    byte      // receive data register
+	status  byte
+	command byte
+	control byte
+	rxWait  int // cycles until the next character can arrive
+	txWait  int // cycles until the character being sent is gone
+}
+
+func newSerial(opts *Options) (vm.Card, error) {
+	base, err := opts.Addr("addr", 0xC200)
+	if err != nil {
+		return nil, err
+	}
+	if base&0x03 != 0 {
+		return nil, fmt.Errorf("$%04X must be a multiple of 4", base)
+	}
+	s := &serial{base: base, rx: make(chan byte, serialBuffer), tx: make(chan byte, serialBuffer)}
+	if err := s.connect(opts.String("port", "stdio")); err != nil {
+		return nil, err
+	}
+	s.Reset()
+	return s, nil
+}
+
+// connect starts moving bytes between the card's buffers and the host
+func (s *serial) connect(port string) error {
+	switch {
+	case port == "stdio":
+		if stdinClaimed {
+			return fmt.Errorf("port=stdio can't be used while the keyboard reads stdin, use port=pty or port=unix:/path/to/socket")
+		}
+		// Writing straight to stdout, as the display does, means nothing is left in the
+		// buffer when the emulator exits
+		go s.receive(os.Stdin)
+		s.out = os.Stdout
+	case port == "pty":
+		pty, err := term.OpenPTY()
+		if err != nil {
+			return err
+		}
+		log.Printf("serial card at $%04X is connected to %s", s.base, pty.Name)
+		go s.receive(pty)
+		go s.transmit(pty)
+	case strings.HasPrefix(port, "unix:"):
+		path := strings.TrimPrefix(port, "unix:")
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path) // a socket left over from an earlier run
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return err
+		}
+		log.Printf("serial card at $%04X is listening on %s", s.base, path)
+		go s.accept(l)
+	default:
+		return fmt.Errorf("unknown port %q, expected stdio, pty or unix:/path/to/socket", port)
+	}
+	return nil
+}
+
+// receive buffers bytes from r until it fails
+func (s *serial) receive(r io.Reader) {
+	buf := make([]byte, 256)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			s.rx <- b
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// transmit writes buffered bytes to w, dropping them if it fails
+func (s *serial) transmit(w io.Writer) {
+	for b := range s.tx {
+		w.Write([]byte{b})
+	}
+}
+
+// accept connects each client of the socket in turn. Bytes sent while nobody is connected
+// are lost, like a serial line with nothing on the other end.
+func (s *serial) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		done := make(chan struct{})
+		go func() {
+			s.receive(conn)
+			close(done)
+		}()
+	send:
+		for {
+			select {
+			case b := <-s.tx:
+				if _, err := conn.Write([]byte{b}); err != nil {
+					break send
+				}
+			case <-done:
+				break send
+			}
+		}
+		conn.Close()
+	}
+}
+
+// charCycles returns how many cycles a character takes at the current baud rate: a start
+// bit, eight data bits and a stop bit
+func (s *serial) charCycles() int {
+	return vm.DefaultClockSpeed * 10 / aciaBaud[s.control&0x0F]
+}
+
+func (s *serial) Ranges() []vm.Range {
+	return []vm.Range{{Start: s.base, End: s.base + 3}}
+}
+
+func (s *serial) Read(addr uint16) byte {
+	switch addr - s.base {
+	case aciaData:
+		s.status &^= aciaRxFull
+		return s.data
+	case aciaStatus:
+		status := s.status
+		s.status &^= aciaIRQ
+		return status
+	case aciaCommand:
+		return s.command
+	}
+	return s.control
+}
+
+// Peek reads registers without acknowledging received data or interrupts
+func (s *serial) Peek(addr uint16) byte {
+	switch addr - s.base {
+	case aciaData:
+		return s.data
+	case aciaStatus:
+		return s.status
+	}
+	return s.Read(addr)
+}
+
+func (s *serial) Write(addr uint16, b byte) {
+	switch addr - s.base {
+	case aciaData:
+		if s.out != nil {
+			s.out.Write([]byte{b})
+		} else {
+			select {
+			case s.tx <- b:
+			default: // the host isn't keeping up, so the byte is lost
+			}
+		}
+		s.status &^= aciaTxEmpty
+		s.txWait = s.charCycles()
+	case aciaStatus:
+		// A programmed reset clears most of the command register and any overrun
+		s.command &= 0xE0
+		s.status &^= aciaOverrun
+	case aciaCommand:
+		s.command = b
+	case aciaControl:
+		s.control = b
+	}
+}
+
+// Reset sets the registers as the ACIA's reset line does
+func (s *serial) Reset() {
+	s.control = 0
+	s.command = aciaCommandNoRxIR
+	s.status = aciaTxEmpty
+	s.rxWait, s.txWait = 0, 0
+}
+
+// Tick finishes sending and receiving characters as their time passes
+func (s *serial) Tick(cycles int) {
+	if s.txWait > 0 {
+		if s.txWait -= cycles; s.txWait <= 0 {
+			s.status |= aciaTxEmpty
+			if s.command&aciaCommandTx == aciaCommandTxIRQ && s.command&aciaCommandDTR != 0 {
+				s.status |= aciaIRQ
+			}
+		}
+	}
+
+	if s.rxWait > 0 {
+		s.rxWait -= cycles
+	}
+	if s.rxWait > 0 || s.status&aciaRxFull != 0 || s.command&aciaCommandDTR == 0 {
+		return
+	}
+	select {
+	case b := <-s.rx:
+		s.data = b
+		s.status |= aciaRxFull
+		s.rxWait = s.charCycles()
+		if s.command&aciaCommandNoRxIR == 0 {
+			s.status |= aciaIRQ
+		}
+	default:
+	}
+}
+
+// IRQ reports whether the ACIA is interrupting, until the program reads the status register
+func (s *serial) IRQ() bool {
+	return s.status&aciaIRQ != 0
+}
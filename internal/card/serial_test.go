@@ -0,0 +1,175 @@
+package card
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSerialStdinClaimed(t *testing.T) {
+	ClaimStdin()
+	defer func() { stdinClaimed = false }()
+
+	_, err := New("serial", nil)
+	if err == nil || !strings.Contains(err.Error(), "keyboard reads stdin") {
+		t.Errorf("got %v, want stdio refused while the keyboard reads stdin", err)
+	}
+}
+
+func TestSerialSocketPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A file that isn't a socket is left alone, and the card can't listen there
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New("serial", map[string]interface{}{"port": "unix:" + path}); err == nil {
+		t.Error("expected an error listening over a regular file")
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "keep" {
+		t.Errorf("the file was removed or changed: %q, %v", data, err)
+	}
+
+	// A socket left over from an earlier run is replaced
+	path = filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if _, err := New("serial", map[string]interface{}{"port": "unix:" + path}); err != nil {
+		t.Fatalf("listening over a stale socket: %v", err)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("connecting to the card: %v", err)
+	}
+	conn.Close()
+
+	// A mistyped option is caught before the card listens
+	path = filepath.Join(dir, "typo")
+	if _, err := New("serial", map[string]interface{}{"port": "unix:" + path, "typo": 1}); err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the card listened on %s despite the unknown option", path)
+	}
+}
+
+// newTestSerial returns an ACIA at $C200 with its buffers but nothing on the host side
+func newTestSerial() *serial {
+	s := &serial{base: 0xC200, rx: make(chan byte, serialBuffer), tx: make(chan byte, serialBuffer)}
+	s.Reset()
+	return s
+}
+
+func TestSerialBaud(t *testing.T) {
+	s := newTestSerial()
+	for control, want := range map[byte]int{0x00: 86, 0x06: 33333, 0x1F: 520} {
+		s.Write(0xC200+aciaControl, control)
+		if got := s.charCycles(); got != want {
+			t.Errorf("control $%02X: %d cycles a character, want %d", control, got, want)
+		}
+	}
+}
+
+func TestSerialTransmit(t *testing.T) {
+	s := newTestSerial()
+	if status := s.Read(0xC200 + aciaStatus); status != aciaTxEmpty {
+		t.Fatalf("status $%02X after a reset, want only TxEmpty", status)
+	}
+	s.Write(0xC200+aciaControl, 0x1F) // 19200 baud, 520 cycles a character
+	s.Write(0xC200+aciaCommand, aciaCommandTxIRQ|aciaCommandDTR)
+
+	s.Write(0xC200+aciaData, 'A')
+	if b := <-s.tx; b != 'A' {
+		t.Errorf("sent %q, want A", b)
+	}
+	s.Tick(519)
+	if s.Peek(0xC200+aciaStatus)&aciaTxEmpty != 0 || s.IRQ() {
+		t.Error("the character finished sending early")
+	}
+	s.Tick(1)
+	if status := s.Peek(0xC200 + aciaStatus); status != aciaTxEmpty|aciaIRQ || !s.IRQ() {
+		t.Errorf("status $%02X once sent, want TxEmpty and an interrupt", status)
+	}
+	s.Read(0xC200 + aciaStatus)
+	if s.IRQ() {
+		t.Error("reading the status didn't acknowledge the interrupt")
+	}
+
+	// Without the transmit interrupt enabled, sending finishes quietly
+	s.Write(0xC200+aciaCommand, aciaCommandDTR)
+	s.Write(0xC200+aciaData, 'B')
+	s.Tick(520)
+	if s.IRQ() {
+		t.Error("interrupted with the transmit interrupt disabled")
+	}
+}
+
+func TestSerialReceive(t *testing.T) {
+	s := newTestSerial()
+	s.Write(0xC200+aciaControl, 0x1F)
+	s.rx <- 'x'
+	s.rx <- 'y'
+
+	// Nothing arrives until DTR enables the receiver
+	s.Tick(1000)
+	if s.Peek(0xC200+aciaStatus)&aciaRxFull != 0 {
+		t.Fatal("received with the receiver disabled")
+	}
+	s.Write(0xC200+aciaCommand, aciaCommandDTR|aciaCommandNoRxIR)
+	s.Tick(1)
+	if status := s.Peek(0xC200 + aciaStatus); status&aciaRxFull == 0 || s.IRQ() {
+		t.Fatalf("status $%02X, want RxFull without an interrupt", status)
+	}
+
+	// The next character waits while the last is unread, and then for a character time
+	s.Tick(1000)
+	if b := s.Peek(0xC200 + aciaData); b != 'x' {
+		t.Fatalf("data register $%02X, want x still", b)
+	}
+	if b := s.Read(0xC200 + aciaData); b != 'x' || s.Peek(0xC200+aciaStatus)&aciaRxFull != 0 {
+		t.Fatal("reading the data didn't clear RxFull")
+	}
+	s.Write(0xC200+aciaCommand, aciaCommandDTR) // receive interrupt enabled
+	s.Tick(1)
+	if b := s.Read(0xC200 + aciaData); b != 'y' || !s.IRQ() {
+		t.Fatalf("received $%02X, interrupt %t, want y with an interrupt", b, s.IRQ())
+	}
+	s.Read(0xC200 + aciaStatus)
+
+	// A character arriving straight after takes a character time
+	s.rx <- 'z'
+	s.Tick(519)
+	if s.Peek(0xC200+aciaStatus)&aciaRxFull != 0 {
+		t.Fatal("received before a character time had passed")
+	}
+	s.Tick(1)
+	if b := s.Read(0xC200 + aciaData); b != 'z' {
+		t.Errorf("received $%02X, want z", b)
+	}
+}
+
+func TestSerialProgrammedReset(t *testing.T) {
+	s := newTestSerial()
+	s.Write(0xC200+aciaControl, 0x1F)
+	s.Write(0xC200+aciaCommand, 0xFF)
+	s.Write(0xC200+aciaStatus, 0)
+	if command, control := s.Read(0xC200+aciaCommand), s.Read(0xC200+aciaControl); command != 0xE0 || control != 0x1F {
+		t.Errorf("command $%02X control $%02X after a programmed reset, want $E0 and $1F", command, control)
+	}
+	s.Reset()
+	if command, control := s.Read(0xC200+aciaCommand), s.Read(0xC200+aciaControl); command != aciaCommandNoRxIR || control != 0 {
+		t.Errorf("command $%02X control $%02X after a hardware reset, want $02 and $00", command, control)
+	}
+}
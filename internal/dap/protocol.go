@@ -0,0 +1,114 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// request is a message sent by the client
+type request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// conn reads requests from a client and sends it responses and events. Each message is a
+// JSON object preceded by a Content-Length header, like an HTTP message. Events can be sent
+// from any goroutine.
+type conn struct {
+	r *textproto.Reader
+	w io.Writer
+
+	mu  sync.Mutex
+	seq int
+}
+
+func newConn(rw io.ReadWriter) *conn {
+	return &conn{r: textproto.NewReader(bufio.NewReader(rw)), w: rw}
+}
+
+// read returns the next request from the client
+func (c *conn) read() (*request, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, errors.New("message without a valid Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, body); err != nil {
+		return nil, err
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("invalid message: %v", err)
+	}
+	if req.Type != "request" {
+		return nil, fmt.Errorf("expected a request, got a %q message", req.Type)
+	}
+	return &req, nil
+}
+
+// respond answers req with body, or with err if it failed
+func (c *conn) respond(req *request, body interface{}, err error) error {
+	res := &response{Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+	if err != nil {
+		res.Message = err.Error()
+		res.Body = nil
+	}
+	return c.send(func(seq int) interface{} {
+		res.Seq = seq
+		return res
+	})
+}
+
+// event sends the named event to the client
+func (c *conn) event(name string, body interface{}) error {
+	return c.send(func(seq int) interface{} {
+		return &event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+// send numbers the message made by msg and writes it
+func (c *conn) send(msg func(seq int) interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	data, err := json.Marshal(msg(c.seq))
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(data)
+	return err
+}
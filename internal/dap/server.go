@@ -0,0 +1,844 @@
+// Package dap implements a Debug Adapter Protocol server so editors such as VS Code can debug
+// 6502 programs running on the emulated Apple 1: launching or attaching, breakpoints,
+// stepping, call stacks rebuilt from JSR tracking, registers as variables and memory reads.
+//
+// Programs run as they do under `appleone run`, through vm.Run, and breakpoints and steps are
+// conditions in the vm's breakpoint expression language. The Apple 1's display is sent as
+// output events, and REPL expressions written as a quoted string are typed on its keyboard.
+package dap
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bradford-hamilton/apple-1/internal/term"
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// threadID is the id of the only thread, the 6502
+const threadID = 1
+
+// Variable references for the scopes shown in every stack frame
+const (
+	registersRef = 1
+	flagsRef     = 2
+)
+
+// Server accepts debugging sessions one at a time. The machine outlives sessions, so a client
+// can attach to a program started by an earlier launch or by the server's creator.
+type Server struct {
+	Machine *vm.VM     // machine attach requests debug, nil until one is launched
+	Lines   vm.LineMap // source lines of the machine's program, if known
+}
+
+// ListenAndServe listens on the TCP address addr and serves debugging sessions until the
+// listener fails
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	log.Printf("debug adapter listening on %s", l.Addr())
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		log.Printf("debug session from %s", c.RemoteAddr())
+		if err := s.Serve(c); err != nil && err != io.EOF {
+			log.Printf("debug session ended: %v", err)
+		}
+		c.Close()
+	}
+}
+
+// Serve runs a debugging session over rw until the client disconnects
+func (s *Server) Serve(rw io.ReadWriter) error {
+	sess := &session{srv: s, conn: newConn(rw)}
+	defer sess.stop("disconnect")
+
+	for {
+		req, err := sess.conn.read()
+		if err != nil {
+			return err
+		}
+		body, err := sess.handle(req)
+		if err := sess.conn.respond(req, body, err); err != nil {
+			return err
+		}
+		for _, f := range sess.after {
+			f()
+		}
+		sess.after = nil
+		switch req.Command {
+		case "initialize":
+			// The client waits for this before sending breakpoints and configurationDone
+			sess.conn.event("initialized", nil)
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+// session is one client's debugging session. The vm belongs to the goroutine running it
+// while the program runs, so requests that touch it stop the program first.
+type session struct {
+	srv   *Server
+	conn  *conn
+	vm    *vm.VM
+	lines vm.LineMap
+
+	stopOnEntry bool
+
+	// after holds what to do once the current request has been answered, such as resuming
+	// the program, so the client sees the response before any event it causes
+	after []func()
+
+	// Breakpoint conditions by where they were set
+	sourceBreaks      map[string][]string
+	functionBreaks    []string
+	instructionBreaks []string
+	step              string // temporary breakpoint ending a step over or out
+
+	cancel    context.CancelFunc // stops the running program
+	done      chan struct{}      // closed once the running program stops
+	interrupt string             // why cancel was called: pause, internal or disconnect
+	stopped   string             // why the program last stopped, empty if it was interrupted internally
+}
+
+// launchArgs are the arguments of launch requests
+type launchArgs struct {
+	Program     string   `json:"program"`
+	LoadAddress string   `json:"loadAddress"`
+	Symbols     []string `json:"symbols"`
+	LineMap     string   `json:"lineMap"`
+	CPU         string   `json:"cpu"`
+	ClockSpeed  *int     `json:"clockSpeed"`
+	StopOnEntry bool     `json:"stopOnEntry"`
+}
+
+func (s *session) handle(req *request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+			"supportsConditionalBreakpoints":   true,
+			"supportsInstructionBreakpoints":   true,
+			"supportsEvaluateForHovers":        true,
+			"supportsReadMemoryRequest":        true,
+			"supportsDisassembleRequest":       true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var args launchArgs
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "attach":
+		var args struct {
+			StopOnEntry bool `json:"stopOnEntry"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		if s.srv.Machine == nil {
+			return nil, errors.New("there is no machine to attach to, launch a program instead")
+		}
+		s.attach(s.srv.Machine, s.srv.Lines, args.StopOnEntry)
+		return nil, nil
+	case "configurationDone":
+		if s.vm == nil {
+			return nil, errors.New("launch or attach first")
+		}
+		if s.stopOnEntry {
+			s.notify("stopped", stoppedBody("entry", ""))
+		} else {
+			s.after = append(s.after, s.resume)
+		}
+		return nil, nil
+	case "disconnect", "terminate":
+		s.stop("disconnect")
+		if req.Command == "terminate" {
+			s.notify("terminated", nil)
+		}
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadID, "name": "6502"}},
+		}, nil
+	}
+
+	if s.vm == nil {
+		return nil, errors.New("launch or attach first")
+	}
+	switch req.Command {
+	case "setBreakpoints":
+		return s.setBreakpoints(req.Arguments)
+	case "setFunctionBreakpoints":
+		return s.setFunctionBreakpoints(req.Arguments)
+	case "setInstructionBreakpoints":
+		return s.setInstructionBreakpoints(req.Arguments)
+	case "continue":
+		if !s.running() {
+			s.after = append(s.after, s.resume)
+		}
+		return map[string]interface{}{"allThreadsContinued": true}, nil
+	case "pause":
+		if s.running() {
+			s.stop("pause")
+			s.notify("stopped", stoppedBody("pause", ""))
+		}
+		return nil, nil
+	case "next":
+		return nil, s.stepOver()
+	case "stepIn":
+		return nil, s.stepIn()
+	case "stepOut":
+		return nil, s.stepOut()
+	}
+
+	// Everything else inspects the vm, so pause it for a moment if it is running
+	var body interface{}
+	var err error
+	s.whileStopped(func() {
+		switch req.Command {
+		case "stackTrace":
+			body = s.stackTrace()
+		case "scopes":
+			body = map[string]interface{}{
+				"scopes": []map[string]interface{}{
+					{"name": "Registers", "variablesReference": registersRef, "expensive": false},
+				},
+			}
+		case "variables":
+			body, err = s.variables(req.Arguments)
+		case "evaluate":
+			body, err = s.evaluate(req.Arguments)
+		case "readMemory":
+			body, err = s.readMemory(req.Arguments)
+		case "disassemble":
+			body, err = s.disassemble(req.Arguments)
+		default:
+			err = fmt.Errorf("unsupported request %q", req.Command)
+		}
+	})
+	return body, err
+}
+
+// launch creates a machine running the program described by args, which the server keeps
+// for later sessions to attach to
+func (s *session) launch(args launchArgs) error {
+	if args.Program == "" {
+		return errors.New("launch needs the path of a program")
+	}
+	program, err := ioutil.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+
+	machine := vm.New()
+	switch strings.ToLower(args.CPU) {
+	case "", "6502":
+	case "65c02":
+		machine.SetVariant(vm.CMOS65C02)
+	default:
+		return fmt.Errorf("unknown cpu %q, expected 6502 or 65c02", args.CPU)
+	}
+	for _, path := range args.Symbols {
+		if err := machine.LoadSymbols(path); err != nil {
+			return err
+		}
+	}
+	var lines vm.LineMap
+	if args.LineMap != "" {
+		if lines, err = vm.LoadLineMap(args.LineMap); err != nil {
+			return err
+		}
+	}
+	if args.ClockSpeed != nil {
+		machine.SetClockSpeed(*args.ClockSpeed)
+	}
+	if args.LoadAddress == "" {
+		args.LoadAddress = "$0280"
+	}
+	addr, err := machine.Evaluate(args.LoadAddress)
+	if err != nil || addr < 0 || addr > 0xFFFF {
+		return fmt.Errorf("invalid load address %q", args.LoadAddress)
+	}
+
+	machine.Load(uint16(addr), program)
+	regs := machine.Registers()
+	regs.PC = uint16(addr)
+	machine.SetRegisters(regs)
+
+	s.stop("disconnect")
+	s.srv.Machine, s.srv.Lines = machine, lines
+	s.attach(machine, lines, args.StopOnEntry)
+	return nil
+}
+
+// attach makes machine the one debugged by this session
+func (s *session) attach(machine *vm.VM, lines vm.LineMap, stopOnEntry bool) {
+	s.vm, s.lines, s.stopOnEntry = machine, lines, stopOnEntry
+	s.sourceBreaks = make(map[string][]string)
+	s.functionBreaks, s.instructionBreaks, s.step = nil, nil, ""
+	machine.ClearBreakpoints()
+	machine.SetDisplay(term.NewTextDisplay(outputWriter{s.conn}))
+}
+
+// outputWriter sends what the Apple 1 displays to the client's debug console
+type outputWriter struct {
+	conn *conn
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	if err := w.conn.event("output", map[string]interface{}{"category": "stdout", "output": string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func stoppedBody(reason, text string) map[string]interface{} {
+	body := map[string]interface{}{"reason": reason, "threadId": threadID, "allThreadsStopped": true}
+	if text != "" {
+		body["text"] = text
+	}
+	return body
+}
+
+// running reports whether the program is running
+func (s *session) running() bool {
+	if s.done == nil {
+		return false
+	}
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// resume runs the program in the background until it stops, telling the client why
+func (s *session) resume() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	s.cancel, s.done, s.interrupt, s.stopped = cancel, done, "", ""
+
+	go func() {
+		defer close(done)
+		err := s.vm.Run(ctx)
+
+		var reason, text string
+		switch e := err.(type) {
+		case *vm.Halt:
+			reason = "breakpoint"
+			if e.Breakpoint == s.step {
+				reason = "step"
+			}
+		case *vm.Fault:
+			reason, text = "exception", e.Error()
+		default:
+			if ctx.Err() == nil {
+				reason, text = "exception", err.Error()
+			} else if s.interrupt == "pause" {
+				reason = "pause"
+			}
+		}
+		if reason == "" {
+			return
+		}
+		s.clearStep()
+		s.stopped = reason
+		if reason != "pause" {
+			// The pause request's response announces a pause itself
+			s.conn.event("stopped", stoppedBody(reason, text))
+		}
+	}()
+}
+
+// stop stops the program if it is running, giving why for the stopped event
+func (s *session) stop(why string) {
+	if !s.running() {
+		return
+	}
+	s.interrupt = why
+	s.cancel()
+	<-s.done
+}
+
+// whileStopped runs f with the program stopped, resuming it afterwards if it was running
+func (s *session) whileStopped(f func()) {
+	if !s.running() {
+		f()
+		return
+	}
+	s.stop("internal")
+	f()
+	if s.stopped == "" {
+		s.resume()
+	}
+}
+
+// stepIn executes a single instruction
+func (s *session) stepIn() error {
+	if s.running() {
+		return errors.New("pause the program before stepping")
+	}
+	if _, err := s.vm.Step(); err != nil {
+		s.notify("stopped", stoppedBody("exception", err.Error()))
+		return nil
+	}
+	s.notify("stopped", stoppedBody("step", ""))
+	return nil
+}
+
+// stepOver executes a single instruction, running a subroutine it calls until it returns
+func (s *session) stepOver() error {
+	if s.running() {
+		return errors.New("pause the program before stepping")
+	}
+	regs := s.vm.Registers()
+	if s.vm.Peek(regs.PC) != 0x20 {
+		return s.stepIn()
+	}
+	// JSR pushes two bytes, and the call returns once SP rises above them
+	return s.runUntil(vm.ReturnCondition(regs.SP - 2))
+}
+
+// stepOut runs until the current subroutine returns
+func (s *session) stepOut() error {
+	if s.running() {
+		return errors.New("pause the program before stepping")
+	}
+	calls := s.vm.CallStack()
+	if len(calls) == 0 {
+		s.after = append(s.after, s.resume)
+		return nil
+	}
+	return s.runUntil(vm.ReturnCondition(calls[len(calls)-1].SP))
+}
+
+// runUntil resumes the program with a temporary breakpoint on cond that reports a step
+func (s *session) runUntil(cond string) error {
+	if err := s.vm.AddBreakpoint(cond); err != nil {
+		return err
+	}
+	s.step = cond
+	s.after = append(s.after, s.resume)
+	return nil
+}
+
+// notify sends an event once the current request has been answered
+func (s *session) notify(name string, body interface{}) {
+	s.after = append(s.after, func() { s.conn.event(name, body) })
+}
+
+func (s *session) clearStep() {
+	if s.step != "" {
+		s.vm.RemoveBreakpoint(s.step)
+		s.step = ""
+	}
+}
+
+// sourceBreakpoint is a breakpoint set in a setBreakpoints request
+type sourceBreakpoint struct {
+	Line      int    `json:"line"`
+	Condition string `json:"condition"`
+}
+
+func (s *session) setBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []sourceBreakpoint `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	var conds []string
+	results := make([]map[string]interface{}, 0, len(args.Breakpoints))
+	for _, bp := range args.Breakpoints {
+		result := map[string]interface{}{"verified": false, "line": bp.Line}
+		addr, ok := s.addressOf(args.Source.Path, bp.Line)
+		if ok {
+			conds = append(conds, pcCondition(fmt.Sprintf("$%04X", addr), bp.Condition))
+			result["verified"] = true
+			result["instructionReference"] = fmt.Sprintf("0x%04X", addr)
+		} else {
+			result["message"] = "no instruction was assembled from this line"
+		}
+		results = append(results, result)
+	}
+	s.sourceBreaks[args.Source.Path] = conds
+	return map[string]interface{}{"breakpoints": results}, s.applyBreakpoints()
+}
+
+func (s *session) setFunctionBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Breakpoints []struct {
+			Name      string `json:"name"`
+			Condition string `json:"condition"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	s.functionBreaks = nil
+	results := make([]map[string]interface{}, 0, len(args.Breakpoints))
+	for _, bp := range args.Breakpoints {
+		addr, err := s.vm.Evaluate(bp.Name)
+		if err != nil {
+			results = append(results, map[string]interface{}{"verified": false, "message": err.Error()})
+			continue
+		}
+		s.functionBreaks = append(s.functionBreaks, pcCondition(bp.Name, bp.Condition))
+		results = append(results, map[string]interface{}{
+			"verified":             true,
+			"instructionReference": fmt.Sprintf("0x%04X", uint16(addr)),
+		})
+	}
+	return map[string]interface{}{"breakpoints": results}, s.applyBreakpoints()
+}
+
+func (s *session) setInstructionBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Breakpoints []struct {
+			InstructionReference string `json:"instructionReference"`
+			Offset               int    `json:"offset"`
+			Condition            string `json:"condition"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	s.instructionBreaks = nil
+	results := make([]map[string]interface{}, 0, len(args.Breakpoints))
+	for _, bp := range args.Breakpoints {
+		addr, err := parseReference(bp.InstructionReference)
+		if err != nil {
+			results = append(results, map[string]interface{}{"verified": false, "message": err.Error()})
+			continue
+		}
+		addr += uint16(bp.Offset)
+		s.instructionBreaks = append(s.instructionBreaks, pcCondition(fmt.Sprintf("$%04X", addr), bp.Condition))
+		results = append(results, map[string]interface{}{
+			"verified":             true,
+			"instructionReference": fmt.Sprintf("0x%04X", addr),
+		})
+	}
+	return map[string]interface{}{"breakpoints": results}, s.applyBreakpoints()
+}
+
+// pcCondition returns the breakpoint condition for reaching loc while cond, if any, holds
+func pcCondition(loc, cond string) string {
+	if cond == "" {
+		return fmt.Sprintf("PC == (%s)", loc)
+	}
+	return fmt.Sprintf("PC == (%s) && (%s)", loc, cond)
+}
+
+// applyBreakpoints replaces the vm's breakpoints with those set by the client
+func (s *session) applyBreakpoints() error {
+	var err error
+	s.whileStopped(func() {
+		s.vm.ClearBreakpoints()
+		var conds []string
+		for _, c := range s.sourceBreaks {
+			conds = append(conds, c...)
+		}
+		conds = append(conds, s.functionBreaks...)
+		conds = append(conds, s.instructionBreaks...)
+		if s.step != "" {
+			conds = append(conds, s.step)
+		}
+		for _, cond := range conds {
+			if e := s.vm.AddBreakpoint(cond); e != nil && err == nil {
+				err = e
+			}
+		}
+	})
+	return err
+}
+
+// addressOf returns the address of the first instruction assembled from line of the source
+// file at path
+func (s *session) addressOf(path string, line int) (uint16, bool) {
+	var addrs []int
+	for addr, src := range s.lines {
+		if src.Line == line && sameFile(path, src.File) {
+			addrs = append(addrs, int(addr))
+		}
+	}
+	if len(addrs) == 0 {
+		return 0, false
+	}
+	sort.Ints(addrs)
+	return uint16(addrs[0]), true
+}
+
+// sameFile reports whether the client's absolute path names the file a line map refers to,
+// which is usually relative to wherever the program was assembled
+func sameFile(path, file string) bool {
+	path, file = filepath.ToSlash(filepath.Clean(path)), filepath.ToSlash(filepath.Clean(file))
+	return path == file || strings.HasSuffix(path, "/"+strings.TrimPrefix(file, "./"))
+}
+
+// frame returns a stack frame for the instruction at addr within the routine entered at entry
+func (s *session) frame(id int, addr, entry uint16) map[string]interface{} {
+	name := s.vm.Describe(entry)
+	if name == "" {
+		name = fmt.Sprintf("$%04X", entry)
+	}
+	f := map[string]interface{}{
+		"id":                          id,
+		"name":                        name,
+		"line":                        0,
+		"column":                      0,
+		"instructionPointerReference": fmt.Sprintf("0x%04X", addr),
+	}
+	if src, ok := s.lines[addr]; ok {
+		f["source"] = map[string]interface{}{"name": filepath.Base(src.File), "path": src.File}
+		f["line"] = src.Line
+		f["column"] = 1
+	}
+	return f
+}
+
+func (s *session) stackTrace() interface{} {
+	calls := s.vm.CallStack()
+	pc := s.vm.Registers().PC
+
+	// The innermost frame is the next instruction, inside the routine entered last. Each call
+	// site is inside the routine entered before it, and the outermost routine is named after
+	// wherever its code is.
+	frames := make([]map[string]interface{}, 0, len(calls)+1)
+	addr := pc
+	for i := len(calls); i >= 0; i-- {
+		entry := addr
+		if i > 0 {
+			entry = calls[i-1].Entry
+		}
+		frames = append(frames, s.frame(len(frames), addr, entry))
+		if i > 0 {
+			addr = calls[i-1].Caller
+		}
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+func (s *session) variables(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	regs := s.vm.Registers()
+	byteVar := func(name string, v byte) map[string]interface{} {
+		return map[string]interface{}{"name": name, "value": fmt.Sprintf("$%02X (%d)", v, v), "variablesReference": 0}
+	}
+	var vars []map[string]interface{}
+	switch args.VariablesReference {
+	case registersRef:
+		vars = []map[string]interface{}{
+			byteVar("A", regs.A),
+			byteVar("X", regs.X),
+			byteVar("Y", regs.Y),
+			byteVar("SP", regs.SP),
+			{"name": "PC", "value": fmt.Sprintf("$%04X", regs.PC), "variablesReference": 0, "memoryReference": fmt.Sprintf("0x%04X", regs.PC)},
+			{"name": "P", "value": fmt.Sprintf("$%02X", regs.P), "variablesReference": flagsRef},
+			{"name": "cycles", "value": strconv.FormatUint(s.vm.Cycles(), 10), "variablesReference": 0},
+		}
+	case flagsRef:
+		for i, name := range "NV-BDIZC" {
+			if name == '-' {
+				continue
+			}
+			bit := (regs.P >> uint(7-i)) & 1
+			vars = append(vars, map[string]interface{}{"name": string(name), "value": strconv.Itoa(int(bit)), "variablesReference": 0})
+		}
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+	return map[string]interface{}{"variables": vars}, nil
+}
+
+func (s *session) evaluate(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Expression string `json:"expression"`
+		Context    string `json:"context"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	// A quoted string typed into the debug console goes to the Apple 1's keyboard
+	if args.Context == "repl" && strings.HasPrefix(args.Expression, `"`) {
+		text, err := strconv.Unquote(args.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", args.Expression)
+		}
+		for i := 0; i < len(text); i++ {
+			if k, ok := term.Key(text[i]); ok {
+				s.vm.KeyPress(k)
+			}
+		}
+		return map[string]interface{}{"result": fmt.Sprintf("typed %d keys", len(text)), "variablesReference": 0}, nil
+	}
+
+	v, err := s.vm.Evaluate(args.Expression)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"result": fmt.Sprintf("$%X (%d)", v, v), "variablesReference": 0}, nil
+}
+
+func (s *session) readMemory(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Count           int    `json:"count"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.Count < 0 {
+		return nil, fmt.Errorf("invalid count %d", args.Count)
+	}
+	base, err := parseReference(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+
+	start := int(base) + args.Offset
+	if start < 0 || start > 0xFFFF {
+		return map[string]interface{}{"address": fmt.Sprintf("0x%04X", base), "unreadableBytes": args.Count}, nil
+	}
+	count := args.Count
+	if start+count > 0x10000 {
+		count = 0x10000 - start
+	}
+	data := make([]byte, count)
+	for i := range data {
+		data[i] = s.vm.Peek(uint16(start + i))
+	}
+	return map[string]interface{}{
+		"address":         fmt.Sprintf("0x%04X", start),
+		"data":            base64.StdEncoding.EncodeToString(data),
+		"unreadableBytes": args.Count - count,
+	}, nil
+}
+
+func (s *session) disassemble(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference   string `json:"memoryReference"`
+		Offset            int    `json:"offset"`
+		InstructionOffset int    `json:"instructionOffset"`
+		InstructionCount  int    `json:"instructionCount"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.InstructionCount < 0 {
+		return nil, fmt.Errorf("invalid instruction count %d", args.InstructionCount)
+	}
+	base, err := parseReference(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	addr := int(base) + args.Offset
+
+	// Instructions vary in length, so to go backwards disassemble from a few bytes further
+	// back and keep the instructions that end up leading to addr
+	var addrs []int
+	if args.InstructionOffset < 0 {
+		from := addr + 3*args.InstructionOffset
+		if from < 0 {
+			from = 0
+		}
+		for a := from; a < addr; {
+			addrs = append(addrs, a)
+			_, next := s.vm.Disassemble(uint16(a))
+			if int(next) <= a {
+				break
+			}
+			a = int(next)
+		}
+		if len(addrs) > -args.InstructionOffset {
+			addrs = addrs[len(addrs)+args.InstructionOffset:]
+		}
+	}
+	want := args.InstructionCount
+	if args.InstructionOffset > 0 {
+		want += args.InstructionOffset
+	}
+	for a := addr; len(addrs) < want && a <= 0xFFFF; {
+		addrs = append(addrs, a)
+		_, next := s.vm.Disassemble(uint16(a))
+		if int(next) <= a {
+			break
+		}
+		a = int(next)
+	}
+	if args.InstructionOffset > 0 && len(addrs) > args.InstructionOffset {
+		addrs = addrs[args.InstructionOffset:]
+	}
+	if len(addrs) > args.InstructionCount {
+		addrs = addrs[:args.InstructionCount]
+	}
+
+	instructions := make([]map[string]interface{}, 0, len(addrs))
+	for _, a := range addrs {
+		text, next := s.vm.Disassemble(uint16(a))
+		size := int(next) - a
+		if size <= 0 {
+			size = 0x10000 - a
+		}
+		var bytes []string
+		for b := a; b < a+size; b++ {
+			bytes = append(bytes, fmt.Sprintf("%02X", s.vm.Peek(uint16(b))))
+		}
+		ins := map[string]interface{}{
+			"address":          fmt.Sprintf("0x%04X", a),
+			"instruction":      text,
+			"instructionBytes": strings.Join(bytes, " "),
+		}
+		if name, ok := s.vm.Label(uint16(a)); ok {
+			ins["symbol"] = name
+		}
+		if src, ok := s.lines[uint16(a)]; ok {
+			ins["location"] = map[string]interface{}{"name": filepath.Base(src.File), "path": src.File}
+			ins["line"] = src.Line
+		}
+		instructions = append(instructions, ins)
+	}
+	return map[string]interface{}{"instructions": instructions}, nil
+}
+
+// parseReference parses a memory or instruction reference, an address in hex such as 0x0280
+func parseReference(ref string) (uint16, error) {
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(ref), "0x"), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory reference %q", ref)
+	}
+	return uint16(addr), nil
+}
@@ -0,0 +1,311 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// message is a response or event read by the test client
+type message struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client drives a Server over one end of a pipe
+type client struct {
+	t        *testing.T
+	conn     net.Conn
+	seq      int
+	messages chan message
+	events   []message // events read while waiting for a response
+}
+
+func newClient(t *testing.T) *client {
+	server, conn := net.Pipe()
+	c := &client{t: t, conn: conn, messages: make(chan message, 64)}
+	go (&Server{}).Serve(server)
+	go func() {
+		r := textproto.NewReader(bufio.NewReader(conn))
+		for {
+			header, err := r.ReadMIMEHeader()
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			n, _ := strconv.Atoi(header.Get("Content-Length"))
+			body := make([]byte, n)
+			if _, err := io.ReadFull(r.R, body); err != nil {
+				close(c.messages)
+				return
+			}
+			var m message
+			if err := json.Unmarshal(body, &m); err != nil {
+				t.Errorf("invalid message %s: %v", body, err)
+			}
+			c.messages <- m
+		}
+	}()
+	return c
+}
+
+// next returns the next message from the server, failing the test if none arrives
+func (c *client) next() message {
+	c.t.Helper()
+	select {
+	case m, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("the server closed the connection")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server")
+	}
+	return message{}
+}
+
+// call sends a request and returns the body of its successful response
+func (c *client) call(command string, args interface{}) json.RawMessage {
+	c.t.Helper()
+	m := c.request(command, args)
+	if !m.Success {
+		c.t.Fatalf("%s failed: %s", command, m.Message)
+	}
+	return m.Body
+}
+
+// fail sends a request that should fail and returns the error message of its response
+func (c *client) fail(command string, args interface{}) string {
+	c.t.Helper()
+	m := c.request(command, args)
+	if m.Success {
+		c.t.Fatalf("%s succeeded, expected it to fail", command)
+	}
+	return m.Message
+}
+
+// request sends a request and returns its response
+func (c *client) request(command string, args interface{}) message {
+	c.t.Helper()
+	c.seq++
+	data, err := json.Marshal(map[string]interface{}{
+		"seq": c.seq, "type": "request", "command": command, "arguments": args,
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		m := c.next()
+		if m.Type == "event" {
+			c.events = append(c.events, m)
+			continue
+		}
+		if m.RequestSeq != c.seq || m.Command != command {
+			c.t.Fatalf("got a response to %q (%d) while waiting for %q (%d)", m.Command, m.RequestSeq, command, c.seq)
+		}
+		return m
+	}
+}
+
+// event waits for the named event, skipping others such as output
+func (c *client) event(name string) json.RawMessage {
+	c.t.Helper()
+	for {
+		var m message
+		if len(c.events) > 0 {
+			m, c.events = c.events[0], c.events[1:]
+		} else {
+			m = c.next()
+		}
+		if m.Type == "event" && m.Event == name {
+			return m.Body
+		}
+	}
+}
+
+// stopped waits for a stopped event and returns its reason
+func (c *client) stopped() string {
+	c.t.Helper()
+	var body struct {
+		Reason string `json:"reason"`
+		Text   string `json:"text"`
+	}
+	json.Unmarshal(c.event("stopped"), &body)
+	if body.Text != "" {
+		return body.Reason + ": " + body.Text
+	}
+	return body.Reason
+}
+
+// top returns the innermost stack frame's name and line
+func (c *client) top() (string, int) {
+	c.t.Helper()
+	var body struct {
+		StackFrames []struct {
+			Name string `json:"name"`
+			Line int    `json:"line"`
+		} `json:"stackFrames"`
+	}
+	if err := json.Unmarshal(c.call("stackTrace", map[string]int{"threadId": threadID}), &body); err != nil {
+		c.t.Fatal(err)
+	}
+	if len(body.StackFrames) == 0 {
+		c.t.Fatal("no stack frames")
+	}
+	return body.StackFrames[0].Name, body.StackFrames[0].Line
+}
+
+// program sets the stack pointer to 1 so return addresses wrap around the stack, then calls
+// a subroutine twice
+var program = []byte{
+	0xA2, 0x01, // $0300 LDX #$01    line 1
+	0x9A,             // $0302 TXS         line 2
+	0x20, 0x10, 0x03, // $0303 JSR sub     line 3
+	0x20, 0x10, 0x03, // $0306 JSR sub     line 4
+	0x4C, 0x09, 0x03, // $0309 JMP *       line 5
+	0, 0, 0, 0,
+	0xC8, // $0310 sub: INY    line 7
+	0x60, // $0311 RTS         line 8
+}
+
+const programLines = `$0300 prog.s:1
+$0302 prog.s:2
+$0303 prog.s:3
+$0306 prog.s:4
+$0309 prog.s:5
+$0310 prog.s:7
+$0311 prog.s:8
+`
+
+func TestSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bin, lines := filepath.Join(dir, "prog.bin"), filepath.Join(dir, "prog.lines")
+	if err := ioutil.WriteFile(bin, program, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(lines, []byte(programLines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t)
+	defer c.conn.Close()
+
+	c.call("initialize", map[string]string{"adapterID": "appleone"})
+	c.event("initialized")
+	c.call("launch", map[string]interface{}{
+		"program":     bin,
+		"loadAddress": "$0300",
+		"lineMap":     lines,
+		"clockSpeed":  0,
+	})
+
+	var bps struct {
+		Breakpoints []struct {
+			Verified             bool   `json:"verified"`
+			InstructionReference string `json:"instructionReference"`
+		} `json:"breakpoints"`
+	}
+	body := c.call("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": filepath.Join(dir, "prog.s")},
+		"breakpoints": []map[string]int{{"line": 3}, {"line": 6}},
+	})
+	if err := json.Unmarshal(body, &bps); err != nil {
+		t.Fatal(err)
+	}
+	if len(bps.Breakpoints) != 2 || !bps.Breakpoints[0].Verified || bps.Breakpoints[0].InstructionReference != "0x0303" || bps.Breakpoints[1].Verified {
+		t.Fatalf("breakpoints %s, want line 3 verified at 0x0303 and line 6 unverified", body)
+	}
+
+	c.call("configurationDone", nil)
+	if reason := c.stopped(); reason != "breakpoint" {
+		t.Fatalf("stopped for %q, want breakpoint", reason)
+	}
+	if _, line := c.top(); line != 3 {
+		t.Fatalf("stopped on line %d, want 3", line)
+	}
+
+	// Stepping over a JSR runs the subroutine even though its return address wrapped
+	c.call("next", map[string]int{"threadId": threadID})
+	if reason := c.stopped(); reason != "step" {
+		t.Fatalf("stopped for %q, want step", reason)
+	}
+	if _, line := c.top(); line != 4 {
+		t.Fatalf("stepped over to line %d, want 4", line)
+	}
+	if y := c.register("Y"); y != "$01 (1)" {
+		t.Errorf("Y = %s after stepping over the call, want $01 (1)", y)
+	}
+
+	// Stepping into the call shows the subroutine, and stepping out returns from it
+	c.call("stepIn", map[string]int{"threadId": threadID})
+	if reason := c.stopped(); reason != "step" {
+		t.Fatalf("stopped for %q, want step", reason)
+	}
+	if name, line := c.top(); name != "$0310" || line != 7 {
+		t.Fatalf("stepped into %s line %d, want $0310 line 7", name, line)
+	}
+	c.call("stepOut", map[string]int{"threadId": threadID})
+	if reason := c.stopped(); reason != "step" {
+		t.Fatalf("stopped for %q, want step", reason)
+	}
+	if _, line := c.top(); line != 5 {
+		t.Fatalf("stepped out to line %d, want 5", line)
+	}
+	if y := c.register("Y"); y != "$02 (2)" {
+		t.Errorf("Y = %s after stepping out, want $02 (2)", y)
+	}
+
+	// Negative counts are refused rather than crashing the adapter
+	if msg := c.fail("readMemory", map[string]interface{}{"memoryReference": "0x0300", "count": -1}); !strings.Contains(msg, "invalid count -1") {
+		t.Errorf("readMemory with a negative count: %q", msg)
+	}
+	if msg := c.fail("disassemble", map[string]interface{}{"memoryReference": "0x0300", "instructionCount": -1}); !strings.Contains(msg, "invalid instruction count -1") {
+		t.Errorf("disassemble with a negative count: %q", msg)
+	}
+	c.call("readMemory", map[string]interface{}{"memoryReference": "0x0300", "count": 4})
+
+	c.call("disconnect", nil)
+}
+
+// register returns the value shown for the named register in the Registers scope
+func (c *client) register(name string) string {
+	c.t.Helper()
+	var body struct {
+		Variables []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"variables"`
+	}
+	if err := json.Unmarshal(c.call("variables", map[string]int{"variablesReference": registersRef}), &body); err != nil {
+		c.t.Fatal(err)
+	}
+	for _, v := range body.Variables {
+		if v.Name == name {
+			return v.Value
+		}
+	}
+	c.t.Fatalf("no register %s", name)
+	return ""
+}
@@ -0,0 +1,175 @@
+// Package diff compares text line by line and formats the differences as a unified diff, the
+// format printed by `diff -u` and `git diff`.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is how many unchanged lines surround each change
+const contextLines = 3
+
+// edit is one line of the comparison: kept in both texts, deleted from a or inserted from b
+type edit struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Unified returns a unified diff turning text a, named aName, into text b, named bName, or
+// an empty string if they have the same lines. Texts are compared line by line, so \r\n and
+// \n line endings match and a missing final line ending is ignored.
+func Unified(aName, bName, a, b string) string {
+	aLines, bLines := splitLines(a), splitLines(b)
+	if equal(aLines, bLines) {
+		return ""
+	}
+	edits := compare(aLines, bLines)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(edits); {
+		// Find the next change and the run of edits its hunk covers, merging changes whose
+		// context would overlap
+		first := start
+		for first < len(edits) && edits[first].kind == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		from := max(first-contextLines, start)
+		end := first
+		for unchanged := 0; end < len(edits) && unchanged <= 2*contextLines; end++ {
+			if edits[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		to := end
+		for to > first && edits[to-1].kind == ' ' {
+			to--
+		}
+		to = min(to+contextLines, len(edits))
+
+		writeHunk(&out, edits, from, to)
+		start = to
+	}
+	return out.String()
+}
+
+// writeHunk writes edits[from:to] as a hunk, with a header giving the line ranges it covers
+func writeHunk(out *strings.Builder, edits []edit, from, to int) {
+	aLine, bLine := 1, 1
+	for _, e := range edits[:from] {
+		if e.kind != '+' {
+			aLine++
+		}
+		if e.kind != '-' {
+			bLine++
+		}
+	}
+	aCount, bCount := 0, 0
+	for _, e := range edits[from:to] {
+		if e.kind != '+' {
+			aCount++
+		}
+		if e.kind != '-' {
+			bCount++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+	for _, e := range edits[from:to] {
+		fmt.Fprintf(out, "%c%s\n", e.kind, e.line)
+	}
+}
+
+// hunkRange formats a hunk's start line and length, where an empty range names the line
+// before it
+func hunkRange(line, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", line-1)
+	case 1:
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// compare returns the edits turning a into b, keeping their longest common subsequence
+func compare(a, b []string) []edit {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return edits
+}
+
+// splitLines splits text into lines ending in \n or \r\n, ignoring a final line ending
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
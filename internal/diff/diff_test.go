@@ -0,0 +1,67 @@
+package diff
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"empty", "", "", ""},
+		{"missing final newline", "a\nb\n", "a\nb", ""},
+		{"crlf", "a\r\nb\r\n", "a\nb\n", ""},
+		{
+			"changed line",
+			"a\nb\nc\n",
+			"a\nB\nc\n",
+			"--- want\n+++ got\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"from empty",
+			"",
+			"a\n",
+			"--- want\n+++ got\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			"to empty",
+			"a\n",
+			"",
+			"--- want\n+++ got\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			"blank line added",
+			"a\n",
+			"a\n\n",
+			"--- want\n+++ got\n@@ -1 +1,2 @@\n a\n+\n",
+		},
+		{
+			"context is trimmed",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			"1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			"--- want\n+++ got\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			"separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			"--- want\n+++ got\n" +
+				"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			"nearby changes share a hunk",
+			"1\n2\n3\n4\n5\n6\n7\n8\n",
+			"one\n2\n3\n4\n5\n6\n7\neight\n",
+			"--- want\n+++ got\n@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("want", "got", tt.a, tt.b); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// Package pprof writes profiles in the gzipped protocol buffer format read by `go tool pprof`,
+// described by https://github.com/google/pprof/blob/master/proto/profile.proto. Only the
+// parts needed to profile 6502 code are supported: samples made of call stacks and values,
+// with each stack frame a code address inside a named function.
+package pprof
+
+import (
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// ValueType names the kind and unit of one of a sample's values, e.g. cycles and count
+type ValueType struct {
+	Type string
+	Unit string
+}
+
+// Frame is a location in a call stack
+type Frame struct {
+	Addr     uint64 // code address
+	Function string // name of the function containing Addr
+}
+
+// Sample is a call stack, innermost frame first, and the values measured for it
+type Sample struct {
+	Stack  []Frame
+	Values []int64
+}
+
+// Profile is a set of samples sharing the same value types
+type Profile struct {
+	Binary      string // name of the program profiled, which every address belongs to
+	SampleTypes []ValueType
+	Samples     []Sample
+	PeriodType  ValueType
+	Period      int64
+	Time        time.Time
+	Duration    time.Duration
+}
+
+// Field numbers from profile.proto
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileMapping       = 3
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	mappingID           = 1
+	mappingMemoryLimit  = 3
+	mappingFilename     = 5
+	mappingHasFunctions = 7
+
+	locationID        = 1
+	locationMappingID = 2
+	locationAddress   = 3
+	locationLine      = 4
+
+	lineFunctionID = 1
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+)
+
+// Write encodes p and writes it to w gzipped
+func (p *Profile) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(p.encode()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// encoder builds a Profile message, interning strings, functions and locations as it goes
+type encoder struct {
+	buf       buffer
+	strings   map[string]int64
+	table     []string
+	functions map[string]uint64
+	locations map[Frame]uint64
+	funcBuf   buffer
+	locBuf    buffer
+	mapping   uint64 // id of the mapping locations belong to, 0 for none
+}
+
+func (p *Profile) encode() []byte {
+	e := &encoder{
+		strings:   map[string]int64{"": 0},
+		table:     []string{""},
+		functions: make(map[string]uint64),
+		locations: make(map[Frame]uint64),
+	}
+
+	for _, vt := range p.SampleTypes {
+		e.buf.message(profileSampleType, e.valueType(vt))
+	}
+	if p.Binary != "" {
+		// A single mapping covering the 6502's address space, marking every function as
+		// already symbolized
+		var m buffer
+		m.uint(mappingID, 1)
+		m.uint(mappingMemoryLimit, 0x10000)
+		m.uint(mappingFilename, uint64(e.str(p.Binary)))
+		m.uint(mappingHasFunctions, 1)
+		e.buf.message(profileMapping, m)
+		e.mapping = 1
+	}
+	for _, s := range p.Samples {
+		var m buffer
+		ids := make([]uint64, len(s.Stack))
+		for i, f := range s.Stack {
+			ids[i] = e.location(f)
+		}
+		m.packedUints(sampleLocationID, ids)
+		values := make([]uint64, len(s.Values))
+		for i, v := range s.Values {
+			values[i] = uint64(v)
+		}
+		m.packedUints(sampleValue, values)
+		e.buf.message(profileSample, m)
+	}
+	e.buf.append(e.locBuf)
+	e.buf.append(e.funcBuf)
+
+	if !p.Time.IsZero() {
+		e.buf.uint(profileTimeNanos, uint64(p.Time.UnixNano()))
+	}
+	e.buf.uint(profileDurationNanos, uint64(p.Duration))
+	if p.PeriodType != (ValueType{}) {
+		e.buf.message(profilePeriodType, e.valueType(p.PeriodType))
+	}
+	e.buf.uint(profilePeriod, uint64(p.Period))
+
+	// The string table is written last since encoding everything else fills it
+	for _, s := range e.table {
+		e.buf.bytes(profileStringTable, []byte(s))
+	}
+	return e.buf
+}
+
+func (e *encoder) valueType(vt ValueType) buffer {
+	var m buffer
+	m.uint(valueTypeType, uint64(e.str(vt.Type)))
+	m.uint(valueTypeUnit, uint64(e.str(vt.Unit)))
+	return m
+}
+
+// str returns the index of s in the string table, adding it if needed
+func (e *encoder) str(s string) int64 {
+	if i, ok := e.strings[s]; ok {
+		return i
+	}
+	i := int64(len(e.table))
+	e.strings[s] = i
+	e.table = append(e.table, s)
+	return i
+}
+
+// function returns the id of the named function, adding it if needed
+func (e *encoder) function(name string) uint64 {
+	if id, ok := e.functions[name]; ok {
+		return id
+	}
+	id := uint64(len(e.functions) + 1)
+	e.functions[name] = id
+
+	var m buffer
+	m.uint(functionID, id)
+	m.uint(functionName, uint64(e.str(name)))
+	m.uint(functionSystemName, uint64(e.str(name)))
+	e.funcBuf.message(profileFunction, m)
+	return id
+}
+
+// location returns the id of the location for f, adding it if needed
+func (e *encoder) location(f Frame) uint64 {
+	if id, ok := e.locations[f]; ok {
+		return id
+	}
+	id := uint64(len(e.locations) + 1)
+	e.locations[f] = id
+
+	var line buffer
+	line.uint(lineFunctionID, e.function(f.Function))
+	var m buffer
+	m.uint(locationID, id)
+	m.uint(locationMappingID, e.mapping)
+	m.uint(locationAddress, f.Addr)
+	m.message(locationLine, line)
+	e.locBuf.message(profileLocation, m)
+	return id
+}
+
+// buffer accumulates protocol buffer fields
+type buffer []byte
+
+// Wire types
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *buffer) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *buffer) key(field, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// uint writes a varint field, omitting it when it holds the default of zero
+func (b *buffer) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(v)
+}
+
+func (b *buffer) bytes(field int, p []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(p)))
+	*b = append(*b, p...)
+}
+
+func (b *buffer) message(field int, m buffer) {
+	b.bytes(field, m)
+}
+
+func (b *buffer) packedUints(field int, vs []uint64) {
+	if len(vs) == 0 {
+		return
+	}
+	var packed buffer
+	for _, v := range vs {
+		packed.varint(v)
+	}
+	b.bytes(field, packed)
+}
+
+func (b *buffer) append(p buffer) {
+	*b = append(*b, p...)
+}
@@ -0,0 +1,249 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// field is a decoded protocol buffer field
+type field struct {
+	num   int
+	wire  int
+	value uint64 // varint fields
+	data  []byte // length delimited fields
+}
+
+// varint reads a varint from the start of *b
+func varint(t *testing.T, b *[]byte) uint64 {
+	t.Helper()
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		if len(*b) == 0 {
+			t.Fatal("truncated varint")
+		}
+		c := (*b)[0]
+		*b = (*b)[1:]
+		v |= uint64(c&0x7F) << shift
+		if c < 0x80 {
+			return v
+		}
+	}
+}
+
+// decode splits a protocol buffer message into its fields
+func decode(t *testing.T, b []byte) []field {
+	t.Helper()
+	var fields []field
+	for len(b) > 0 {
+		key := varint(t, &b)
+		f := field{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.value = varint(t, &b)
+		case wireBytes:
+			n := varint(t, &b)
+			if uint64(len(b)) < n {
+				t.Fatalf("field %d is %d bytes, only %d left", f.num, n, len(b))
+			}
+			f.data, b = b[:n], b[n:]
+		default:
+			t.Fatalf("field %d has unexpected wire type %d", f.num, f.wire)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// values returns the varint fields numbered num, and packed fields unpacked
+func values(t *testing.T, fields []field, num int) []uint64 {
+	t.Helper()
+	var vs []uint64
+	for _, f := range fields {
+		if f.num != num {
+			continue
+		}
+		if f.wire == wireVarint {
+			vs = append(vs, f.value)
+			continue
+		}
+		for packed := f.data; len(packed) > 0; {
+			vs = append(vs, varint(t, &packed))
+		}
+	}
+	return vs
+}
+
+// messages returns the embedded messages numbered num
+func messages(t *testing.T, fields []field, num int) [][]field {
+	t.Helper()
+	var ms [][]field
+	for _, f := range fields {
+		if f.num == num {
+			ms = append(ms, decode(t, f.data))
+		}
+	}
+	return ms
+}
+
+// one returns the single varint field numbered num, 0 if it was left out as the default
+func one(t *testing.T, fields []field, num int) uint64 {
+	t.Helper()
+	vs := values(t, fields, num)
+	if len(vs) > 1 {
+		t.Fatalf("field %d repeated %d times", num, len(vs))
+	}
+	if len(vs) == 0 {
+		return 0
+	}
+	return vs[0]
+}
+
+func TestWrite(t *testing.T) {
+	start := time.Date(2020, 5, 17, 12, 0, 0, 0, time.UTC)
+	p := &Profile{
+		Binary:      "apple1",
+		SampleTypes: []ValueType{{Type: "instructions", Unit: "count"}, {Type: "cycles", Unit: "count"}},
+		Samples: []Sample{
+			{Stack: []Frame{{Addr: 0x0320, Function: "PRBYTE"}, {Addr: 0x0300, Function: "MAIN"}}, Values: []int64{2, 300}},
+			{Stack: []Frame{{Addr: 0x0300, Function: "MAIN"}}, Values: []int64{1, 6}},
+		},
+		PeriodType: ValueType{Type: "cycles", Unit: "count"},
+		Period:     1,
+		Time:       start,
+		Duration:   1500 * time.Millisecond,
+	}
+	var out bytes.Buffer
+	if err := p.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := decode(t, raw)
+
+	var strs []string
+	for _, f := range msg {
+		if f.num == profileStringTable {
+			strs = append(strs, string(f.data))
+		}
+	}
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table %q doesn't start with the empty string", strs)
+	}
+	str := func(i uint64) string {
+		t.Helper()
+		if i >= uint64(len(strs)) {
+			t.Fatalf("string %d is past the end of the table", i)
+		}
+		return strs[i]
+	}
+	valueType := func(m []field) ValueType {
+		return ValueType{Type: str(one(t, m, valueTypeType)), Unit: str(one(t, m, valueTypeUnit))}
+	}
+
+	var types []ValueType
+	for _, m := range messages(t, msg, profileSampleType) {
+		types = append(types, valueType(m))
+	}
+	if !reflect.DeepEqual(types, p.SampleTypes) {
+		t.Errorf("sample types %v, want %v", types, p.SampleTypes)
+	}
+	if pt := messages(t, msg, profilePeriodType); len(pt) != 1 || valueType(pt[0]) != p.PeriodType {
+		t.Errorf("period type %v, want %v", pt, p.PeriodType)
+	}
+	if period := one(t, msg, profilePeriod); period != 1 {
+		t.Errorf("period %d, want 1", period)
+	}
+	if ns := one(t, msg, profileTimeNanos); ns != uint64(start.UnixNano()) {
+		t.Errorf("time %d, want %d", ns, start.UnixNano())
+	}
+	if ns := one(t, msg, profileDurationNanos); ns != uint64(p.Duration) {
+		t.Errorf("duration %d, want %d", ns, p.Duration)
+	}
+
+	mappings := messages(t, msg, profileMapping)
+	if len(mappings) != 1 {
+		t.Fatalf("%d mappings, want 1", len(mappings))
+	}
+	m := mappings[0]
+	if one(t, m, mappingID) != 1 || one(t, m, mappingMemoryLimit) != 0x10000 || str(one(t, m, mappingFilename)) != "apple1" || one(t, m, mappingHasFunctions) != 1 {
+		t.Errorf("mapping %+v", m)
+	}
+
+	functions := make(map[uint64]string)
+	for _, f := range messages(t, msg, profileFunction) {
+		name := str(one(t, f, functionName))
+		if str(one(t, f, functionSystemName)) != name {
+			t.Errorf("function %s has a different system name", name)
+		}
+		functions[one(t, f, functionID)] = name
+	}
+	locations := make(map[uint64]Frame)
+	for _, l := range messages(t, msg, profileLocation) {
+		if one(t, l, locationMappingID) != 1 {
+			t.Errorf("location %+v isn't in the mapping", l)
+		}
+		lines := messages(t, l, locationLine)
+		if len(lines) != 1 {
+			t.Fatalf("location has %d lines, want 1", len(lines))
+		}
+		locations[one(t, l, locationID)] = Frame{Addr: one(t, l, locationAddress), Function: functions[one(t, lines[0], lineFunctionID)]}
+	}
+	if len(functions) != 2 || len(locations) != 2 {
+		t.Errorf("%d functions and %d locations, want each interned to 2", len(functions), len(locations))
+	}
+
+	var samples []Sample
+	for _, s := range messages(t, msg, profileSample) {
+		var sample Sample
+		for _, id := range values(t, s, sampleLocationID) {
+			sample.Stack = append(sample.Stack, locations[id])
+		}
+		for _, v := range values(t, s, sampleValue) {
+			sample.Values = append(sample.Values, int64(v))
+		}
+		samples = append(samples, sample)
+	}
+	if !reflect.DeepEqual(samples, p.Samples) {
+		t.Errorf("samples %v, want %v", samples, p.Samples)
+	}
+}
+
+func TestVarint(t *testing.T) {
+	tests := []struct {
+		v    uint64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{300, []byte{0xAC, 0x02}},
+		{1<<64 - 1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}},
+	}
+	for _, tt := range tests {
+		var b buffer
+		b.varint(tt.v)
+		if !bytes.Equal(b, tt.want) {
+			t.Errorf("%d encoded as % X, want % X", tt.v, []byte(b), tt.want)
+		}
+	}
+
+	// Field keys carry the wire type, and zero varints are left out
+	var b buffer
+	b.uint(profilePeriod, 0)
+	b.uint(profilePeriod, 5)
+	b.bytes(profileStringTable, []byte("hi"))
+	if want := []byte{12<<3 | wireVarint, 5, 6<<3 | wireBytes, 2, 'h', 'i'}; !bytes.Equal(b, want) {
+		t.Errorf("fields encoded as % X, want % X", []byte(b), want)
+	}
+}
@@ -0,0 +1,455 @@
+package prodos
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// slot is a place for a directory entry
+type slot struct {
+	block  uint16
+	offset int
+}
+
+// dirEntries returns the entries in the directory whose key block is key, along with the
+// free slots in it
+func (v *Volume) dirEntries(key uint16) ([]Entry, []slot, error) {
+	var entries []Entry
+	var free []slot
+	seen := make(map[uint16]bool)
+	for n := key; n != 0; {
+		if seen[n] || int(n) >= v.Blocks {
+			return nil, nil, fmt.Errorf("directory block %d is corrupt", n)
+		}
+		seen[n] = true
+		b, err := v.readBlock(n)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := 0; i < entriesPerBlock; i++ {
+			if n == key && i == 0 {
+				continue // the directory header
+			}
+			off := entriesOffset + i*entryLength
+			e := b[off : off+entryLength]
+			storage := e[offStorage] >> 4
+			if storage == storageDeleted {
+				free = append(free, slot{block: n, offset: off})
+				continue
+			}
+			entries = append(entries, Entry{
+				Name:     string(e[offName : offName+int(e[offStorage]&0x0F)]),
+				Type:     e[offFileType],
+				Aux:      binary.LittleEndian.Uint16(e[offAuxType:]),
+				Blocks:   int(binary.LittleEndian.Uint16(e[offBlocksUsed:])),
+				Size:     int(e[offEOF]) | int(e[offEOF+1])<<8 | int(e[offEOF+2])<<16,
+				Created:  dateTime(e[offCreated:]),
+				Modified: dateTime(e[offModified:]),
+				Access:   e[offAccess],
+				IsDir:    storage == storageDirectory,
+				storage:  storage,
+				key:      binary.LittleEndian.Uint16(e[offKeyPointer:]),
+				block:    n,
+				offset:   off,
+				dirKey:   key,
+			})
+		}
+		n = binary.LittleEndian.Uint16(b[2:])
+	}
+	return entries, free, nil
+}
+
+// splitPath breaks a path into upper case names. A leading /VOLUME/ is allowed and dropped.
+func (v *Volume) splitPath(path string) []string {
+	var names []string
+	for _, name := range strings.Split(strings.ToUpper(path), "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if strings.HasPrefix(path, "/") && len(names) > 0 && names[0] == v.Name {
+		names = names[1:]
+	}
+	return names
+}
+
+// findDir returns the key block of the directory at the given names
+func (v *Volume) findDir(names []string) (uint16, error) {
+	key := uint16(volumeDirBlock)
+	for i, name := range names {
+		e, err := v.find(key, name)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", strings.Join(names[:i+1], "/"), err)
+		}
+		if !e.IsDir {
+			return 0, fmt.Errorf("%s: %v", strings.Join(names[:i+1], "/"), ErrNotDirectory)
+		}
+		key = e.key
+	}
+	return key, nil
+}
+
+// find returns the entry called name in the directory whose key block is key
+func (v *Volume) find(key uint16, name string) (Entry, error) {
+	entries, _, err := v.dirEntries(key)
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, e := range entries {
+		if e.Name == name {
+			return e, nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+// lookup returns the entry at path
+func (v *Volume) lookup(path string) (Entry, error) {
+	names := v.splitPath(path)
+	if len(names) == 0 {
+		return Entry{}, fmt.Errorf("%s: %v", path, ErrDirectory)
+	}
+	key, err := v.findDir(names[:len(names)-1])
+	if err != nil {
+		return Entry{}, err
+	}
+	e, err := v.find(key, names[len(names)-1])
+	if err != nil {
+		return Entry{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return e, nil
+}
+
+// List returns the entries in the directory at path, the volume directory if path is empty
+func (v *Volume) List(path string) ([]Entry, error) {
+	key, err := v.findDir(v.splitPath(path))
+	if err != nil {
+		return nil, err
+	}
+	entries, _, err := v.dirEntries(key)
+	return entries, err
+}
+
+// Stat returns the entry for the file at path
+func (v *Volume) Stat(path string) (Entry, error) {
+	return v.lookup(path)
+}
+
+// ReadFile returns the contents of the file at path, along with its entry
+func (v *Volume) ReadFile(path string) ([]byte, Entry, error) {
+	e, err := v.lookup(path)
+	if err != nil {
+		return nil, e, err
+	}
+	if e.IsDir {
+		return nil, e, fmt.Errorf("%s: %v", path, ErrDirectory)
+	}
+
+	data := make([]byte, 0, e.Size)
+	blocks, err := v.dataBlocks(e.storage, e.key, (e.Size+BlockSize-1)/BlockSize)
+	if err != nil {
+		return nil, e, err
+	}
+	for _, n := range blocks {
+		b := make([]byte, BlockSize)
+		if n != 0 { // zero is a sparse block, never written
+			if b, err = v.readBlock(n); err != nil {
+				return nil, e, err
+			}
+		}
+		data = append(data, b...)
+	}
+	return data[:e.Size], e, nil
+}
+
+// dataBlocks returns the first count data blocks of a file with the given storage type and
+// key block
+func (v *Volume) dataBlocks(storage byte, key uint16, count int) ([]uint16, error) {
+	switch storage {
+	case storageSeedling:
+		return []uint16{key}, nil
+	case storageSapling:
+		return v.indexBlocks(key, count)
+	case storageTree:
+		master, err := v.indexBlocks(key, (count+255)/256)
+		if err != nil {
+			return nil, err
+		}
+		var blocks []uint16
+		for _, index := range master {
+			n := count - len(blocks)
+			if n > 256 {
+				n = 256
+			}
+			if index == 0 {
+				blocks = append(blocks, make([]uint16, n)...)
+				continue
+			}
+			b, err := v.indexBlocks(index, n)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, b...)
+		}
+		return blocks, nil
+	}
+	return nil, fmt.Errorf("unsupported storage type $%X", storage)
+}
+
+// indexBlocks returns the first count block pointers in an index block, which stores their
+// low bytes in its first half and high bytes in its second
+func (v *Volume) indexBlocks(index uint16, count int) ([]uint16, error) {
+	b, err := v.readBlock(index)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]uint16, count)
+	for i := range blocks {
+		blocks[i] = uint16(b[i]) | uint16(b[256+i])<<8
+	}
+	return blocks, nil
+}
+
+// WriteFile stores data in the file at path with the given file type and aux type,
+// replacing any file already there. The directory it goes in must exist. A file being
+// replaced is only removed once the new data is written, so it survives a full volume.
+func (v *Volume) WriteFile(path string, data []byte, fileType byte, aux uint16) error {
+	names := v.splitPath(path)
+	if len(names) == 0 {
+		return fmt.Errorf("%s: %v", path, ErrDirectory)
+	}
+	name := names[len(names)-1]
+	if err := validName(name); err != nil {
+		return err
+	}
+	if len(data) > 0xFFFFFF {
+		return fmt.Errorf("%s is %d bytes, more than a ProDOS file can hold", path, len(data))
+	}
+	key, err := v.findDir(names[:len(names)-1])
+	if err != nil {
+		return err
+	}
+
+	// A new file takes a free slot in the directory, a replacement that of the old file
+	created := time.Now()
+	old, err := v.find(key, name)
+	replacing := err == nil
+	var to slot
+	switch {
+	case replacing && old.IsDir:
+		return fmt.Errorf("%s: %v", path, ErrDirectory)
+	case replacing:
+		if !old.Created.IsZero() {
+			created = old.Created
+		}
+		to = slot{block: old.block, offset: old.offset}
+	case err != ErrNotFound:
+		return err
+	default:
+		_, free, err := v.dirEntries(key)
+		if err != nil {
+			return err
+		}
+		if len(free) == 0 {
+			return fmt.Errorf("%s: %v", path, ErrDirFull)
+		}
+		to = free[0]
+	}
+
+	// The blocks go back to the bitmap if the data can't be written
+	bitmap := append([]byte(nil), v.bitmap...)
+	storage, keyBlock, used, err := v.writeData(data)
+	if err != nil {
+		v.bitmap = bitmap
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	b, err := v.readBlock(to.block)
+	if err != nil {
+		return err
+	}
+	e := b[to.offset : to.offset+entryLength]
+	for i := range e {
+		e[i] = 0
+	}
+	e[offStorage] = storage<<4 | byte(len(name))
+	copy(e[offName:], name)
+	e[offFileType] = fileType
+	binary.LittleEndian.PutUint16(e[offKeyPointer:], keyBlock)
+	binary.LittleEndian.PutUint16(e[offBlocksUsed:], uint16(used))
+	e[offEOF], e[offEOF+1], e[offEOF+2] = byte(len(data)), byte(len(data)>>8), byte(len(data)>>16)
+	putDateTime(e[offCreated:], created)
+	e[offAccess] = accessDefault
+	binary.LittleEndian.PutUint16(e[offAuxType:], aux)
+	putDateTime(e[offModified:], time.Now())
+	binary.LittleEndian.PutUint16(e[offHeaderPtr:], key)
+	if err := v.writeBlock(to.block, b); err != nil {
+		return err
+	}
+	if replacing {
+		err = v.free(old)
+	} else {
+		err = v.adjustFileCount(key, 1)
+	}
+	if err != nil {
+		return err
+	}
+	return v.writeBitmap()
+}
+
+// writeData allocates blocks for data and writes it, returning the storage type, key block
+// and number of blocks used
+func (v *Volume) writeData(data []byte) (byte, uint16, int, error) {
+	count := (len(data) + BlockSize - 1) / BlockSize
+	if count == 0 {
+		count = 1 // even an empty file has a data block
+	}
+	var indexes int
+	storage := byte(storageSeedling)
+	switch {
+	case count > 256:
+		storage = storageTree
+		indexes = 1 + (count+255)/256
+	case count > 1:
+		storage = storageSapling
+		indexes = 1
+	}
+
+	blocks, err := v.allocate(count + indexes)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	index, blocks := blocks[:indexes], blocks[indexes:]
+	for i, n := range blocks {
+		b := make([]byte, BlockSize)
+		if i*BlockSize < len(data) {
+			copy(b, data[i*BlockSize:])
+		}
+		if err := v.writeBlock(n, b); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	switch storage {
+	case storageSeedling:
+		return storage, blocks[0], 1, nil
+	case storageSapling:
+		return storage, index[0], count + 1, v.writeIndex(index[0], blocks)
+	}
+	for i, n := range index[1:] {
+		end := (i + 1) * 256
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+		if err := v.writeIndex(n, blocks[i*256:end]); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return storage, index[0], count + indexes, v.writeIndex(index[0], index[1:])
+}
+
+// writeIndex writes an index block pointing at blocks
+func (v *Volume) writeIndex(index uint16, blocks []uint16) error {
+	b := make([]byte, BlockSize)
+	for i, n := range blocks {
+		b[i], b[256+i] = byte(n), byte(n>>8)
+	}
+	return v.writeBlock(index, b)
+}
+
+// Remove deletes the file at path. Directories can be removed once they are empty.
+func (v *Volume) Remove(path string) error {
+	e, err := v.lookup(path)
+	if err != nil {
+		return err
+	}
+	if e.IsDir {
+		entries, _, err := v.dirEntries(e.key)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("%s: directory not empty", path)
+		}
+	}
+	if err := v.remove(e); err != nil {
+		return err
+	}
+	return v.writeBitmap()
+}
+
+// remove frees a file's blocks and its directory entry, leaving the bitmap to be written
+func (v *Volume) remove(e Entry) error {
+	if err := v.free(e); err != nil {
+		return err
+	}
+	b, err := v.readBlock(e.block)
+	if err != nil {
+		return err
+	}
+	b[e.offset+offStorage] = storageDeleted
+	if err := v.writeBlock(e.block, b); err != nil {
+		return err
+	}
+	return v.adjustFileCount(e.dirKey, -1)
+}
+
+// free marks the blocks of a file or directory free in the bitmap, leaving it to be written
+func (v *Volume) free(e Entry) error {
+	var blocks []uint16
+	switch e.storage {
+	case storageSeedling:
+		blocks = []uint16{e.key}
+	case storageSapling, storageTree:
+		count := (e.Size + BlockSize - 1) / BlockSize
+		if count > 256 && e.storage == storageSapling {
+			count = 256
+		}
+		data, err := v.dataBlocks(e.storage, e.key, count)
+		if err != nil {
+			return err
+		}
+		blocks = append(data, e.key)
+		if e.storage == storageTree {
+			index, err := v.indexBlocks(e.key, (count+255)/256)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, index...)
+		}
+	case storageDirectory:
+		for n := e.key; n != 0; {
+			b, err := v.readBlock(n)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, n)
+			n = binary.LittleEndian.Uint16(b[2:])
+		}
+	default:
+		return fmt.Errorf("%s: unsupported storage type $%X", e.Name, e.storage)
+	}
+	for _, n := range blocks {
+		if n != 0 && int(n) < v.Blocks {
+			v.setFree(n, true)
+		}
+	}
+	return nil
+}
+
+// adjustFileCount changes the file count in a directory's header by delta
+func (v *Volume) adjustFileCount(key uint16, delta int) error {
+	b, err := v.readBlock(key)
+	if err != nil {
+		return err
+	}
+	h := b[entriesOffset:]
+	count := int(binary.LittleEndian.Uint16(h[offFileCount:])) + delta
+	if count < 0 {
+		count = 0
+	}
+	binary.LittleEndian.PutUint16(h[offFileCount:], uint16(count))
+	return v.writeBlock(key, b)
+}
@@ -0,0 +1,34 @@
+package prodos
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// 2IMG disk image header layout
+const (
+	twoIMGHeaderSize = 64
+	twoIMGBlocks     = 0x14 // blocks in a ProDOS order image, used when the data length is 0
+	twoIMGDataOffset = 0x18 // where the disk data starts
+	twoIMGDataLength = 0x1C // how long it is, before any creator and comment chunks
+)
+
+// ImageData returns where the disk data in an image of size bytes starts and how long it is.
+// ProDOS order images (.po, .hdv) are all data, and 2IMG images (.2mg) say where theirs is in
+// their header, as it may be followed by a comment and creator data.
+func ImageData(r io.ReaderAt, size int64) (offset, length int64, err error) {
+	var header [twoIMGHeaderSize]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil || string(header[:4]) != "2IMG" {
+		return 0, size, nil
+	}
+	offset = int64(binary.LittleEndian.Uint32(header[twoIMGDataOffset:]))
+	length = int64(binary.LittleEndian.Uint32(header[twoIMGDataLength:]))
+	if length == 0 {
+		length = int64(binary.LittleEndian.Uint32(header[twoIMGBlocks:])) * BlockSize
+	}
+	if offset < twoIMGHeaderSize || offset+length > size {
+		return 0, 0, fmt.Errorf("2IMG data of %d bytes at %d doesn't fit in the %d byte image", length, offset, size)
+	}
+	return offset, length, nil
+}
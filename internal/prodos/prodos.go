@@ -0,0 +1,319 @@
+// Package prodos reads and writes ProDOS volumes in disk images, the format of the CFFA1's
+// CompactFlash cards, so files can be moved between the host and an image.
+//
+// A volume is a sequence of 512 byte blocks. Blocks 0 and 1 hold the boot loader, the volume
+// directory starts at block 2 and a bitmap of free blocks follows it. Files are stored as a
+// single data block (seedling), an index block of up to 256 data blocks (sapling) or a
+// master index of up to 128 index blocks (tree).
+package prodos
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// BlockSize is the size of a ProDOS block
+const BlockSize = 512
+
+// MaxBlocks is the most blocks a volume can have
+const MaxBlocks = 0xFFFF
+
+// Storage types, kept in the high nibble of an entry's first byte
+const (
+	storageDeleted   = 0x0
+	storageSeedling  = 0x1
+	storageSapling   = 0x2
+	storageTree      = 0x3
+	storageDirectory = 0xD
+	storageVolHeader = 0xF
+)
+
+// Directory layout
+const (
+	volumeDirBlock  = 2    // key block of the volume directory
+	volumeDirBlocks = 4    // blocks in the volume directory
+	bitmapBlock     = 6    // first block of the volume bitmap
+	entryLength     = 0x27 // bytes per directory entry
+	entriesPerBlock = 0x0D // entries in each directory block
+	entriesOffset   = 4    // after the previous and next block pointers
+)
+
+// Offsets within directory entries
+const (
+	offStorage      = 0x00 // storage type and name length
+	offName         = 0x01
+	offFileType     = 0x10
+	offKeyPointer   = 0x11
+	offBlocksUsed   = 0x13
+	offEOF          = 0x15
+	offCreated      = 0x18
+	offAccess       = 0x1E
+	offAuxType      = 0x1F
+	offModified     = 0x21
+	offHeaderPtr    = 0x25
+	offEntryLength  = 0x1F // in directory headers
+	offEntriesBlock = 0x20
+	offFileCount    = 0x21
+	offBitmapPtr    = 0x23 // in the volume header
+	offTotalBlocks  = 0x25
+)
+
+// accessDefault allows reading, writing, renaming and destroying
+const accessDefault = 0xC3
+
+// Errors returned for paths that don't lead anywhere useful
+var (
+	ErrNotFound     = errors.New("file not found")
+	ErrNotDirectory = errors.New("not a directory")
+	ErrDirectory    = errors.New("is a directory")
+	ErrDiskFull     = errors.New("volume full")
+	ErrDirFull      = errors.New("directory full")
+)
+
+// Entry describes a file or directory
+type Entry struct {
+	Name     string
+	Type     byte   // file type, e.g. $06 for BIN
+	Aux      uint16 // aux type, the load address of BIN files
+	Blocks   int    // blocks used, including index blocks
+	Size     int    // length in bytes
+	Created  time.Time
+	Modified time.Time
+	Access   byte
+	IsDir    bool
+
+	storage byte
+	key     uint16 // key block
+	block   uint16 // directory block holding the entry
+	offset  int    // offset of the entry within that block
+	dirKey  uint16 // key block of the directory holding the entry
+}
+
+// Volume is a ProDOS volume in an image file
+type Volume struct {
+	Name   string
+	Blocks int // total blocks
+
+	file   *os.File
+	offset int64 // where block 0 starts, after any 2IMG header
+	bitmap []byte
+	mapPtr uint16
+}
+
+// Create writes a new, empty volume of the given number of blocks to path
+func Create(path, name string, blocks int) error {
+	name = strings.ToUpper(name)
+	if err := validName(name); err != nil {
+		return err
+	}
+	mapBlocks := (blocks + BlockSize*8 - 1) / (BlockSize * 8)
+	if blocks < bitmapBlock+mapBlocks+1 || blocks > MaxBlocks {
+		return fmt.Errorf("a volume needs between %d and %d blocks", bitmapBlock+mapBlocks+1, MaxBlocks)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	v := &Volume{Name: name, Blocks: blocks, file: f, mapPtr: bitmapBlock}
+	if err := f.Truncate(int64(blocks) * BlockSize); err != nil {
+		f.Close()
+		return err
+	}
+
+	// The volume directory is four linked blocks, with the header first
+	for i := 0; i < volumeDirBlocks; i++ {
+		b := make([]byte, BlockSize)
+		n := uint16(volumeDirBlock + i)
+		if i > 0 {
+			binary.LittleEndian.PutUint16(b[0:], n-1)
+		}
+		if i < volumeDirBlocks-1 {
+			binary.LittleEndian.PutUint16(b[2:], n+1)
+		}
+		if i == 0 {
+			h := b[entriesOffset:]
+			h[offStorage] = storageVolHeader<<4 | byte(len(name))
+			copy(h[offName:], name)
+			putDateTime(h[offCreated:], time.Now())
+			h[offAccess] = accessDefault
+			h[offEntryLength] = entryLength
+			h[offEntriesBlock] = entriesPerBlock
+			binary.LittleEndian.PutUint16(h[offBitmapPtr:], bitmapBlock)
+			binary.LittleEndian.PutUint16(h[offTotalBlocks:], uint16(blocks))
+		}
+		if err := v.writeBlock(n, b); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	v.bitmap = make([]byte, mapBlocks*BlockSize)
+	for n := 0; n < blocks; n++ {
+		if n >= bitmapBlock+mapBlocks {
+			v.setFree(uint16(n), true)
+		}
+	}
+	if err := v.writeBitmap(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Open opens the volume in the image at path. ProDOS order images (.po, .hdv) are read as
+// is, and 2IMG images (.2mg) have their header skipped.
+func Open(path string) (*Volume, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	v := &Volume{file: f}
+	if v.offset, _, err = ImageData(f, info.Size()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	b, err := v.readBlock(volumeDirBlock)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	h := b[entriesOffset:]
+	if h[offStorage]>>4 != storageVolHeader {
+		f.Close()
+		return nil, fmt.Errorf("%s doesn't hold a ProDOS volume", path)
+	}
+	v.Name = string(h[offName : offName+int(h[offStorage]&0x0F)])
+	v.Blocks = int(binary.LittleEndian.Uint16(h[offTotalBlocks:]))
+	v.mapPtr = binary.LittleEndian.Uint16(h[offBitmapPtr:])
+
+	mapBlocks := (v.Blocks + BlockSize*8 - 1) / (BlockSize * 8)
+	for i := 0; i < mapBlocks; i++ {
+		b, err := v.readBlock(v.mapPtr + uint16(i))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		v.bitmap = append(v.bitmap, b...)
+	}
+	return v, nil
+}
+
+// Close closes the image
+func (v *Volume) Close() error {
+	return v.file.Close()
+}
+
+// FreeBlocks returns how many blocks are unused
+func (v *Volume) FreeBlocks() int {
+	n := 0
+	for b := 0; b < v.Blocks; b++ {
+		if v.isFree(uint16(b)) {
+			n++
+		}
+	}
+	return n
+}
+
+func (v *Volume) readBlock(n uint16) ([]byte, error) {
+	b := make([]byte, BlockSize)
+	if _, err := v.file.ReadAt(b, v.offset+int64(n)*BlockSize); err != nil {
+		return nil, fmt.Errorf("reading block %d: %v", n, err)
+	}
+	return b, nil
+}
+
+func (v *Volume) writeBlock(n uint16, b []byte) error {
+	if _, err := v.file.WriteAt(b, v.offset+int64(n)*BlockSize); err != nil {
+		return fmt.Errorf("writing block %d: %v", n, err)
+	}
+	return nil
+}
+
+// The bitmap has a bit per block, most significant bit first, set while the block is free
+
+func (v *Volume) isFree(n uint16) bool {
+	return v.bitmap[n/8]&(0x80>>(n%8)) != 0
+}
+
+func (v *Volume) setFree(n uint16, free bool) {
+	if free {
+		v.bitmap[n/8] |= 0x80 >> (n % 8)
+	} else {
+		v.bitmap[n/8] &^= 0x80 >> (n % 8)
+	}
+}
+
+func (v *Volume) writeBitmap() error {
+	for i := 0; i*BlockSize < len(v.bitmap); i++ {
+		if err := v.writeBlock(v.mapPtr+uint16(i), v.bitmap[i*BlockSize:(i+1)*BlockSize]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allocate marks n free blocks as used and returns them
+func (v *Volume) allocate(n int) ([]uint16, error) {
+	var blocks []uint16
+	for b := 0; b < v.Blocks && len(blocks) < n; b++ {
+		if v.isFree(uint16(b)) {
+			blocks = append(blocks, uint16(b))
+		}
+	}
+	if len(blocks) < n {
+		return nil, ErrDiskFull
+	}
+	for _, b := range blocks {
+		v.setFree(b, false)
+	}
+	return blocks, nil
+}
+
+// validName reports whether name can be a ProDOS file or volume name: up to 15 letters,
+// digits and periods, starting with a letter
+func validName(name string) error {
+	if len(name) == 0 || len(name) > 15 {
+		return fmt.Errorf("invalid name %q, names are 1 to 15 characters", name)
+	}
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || i > 0 && (c >= '0' && c <= '9' || c == '.')) {
+			return fmt.Errorf("invalid name %q, names are letters, digits and periods starting with a letter", name)
+		}
+	}
+	return nil
+}
+
+// putDateTime stores t as a ProDOS date and time
+func putDateTime(b []byte, t time.Time) {
+	date := uint16(t.Year()%100)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	binary.LittleEndian.PutUint16(b[0:], date)
+	b[2] = byte(t.Minute())
+	b[3] = byte(t.Hour())
+}
+
+// dateTime decodes a ProDOS date and time, returning the zero time if none is set. Two digit
+// years from 40 are taken to be in the 1900s, as ProDOS 2.4 does.
+func dateTime(b []byte) time.Time {
+	date := binary.LittleEndian.Uint16(b)
+	if date == 0 {
+		return time.Time{}
+	}
+	year := int(date >> 9)
+	if year < 40 {
+		year += 2000
+	} else {
+		year += 1900
+	}
+	return time.Date(year, time.Month(date>>5&0x0F), int(date&0x1F), int(b[3]&0x1F), int(b[2]&0x3F), 0, 0, time.Local)
+}
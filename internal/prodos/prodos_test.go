@@ -0,0 +1,258 @@
+package prodos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newVolume creates and opens an empty volume of the given number of blocks
+func newVolume(t *testing.T, blocks int) (*Volume, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "prodos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "test.po")
+	if err := Create(path, "test", blocks); err != nil {
+		t.Fatal(err)
+	}
+	v, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { v.Close() })
+	return v, path
+}
+
+// pattern returns n bytes that differ from block to block, tagged with seed
+func pattern(n int, seed byte) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i/BlockSize) ^ byte(i) ^ seed
+	}
+	return data
+}
+
+func TestCreate(t *testing.T) {
+	v, path := newVolume(t, 280)
+	if v.Name != "TEST" || v.Blocks != 280 {
+		t.Errorf("opened %s of %d blocks, want TEST of 280", v.Name, v.Blocks)
+	}
+	// Blocks 0 and 1 hold the boot loader, then come four directory blocks and the bitmap
+	if free := v.FreeBlocks(); free != 280-7 {
+		t.Errorf("%d blocks free, want %d", free, 280-7)
+	}
+	if entries, err := v.List(""); err != nil || len(entries) != 0 {
+		t.Errorf("listed %d entries, %v, want none", len(entries), err)
+	}
+
+	if err := Create(path, "test", 280); err == nil {
+		t.Error("expected an error creating over an existing image")
+	}
+	dir := filepath.Dir(path)
+	if err := Create(filepath.Join(dir, "small.po"), "test", 7); err == nil {
+		t.Error("expected an error for a volume with no room for files")
+	}
+	if err := Create(filepath.Join(dir, "name.po"), "1test", 280); err == nil {
+		t.Error("expected an error for a name starting with a digit")
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	v, path := newVolume(t, 1600)
+	free := v.FreeBlocks()
+
+	tests := []struct {
+		name    string
+		size    int
+		storage byte
+		blocks  int
+	}{
+		{"EMPTY", 0, storageSeedling, 1},
+		{"SEEDLING", BlockSize, storageSeedling, 1},
+		{"SAPLING", BlockSize + 1, storageSapling, 3},
+		{"FULL.SAPLING", 256 * BlockSize, storageSapling, 257},
+		{"TREE", 256*BlockSize + 1, storageTree, 260}, // a master index and two indexes
+	}
+	for i, tt := range tests {
+		data := pattern(tt.size, byte(i))
+		if err := v.WriteFile(tt.name, data, 0x06, 0x0280); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, e, err := v.ReadFile(tt.name)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: read back different data", tt.name)
+		}
+		if e.storage != tt.storage || e.Blocks != tt.blocks || e.Size != tt.size {
+			t.Errorf("%s: storage %d, %d blocks, %d bytes, want %d, %d, %d", tt.name, e.storage, e.Blocks, e.Size, tt.storage, tt.blocks, tt.size)
+		}
+		if e.Type != 0x06 || e.Aux != 0x0280 {
+			t.Errorf("%s: type $%02X aux $%04X, want BIN $0280", tt.name, e.Type, e.Aux)
+		}
+		free -= tt.blocks
+		if n := v.FreeBlocks(); n != free {
+			t.Errorf("%s: %d blocks free, want %d", tt.name, n, free)
+		}
+	}
+
+	// The bitmap and files are on disk, not just in the open volume
+	v.Close()
+	v, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if n := v.FreeBlocks(); n != free {
+		t.Errorf("reopened with %d blocks free, want %d", n, free)
+	}
+	entries, err := v.List("")
+	if err != nil || len(entries) != len(tests) {
+		t.Fatalf("listed %d entries, %v, want %d", len(entries), err, len(tests))
+	}
+	if data, _, err := v.ReadFile("tree"); err != nil || !bytes.Equal(data, pattern(256*BlockSize+1, 4)) {
+		t.Errorf("reading the tree file after reopening: %v", err)
+	}
+
+	// Removing the files gives all their blocks back
+	for _, tt := range tests {
+		if err := v.Remove(tt.name); err != nil {
+			t.Fatalf("removing %s: %v", tt.name, err)
+		}
+		free += tt.blocks
+		if n := v.FreeBlocks(); n != free {
+			t.Errorf("removing %s: %d blocks free, want %d", tt.name, n, free)
+		}
+	}
+	if entries, err := v.List(""); err != nil || len(entries) != 0 {
+		t.Errorf("listed %d entries after removing them all, %v", len(entries), err)
+	}
+	if _, _, err := v.ReadFile("TREE"); err == nil || !strings.Contains(err.Error(), ErrNotFound.Error()) {
+		t.Errorf("reading a removed file: got %v, want %v", err, ErrNotFound)
+	}
+	if err := v.Remove("TREE"); err == nil {
+		t.Error("expected an error removing a missing file")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	v, _ := newVolume(t, 280)
+	free := v.FreeBlocks()
+
+	old := pattern(100*BlockSize, 1)
+	if err := v.WriteFile("FILE", old, 0x06, 0x0300); err != nil {
+		t.Fatal(err)
+	}
+	_, before, err := v.ReadFile("FILE")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With the old file still on disk there's no room for the new one, which must leave
+	// the old one as it was
+	err = v.WriteFile("FILE", pattern(200*BlockSize, 2), 0x06, 0x0400)
+	if err == nil || !strings.Contains(err.Error(), ErrDiskFull.Error()) {
+		t.Fatalf("got %v, want %v", err, ErrDiskFull)
+	}
+	data, e, err := v.ReadFile("FILE")
+	if err != nil || !bytes.Equal(data, old) || e.Aux != 0x0300 {
+		t.Errorf("the old file didn't survive a failed replacement: %v", err)
+	}
+	if n := v.FreeBlocks(); n != free-101 {
+		t.Errorf("%d blocks free after a failed replacement, want %d", n, free-101)
+	}
+
+	replacement := pattern(10*BlockSize, 3)
+	if err := v.WriteFile("FILE", replacement, 0x04, 0x0400); err != nil {
+		t.Fatal(err)
+	}
+	data, e, err = v.ReadFile("FILE")
+	if err != nil || !bytes.Equal(data, replacement) {
+		t.Fatalf("read back different data after replacing: %v", err)
+	}
+	if e.Type != 0x04 || e.Aux != 0x0400 || !e.Created.Equal(before.Created) {
+		t.Errorf("replaced entry has type $%02X aux $%04X created %v", e.Type, e.Aux, e.Created)
+	}
+	if n := v.FreeBlocks(); n != free-11 {
+		t.Errorf("%d blocks free after replacing, want %d", n, free-11)
+	}
+	if entries, err := v.List(""); err != nil || len(entries) != 1 {
+		t.Errorf("listed %d entries after replacing, %v, want 1", len(entries), err)
+	}
+}
+
+func TestDirFull(t *testing.T) {
+	v, _ := newVolume(t, 280)
+	slots := volumeDirBlocks*entriesPerBlock - 1 // less the header
+	for i := 0; i < slots; i++ {
+		if err := v.WriteFile(fmt.Sprintf("F%d", i), []byte{byte(i)}, 0x06, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := v.WriteFile("EXTRA", nil, 0x06, 0)
+	if err == nil || !strings.Contains(err.Error(), ErrDirFull.Error()) {
+		t.Errorf("got %v, want %v", err, ErrDirFull)
+	}
+
+	// A replacement reuses the old file's entry, so a full directory doesn't stop it
+	if err := v.WriteFile("F0", []byte("new"), 0x06, 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, _, err := v.ReadFile("F0"); err != nil || string(data) != "new" {
+		t.Errorf("read %q, %v, want new", data, err)
+	}
+}
+
+func TestDefaultAux(t *testing.T) {
+	for typ, want := range map[byte]uint16{TypeBinary: 0x0280, TypeSystem: 0x2000, TypeText: 0, TypeApple1: 0} {
+		if got := DefaultAux(typ); got != want {
+			t.Errorf("%s: aux $%04X, want $%04X", TypeName(typ), got, want)
+		}
+	}
+}
+
+func TestImageData(t *testing.T) {
+	twoIMG := func(offset, length, blocks uint32, size int) []byte {
+		image := make([]byte, size)
+		copy(image, "2IMG")
+		binary.LittleEndian.PutUint32(image[twoIMGBlocks:], blocks)
+		binary.LittleEndian.PutUint32(image[twoIMGDataOffset:], offset)
+		binary.LittleEndian.PutUint32(image[twoIMGDataLength:], length)
+		return image
+	}
+	tests := []struct {
+		name   string
+		image  []byte
+		offset int64
+		length int64
+		err    bool
+	}{
+		{name: "prodos order", image: make([]byte, 4*BlockSize), offset: 0, length: 4 * BlockSize},
+		{name: "2img", image: twoIMG(64, 2*BlockSize, 0, 64+2*BlockSize), offset: 64, length: 2 * BlockSize},
+		{name: "2img with a comment", image: twoIMG(64, 2*BlockSize, 2, 64+2*BlockSize+100), offset: 64, length: 2 * BlockSize},
+		{name: "2img with only a block count", image: twoIMG(64, 0, 2, 64+2*BlockSize), offset: 64, length: 2 * BlockSize},
+		{name: "2img data past the end", image: twoIMG(64, 3*BlockSize, 0, 64+2*BlockSize), err: true},
+		{name: "2img data in the header", image: twoIMG(16, BlockSize, 0, 64+BlockSize), err: true},
+	}
+	for _, tt := range tests {
+		offset, length, err := ImageData(bytes.NewReader(tt.image), int64(len(tt.image)))
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil || offset != tt.offset || length != tt.length {
+			t.Errorf("%s: got %d, %d, %v, want %d, %d", tt.name, offset, length, err, tt.offset, tt.length)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package prodos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// File types
+const (
+	TypeText      byte = 0x04 // TXT, aux type is the record length
+	TypeBinary    byte = 0x06 // BIN, aux type is the load address
+	TypeDirectory byte = 0x0F // DIR
+	TypeApple1    byte = 0xF1 // user type 1, which the CFFA1 firmware saves Apple 1 BASIC programs as
+	TypeInteger   byte = 0xFA // INT, Integer BASIC
+	TypeApplesoft byte = 0xFC // BAS, aux type is the load address
+	TypeSystem    byte = 0xFF // SYS, loaded at $2000
+)
+
+var typeNames = map[byte]string{
+	TypeText:      "TXT",
+	TypeBinary:    "BIN",
+	TypeDirectory: "DIR",
+	TypeInteger:   "INT",
+	TypeApplesoft: "BAS",
+	TypeSystem:    "SYS",
+}
+
+// TypeName returns the three letter name ProDOS gives a file type, or $XX for types without
+// one
+func TypeName(t byte) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("$%02X", t)
+}
+
+// ParseType parses a file type given by name, such as BIN, or as hex with an optional $ or 0x
+// prefix
+func ParseType(s string) (byte, error) {
+	upper := strings.ToUpper(s)
+	for t, name := range typeNames {
+		if name == upper {
+			return t, nil
+		}
+	}
+	hex := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "$"), "0x")
+	t, err := strconv.ParseUint(hex, 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("unknown file type %q, expected a name such as BIN or hex such as $06", s)
+	}
+	return byte(t), nil
+}
+
+// DefaultAux returns the aux type a file of type t gets when none is given: $0280, where
+// Apple 1 programs usually load, for BIN, $2000 for SYS and 0 for everything else
+func DefaultAux(t byte) uint16 {
+	switch t {
+	case TypeBinary:
+		return 0x0280
+	case TypeSystem:
+		return 0x2000
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+package profile
+
+import (
+	"sort"
+)
+
+// builtins are the profiles of stock machines, written as they would be in a profile file
+var builtins = map[string]string{
+	// The Apple 1 as shipped: 4KiB of RAM in the bottom of memory
+	"apple1-4k": `
+name = "apple1-4k"
+cpu = "6502"
+clock = 1_000_000
+memory = [
+  "ram $0000-$0FFF",
+  "pia $D000-$DFFF",
+  "rom $FF00-$FFFF wozmon",
+]
+`,
+
+	// The common 8KiB upgrade, with the second 4KiB at $E000 where Apple 1 BASIC is loaded.
+	// BASIC isn't included, so a profile of your own has to load it, as in the package example.
+	"apple1-8k-basic": `
+name = "apple1-8k-basic"
+cpu = "6502"
+clock = 1_000_000
+memory = [
+  "ram $0000-$0FFF",
+  "pia $D000-$DFFF",
+  "ram $E000-$EFFF",
+  "rom $FF00-$FFFF wozmon",
+]
+`,
+
+	// Briel Computers' Replica 1: a 65C02 with 32KiB of RAM. Its $E000-$FFFF ROM isn't
+	// included, so $E000 is RAM for loading BASIC and only the Woz Monitor is mapped.
+	"replica1": `
+name = "replica1"
+cpu = "65c02"
+clock = 1_000_000
+memory = [
+  "ram $0000-$7FFF",
+  "pia $D000-$DFFF",
+  "ram $E000-$EFFF",
+  "rom $FF00-$FFFF wozmon",
+]
+`,
+}
+
+// Builtin returns the built-in profile called name
+func Builtin(name string) (*Profile, bool) {
+	text, ok := builtins[name]
+	if !ok {
+		return nil, false
+	}
+	p, err := parse([]byte(text))
+	if err != nil {
+		panic("profile: invalid built-in profile " + name + ": " + err.Error())
+	}
+	return p, true
+}
+
+// Names returns the names of the built-in profiles in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,218 @@
+// Package profile describes whole machines in a file so they can be reproduced without a
+// dozen flags: the cpu, clock speed, memory map, ROM and RAM images, expansion cards and
+// frontend options. Profiles are TOML or JSON, and a few stock machines are built in.
+//
+//	name = "apple1-8k-basic"
+//	cpu = "6502"
+//	clock = 1_000_000
+//	memory = [
+//	  "ram $0000-$0FFF",
+//	  "pia $D000-$DFFF",
+//	  "ram $E000-$EFFF",
+//	  "rom $FF00-$FFFF wozmon",
+//	]
+//
+//	[[load]]
+//	file = "basic.bin"
+//	addr = "$E000"
+//
+//	[[card]]
+//	name = "ram"
+//	start = "$2000"
+//	end = "$7FFF"
+//
+//	[frontend]
+//	headless = false
+//	telnet = "127.0.0.1:6502"
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bradford-hamilton/apple-1/internal/card"
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// Profile describes a machine
+type Profile struct {
+	Name     string                   `json:"name"`     // shown in errors, the file name if empty
+	CPU      string                   `json:"cpu"`      // "6502" or "65c02", 6502 if empty
+	Clock    *int                     `json:"clock"`    // clock speed in Hz, 0 for unthrottled
+	Memory   []string                 `json:"memory"`   // memory map regions, e.g. "ram $0000-$0FFF"
+	Load     []Image                  `json:"load"`     // images loaded into memory
+	Cards    []map[string]interface{} `json:"card"`     // expansion cards, each with a name and its options
+	Frontend Frontend                 `json:"frontend"` // how the machine is presented
+
+	dir string // where files named in the profile are found
+}
+
+// Image is a file loaded into memory when the machine is built, such as a BASIC interpreter
+// loaded into RAM
+type Image struct {
+	File string `json:"file"`
+	Addr string `json:"addr"`
+}
+
+// Frontend holds the options of `appleone run` a profile can set. Flags given on the command
+// line take precedence.
+type Frontend struct {
+	Headless bool   `json:"headless"` // run without a terminal
+	Telnet   string `json:"telnet"`   // address to serve a telnet console on
+	Binmon   string `json:"binmon"`   // address to serve a VICE binary monitor on
+}
+
+// Load reads the profile at path, which is JSON if it ends in .json and TOML otherwise
+func Load(path string) (*Profile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p *Profile
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		p, err = decode(data)
+	} else {
+		p, err = parse(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	p.dir = filepath.Dir(path)
+	if p.Name == "" {
+		p.Name = path
+	}
+	return p, nil
+}
+
+// Find returns the built-in profile called name, or loads it as a file if there isn't one
+func Find(name string) (*Profile, error) {
+	if p, ok := Builtin(name); ok {
+		return p, nil
+	}
+	if _, err := os.Stat(name); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no profile file %s or built-in profile of that name, the built-in profiles are %s", name, strings.Join(Names(), ", "))
+	}
+	return Load(name)
+}
+
+// parse decodes a TOML profile
+func parse(data []byte) (*Profile, error) {
+	doc, err := parseTOML(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	// The TOML document has the same shape as a JSON one, so it's decoded the same way
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return decode(js)
+}
+
+// decode decodes a JSON profile, rejecting unknown keys so typos don't go unnoticed
+func decode(data []byte) (*Profile, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var p Profile
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Apply configures machine as the profile describes. Frontend options are left to the caller.
+func (p *Profile) Apply(machine *vm.VM) error {
+	switch strings.ToLower(p.CPU) {
+	case "", "6502":
+		machine.SetVariant(vm.NMOS6502)
+	case "65c02":
+		machine.SetVariant(vm.CMOS65C02)
+	default:
+		return fmt.Errorf("profile %s: unknown cpu %q, expected 6502 or 65c02", p.Name, p.CPU)
+	}
+	if p.Clock != nil {
+		if *p.Clock < 0 {
+			return fmt.Errorf("profile %s: negative clock speed %d", p.Name, *p.Clock)
+		}
+		machine.SetClockSpeed(*p.Clock)
+	}
+
+	if len(p.Memory) > 0 {
+		var m vm.MemoryMap
+		for _, spec := range p.Memory {
+			r, err := vm.ParseRegion(spec, p.dir)
+			if err != nil {
+				return fmt.Errorf("profile %s: memory: %v", p.Name, err)
+			}
+			m = append(m, r)
+		}
+		if err := machine.SetMemoryMap(m); err != nil {
+			return fmt.Errorf("profile %s: memory: %v", p.Name, err)
+		}
+	}
+
+	for _, img := range p.Load {
+		addr, err := parseAddr(img.Addr)
+		if err != nil {
+			return fmt.Errorf("profile %s: load %s: %v", p.Name, img.File, err)
+		}
+		path := img.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(p.dir, path)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("profile %s: %v", p.Name, err)
+		}
+		machine.Load(addr, data)
+	}
+
+	for _, c := range p.Cards {
+		if err := p.insertCard(machine, c); err != nil {
+			return fmt.Errorf("profile %s: %v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// insertCard creates a card from a profile's card table, whose name key picks the card and
+// whose other keys are its options, and plugs it into machine
+func (p *Profile) insertCard(machine *vm.VM, table map[string]interface{}) error {
+	name, ok := table["name"].(string)
+	if !ok {
+		return errors.New("card without a name")
+	}
+	opts := make(map[string]interface{})
+	for key, v := range table {
+		if key == "name" {
+			continue
+		}
+		opts[key] = v
+		// Files named by cards are relative to the profile
+		if s, ok := v.(string); ok && (key == "image" || key == "dir" || key == "file") && !filepath.IsAbs(s) {
+			opts[key] = filepath.Join(p.dir, s)
+		}
+	}
+	c, err := card.New(name, opts)
+	if err != nil {
+		return err
+	}
+	return machine.InsertCard(c)
+}
+
+// parseAddr parses a 16-bit hex address with an optional $ or 0x prefix
+func parseAddr(s string) (uint16, error) {
+	hex := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "$"), "0x")
+	addr, err := strconv.ParseUint(hex, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q, expected hex such as $E000", s)
+	}
+	return uint16(addr), nil
+}
@@ -0,0 +1,101 @@
+package profile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+func TestBuiltins(t *testing.T) {
+	if names := Names(); !reflect.DeepEqual(names, []string{"apple1-4k", "apple1-8k-basic", "replica1"}) {
+		t.Errorf("built-in profiles are %v", names)
+	}
+	for _, name := range Names() {
+		p, ok := Builtin(name)
+		if !ok || p.Name != name {
+			t.Fatalf("built-in profile %s not found", name)
+		}
+		if err := p.Apply(vm.New()); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// write writes a profile file and returns its path
+func write(t *testing.T, dir, name, text string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write(t, dir, "prog.bin", "\xA9\x42")
+
+	path := write(t, dir, "machine.toml", `
+cpu = "65c02"
+clock = 0
+memory = ["ram $0000-$0FFF", "pia $D000-$DFFF", "rom $FF00-$FFFF wozmon"]
+
+[[load]]
+file = "prog.bin"   # relative to the profile
+addr = "$0300"
+
+[[card]]
+name = "ram"
+start = "$2000"
+end = "$2FFF"
+`)
+	p, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := vm.New()
+	if err := p.Apply(machine); err != nil {
+		t.Fatal(err)
+	}
+	if machine.Peek(0x0300) != 0xA9 || machine.Peek(0x0301) != 0x42 {
+		t.Error("prog.bin wasn't loaded at $0300")
+	}
+	machine.Write(0x3000, 0x66)
+	machine.Write(0x2000, 0x55)
+	if machine.Peek(0x2000) != 0x55 || machine.Peek(0x3000) == 0x66 {
+		t.Error("expected the ram card's RAM at $2000-$2FFF only")
+	}
+}
+
+func TestApplyRefusesNumericAddresses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	profiles := map[string]string{
+		"hex.toml":     "[[card]]\nname = \"ram\"\nstart = 0x2000",
+		"decimal.toml": "[[card]]\nname = \"ram\"\nstart = 8192",
+		"machine.json": `{"card": [{"name": "ram", "start": 8192}]}`,
+	}
+	for name, text := range profiles {
+		p, err := Load(write(t, dir, name, text))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		err = p.Apply(vm.New())
+		if err == nil || !strings.Contains(err.Error(), `invalid start address 8192, expected a hex string such as "$C000"`) {
+			t.Errorf("%s: got error %v, want the number refused", name, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package profile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the subset of TOML profiles need: tables, arrays of tables, and keys whose
+// values are strings, integers, booleans or arrays of those, which may span several lines.
+// Values are returned as string, int64, bool, []interface{} and map[string]interface{}.
+func parseTOML(r io.Reader) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	table := root
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "[["):
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "[["), "]]"))
+			if !strings.HasSuffix(line, "]]") || !validKey(name) {
+				return nil, fmt.Errorf("line %d: malformed array of tables %q", n, line)
+			}
+			array, ok := root[name].([]interface{})
+			if _, exists := root[name]; exists && !ok {
+				return nil, fmt.Errorf("line %d: %s is already defined", n, name)
+			}
+			table = make(map[string]interface{})
+			root[name] = append(array, table)
+			continue
+		case strings.HasPrefix(line, "["):
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
+			if !strings.HasSuffix(line, "]") || !validKey(name) {
+				return nil, fmt.Errorf("line %d: malformed table %q", n, line)
+			}
+			if _, exists := root[name]; exists {
+				return nil, fmt.Errorf("line %d: %s is already defined", n, name)
+			}
+			table = make(map[string]interface{})
+			root[name] = table
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", n, line)
+		}
+		key := strings.TrimSpace(line[:eq])
+		if !validKey(key) {
+			return nil, fmt.Errorf("line %d: invalid key %q", n, key)
+		}
+		if _, exists := table[key]; exists {
+			return nil, fmt.Errorf("line %d: %s is already defined", n, key)
+		}
+
+		// Arrays may continue over the following lines until their brackets balance
+		text := strings.TrimSpace(line[eq+1:])
+		start := n
+		for depth(text) > 0 && scanner.Scan() {
+			n++
+			text += " " + strings.TrimSpace(stripComment(scanner.Text()))
+		}
+		p := &valueParser{s: text}
+		v, err := p.value()
+		if err == nil && strings.TrimSpace(p.s[p.pos:]) != "" {
+			err = fmt.Errorf("unexpected %q after value", strings.TrimSpace(p.s[p.pos:]))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", start, key, err)
+		}
+		table[key] = v
+	}
+	return root, scanner.Err()
+}
+
+// validKey reports whether s is a bare TOML key
+func validKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// stripComment removes a # comment that isn't inside a string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// depth returns how many arrays are still open at the end of s
+func depth(s string) int {
+	d := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '[':
+			d++
+		case quote == 0 && c == ']':
+			d--
+		}
+	}
+	return d
+}
+
+// valueParser parses a single TOML value
+type valueParser struct {
+	s   string
+	pos int
+}
+
+func (p *valueParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *valueParser) value() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return nil, fmt.Errorf("missing value")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '"':
+		return p.basicString()
+	case c == '\'':
+		end := strings.IndexByte(p.s[p.pos+1:], '\'')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		v := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return v, nil
+	case c == '[':
+		return p.array()
+	default:
+		return p.scalar()
+	}
+}
+
+func (p *valueParser) basicString() (string, error) {
+	for i := p.pos + 1; i < len(p.s); i++ {
+		switch p.s[i] {
+		case '\\':
+			i++
+		case '"':
+			v, err := strconv.Unquote(p.s[p.pos : i+1])
+			if err != nil {
+				return "", fmt.Errorf("invalid string %s", p.s[p.pos:i+1])
+			}
+			p.pos = i + 1
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+func (p *valueParser) array() ([]interface{}, error) {
+	p.pos++ // [
+	values := []interface{}{}
+	for {
+		p.skipSpace()
+		if p.pos < len(p.s) && p.s[p.pos] == ']' {
+			p.pos++
+			return values, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+
+		p.skipSpace()
+		switch {
+		case p.pos >= len(p.s):
+			return nil, fmt.Errorf("unterminated array")
+		case p.s[p.pos] == ',':
+			p.pos++
+		case p.s[p.pos] != ']':
+			return nil, fmt.Errorf("expected , or ] in array, got %q", p.s[p.pos:])
+		}
+	}
+}
+
+// scalar parses a boolean or an integer, which may be hex with 0x and use _ between digits
+func (p *valueParser) scalar() (interface{}, error) {
+	end := p.pos
+	for end < len(p.s) && !strings.ContainsRune(" \t,]", rune(p.s[end])) {
+		end++
+	}
+	word := p.s[p.pos:end]
+	p.pos = end
+
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	v, err := strconv.ParseInt(strings.Replace(word, "_", "", -1), 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported value %q, expected a string, integer, boolean or array", word)
+	}
+	return v, nil
+}
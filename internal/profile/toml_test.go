@@ -0,0 +1,116 @@
+package profile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]interface{}
+	}{
+		{
+			"strings",
+			`a = "tab\there \"quoted\" \u00e9"
+b = 'C:\raw # not a comment'
+c = "# not a comment either" # but this is`,
+			map[string]interface{}{
+				"a": "tab\there \"quoted\" é",
+				"b": `C:\raw # not a comment`,
+				"c": "# not a comment either",
+			},
+		},
+		{
+			"integers",
+			"clock = 1_000_000\nhex = 0xE000\nneg = -5\nzero = 0",
+			map[string]interface{}{"clock": int64(1000000), "hex": int64(0xE000), "neg": int64(-5), "zero": int64(0)},
+		},
+		{
+			"booleans",
+			"yes = true\nno = false",
+			map[string]interface{}{"yes": true, "no": false},
+		},
+		{
+			"arrays",
+			`empty = []
+nested = [[1, 2], ["a"]]
+memory = [
+  "ram $0000-$0FFF",  # comments inside
+  "rom $FF00-$FFFF wozmon",
+]`,
+			map[string]interface{}{
+				"empty":  []interface{}{},
+				"nested": []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{"a"}},
+				"memory": []interface{}{"ram $0000-$0FFF", "rom $FF00-$FFFF wozmon"},
+			},
+		},
+		{
+			"tables",
+			`name = "top"
+[frontend]
+telnet = "127.0.0.1:6502"
+
+[[card]]
+name = "ram"
+start = "$2000"
+
+[[card]]
+name = "cffa1"`,
+			map[string]interface{}{
+				"name":     "top",
+				"frontend": map[string]interface{}{"telnet": "127.0.0.1:6502"},
+				"card": []interface{}{
+					map[string]interface{}{"name": "ram", "start": "$2000"},
+					map[string]interface{}{"name": "cffa1"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(strings.NewReader(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"a = 1\nnonsense", `line 2: expected key = value, got "nonsense"`},
+		{"a = 1\na = 2", "line 2: a is already defined"},
+		{"bad key = 1", `line 1: invalid key "bad key"`},
+		{"a =", "line 1: a: missing value"},
+		{`a = "open`, "line 1: a: unterminated string"},
+		{`a = 'open`, "line 1: a: unterminated string"},
+		{`a = "\q"`, `line 1: a: invalid string "\q"`},
+		{"a = 1.5", `line 1: a: unsupported value "1.5"`},
+		{"a = 1 2", `line 1: a: unexpected "2" after value`},
+		{"\n\na = [\n  1,\n  2", "line 3: a: unterminated array"},
+		{"a = [1 2]", "line 1: a: expected , or ] in array"},
+		{"[frontend", `line 1: malformed table "[frontend"`},
+		{"[[card]", `line 1: malformed array of tables "[[card]"`},
+		{"[frontend]\n[frontend]", "line 2: frontend is already defined"},
+		{"card = 1\n[[card]]", "line 2: card is already defined"},
+	}
+	for _, tt := range tests {
+		_, err := parseTOML(strings.NewReader(tt.src))
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.src, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Package script runs expect-style conversations with a program on the Apple 1: typing on its
+// keyboard, waiting for it to print prompts and checking what ends up on the screen.
+//
+//	# comments run to the end of the line
+//	type "E000R\r"                # start Integer BASIC from the Woz Monitor
+//	wait ">" 2000000              # wait for its prompt, at most 2,000,000 cycles
+//	type "10 PRINT 1\rRUN\r"
+//	wait-cycles 50000             # let the program run for 50,000 cycles
+//	snapshot out.txt              # write the screen to out.txt
+//	assert-screen line 5 "1"      # fail unless the fifth row contains 1
+//
+// Strings are double quoted and take Go escapes such as \r and \x8D. Typed characters are fed
+// to the keyboard one at a time, each waiting for the program to read the last. `wait` only
+// matches output printed since the previous `wait` matched.
+package script
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+const (
+	// DefaultWaitCycles is how long `wait` gives the program to print its text when the script
+	// doesn't say, 10 seconds at the Apple 1's clock speed
+	DefaultWaitCycles = 10000000
+
+	// keyCycles is how long a program has to read each typed key
+	keyCycles = 1000000
+
+	// quantum is how many cycles run between checks of the condition being waited on
+	quantum = 100
+)
+
+// Script is a parsed interaction script
+type Script struct {
+	name     string
+	commands []command
+}
+
+// command is one line of a script
+type command struct {
+	line   int    // line number in the script, for error messages
+	op     string // the command name, e.g. wait
+	text   string // the string argument, or the path for snapshot
+	number uint64 // cycles for wait and wait-cycles, the row for assert-screen
+}
+
+// Load reads and parses the script at path
+func Load(path string) (*Script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(path, f)
+}
+
+// Parse parses a script from r, using name in error messages
+func Parse(name string, r io.Reader) (*Script, error) {
+	s := &Script{name: name}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		args, err := split(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		cmd, err := parseCommand(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		cmd.line = line
+		s.commands = append(s.commands, cmd)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// arg is a word or quoted string on a script line
+type arg struct {
+	text   string
+	quoted bool
+}
+
+// split breaks a line into words and quoted strings, dropping any comment
+func split(line string) ([]arg, error) {
+	var args []arg
+	for {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" || line[0] == '#' {
+			return args, nil
+		}
+		if line[0] != '"' {
+			end := strings.IndexFunc(line, unicode.IsSpace)
+			if end < 0 {
+				end = len(line)
+			}
+			args = append(args, arg{text: line[:end]})
+			line = line[end:]
+			continue
+		}
+
+		end := 1
+		for ; end < len(line) && line[end] != '"'; end++ {
+			if line[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(line) {
+			return nil, errors.New("unterminated string")
+		}
+		text, err := strconv.Unquote(line[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", line[:end+1])
+		}
+		args = append(args, arg{text: text, quoted: true})
+		line = line[end+1:]
+	}
+}
+
+func parseCommand(args []arg) (command, error) {
+	cmd := command{op: args[0].text}
+	switch cmd.op {
+	case "type":
+		if len(args) != 2 || !args[1].quoted {
+			return cmd, errors.New(`usage: type "text"`)
+		}
+		cmd.text = args[1].text
+	case "wait":
+		if len(args) < 2 || len(args) > 3 || !args[1].quoted {
+			return cmd, errors.New(`usage: wait "text" [cycles]`)
+		}
+		cmd.text = args[1].text
+		cmd.number = DefaultWaitCycles
+		if len(args) == 3 {
+			n, err := strconv.ParseUint(args[2].text, 10, 64)
+			if err != nil {
+				return cmd, fmt.Errorf("invalid cycle count %q", args[2].text)
+			}
+			cmd.number = n
+		}
+	case "wait-cycles":
+		if len(args) != 2 {
+			return cmd, errors.New("usage: wait-cycles cycles")
+		}
+		n, err := strconv.ParseUint(args[1].text, 10, 64)
+		if err != nil {
+			return cmd, fmt.Errorf("invalid cycle count %q", args[1].text)
+		}
+		cmd.number = n
+	case "snapshot":
+		if len(args) != 2 {
+			return cmd, errors.New("usage: snapshot path")
+		}
+		cmd.text = args[1].text
+	case "assert-screen":
+		if len(args) != 4 || args[1].text != "line" || !args[3].quoted {
+			return cmd, errors.New(`usage: assert-screen line row "text"`)
+		}
+		row, err := strconv.Atoi(args[2].text)
+		if err != nil || row < 1 || row > vm.ScreenHeight {
+			return cmd, fmt.Errorf("invalid row %q, rows are numbered 1 to %d", args[2].text, vm.ScreenHeight)
+		}
+		cmd.number = uint64(row)
+		cmd.text = args[3].text
+	default:
+		return cmd, fmt.Errorf("unknown command %q", cmd.op)
+	}
+	return cmd, nil
+}
+
+// runner holds the state of a script being run against a vm
+type runner struct {
+	ctx    context.Context
+	vm     *vm.VM
+	output []byte // everything printed to the display so far
+	seen   int    // how much of output earlier waits have consumed
+}
+
+func (r *runner) Write(p []byte) (int, error) {
+	r.output = append(r.output, p...)
+	return len(p), nil
+}
+
+// Run executes the script against machine, copying the display to out if it isn't nil. It
+// returns an error naming the failing line if a command can't be satisfied, wrapping any
+// error from the vm itself such as a *vm.Fault, or a *vm.Halt when a breakpoint or
+// watchpoint stops the machine.
+func (s *Script) Run(ctx context.Context, machine *vm.VM, out io.Writer) error {
+	r := &runner{ctx: ctx, vm: machine}
+	if out != nil {
+		machine.SetDisplay(io.MultiWriter(out, r))
+	} else {
+		machine.SetDisplay(r)
+	}
+
+	for _, cmd := range s.commands {
+		if err := r.exec(cmd); err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", s.name, cmd.line, cmd.op, err)
+		}
+	}
+	return nil
+}
+
+func (r *runner) exec(cmd command) error {
+	switch cmd.op {
+	case "type":
+		for i := 0; i < len(cmd.text); i++ {
+			r.vm.KeyPress(cmd.text[i])
+			read, err := r.runUntil(keyCycles, func() bool { return r.vm.KeysPending() == 0 })
+			if err != nil {
+				return err
+			}
+			if !read {
+				return fmt.Errorf("the program stopped reading the keyboard at %q", cmd.text[i:])
+			}
+		}
+	case "wait":
+		found, err := r.runUntil(cmd.number, func() bool {
+			i := bytes.Index(r.output[r.seen:], []byte(cmd.text))
+			if i < 0 {
+				return false
+			}
+			r.seen += i + len(cmd.text)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%q didn't appear within %d cycles", cmd.text, cmd.number)
+		}
+	case "wait-cycles":
+		if _, err := r.runUntil(cmd.number, func() bool { return false }); err != nil {
+			return err
+		}
+	case "snapshot":
+		return ioutil.WriteFile(cmd.text, []byte(r.vm.ScreenText()), 0644)
+	case "assert-screen":
+		line := r.vm.ScreenLines()[cmd.number-1]
+		if !strings.Contains(line, cmd.text) {
+			return fmt.Errorf("line %d is %q, expected it to contain %q", cmd.number, line, cmd.text)
+		}
+	}
+	return nil
+}
+
+// runUntil runs the vm until done reports true, returning true, or for the given number of
+// cycles, returning false
+func (r *runner) runUntil(cycles uint64, done func() bool) (bool, error) {
+	for start := r.vm.Cycles(); r.vm.Cycles()-start < cycles; {
+		if done() {
+			return true, nil
+		}
+		if err := r.ctx.Err(); err != nil {
+			return false, err
+		}
+		if _, err := r.vm.RunCycles(quantum); err != nil {
+			return false, err
+		}
+	}
+	return done(), nil
+}
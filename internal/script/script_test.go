@@ -0,0 +1,162 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+func TestParse(t *testing.T) {
+	src := `# start Integer BASIC
+type "E000R\r"   # from the Woz Monitor
+wait ">" 2000000
+wait "READY"
+
+type "\x8D\"q\""
+wait-cycles 50000
+snapshot out.txt
+assert-screen line 5 "1 # not a comment"
+`
+	s, err := Parse("test.script", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []command{
+		{line: 2, op: "type", text: "E000R\r"},
+		{line: 3, op: "wait", text: ">", number: 2000000},
+		{line: 4, op: "wait", text: "READY", number: DefaultWaitCycles},
+		{line: 6, op: "type", text: "\x8D\"q\""},
+		{line: 7, op: "wait-cycles", number: 50000},
+		{line: 8, op: "snapshot", text: "out.txt"},
+		{line: 9, op: "assert-screen", text: "1 # not a comment", number: 5},
+	}
+	if !reflect.DeepEqual(s.commands, want) {
+		t.Errorf("parsed\n%+v\nwant\n%+v", s.commands, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{`type E000R`, `usage: type "text"`},
+		{`type "a" "b"`, `usage: type "text"`},
+		{`type "abc`, "unterminated string"},
+		{`type "\q"`, `invalid string "\q"`},
+		{`wait`, `usage: wait "text" [cycles]`},
+		{`wait ">" soon`, `invalid cycle count "soon"`},
+		{`wait-cycles -1`, `invalid cycle count "-1"`},
+		{`snapshot`, "usage: snapshot path"},
+		{`assert-screen 5 "x"`, `usage: assert-screen line row "text"`},
+		{`assert-screen line 25 "x"`, `invalid row "25", rows are numbered 1 to 24`},
+		{`assert-screen line 0 "x"`, `invalid row "0"`},
+		{`press "x"`, `unknown command "press"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse("test.script", strings.NewReader("\n"+tt.line))
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.line)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "test.script:2: ") || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %q, want test.script:2: %s", tt.line, err, tt.want)
+		}
+	}
+}
+
+// run runs src against a stock machine that has just reset into the Woz Monitor
+func run(t *testing.T, src string, setup func(machine *vm.VM)) (*vm.VM, error) {
+	t.Helper()
+	s, err := Parse("test.script", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := vm.New()
+	machine.Reset()
+	if setup != nil {
+		setup(machine)
+	}
+	return machine, s.Run(context.Background(), machine, nil)
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, "screen.txt")
+	machine, err := run(t, `
+wait "\\"
+type "FF00.FF03\r"
+wait "FF00: D8 58 A0 7F" 100000
+assert-screen line 4 "FF00: D8"
+snapshot `+snapshot+`
+`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != machine.ScreenText() {
+		t.Errorf("snapshot is %q, want %q", got, machine.ScreenText())
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			"wait times out",
+			`wait "READY" 5000`,
+			`test.script:1: wait: "READY" didn't appear within 5000 cycles`,
+		},
+		{
+			// The prompt was consumed by the first wait, so it can't match again
+			"wait only matches new output",
+			"wait \"\\\\\"\nwait \"\\\\\" 5000",
+			`test.script:2: wait: "\\" didn't appear within 5000 cycles`,
+		},
+		{
+			"assert-screen",
+			"wait \"\\\\\"\nassert-screen line 1 \"BASIC\"",
+			`test.script:2: assert-screen: line 1 is "\\", expected it to contain "BASIC"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := run(t, tt.src, nil)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunHonoursBreakpoints(t *testing.T) {
+	machine, err := run(t, `type "FF00R\r"`, func(machine *vm.VM) {
+		if err := machine.AddPCBreakpoint("ESCAPE"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var halt *vm.Halt
+	if !errors.As(err, &halt) {
+		t.Fatalf("got error %v, want a breakpoint halt", err)
+	}
+	if pc := machine.Registers().PC; pc != 0xFF1A {
+		t.Errorf("halted at $%04X, want ESCAPE ($FF1A)", pc)
+	}
+}
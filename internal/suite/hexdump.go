@@ -0,0 +1,95 @@
+package suite
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Segment is a run of bytes at an address
+type Segment struct {
+	Addr uint16
+	Data []byte
+}
+
+// hexDump is a program, or the memory a program is expected to leave behind, written the way
+// the Woz Monitor takes it:
+//
+//	0280: A9 8D 20 EF FF  # bytes from $0280
+//	: A9 C8 20 EF FF      # bytes continuing where the last line left off
+//	0280R                 # where the program starts
+//
+// Addresses may have a $ prefix, and # or ; starts a comment.
+type hexDump struct {
+	segments []Segment
+	start    uint16
+	hasStart bool
+}
+
+// parseHexDump reads a hex dump from r. name is used in error messages.
+func parseHexDump(r io.Reader, name string) (*hexDump, error) {
+	d := &hexDump{}
+	next, started := 0, false
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			if run := strings.TrimSuffix(strings.ToUpper(line), "R"); run != strings.ToUpper(line) {
+				addr, err := parseHex(run, 16)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: invalid start address %q", name, n, line)
+				}
+				d.start, d.hasStart = uint16(addr), true
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: expected ADDR: BYTES or ADDRR, got %q", name, n, line)
+		}
+
+		if addrText := strings.TrimSpace(line[:colon]); addrText != "" {
+			addr, err := parseHex(addrText, 16)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid address %q", name, n, addrText)
+			}
+			next, started = int(addr), true
+			d.segments = append(d.segments, Segment{Addr: uint16(addr)})
+		} else if !started {
+			return nil, fmt.Errorf("%s:%d: bytes before any address", name, n)
+		}
+
+		seg := &d.segments[len(d.segments)-1]
+		for _, field := range strings.Fields(line[colon+1:]) {
+			b, err := parseHex(field, 8)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid byte %q", name, n, field)
+			}
+			if next > 0xFFFF {
+				return nil, fmt.Errorf("%s:%d: bytes run past $FFFF", name, n)
+			}
+			seg.Data = append(seg.Data, byte(b))
+			next++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !d.hasStart && len(d.segments) > 0 {
+		d.start = d.segments[0].Addr
+	}
+	return d, nil
+}
+
+// parseHex parses a hex number with an optional $ or 0x prefix
+func parseHex(s string, bits int) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "$"), "0x"), 16, bits)
+}
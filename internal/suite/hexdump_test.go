@@ -0,0 +1,71 @@
+package suite
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHexDump(t *testing.T) {
+	in := `# a comment on its own
+0280: A9 8D 20 EF FF  ; bytes from $0280
+: a9 c8               # continuing where the last line left off
+$0300: 00
+:01 02
+0x0290R
+`
+	d, err := parseHexDump(strings.NewReader(in), "test.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Segment{
+		{Addr: 0x0280, Data: []byte{0xA9, 0x8D, 0x20, 0xEF, 0xFF, 0xA9, 0xC8}},
+		{Addr: 0x0300, Data: []byte{0x00, 0x01, 0x02}},
+	}
+	if !reflect.DeepEqual(d.segments, want) {
+		t.Errorf("got segments %v, want %v", d.segments, want)
+	}
+	if !d.hasStart || d.start != 0x0290 {
+		t.Errorf("start $%04X, %t, want $0290", d.start, d.hasStart)
+	}
+
+	// Without an ADDRR line the program starts at its first byte
+	d, err = parseHexDump(strings.NewReader("0400: EA\n0200: EA\n"), "test.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.hasStart || d.start != 0x0400 {
+		t.Errorf("start $%04X, %t, want $0400 by default", d.start, d.hasStart)
+	}
+
+	// Bytes can reach $FFFF but not go past it
+	d, err = parseHexDump(strings.NewReader("FFFE: 00 FF\n"), "test.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d.segments[0].Data, []byte{0x00, 0xFF}) {
+		t.Errorf("got %v at $FFFE, want 00 FF", d.segments[0].Data)
+	}
+}
+
+func TestParseHexDumpErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{": 00", "test.hex:1: bytes before any address"},
+		{"0280 A9", `test.hex:1: expected ADDR: BYTES or ADDRR, got "0280 A9"`},
+		{"XYZR", `test.hex:1: invalid start address "XYZR"`},
+		{"\n10000: 00", `test.hex:2: invalid address "10000"`},
+		{"0280: A9 100", `test.hex:1: invalid byte "100"`},
+		{"0280: G1", `test.hex:1: invalid byte "G1"`},
+		{"FFFF: 00\n: 01", "test.hex:2: bytes run past $FFFF"},
+	}
+	for _, tt := range tests {
+		_, err := parseHexDump(strings.NewReader(tt.in), "test.hex")
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got error %v, want %s", tt.in, err, tt.want)
+		}
+	}
+}
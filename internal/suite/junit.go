@@ -0,0 +1,82 @@
+package suite
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// JUnit XML elements, as read by CI servers
+type (
+	junitSuites struct {
+		XMLName xml.Name     `xml:"testsuites"`
+		Suites  []junitSuite `xml:"testsuite"`
+	}
+
+	junitSuite struct {
+		Name      string      `xml:"name,attr"`
+		Tests     int         `xml:"tests,attr"`
+		Failures  int         `xml:"failures,attr"`
+		Errors    int         `xml:"errors,attr"`
+		Time      string      `xml:"time,attr"`
+		Timestamp string      `xml:"timestamp,attr"`
+		Cases     []junitCase `xml:"testcase"`
+	}
+
+	junitCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+		Error     *junitFailure `xml:"error,omitempty"`
+		SystemOut string        `xml:"system-out,omitempty"`
+	}
+
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// WriteJUnit writes results as a JUnit XML test suite called name, which started at started
+func WriteJUnit(w io.Writer, name string, started time.Time, results []Result) error {
+	suite := junitSuite{Name: name, Tests: len(results), Timestamp: started.Format("2006-01-02T15:04:05")}
+	var total time.Duration
+	for _, r := range results {
+		total += r.Duration
+		c := junitCase{
+			Name:      r.Test.Name,
+			Classname: name,
+			Time:      seconds(r.Duration),
+			SystemOut: r.Output,
+		}
+		failure := &junitFailure{Message: r.Reason, Text: fmt.Sprintf("%s after %d cycles", r.Reason, r.Cycles)}
+		switch {
+		case r.Error:
+			suite.Errors++
+			c.Error = failure
+		case !r.Passed:
+			suite.Failures++
+			c.Failure = failure
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// seconds formats d as JUnit times are, in seconds
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,54 @@
+package suite
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	results := []Result{
+		{Test: &Test{Name: "pass"}, Passed: true, Cycles: 100, Duration: 1500 * time.Millisecond, Output: "HELLO"},
+		{Test: &Test{Name: "fail"}, Reason: "exited with code 3", Cycles: 200, Duration: 250 * time.Millisecond},
+		{Test: &Test{Name: "error"}, Error: true, Reason: "unknown opcode", Cycles: 5},
+	}
+	started := time.Date(2020, 5, 17, 12, 30, 0, 0, time.UTC)
+	var out bytes.Buffer
+	if err := WriteJUnit(&out, "suite", started, results); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), xml.Header) {
+		t.Errorf("output doesn't start with the XML header:\n%s", out.String())
+	}
+
+	var got junitSuites
+	if err := xml.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Suites) != 1 {
+		t.Fatalf("got %d suites, want 1", len(got.Suites))
+	}
+	s := got.Suites[0]
+	if s.Name != "suite" || s.Tests != 3 || s.Failures != 1 || s.Errors != 1 {
+		t.Errorf("suite %s has %d tests, %d failures, %d errors, want suite, 3, 1, 1", s.Name, s.Tests, s.Failures, s.Errors)
+	}
+	if s.Time != "1.750" || s.Timestamp != "2020-05-17T12:30:00" {
+		t.Errorf("suite time %s at %s, want 1.750 at 2020-05-17T12:30:00", s.Time, s.Timestamp)
+	}
+	if len(s.Cases) != 3 {
+		t.Fatalf("got %d cases, want 3", len(s.Cases))
+	}
+
+	pass, fail, errored := s.Cases[0], s.Cases[1], s.Cases[2]
+	if pass.Name != "pass" || pass.Classname != "suite" || pass.Time != "1.500" || pass.Failure != nil || pass.Error != nil || pass.SystemOut != "HELLO" {
+		t.Errorf("passing case %+v", pass)
+	}
+	if fail.Failure == nil || fail.Error != nil || fail.Failure.Message != "exited with code 3" || fail.Failure.Text != "exited with code 3 after 200 cycles" {
+		t.Errorf("failing case %+v, failure %+v", fail, fail.Failure)
+	}
+	if errored.Error == nil || errored.Failure != nil || errored.Error.Message != "unknown opcode" {
+		t.Errorf("errored case %+v, error %+v", errored, errored.Error)
+	}
+}
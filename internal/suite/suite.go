@@ -0,0 +1,253 @@
+// Package suite runs directories of 6502 test programs, deciding whether each passed from
+// where it stopped, the code it exited with through a debug port, and the memory it left
+// behind, and reports the results as text and JUnit XML.
+package suite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bradford-hamilton/apple-1/internal/card"
+	"github.com/bradford-hamilton/apple-1/internal/term"
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// Test file extensions
+const (
+	binaryExt    = ".bin" // a program loaded at Options.LoadAddr
+	hexDumpExt   = ".hex" // a Woz Monitor style hex dump
+	assertionExt = ".mem" // memory the test is expected to leave behind, as a hex dump
+)
+
+// maxMismatches is how many differing bytes a failure lists
+const maxMismatches = 8
+
+// Test is a test program
+type Test struct {
+	Name   string // path relative to the suite's directory, without the extension
+	Path   string
+	Memory []Segment // expected memory, from the assertion file
+
+	segments []Segment
+	start    uint16
+	binary   bool // loaded at Options.LoadAddr rather than its own addresses
+}
+
+// Options controls how tests are run
+type Options struct {
+	// Machine creates the machine each test runs on
+	Machine func() (*vm.VM, error)
+
+	LoadAddr  uint16 // where binaries are loaded and started
+	MaxCycles uint64 // cycle budget for each test
+	DebugPort uint16 // address of the debug port inserted for each test
+
+	// PassAddr and FailAddr end a test when execution reaches them, passing or failing it
+	PassAddr *uint16
+	FailAddr *uint16
+}
+
+// Result is the outcome of running a test
+type Result struct {
+	Test     *Test
+	Passed   bool
+	Error    bool   // the test couldn't run to a verdict, e.g. the cpu faulted
+	Reason   string // why the test didn't pass
+	Cycles   uint64
+	Duration time.Duration
+	Output   string // what the test printed on the display and debug console
+}
+
+// Load finds the tests in dir and its subdirectories: binaries (.bin) and hex dumps (.hex),
+// each with an optional assertion file (.mem) of the same name
+func Load(dir string) ([]*Test, error) {
+	var tests []*Test
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if info.IsDir() || ext != binaryExt && ext != hexDumpExt {
+			return nil
+		}
+		t, err := loadTest(dir, path)
+		if err != nil {
+			return err
+		}
+		tests = append(tests, t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(tests) == 0 {
+		return nil, fmt.Errorf("no %s or %s test programs in %s", binaryExt, hexDumpExt, dir)
+	}
+	return tests, nil
+}
+
+func loadTest(dir, path string) (*Test, error) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		rel = path
+	}
+	ext := filepath.Ext(path)
+	t := &Test{Name: filepath.ToSlash(strings.TrimSuffix(rel, ext)), Path: path}
+
+	if ext == binaryExt {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		t.segments, t.binary = []Segment{{Data: data}}, true
+	} else {
+		d, err := readHexDump(path)
+		if err != nil {
+			return nil, err
+		}
+		t.segments, t.start = d.segments, d.start
+	}
+
+	memPath := strings.TrimSuffix(path, ext) + assertionExt
+	if _, err := os.Stat(memPath); err == nil {
+		d, err := readHexDump(memPath)
+		if err != nil {
+			return nil, err
+		}
+		if d.hasStart {
+			return nil, fmt.Errorf("%s: assertion files can't have a start address", memPath)
+		}
+		t.Memory = d.segments
+	}
+	return t, nil
+}
+
+func readHexDump(path string) (*hexDump, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseHexDump(f, path)
+}
+
+// Run runs t on a new machine until it passes, fails or runs out of cycles. The test ends
+// when it exits through the debug port, passing with code 0, when it reaches the pass or fail
+// address, or when it traps in an instruction that jumps to itself. A trap anywhere but the
+// pass address fails if there is one, and otherwise ends the test for its memory to be
+// checked. A test that passes must also leave memory as its assertion file says.
+func (t *Test) Run(ctx context.Context, opts Options) Result {
+	start := time.Now()
+	res := t.run(ctx, opts)
+	res.Test, res.Duration = t, time.Since(start)
+	return res
+}
+
+func (t *Test) run(ctx context.Context, opts Options) Result {
+	machine, err := opts.Machine()
+	if err != nil {
+		return Result{Error: true, Reason: err.Error()}
+	}
+	var output bytes.Buffer
+	machine.SetDisplay(term.NewTextDisplay(&output))
+	port, err := card.NewDebugPort(opts.DebugPort, &output)
+	if err == nil {
+		err = machine.InsertCard(port)
+	}
+	if err != nil {
+		return Result{Error: true, Reason: err.Error()}
+	}
+
+	pc := t.start
+	for _, seg := range t.segments {
+		if t.binary {
+			seg.Addr, pc = opts.LoadAddr, opts.LoadAddr
+		}
+		machine.Load(seg.Addr, seg.Data)
+	}
+	regs := machine.Registers()
+	regs.PC = pc
+	machine.SetRegisters(regs)
+
+	res := Result{}
+	finish := func(reason string) Result {
+		res.Cycles = machine.Cycles()
+		res.Output = output.String()
+		res.Reason = reason
+		return res
+	}
+
+	for steps := 0; ; steps++ {
+		if steps%4096 == 0 && ctx.Err() != nil {
+			res.Error = true
+			return finish(ctx.Err().Error())
+		}
+
+		pc := machine.Registers().PC
+		_, err := machine.Step()
+		if exit, ok := err.(*vm.Exit); ok {
+			if exit.Code != 0 {
+				return finish(fmt.Sprintf("exited with code %d", exit.Code))
+			}
+			return t.check(machine, finish)
+		}
+		if err != nil {
+			res.Error = true
+			return finish(err.Error())
+		}
+
+		next := machine.Registers().PC
+		switch {
+		case opts.PassAddr != nil && next == *opts.PassAddr:
+			return t.check(machine, finish)
+		case opts.FailAddr != nil && next == *opts.FailAddr:
+			return finish(fmt.Sprintf("reached the fail address $%04X", next))
+		case next == pc:
+			if opts.PassAddr != nil {
+				return finish(fmt.Sprintf("trapped at $%04X", pc))
+			}
+			if t.Memory == nil {
+				return finish(fmt.Sprintf("trapped at $%04X with no pass address or %s file to say whether that passed", pc, assertionExt))
+			}
+			return t.check(machine, finish)
+		case machine.Cycles() >= opts.MaxCycles:
+			return finish(fmt.Sprintf("cycle budget of %d exhausted at $%04X", opts.MaxCycles, next))
+		}
+	}
+}
+
+// check compares memory with the test's assertion file, passing the test if it matches
+func (t *Test) check(machine *vm.VM, finish func(string) Result) Result {
+	var mismatches []string
+	count := 0
+	for _, seg := range t.Memory {
+		for i, want := range seg.Data {
+			addr := seg.Addr + uint16(i)
+			if got := machine.Peek(addr); got != want {
+				count++
+				if len(mismatches) < maxMismatches {
+					mismatches = append(mismatches, fmt.Sprintf("$%04X is $%02X, expected $%02X", addr, got, want))
+				}
+			}
+		}
+	}
+	if count > 0 {
+		reason := fmt.Sprintf("%d bytes of memory differ: %s", count, strings.Join(mismatches, ", "))
+		if count == 1 {
+			reason = "memory differs: " + mismatches[0]
+		}
+		if count > len(mismatches) {
+			reason += ", ..."
+		}
+		return finish(reason)
+	}
+	res := finish("")
+	res.Passed = true
+	return res
+}
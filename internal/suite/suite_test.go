@@ -0,0 +1,188 @@
+package suite
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// testOptions runs tests on a stock machine with the debug port at $C300
+func testOptions() Options {
+	return Options{
+		Machine:   func() (*vm.VM, error) { return vm.New(), nil },
+		LoadAddr:  0x0300,
+		MaxCycles: 1000,
+		DebugPort: 0xC300,
+	}
+}
+
+func addr(a uint16) *uint16 {
+	return &a
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte // loaded and started at $0300
+		memory  []Segment
+		pass    *uint16
+		fail    *uint16
+		passed  bool
+		reason  string
+		output  string
+	}{
+		{
+			name:    "exit 0",
+			program: []byte{0xA9, 'K', 0x8D, 0x00, 0xC3, 0xA9, 0x00, 0x8D, 0x01, 0xC3}, // print K and exit 0
+			passed:  true,
+			output:  "K",
+		},
+		{
+			name:    "exit 3",
+			program: []byte{0xA9, 0x03, 0x8D, 0x01, 0xC3},
+			reason:  "exited with code 3",
+		},
+		{
+			name:    "exit 0 with memory differing",
+			program: []byte{0xA9, 0x00, 0x8D, 0x01, 0xC3},
+			memory:  []Segment{{Addr: 0x0010, Data: []byte{0x01, 0x02}}},
+			reason:  "2 bytes of memory differ: $0010 is $00, expected $01, $0011 is $00, expected $02",
+		},
+		{
+			name:    "pass address",
+			program: []byte{0x4C, 0x00, 0x04}, // JMP $0400
+			pass:    addr(0x0400),
+			fail:    addr(0x0500),
+			passed:  true,
+		},
+		{
+			name:    "fail address",
+			program: []byte{0x4C, 0x00, 0x05}, // JMP $0500
+			pass:    addr(0x0400),
+			fail:    addr(0x0500),
+			reason:  "reached the fail address $0500",
+		},
+		{
+			name:    "trap with a pass address",
+			program: []byte{0x4C, 0x00, 0x03}, // JMP *
+			pass:    addr(0x0400),
+			reason:  "trapped at $0300",
+		},
+		{
+			name:    "trap with nothing to check",
+			program: []byte{0x4C, 0x00, 0x03},
+			reason:  "trapped at $0300 with no pass address or .mem file to say whether that passed",
+		},
+		{
+			name:    "trap with memory matching",
+			program: []byte{0xA9, 0x42, 0x85, 0x10, 0x4C, 0x04, 0x03}, // LDA #$42; STA $10; JMP *
+			memory:  []Segment{{Addr: 0x0010, Data: []byte{0x42}}},
+			passed:  true,
+		},
+		{
+			name:    "trap with memory differing",
+			program: []byte{0xA9, 0x42, 0x85, 0x10, 0x4C, 0x04, 0x03},
+			memory:  []Segment{{Addr: 0x0010, Data: []byte{0x43}}},
+			reason:  "memory differs: $0010 is $42, expected $43",
+		},
+		{
+			name:    "budget",
+			program: []byte{0xE8, 0x4C, 0x00, 0x03}, // INX; JMP $0300
+			reason:  "cycle budget of 1000 exhausted at $0300",
+		},
+	}
+	for _, tt := range tests {
+		test := &Test{Name: tt.name, Memory: tt.memory, segments: []Segment{{Addr: 0x0300, Data: tt.program}}, start: 0x0300}
+		opts := testOptions()
+		opts.PassAddr, opts.FailAddr = tt.pass, tt.fail
+		res := test.Run(context.Background(), opts)
+		if res.Passed != tt.passed || res.Error || res.Reason != tt.reason {
+			t.Errorf("%s: passed %t, error %t, reason %q, want %t, %q", tt.name, res.Passed, res.Error, res.Reason, tt.passed, tt.reason)
+		}
+		if res.Test != test || res.Cycles == 0 {
+			t.Errorf("%s: result for %v after %d cycles", tt.name, res.Test, res.Cycles)
+		}
+		if res.Output != tt.output {
+			t.Errorf("%s: output %q, want %q", tt.name, res.Output, tt.output)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	trap := &Test{Name: "trap", segments: []Segment{{Addr: 0x0300, Data: []byte{0x4C, 0x00, 0x03}}}, start: 0x0300}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res := trap.Run(ctx, testOptions()); !res.Error || res.Reason != context.Canceled.Error() {
+		t.Errorf("cancelled: error %t, reason %q", res.Error, res.Reason)
+	}
+
+	opts := testOptions()
+	opts.DebugPort = 0xC304
+	if res := trap.Run(context.Background(), opts); !res.Error || !strings.Contains(res.Reason, "$C304") {
+		t.Errorf("misplaced debug port: error %t, reason %q", res.Error, res.Reason)
+	}
+
+	// Binaries load and start at the load address, wherever their segment says
+	binary := &Test{Name: "binary", segments: []Segment{{Data: []byte{0xA9, 0x00, 0x8D, 0x01, 0xC3}}}, binary: true}
+	opts = testOptions()
+	opts.LoadAddr = 0x1000
+	if res := binary.Run(context.Background(), opts); !res.Passed {
+		t.Errorf("binary at $1000: %s", res.Reason)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "suite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := Load(dir); err == nil {
+		t.Error("expected an error for a directory without tests")
+	}
+
+	files := map[string]string{
+		"exit.bin":       "\xA9\x00\x8D\x01\xC3",
+		"sub/store.hex":  "0400: A9 42 85 10 4C 04 04\n0400R\n",
+		"sub/store.mem":  "0010: 42\n",
+		"sub/readme.txt": "not a test",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, test := range tests {
+		names = append(names, test.Name)
+		if res := test.Run(context.Background(), testOptions()); !res.Passed {
+			t.Errorf("%s: %s", test.Name, res.Reason)
+		}
+	}
+	if want := []string{"exit", "sub/store"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("loaded %v, want %v", names, want)
+	}
+
+	// Assertion files only describe memory
+	if err := ioutil.WriteFile(filepath.Join(dir, "sub", "store.mem"), []byte("0010: 42\n0400R\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "can't have a start address") {
+		t.Errorf("got %v, want a start address in an assertion file refused", err)
+	}
+}
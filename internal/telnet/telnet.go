@@ -0,0 +1,233 @@
+// Package telnet serves the emulated Apple 1's keyboard and display over TCP, so a running
+// machine can be reached with `telnet localhost 6502`. Any number of clients can watch the
+// display, but only one holds the keyboard at a time: the one that has been connected
+// longest.
+//
+// Clients are put in character at a time mode with the Apple 1 echoing what they type, using
+// the minimum of telnet negotiation. Plain TCP clients such as nc work too.
+package telnet
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bradford-hamilton/apple-1/internal/term"
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// Telnet commands and options (RFC 854, 857 and 858)
+const (
+	se   = 240 // end of subnegotiation
+	sb   = 250 // start of subnegotiation
+	will = 251
+	wont = 252
+	do   = 253
+	dont = 254
+	iac  = 255 // interpret as command
+
+	optEcho            = 1
+	optSuppressGoAhead = 3
+	optLinemode        = 34
+)
+
+// writeTimeout is how long a client may stall the display before it's disconnected
+const writeTimeout = 2 * time.Second
+
+// queueLength is how many writes may wait for a client before it's disconnected as too slow
+const queueLength = 256
+
+// client is a connected telnet session. Everything sent to it is queued on out for a
+// goroutine of its own, so a slow client never holds up the machine or the other clients.
+type client struct {
+	conn net.Conn
+	out  chan []byte
+}
+
+// send queues msg for c, disconnecting it if its queue is full. s.mu must be held.
+func (c *client) send(msg []byte) {
+	select {
+	case c.out <- msg:
+	default:
+		log.Printf("telnet console: %s is too slow, disconnecting", c.conn.RemoteAddr())
+		c.conn.Close()
+	}
+}
+
+// write sends c its queued output until the queue is closed or a write fails
+func (c *client) write() {
+	for msg := range c.out {
+		c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := c.conn.Write(msg); err != nil {
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// Server is a telnet console for a machine. It's an io.Writer for the machine's display.
+type Server struct {
+	machine  *vm.VM
+	listener net.Listener
+
+	mu      sync.Mutex
+	clients []*client // in the order they connected, the first holds the keyboard
+}
+
+// New returns a console for machine. Its display output must be written to the console,
+// usually alongside the local display.
+func New(machine *vm.VM) *Server {
+	return &Server{machine: machine}
+}
+
+// Listen starts accepting clients on the TCP address addr
+func (s *Server) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	go s.accept()
+	return nil
+}
+
+// Close stops accepting clients and disconnects those connected
+func (s *Server) Close() error {
+	s.mu.Lock()
+	for _, c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// Write queues display characters for every client, disconnecting any that can't keep up.
+// It never waits for a client.
+func (s *Server) Write(p []byte) (int, error) {
+	var out bytes.Buffer
+	term.NewDisplay(&out).Write(p)
+	if out.Len() == 0 {
+		return len(p), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.clients {
+		c.send(out.Bytes())
+	}
+	return len(p), nil
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(conn)
+	}
+}
+
+// serve negotiates character mode with a client and forwards its keys while it holds the
+// keyboard
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	log.Printf("telnet console: %s connected", conn.RemoteAddr())
+
+	c := &client{conn: conn, out: make(chan []byte, queueLength)}
+	go c.write()
+	s.mu.Lock()
+	s.clients = append(s.clients, c)
+	c.send([]byte{iac, will, optEcho, iac, will, optSuppressGoAhead, iac, do, optSuppressGoAhead, iac, dont, optLinemode})
+	if s.clients[0] == c {
+		c.send([]byte("Connected to the Apple 1. You have the keyboard.\r\n"))
+	} else {
+		c.send([]byte(fmt.Sprintf("Connected to the Apple 1. Watching while %s has the keyboard.\r\n", s.clients[0].conn.RemoteAddr())))
+	}
+	s.mu.Unlock()
+	defer s.remove(c)
+
+	r := bufio.NewReader(conn)
+	afterCR := false
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			log.Printf("telnet console: %s disconnected", conn.RemoteAddr())
+			return
+		}
+		if b == iac {
+			if err := skipCommand(r); err != nil {
+				return
+			}
+			continue
+		}
+		// Enter arrives as CR LF or CR NUL, which is one return on the Apple 1
+		if afterCR && (b == '\n' || b == 0) {
+			afterCR = false
+			continue
+		}
+		afterCR = b == '\r'
+
+		if !s.hasKeyboard(c) {
+			continue
+		}
+		if k, ok := term.Key(b); ok {
+			s.machine.KeyPress(k)
+		}
+	}
+}
+
+// skipCommand consumes the rest of a telnet command following IAC. Option negotiation from
+// the client is ignored: it either agrees to character mode or gets it anyway.
+func skipCommand(r *bufio.Reader) error {
+	cmd, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch cmd {
+	case will, wont, do, dont:
+		_, err = r.ReadByte()
+	case sb:
+		// Skip to IAC SE
+		for prev := byte(0); ; {
+			b, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if prev == iac && b == se {
+				return nil
+			}
+			prev = b
+		}
+	}
+	return err
+}
+
+func (s *Server) hasKeyboard(c *client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients) > 0 && s.clients[0] == c
+}
+
+// remove forgets a disconnected client, handing the keyboard on if it held it
+func (s *Server) remove(c *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, other := range s.clients {
+		if other == c {
+			s.clients = append(s.clients[:i], s.clients[i+1:]...)
+			close(c.out)
+			if i == 0 && len(s.clients) > 0 {
+				s.clients[0].send([]byte("\r\nYou have the keyboard.\r\n"))
+			}
+			return
+		}
+	}
+}
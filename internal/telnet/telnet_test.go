@@ -0,0 +1,106 @@
+package telnet
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// connect serves a client over a pipe, returning its end
+func connect(t *testing.T, s *Server) net.Conn {
+	server, conn := net.Pipe()
+	go s.serve(server)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// expect reads from conn until want has been sent
+func expect(t *testing.T, conn net.Conn, want string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var got []byte
+	buf := make([]byte, 256)
+	for !strings.Contains(string(got), want) {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("waiting for %q, got %q: %v", want, got, err)
+		}
+		got = append(got, buf[:n]...)
+	}
+}
+
+// count returns how many clients are connected
+func (s *Server) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// waitFor polls until the server has n clients
+func waitFor(t *testing.T, s *Server, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); s.count() != n; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients connected, want %d", s.count(), n)
+		}
+	}
+}
+
+func TestConsole(t *testing.T) {
+	machine := vm.New()
+	s := New(machine)
+
+	typist := connect(t, s)
+	expect(t, typist, "You have the keyboard.")
+	watcher := connect(t, s)
+	expect(t, watcher, "Watching while")
+	waitFor(t, s, 2)
+
+	// The display goes to everyone, as the terminal shows it
+	s.Write([]byte("hello\r"))
+	expect(t, typist, "HELLO\r\n")
+	expect(t, watcher, "HELLO\r\n")
+
+	// Only the first client's keys reach the machine, and CR LF is one return
+	watcher.Write([]byte("X"))
+	typist.Write([]byte{iac, do, optEcho})
+	typist.Write([]byte("A\r\n"))
+	for deadline := time.Now().Add(5 * time.Second); machine.KeysPending() < 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d keys pending, want 2", machine.KeysPending())
+		}
+	}
+	if n := machine.KeysPending(); n != 2 {
+		t.Errorf("%d keys pending, want A and return", n)
+	}
+
+	// The keyboard passes on when its holder leaves
+	typist.Close()
+	expect(t, watcher, "You have the keyboard.")
+	waitFor(t, s, 1)
+}
+
+func TestSlowClient(t *testing.T) {
+	s := New(vm.New())
+	slow := connect(t, s) // never reads
+	waitFor(t, s, 1)
+
+	start := time.Now()
+	for i := 0; i < queueLength+10; i++ {
+		s.Write([]byte("LINE\r"))
+	}
+	if elapsed := time.Since(start); elapsed > writeTimeout/2 {
+		t.Errorf("writing took %v, want it not to wait for the client", elapsed)
+	}
+	waitFor(t, s, 0)
+	// Its connection was closed
+	slow.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for buf := make([]byte, 256); ; {
+		if _, err := slow.Read(buf); err != nil {
+			break
+		}
+	}
+}
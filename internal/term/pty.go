@@ -0,0 +1,17 @@
+package term
+
+import "os"
+
+// PTY is the master side of a pseudo-terminal, which reads what programs write to the slave
+// side at Name and writes what they read
+type PTY struct {
+	*os.File
+	Name  string
+	slave *os.File // held open so reads wait for data rather than failing
+}
+
+// Close closes both sides of the pseudo-terminal
+func (p *PTY) Close() error {
+	p.slave.Close()
+	return p.File.Close()
+}
@@ -0,0 +1,26 @@
+package term
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// unlockPTY grants and unlocks the slave side of the pseudo-terminal master, as grantpt and
+// unlockpt do, and returns its name
+func unlockPTY(master *os.File) (string, error) {
+	for _, req := range []uintptr{syscall.TIOCPTYGRANT, syscall.TIOCPTYUNLK} {
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), req, 0); errno != 0 {
+			return "", errno
+		}
+	}
+	var name [128]byte
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCPTYGNAME, uintptr(unsafe.Pointer(&name[0]))); errno != 0 {
+		return "", errno
+	}
+	if i := bytes.IndexByte(name[:], 0); i >= 0 {
+		return string(name[:i]), nil
+	}
+	return string(name[:]), nil
+}
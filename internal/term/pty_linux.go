@@ -0,0 +1,21 @@
+package term
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// unlockPTY unlocks the slave side of the pseudo-terminal master and returns its name
+func unlockPTY(master *os.File) (string, error) {
+	var unlock int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		return "", errno
+	}
+	var n uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		return "", errno
+	}
+	return fmt.Sprintf("/dev/pts/%d", n), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package term
+
+import "errors"
+
+// OpenPTY is not supported on this platform
+func OpenPTY() (*PTY, error) {
+	return nil, errors.New("pseudo-terminals are not supported on this platform")
+}
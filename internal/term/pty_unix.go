@@ -0,0 +1,41 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package term
+
+import (
+	"os"
+	"syscall"
+)
+
+// OpenPTY creates a pseudo-terminal in raw mode, for other programs to open by its Name
+func OpenPTY() (*PTY, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	name, err := unlockPTY(master)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	slave, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	t, err := getTermios(int(slave.Fd()))
+	if err == nil {
+		t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+		t.Oflag &^= syscall.OPOST
+		t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+		t.Cflag = t.Cflag&^(syscall.CSIZE|syscall.PARENB) | syscall.CS8
+		err = setTermios(int(slave.Fd()), t)
+	}
+	if err != nil {
+		slave.Close()
+		master.Close()
+		return nil, err
+	}
+	return &PTY{File: master, Name: name, slave: slave}, nil
+}
@@ -0,0 +1,63 @@
+// Package term puts the host terminal into the character at a time mode the Apple 1's keyboard
+// and display expect, and translates between host and Apple 1 characters.
+package term
+
+import (
+	"io"
+)
+
+// Key translates a byte typed on the host into the key an Apple 1 keyboard would send,
+// reporting false for keys it doesn't have. The Apple 1 keyboard is upper case only, sends a
+// carriage return for enter, and the Woz Monitor uses an underscore as rubout.
+func Key(b byte) (byte, bool) {
+	switch {
+	case b == '\n':
+		return '\r', true
+	case b == 0x7F || b == 0x08:
+		return '_', true
+	case b >= 'a' && b <= 'z':
+		return b - 'a' + 'A', true
+	case b < 0x60:
+		return b, true
+	}
+	return 0, false
+}
+
+// Display renders the Apple 1's display output on a host terminal or as plain text
+type Display struct {
+	w       io.Writer
+	newline []byte
+}
+
+// NewDisplay returns a Display writing to a terminal in raw mode at w
+func NewDisplay(w io.Writer) *Display {
+	return &Display{w: w, newline: []byte("\r\n")}
+}
+
+// NewTextDisplay returns a Display writing plain text with \n line endings to w, for files
+// and pipes
+func NewTextDisplay(w io.Writer) *Display {
+	return &Display{w: w, newline: []byte("\n")}
+}
+
+// Write renders Apple 1 display characters. Carriage returns start a new line, lower case is
+// shown as upper case like the Apple 1's character generator, and other control characters
+// are dropped.
+func (d *Display) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p)+8)
+	for _, c := range p {
+		c &= 0x7F
+		switch {
+		case c == '\r':
+			out = append(out, d.newline...)
+		case c >= 'a' && c <= 'z':
+			out = append(out, c-'a'+'A')
+		case c >= 0x20 && c < 0x7F:
+			out = append(out, c)
+		}
+	}
+	if _, err := d.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
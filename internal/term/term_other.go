@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package term
+
+import "errors"
+
+// IsTerminal reports whether fd is a terminal, which is never detected on this platform
+func IsTerminal(fd int) bool {
+	return false
+}
+
+// MakeRaw is not supported on this platform
+func MakeRaw(fd int) (func() error, error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
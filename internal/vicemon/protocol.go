@@ -0,0 +1,150 @@
+package vicemon
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Every message starts with STX and the protocol version
+const (
+	stx        = 0x02
+	apiVersion = 0x02
+)
+
+// Command types, with responses using the same type as their command
+const (
+	cmdMemoryGet          = 0x01
+	cmdMemorySet          = 0x02
+	cmdCheckpointGet      = 0x11
+	cmdCheckpointSet      = 0x12
+	cmdCheckpointDelete   = 0x13
+	cmdCheckpointList     = 0x14
+	cmdCheckpointToggle   = 0x15
+	cmdConditionSet       = 0x22
+	cmdRegistersGet       = 0x31
+	cmdRegistersSet       = 0x32
+	cmdAdvanceInstruction = 0x71
+	cmdExecuteUntilReturn = 0x73
+	cmdPing               = 0x81
+	cmdRegistersAvailable = 0x83
+	cmdExit               = 0xAA
+	cmdQuit               = 0xBB
+	cmdReset              = 0xCC
+)
+
+// Events sent without a request, using the response types below
+const (
+	respCheckpointInfo = 0x11
+	respRegisterInfo   = 0x31
+	respJam            = 0x61
+	respStopped        = 0x62
+	respResumed        = 0x63
+)
+
+// eventID is the request id of events
+const eventID = 0xFFFFFFFF
+
+// Error codes
+const (
+	errOK               = 0x00
+	errObjectMissing    = 0x01
+	errInvalidMemspace  = 0x02
+	errCommandLength    = 0x80
+	errInvalidParameter = 0x81
+	errAPIVersion       = 0x82
+	errInvalidCommand   = 0x83
+	errGeneralFailure   = 0x8F
+)
+
+// maxBodyLength is the longest request body accepted, enough to set all of memory at once
+const maxBodyLength = 0x10000 + 16
+
+// request is a command sent by a client
+type request struct {
+	id      uint32
+	command byte
+	body    []byte
+}
+
+// conn reads requests from a client and writes responses and events to it
+type conn struct {
+	rw io.ReadWriter
+	mu sync.Mutex
+}
+
+// read returns the next request. Requests are STX, the API version, the body length and the
+// request id as 32-bit little endian numbers, the command type and the body.
+func (c *conn) read() (*request, error) {
+	header := make([]byte, 11)
+	if _, err := io.ReadFull(c.rw, header); err != nil {
+		return nil, err
+	}
+	if header[0] != stx {
+		return nil, errors.New("request doesn't start with STX")
+	}
+	length := binary.LittleEndian.Uint32(header[2:])
+	if length > maxBodyLength {
+		return nil, errors.New("request body too long")
+	}
+	req := &request{
+		id:      binary.LittleEndian.Uint32(header[6:]),
+		command: header[10],
+		body:    make([]byte, length),
+	}
+	if _, err := io.ReadFull(c.rw, req.body); err != nil {
+		return nil, err
+	}
+	if header[1] != apiVersion {
+		c.respond(req.id, req.command, errAPIVersion, nil)
+		return c.read()
+	}
+	return req, nil
+}
+
+// respond writes a response to request id, or an event when id is eventID. Responses are STX,
+// the API version, the body length, the response type, the error code, the request id and
+// the body.
+func (c *conn) respond(id uint32, typ, code byte, body []byte) error {
+	msg := make([]byte, 12, 12+len(body))
+	msg[0] = stx
+	msg[1] = apiVersion
+	binary.LittleEndian.PutUint32(msg[2:], uint32(len(body)))
+	msg[6] = typ
+	msg[7] = code
+	binary.LittleEndian.PutUint32(msg[8:], id)
+	msg = append(msg, body...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.rw.Write(msg)
+	return err
+}
+
+// event sends an event of the given type
+func (c *conn) event(typ byte, body []byte) error {
+	return c.respond(eventID, typ, errOK, body)
+}
+
+// builder appends little endian fields to a message body
+type builder []byte
+
+func (b *builder) u8(v byte) {
+	*b = append(*b, v)
+}
+
+func (b *builder) u16(v uint16) {
+	*b = append(*b, byte(v), byte(v>>8))
+}
+
+func (b *builder) u32(v uint32) {
+	*b = append(*b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func boolByte(v bool) byte {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,704 @@
+// Package vicemon lets debuggers and IDE plugins that speak the VICE binary monitor protocol
+// control the emulated Apple 1 over TCP: reading and writing memory and registers, setting
+// checkpoints, stepping, and resuming. The protocol is described in the VICE manual under
+// "Binary Monitor".
+//
+// As in VICE, any command stops the machine, which stays stopped until a client sends exit.
+// Only the main memory space exists, and banks are ignored.
+package vicemon
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// ErrQuit is returned by Run when a client sends the quit command
+var ErrQuit = errors.New("quit requested by a monitor client")
+
+// Checkpoint operations, which may be combined
+const (
+	opLoad  = 0x01
+	opStore = 0x02
+	opExec  = 0x04
+)
+
+// VICE register ids for the 6502
+const (
+	regA  = 0x00
+	regX  = 0x01
+	regY  = 0x02
+	regPC = 0x03
+	regSP = 0x04
+	regFL = 0x05
+)
+
+// registerNames are the registers reported by registers available, in id order
+var registerNames = []struct {
+	id   byte
+	bits byte
+	name string
+}{
+	{regA, 8, "A"},
+	{regX, 8, "X"},
+	{regY, 8, "Y"},
+	{regPC, 16, "PC"},
+	{regSP, 8, "SP"},
+	{regFL, 8, "FL"},
+}
+
+// checkpoint is a breakpoint or watchpoint set by a client
+type checkpoint struct {
+	id        uint32
+	start     uint16
+	end       uint16
+	stop      bool // whether hitting it stops the machine, rather than only being counted
+	enabled   bool
+	op        byte
+	temporary bool // deleted once hit
+	hits      uint32
+	ignore    uint32 // hits still to ignore
+	condition string
+}
+
+// execCondition is the vm breakpoint condition for an exec checkpoint. It is added as a level
+// triggered breakpoint, so like VICE the checkpoint is hit by every instruction executed in
+// its range rather than only on entering it.
+func (c *checkpoint) execCondition() string {
+	return fmt.Sprintf("PC >= $%04X && PC <= $%04X", c.start, c.end)
+}
+
+// watch is a watchpoint added to the vm for a checkpoint
+type watch struct {
+	start, end  uint16
+	load, store bool
+}
+
+// covers reports whether an access to addr hits w
+func (w watch) covers(addr uint16, store bool) bool {
+	return addr >= w.start && addr <= w.end && (store && w.store || !store && w.load)
+}
+
+// command is a request waiting to be executed along with the client that sent it
+type command struct {
+	conn *conn
+	req  *request
+}
+
+// Server runs a machine on behalf of binary monitor clients
+type Server struct {
+	machine  *vm.VM
+	listener net.Listener
+	cmds     chan command
+
+	mu     sync.Mutex
+	conns  map[*conn]bool
+	cancel context.CancelFunc // interrupts the machine while it runs
+
+	// Owned by the goroutine calling Run
+	stopped     bool
+	quit        bool
+	checkpoints map[uint32]*checkpoint
+	nextID      uint32
+	registered  []string // exec conditions currently added to the vm as breakpoints
+	watches     []watch  // watchpoints currently added to the vm
+	step        string   // temporary breakpoint ending a step over or execute until return
+}
+
+// New returns a server controlling machine
+func New(machine *vm.VM) *Server {
+	return &Server{
+		machine:     machine,
+		cmds:        make(chan command, 64),
+		conns:       make(map[*conn]bool),
+		checkpoints: make(map[uint32]*checkpoint),
+		nextID:      1,
+	}
+}
+
+// Listen starts accepting clients on the TCP address addr
+func (s *Server) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	go s.accept()
+	return nil
+}
+
+// Close stops accepting clients and disconnects those connected
+func (s *Server) Close() error {
+	s.mu.Lock()
+	for c := range s.conns {
+		if closer, ok := c.rw.(net.Conn); ok {
+			closer.Close()
+		}
+	}
+	s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) accept() {
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{rw: nc}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+		go s.serve(c)
+	}
+}
+
+// serve queues each request from c for Run, interrupting the machine if it's running
+func (s *Server) serve(c *conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		if closer, ok := c.rw.(net.Conn); ok {
+			closer.Close()
+		}
+	}()
+	for {
+		req, err := c.read()
+		if err != nil {
+			return
+		}
+		s.cmds <- command{conn: c, req: req}
+		s.mu.Lock()
+		if s.cancel != nil {
+			s.cancel()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// broadcast sends an event to every client
+func (s *Server) broadcast(typ byte, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		if err := c.event(typ, body); err != nil {
+			log.Printf("binary monitor: %v", err)
+		}
+	}
+}
+
+// Run runs the machine like vm.Run until ctx is done, stopping whenever a client sends a
+// command or one of their checkpoints is hit. It returns ErrQuit if a client quits, and the
+// vm's error for faults and for breakpoints and watchpoints the clients didn't set.
+func (s *Server) Run(ctx context.Context) error {
+	for !s.quit {
+		if s.stopped {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case c := <-s.cmds:
+				s.exec(c)
+			}
+			continue
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.cancel = cancel
+		pending := len(s.cmds) > 0
+		s.mu.Unlock()
+
+		err := context.Canceled
+		if !pending {
+			err = s.machine.Run(runCtx)
+		}
+		s.mu.Lock()
+		s.cancel = nil
+		s.mu.Unlock()
+		cancel()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		switch e := err.(type) {
+		case *vm.Halt:
+			if !s.halted(e) {
+				return err
+			}
+		case *vm.Fault:
+			s.broadcast(respJam, pcBody(e.PC))
+			return err
+		default:
+			if err != context.Canceled {
+				return err
+			}
+			// A client sent a command
+			s.enterMonitor()
+		}
+	}
+	return ErrQuit
+}
+
+// halted handles the vm halting, returning false if no client asked for it
+func (s *Server) halted(h *vm.Halt) bool {
+	if s.step != "" && h.Breakpoint == s.step {
+		s.clearStep()
+		s.enterMonitor()
+		return true
+	}
+
+	var hit []*checkpoint
+	regs := s.machine.Registers()
+	for _, id := range s.ids() {
+		c := s.checkpoints[id]
+		if !c.enabled {
+			continue
+		}
+		switch {
+		case h.Watch:
+			op := byte(opLoad)
+			if h.Store {
+				op = opStore
+			}
+			if c.op&op == 0 || h.Addr < c.start || h.Addr > c.end {
+				continue
+			}
+		case c.op&opExec == 0 || regs.PC < c.start || regs.PC > c.end || !s.registeredCondition(h.Breakpoint):
+			continue
+		}
+		if c.condition != "" {
+			if v, err := s.machine.Evaluate(c.condition); err != nil || v == 0 {
+				continue
+			}
+		}
+		hit = append(hit, c)
+	}
+	if len(hit) == 0 {
+		// Not a checkpoint, unless it was one whose condition doesn't hold
+		if h.Watch {
+			return s.registeredWatch(h.Addr, h.Store)
+		}
+		return s.registeredCondition(h.Breakpoint)
+	}
+
+	stop := false
+	for _, c := range hit {
+		c.hits++
+		if c.ignore > 0 {
+			c.ignore--
+			continue
+		}
+		if c.stop {
+			stop = true
+			s.broadcast(respCheckpointInfo, c.info(true))
+		}
+		if c.temporary {
+			delete(s.checkpoints, c.id)
+		}
+	}
+	s.apply()
+	if stop {
+		s.enterMonitor()
+	}
+	return true
+}
+
+func (s *Server) registeredCondition(cond string) bool {
+	for _, r := range s.registered {
+		if r == cond {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) registeredWatch(addr uint16, store bool) bool {
+	for _, w := range s.watches {
+		if w.covers(addr, store) {
+			return true
+		}
+	}
+	return false
+}
+
+// enterMonitor stops the machine and tells the clients where
+func (s *Server) enterMonitor() {
+	s.stopped = true
+	s.broadcast(respRegisterInfo, s.registers())
+	s.broadcast(respStopped, pcBody(s.machine.Registers().PC))
+}
+
+// resume lets the machine run again
+func (s *Server) resume() {
+	s.stopped = false
+	s.broadcast(respResumed, pcBody(s.machine.Registers().PC))
+}
+
+func pcBody(pc uint16) []byte {
+	var b builder
+	b.u16(pc)
+	return b
+}
+
+// exec executes a client's command while the machine is stopped
+func (s *Server) exec(cmd command) {
+	c, req := cmd.conn, cmd.req
+	respond := func(code byte, body []byte) {
+		if err := c.respond(req.id, req.command, code, body); err != nil {
+			log.Printf("binary monitor: %v", err)
+		}
+	}
+	body := req.body
+	le := binary.LittleEndian
+
+	switch req.command {
+	case cmdMemoryGet, cmdMemorySet:
+		if len(body) < 8 {
+			respond(errCommandLength, nil)
+			return
+		}
+		sideEffects, start, end := body[0] != 0, le.Uint16(body[1:]), le.Uint16(body[3:])
+		if body[5] != 0 {
+			respond(errInvalidMemspace, nil)
+			return
+		}
+		if end < start {
+			respond(errInvalidParameter, nil)
+			return
+		}
+		n := int(end) - int(start) + 1
+
+		if req.command == cmdMemoryGet {
+			var b builder
+			b.u16(uint16(n))
+			for i := 0; i < n; i++ {
+				addr := start + uint16(i)
+				if sideEffects {
+					b.u8(s.machine.Read(addr))
+				} else {
+					b.u8(s.machine.Peek(addr))
+				}
+			}
+			respond(errOK, b)
+			return
+		}
+
+		data := body[8:]
+		if len(data) != n {
+			respond(errCommandLength, nil)
+			return
+		}
+		if sideEffects {
+			for i, v := range data {
+				s.machine.Write(start+uint16(i), v)
+			}
+		} else {
+			s.machine.Load(start, data)
+		}
+		respond(errOK, nil)
+
+	case cmdCheckpointGet, cmdCheckpointDelete, cmdCheckpointToggle:
+		if len(body) < 4 || req.command == cmdCheckpointToggle && len(body) < 5 {
+			respond(errCommandLength, nil)
+			return
+		}
+		cp, ok := s.checkpoints[le.Uint32(body)]
+		if !ok {
+			respond(errObjectMissing, nil)
+			return
+		}
+		switch req.command {
+		case cmdCheckpointGet:
+			respond(errOK, cp.info(false))
+		case cmdCheckpointDelete:
+			delete(s.checkpoints, cp.id)
+			s.apply()
+			respond(errOK, nil)
+		case cmdCheckpointToggle:
+			cp.enabled = body[4] != 0
+			s.apply()
+			respond(errOK, nil)
+		}
+
+	case cmdCheckpointSet:
+		if len(body) < 8 {
+			respond(errCommandLength, nil)
+			return
+		}
+		if len(body) > 8 && body[8] != 0 {
+			respond(errInvalidMemspace, nil)
+			return
+		}
+		cp := &checkpoint{
+			id:        s.nextID,
+			start:     le.Uint16(body),
+			end:       le.Uint16(body[2:]),
+			stop:      body[4] != 0,
+			enabled:   body[5] != 0,
+			op:        body[6],
+			temporary: body[7] != 0,
+		}
+		if cp.end < cp.start || cp.op&(opLoad|opStore|opExec) == 0 {
+			respond(errInvalidParameter, nil)
+			return
+		}
+		s.nextID++
+		s.checkpoints[cp.id] = cp
+		s.apply()
+		respond(errOK, cp.info(false))
+
+	case cmdCheckpointList:
+		ids := s.ids()
+		for _, id := range ids {
+			if err := c.respond(req.id, respCheckpointInfo, errOK, s.checkpoints[id].info(false)); err != nil {
+				return
+			}
+		}
+		var b builder
+		b.u32(uint32(len(ids)))
+		respond(errOK, b)
+
+	case cmdConditionSet:
+		if len(body) < 5 || len(body) < 5+int(body[4]) {
+			respond(errCommandLength, nil)
+			return
+		}
+		cp, ok := s.checkpoints[le.Uint32(body)]
+		if !ok {
+			respond(errObjectMissing, nil)
+			return
+		}
+		cond := string(body[5 : 5+int(body[4])])
+		if _, err := s.machine.Evaluate(cond); err != nil {
+			respond(errInvalidParameter, nil)
+			return
+		}
+		cp.condition = cond
+		respond(errOK, nil)
+
+	case cmdRegistersGet:
+		if len(body) < 1 {
+			respond(errCommandLength, nil)
+			return
+		}
+		if body[0] != 0 {
+			respond(errInvalidMemspace, nil)
+			return
+		}
+		respond(errOK, s.registers())
+
+	case cmdRegistersSet:
+		if len(body) < 3 {
+			respond(errCommandLength, nil)
+			return
+		}
+		if body[0] != 0 {
+			respond(errInvalidMemspace, nil)
+			return
+		}
+		regs := s.machine.Registers()
+		items := body[3:]
+		for i := 0; i < int(le.Uint16(body[1:])); i++ {
+			if len(items) < 4 || int(items[0]) < 3 || len(items) < 1+int(items[0]) {
+				respond(errCommandLength, nil)
+				return
+			}
+			v := le.Uint16(items[2:])
+			switch items[1] {
+			case regA:
+				regs.A = byte(v)
+			case regX:
+				regs.X = byte(v)
+			case regY:
+				regs.Y = byte(v)
+			case regPC:
+				regs.PC = v
+			case regSP:
+				regs.SP = byte(v)
+			case regFL:
+				regs.P = byte(v)
+			default:
+				respond(errObjectMissing, nil)
+				return
+			}
+			items = items[1+int(items[0]):]
+		}
+		s.machine.SetRegisters(regs)
+		respond(errOK, s.registers())
+
+	case cmdAdvanceInstruction:
+		if len(body) < 3 {
+			respond(errCommandLength, nil)
+			return
+		}
+		stepOver, count := body[0] != 0, int(le.Uint16(body[1:]))
+		respond(errOK, nil)
+		for i := 0; i < count; i++ {
+			regs := s.machine.Registers()
+			if stepOver && s.machine.Peek(regs.PC) == 0x20 {
+				// Run the subroutine at full speed, stopping once it returns. JSR pushes
+				// two bytes and the call has returned once SP rises above them.
+				s.runUntil(vm.ReturnCondition(regs.SP - 2))
+				return
+			}
+			if _, err := s.machine.Step(); err != nil {
+				s.broadcast(respJam, pcBody(regs.PC))
+				break
+			}
+		}
+		s.enterMonitor()
+
+	case cmdExecuteUntilReturn:
+		respond(errOK, nil)
+		calls := s.machine.CallStack()
+		if len(calls) == 0 {
+			s.resume()
+			return
+		}
+		s.runUntil(vm.ReturnCondition(calls[len(calls)-1].SP))
+
+	case cmdPing:
+		respond(errOK, nil)
+
+	case cmdRegistersAvailable:
+		var b builder
+		b.u16(uint16(len(registerNames)))
+		for _, r := range registerNames {
+			b.u8(byte(3 + len(r.name)))
+			b.u8(r.id)
+			b.u8(r.bits)
+			b.u8(byte(len(r.name)))
+			b = append(b, r.name...)
+		}
+		respond(errOK, b)
+
+	case cmdExit:
+		respond(errOK, nil)
+		s.resume()
+
+	case cmdQuit:
+		respond(errOK, nil)
+		s.quit = true
+
+	case cmdReset:
+		s.machine.Reset()
+		respond(errOK, nil)
+
+	default:
+		respond(errInvalidCommand, nil)
+	}
+}
+
+// runUntil resumes the machine with a temporary breakpoint on cond
+func (s *Server) runUntil(cond string) {
+	s.clearStep()
+	if err := s.machine.AddBreakpoint(cond); err != nil {
+		log.Printf("binary monitor: %v", err)
+		return
+	}
+	s.step = cond
+	s.resume()
+}
+
+func (s *Server) clearStep() {
+	if s.step != "" {
+		s.machine.RemoveBreakpoint(s.step)
+		s.step = ""
+	}
+}
+
+// ids returns the checkpoint ids in the order they were created
+func (s *Server) ids() []uint32 {
+	ids := make([]uint32, 0, len(s.checkpoints))
+	for id := range s.checkpoints {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// apply replaces the breakpoints and watchpoints added to the vm for enabled checkpoints,
+// leaving any others alone
+func (s *Server) apply() {
+	for _, cond := range s.registered {
+		s.machine.RemoveBreakpoint(cond)
+	}
+	s.registered = nil
+	for _, w := range s.watches {
+		s.machine.RemoveWatchpoint(w.start, w.end, w.load, w.store)
+	}
+	s.watches = nil
+
+	for _, id := range s.ids() {
+		c := s.checkpoints[id]
+		if !c.enabled {
+			continue
+		}
+		if c.op&opExec != 0 {
+			if cond := c.execCondition(); !s.registeredCondition(cond) {
+				if err := s.machine.AddLevelBreakpoint(cond); err == nil {
+					s.registered = append(s.registered, cond)
+				}
+			}
+		}
+		if c.op&(opLoad|opStore) != 0 {
+			w := watch{start: c.start, end: c.end, load: c.op&opLoad != 0, store: c.op&opStore != 0}
+			if err := s.machine.AddWatchpoint(w.start, w.end, w.load, w.store); err == nil {
+				s.watches = append(s.watches, w)
+			}
+		}
+	}
+}
+
+// info returns the body of a checkpoint info response
+func (c *checkpoint) info(hit bool) []byte {
+	var b builder
+	b.u32(c.id)
+	b.u8(boolByte(hit))
+	b.u16(c.start)
+	b.u16(c.end)
+	b.u8(boolByte(c.stop))
+	b.u8(boolByte(c.enabled))
+	b.u8(c.op)
+	b.u8(boolByte(c.temporary))
+	b.u32(c.hits)
+	b.u32(c.ignore)
+	b.u8(boolByte(c.condition != ""))
+	b.u8(0)
+	return b
+}
+
+// registers returns the body of a register info response
+func (s *Server) registers() []byte {
+	regs := s.machine.Registers()
+	values := []struct {
+		id byte
+		v  uint16
+	}{
+		{regA, uint16(regs.A)},
+		{regX, uint16(regs.X)},
+		{regY, uint16(regs.Y)},
+		{regPC, regs.PC},
+		{regSP, uint16(regs.SP)},
+		{regFL, uint16(regs.P)},
+	}
+	var b builder
+	b.u16(uint16(len(values)))
+	for _, r := range values {
+		b.u8(3)
+		b.u8(r.id)
+		b.u16(r.v)
+	}
+	return b
+}
@@ -0,0 +1,331 @@
+package vicemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// frame builds a request as a client sends it
+func frame(version byte, id uint32, command byte, body []byte) []byte {
+	msg := []byte{stx, version, 0, 0, 0, 0, 0, 0, 0, 0, command}
+	binary.LittleEndian.PutUint32(msg[2:], uint32(len(body)))
+	binary.LittleEndian.PutUint32(msg[6:], id)
+	return append(msg, body...)
+}
+
+// reply is a response or event as a client reads it
+type reply struct {
+	typ  byte
+	code byte
+	id   uint32
+	body []byte
+}
+
+func readReply(r io.Reader) (reply, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return reply{}, err
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(header[2:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return reply{}, err
+	}
+	return reply{typ: header[6], code: header[7], id: binary.LittleEndian.Uint32(header[8:]), body: body}, nil
+}
+
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
+
+func TestConnFraming(t *testing.T) {
+	var in, out bytes.Buffer
+	in.Write(frame(0x01, 7, cmdPing, nil))                        // unsupported API version
+	in.Write(frame(apiVersion, 8, cmdMemoryGet, []byte{1, 2, 3})) // the next request is still read
+	in.Write([]byte{0x03, apiVersion, 0, 0, 0, 0, 0, 0, 0, 0, 0}) // no STX
+	c := &conn{rw: readWriter{&in, &out}}
+
+	req, err := c.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.id != 8 || req.command != cmdMemoryGet || !bytes.Equal(req.body, []byte{1, 2, 3}) {
+		t.Errorf("read request %d command $%02X body %v, want 8 $01 [1 2 3]", req.id, req.command, req.body)
+	}
+	r, err := readReply(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.id != 7 || r.typ != cmdPing || r.code != errAPIVersion {
+		t.Errorf("got response %d type $%02X error $%02X, want 7 $81 $82", r.id, r.typ, r.code)
+	}
+
+	if _, err := c.read(); err == nil {
+		t.Error("expected an error for a request without STX")
+	}
+
+	// Responses carry STX, the version and the body length ahead of the type
+	out.Reset()
+	c.event(respStopped, pcBody(0x1234))
+	want := []byte{stx, apiVersion, 2, 0, 0, 0, respStopped, errOK, 0xFF, 0xFF, 0xFF, 0xFF, 0x34, 0x12}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("event is % X, want % X", out.Bytes(), want)
+	}
+}
+
+func TestConnRejectsLongBodies(t *testing.T) {
+	msg := frame(apiVersion, 1, cmdMemorySet, nil)
+	binary.LittleEndian.PutUint32(msg[2:], maxBodyLength+1)
+	c := &conn{rw: readWriter{bytes.NewReader(msg), ioutil.Discard}}
+	if _, err := c.read(); err == nil {
+		t.Error("expected an error for a body over the limit")
+	}
+}
+
+// program sets the stack pointer to 1 so the JSR's return address wraps around the stack,
+// calls a subroutine and stores to $2000. It starts spinning at $0320 until a client moves PC.
+var program = []byte{
+	0xA2, 0x01, // $0300 LDX #$01
+	0x9A,             // $0302 TXS
+	0x20, 0x10, 0x03, // $0303 JSR $0310
+	0x8D, 0x00, 0x20, // $0306 STA $2000
+	0x4C, 0x09, 0x03, // $0309 JMP *
+	0, 0, 0, 0,
+	0x60, // $0310 RTS
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0x4C, 0x20, 0x03, // $0320 JMP *
+}
+
+// client talks to a Server running program over a pipe
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	id     uint32
+	events []reply
+}
+
+// start runs a server on a machine set up with program, returning a connected client and
+// the error Run returns
+func start(t *testing.T, setup func(machine *vm.VM)) (*client, <-chan error) {
+	machine := vm.New()
+	machine.SetClockSpeed(0)
+	machine.Load(0x0300, program)
+	regs := machine.Registers()
+	regs.PC = 0x0320
+	machine.SetRegisters(regs)
+	if setup != nil {
+		setup(machine)
+	}
+
+	s := New(machine)
+	server, nc := net.Pipe()
+	c := &conn{rw: server}
+	s.conns[c] = true
+	go s.serve(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	errc := make(chan error, 1)
+	go func() { errc <- s.Run(ctx) }()
+	return &client{t: t, conn: nc}, errc
+}
+
+func (c *client) read() reply {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r, err := readReply(c.conn)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return r
+}
+
+// call sends a command and returns its response's body, failing the test unless it succeeded
+func (c *client) call(command byte, body []byte) []byte {
+	c.t.Helper()
+	c.id++
+	if _, err := c.conn.Write(frame(apiVersion, c.id, command, body)); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		r := c.read()
+		if r.id == eventID || r.id == c.id && r.typ != command {
+			c.events = append(c.events, r)
+			continue
+		}
+		if r.id != c.id || r.code != errOK {
+			c.t.Fatalf("command $%02X: got response %d type $%02X error $%02X", command, r.id, r.typ, r.code)
+		}
+		return r.body
+	}
+}
+
+// event waits for an event of the given type, skipping any others
+func (c *client) event(typ byte) []byte {
+	c.t.Helper()
+	for {
+		var r reply
+		if len(c.events) > 0 {
+			r, c.events = c.events[0], c.events[1:]
+		} else {
+			r = c.read()
+		}
+		if r.id == eventID && r.typ == typ {
+			return r.body
+		}
+	}
+}
+
+// registers returns the machine's registers by VICE register id
+func (c *client) registers() map[byte]uint16 {
+	c.t.Helper()
+	body := c.call(cmdRegistersGet, []byte{0})
+	regs := make(map[byte]uint16)
+	n := int(binary.LittleEndian.Uint16(body))
+	for i, items := 0, body[2:]; i < n; i, items = i+1, items[1+int(items[0]):] {
+		regs[items[1]] = binary.LittleEndian.Uint16(items[2:])
+	}
+	return regs
+}
+
+// stop interrupts the running machine and waits for it to stop
+func (c *client) stop() {
+	c.t.Helper()
+	c.call(cmdPing, nil)
+	c.event(respStopped)
+}
+
+func (c *client) setPC(pc uint16) {
+	c.t.Helper()
+	body := []byte{0, 1, 0, 3, regPC, byte(pc), byte(pc >> 8)}
+	c.call(cmdRegistersSet, body)
+}
+
+// checkpointSet returns the body of a checkpoint set command that stops the machine
+func checkpointSet(start, end uint16, op byte) []byte {
+	var b builder
+	b.u16(start)
+	b.u16(end)
+	b.u8(1) // stop
+	b.u8(1) // enabled
+	b.u8(op)
+	b.u8(0) // not temporary
+	return b
+}
+
+func TestMemoryAndRegisters(t *testing.T) {
+	c, _ := start(t, nil)
+
+	c.call(cmdPing, nil)
+	if pc := binary.LittleEndian.Uint16(c.event(respStopped)); pc != 0x0320 {
+		t.Errorf("stopped at $%04X, want $0320", pc)
+	}
+
+	c.call(cmdMemorySet, []byte{0, 0x00, 0x10, 0x02, 0x10, 0, 0, 0, 0xAA, 0xBB, 0xCC})
+	body := c.call(cmdMemoryGet, []byte{0, 0xFF, 0x0F, 0x03, 0x10, 0, 0, 0})
+	if want := []byte{5, 0, 0x00, 0xAA, 0xBB, 0xCC, 0x00}; !bytes.Equal(body, want) {
+		t.Errorf("memory get returned % X, want % X", body, want)
+	}
+
+	c.setPC(0x0300)
+	if regs := c.registers(); regs[regPC] != 0x0300 || regs[regSP] != 0xFF {
+		t.Errorf("PC=$%04X SP=$%02X, want $0300 and $FF", regs[regPC], regs[regSP])
+	}
+}
+
+func TestStepOverAndCheckpoints(t *testing.T) {
+	c, _ := start(t, nil)
+	c.stop()
+	c.setPC(0x0300)
+
+	info := c.call(cmdCheckpointSet, checkpointSet(0x0309, 0x0309, opExec))
+	id := binary.LittleEndian.Uint32(info)
+
+	// Step LDX and TXS, then step over the JSR, whose return address wraps the stack
+	c.call(cmdAdvanceInstruction, []byte{1, 3, 0})
+	if pc := binary.LittleEndian.Uint16(c.event(respStopped)); pc != 0x0306 {
+		t.Fatalf("stepped to $%04X, want $0306", pc)
+	}
+	if regs := c.registers(); regs[regSP] != 0x01 {
+		t.Errorf("SP=$%02X after stepping over the call, want $01", regs[regSP])
+	}
+
+	c.call(cmdExit, nil)
+	hit := c.event(respCheckpointInfo)
+	if binary.LittleEndian.Uint32(hit) != id || hit[4] != 1 {
+		t.Errorf("checkpoint info % X, want checkpoint %d hit", hit, id)
+	}
+	if pc := binary.LittleEndian.Uint16(c.event(respStopped)); pc != 0x0309 {
+		t.Errorf("stopped at $%04X, want the checkpoint at $0309", pc)
+	}
+}
+
+func TestCheckpointsLeaveOtherWatchpoints(t *testing.T) {
+	c, errc := start(t, func(machine *vm.VM) {
+		// Set outside the monitor, e.g. with --watch
+		machine.AddWatchpoint(0x2000, 0x2000, false, true)
+	})
+	c.stop()
+	c.setPC(0x0300)
+
+	// Adding and deleting a checkpoint replaces the monitor's watchpoints, and only those
+	info := c.call(cmdCheckpointSet, checkpointSet(0x2000, 0x2000, opStore))
+	c.call(cmdCheckpointDelete, info[:4])
+	c.call(cmdCheckpointSet, checkpointSet(0x0309, 0x0309, opExec))
+
+	c.call(cmdExit, nil)
+	c.event(respResumed)
+	select {
+	case err := <-errc:
+		h, ok := err.(*vm.Halt)
+		if !ok || !h.Watch || h.Addr != 0x2000 {
+			t.Fatalf("Run returned %v, want the store to $2000 to halt it", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watchpoint set outside the monitor didn't halt the machine")
+	}
+}
+
+func TestRangeCheckpoint(t *testing.T) {
+	var machine *vm.VM
+	c, _ := start(t, func(m *vm.VM) { machine = m })
+	c.stop()
+	c.setPC(0x0300)
+
+	// Every instruction executed in the range stops the machine, not just entering it
+	info := c.call(cmdCheckpointSet, checkpointSet(0x0300, 0x0309, opExec))
+	id := binary.LittleEndian.Uint32(info)
+	for _, want := range []uint16{0x0302, 0x0303, 0x0306, 0x0309, 0x0309} {
+		c.call(cmdExit, nil)
+		if hit := c.event(respCheckpointInfo); binary.LittleEndian.Uint32(hit) != id {
+			t.Fatalf("checkpoint info % X, want checkpoint %d hit", hit, id)
+		}
+		if pc := binary.LittleEndian.Uint16(c.event(respStopped)); pc != want {
+			t.Fatalf("stopped at $%04X, want $%04X", pc, want)
+		}
+	}
+	c.call(cmdCheckpointDelete, info[:4])
+
+	// A condition that comes true while the machine stays in the range stops it there
+	info = c.call(cmdCheckpointSet, checkpointSet(0x0309, 0x0309, opExec))
+	before := machine.Cycles()
+	cond := fmt.Sprintf("cycles > %d", before+30)
+	c.call(cmdConditionSet, append(append(info[:4:4], byte(len(cond))), cond...))
+	c.call(cmdExit, nil)
+	c.event(respCheckpointInfo)
+	if pc := binary.LittleEndian.Uint16(c.event(respStopped)); pc != 0x0309 {
+		t.Errorf("stopped at $%04X, want the checkpoint at $0309", pc)
+	}
+	if ran := machine.Cycles() - before; ran <= 30 {
+		t.Errorf("stopped after %d cycles, before the condition held", ran)
+	}
+}
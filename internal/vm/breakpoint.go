@@ -0,0 +1,480 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// breakpoint halts the vm once its condition evaluates to a non-zero value. Conditions are
+// small C-like expressions evaluated against the cpu registers, individual flags, memory and
+// the cycle count, e.g. `A == $8D && X > 3`, `mem[$24] == 0` or `cycles > 1000000`.
+//
+// Available identifiers (case insensitive):
+// A, X, Y, SP, PC, P	....	registers (P is the processor status)
+// N, V, B, D, I, Z, C	....	individual flags, evaluate to 0 or 1
+// cycles		....	cycles executed since the vm was created
+// mem[addr]		....	the byte stored at addr
+// labels		....	any other identifier is looked up in the symbol table, e.g. PC == ECHO
+//
+// Numbers may be written as decimal (141), hex ($8D or 0x8D) or binary (%10001101). Operators
+// follow C precedence: || && | ^ & (== !=) (< <= > >=) (<< >>) (+ -) (* / %) and unary ! - ~.
+//
+// Breakpoints are edge triggered: one halts the vm when its condition becomes true, and not
+// again until the condition has been false, so resuming from `cycles > 1000000` runs on
+// rather than halting after every instruction. Level triggered breakpoints halt after every
+// instruction that leaves their condition true.
+type breakpoint struct {
+	cond  string
+	expr  exprNode
+	level bool // halt whenever the condition holds, not only when it becomes true
+	held  bool // whether the condition held after the last instruction
+}
+
+func (b breakpoint) String() string {
+	return b.cond
+}
+
+// AddBreakpoint compiles the provided condition and halts the vm whenever it becomes true
+// after an instruction completes.
+func (vm *VM) AddBreakpoint(cond string) error {
+	expr, err := parseExpr(cond, vm.symbols)
+	if err != nil {
+		return fmt.Errorf("invalid breakpoint %q: %v", cond, err)
+	}
+	vm.breakpoints = append(vm.breakpoints, breakpoint{cond: cond, expr: expr})
+	return nil
+}
+
+// AddLevelBreakpoint compiles the provided condition and halts the vm after every instruction
+// that leaves it true, e.g. each instruction executed in `PC >= $0300 && PC <= $03FF`
+func (vm *VM) AddLevelBreakpoint(cond string) error {
+	expr, err := parseExpr(cond, vm.symbols)
+	if err != nil {
+		return fmt.Errorf("invalid breakpoint %q: %v", cond, err)
+	}
+	vm.breakpoints = append(vm.breakpoints, breakpoint{cond: cond, expr: expr, level: true})
+	return nil
+}
+
+// AddPCBreakpoint halts the vm when execution reaches loc, which may be an address such
+// as $FF1F, a label such as GETLINE, or any expression combining them
+func (vm *VM) AddPCBreakpoint(loc string) error {
+	return vm.AddBreakpoint(fmt.Sprintf("PC == (%s)", loc))
+}
+
+// ClearBreakpoints removes every breakpoint from the vm
+func (vm *VM) ClearBreakpoints() {
+	vm.breakpoints = nil
+}
+
+// RemoveBreakpoint removes the breakpoints added with exactly the condition cond
+func (vm *VM) RemoveBreakpoint(cond string) {
+	kept := vm.breakpoints[:0]
+	for _, bp := range vm.breakpoints {
+		if bp.cond != cond {
+			kept = append(kept, bp)
+		}
+	}
+	vm.breakpoints = kept
+}
+
+// Evaluate returns the value of an expression written in the breakpoint condition language,
+// e.g. `mem[$24] + X`
+func (vm *VM) Evaluate(expr string) (int64, error) {
+	node, err := parseExpr(expr, vm.symbols)
+	if err != nil {
+		return 0, err
+	}
+	return node.eval(vm), nil
+}
+
+// breakpointHit returns the first breakpoint whose condition has just become true, or holds
+// for a level triggered one, or nil
+func (vm *VM) breakpointHit() *breakpoint {
+	var hit *breakpoint
+	for i := range vm.breakpoints {
+		bp := &vm.breakpoints[i]
+		holds := bp.expr.eval(vm) != 0
+		if holds && (bp.level || !bp.held) && hit == nil {
+			hit = bp
+		}
+		bp.held = holds
+	}
+	return hit
+}
+
+// exprNode is a node in a compiled breakpoint condition
+type exprNode interface {
+	eval(vm *VM) int64
+}
+
+type numberNode int64
+
+func (n numberNode) eval(vm *VM) int64 {
+	return int64(n)
+}
+
+type identNode func(vm *VM) int64
+
+func (n identNode) eval(vm *VM) int64 {
+	return n(vm)
+}
+
+type memNode struct {
+	addr exprNode
+}
+
+func (n memNode) eval(vm *VM) int64 {
+	return int64(vm.peek(uint16(n.addr.eval(vm))))
+}
+
+type unaryNode struct {
+	op string
+	x  exprNode
+}
+
+func (n unaryNode) eval(vm *VM) int64 {
+	x := n.x.eval(vm)
+	switch n.op {
+	case "!":
+		return boolToInt(x == 0)
+	case "-":
+		return -x
+	case "~":
+		return ^x
+	}
+	return 0
+}
+
+type binaryNode struct {
+	op   string
+	l, r exprNode
+}
+
+func (n binaryNode) eval(vm *VM) int64 {
+	// Evaluate logical operators lazily so the right hand side is skipped where possible
+	switch n.op {
+	case "&&":
+		return boolToInt(n.l.eval(vm) != 0 && n.r.eval(vm) != 0)
+	case "||":
+		return boolToInt(n.l.eval(vm) != 0 || n.r.eval(vm) != 0)
+	}
+
+	l, r := n.l.eval(vm), n.r.eval(vm)
+	switch n.op {
+	case "|":
+		return l | r
+	case "^":
+		return l ^ r
+	case "&":
+		return l & r
+	case "==":
+		return boolToInt(l == r)
+	case "!=":
+		return boolToInt(l != r)
+	case "<":
+		return boolToInt(l < r)
+	case "<=":
+		return boolToInt(l <= r)
+	case ">":
+		return boolToInt(l > r)
+	case ">=":
+		return boolToInt(l >= r)
+	case "<<":
+		return l << uint64(r&63)
+	case ">>":
+		return l >> uint64(r&63)
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		if r == 0 {
+			return 0
+		}
+		return l / r
+	case "%":
+		if r == 0 {
+			return 0
+		}
+		return l % r
+	}
+	return 0
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func flagIdent(flag byte) identNode {
+	return func(vm *VM) int64 {
+		return boolToInt(vm.getFlag(flag) != 0)
+	}
+}
+
+// exprIdents maps the identifiers available in breakpoint conditions to their values
+var exprIdents = map[string]identNode{
+	"a":      func(vm *VM) int64 { return int64(vm.cpu.a) },
+	"x":      func(vm *VM) int64 { return int64(vm.cpu.x) },
+	"y":      func(vm *VM) int64 { return int64(vm.cpu.y) },
+	"sp":     func(vm *VM) int64 { return int64(vm.cpu.sp) },
+	"pc":     func(vm *VM) int64 { return int64(vm.cpu.pc) },
+	"p":      func(vm *VM) int64 { return int64(vm.cpu.ps) },
+	"cycles": func(vm *VM) int64 { return int64(vm.cycles) },
+	"n":      flagIdent(flagNegative),
+	"v":      flagIdent(flagOverflow),
+	"b":      flagIdent(flagBreak),
+	"d":      flagIdent(flagDecimalMode),
+	"i":      flagIdent(flagDisableInterrupts),
+	"z":      flagIdent(flagZero),
+	"c":      flagIdent(flagCarry),
+}
+
+// binaryPrecedence lists the binary operators from loosest to tightest binding
+var binaryPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// exprOperators holds every operator token, longest first so the lexer matches greedily
+var exprOperators = []string{
+	"||", "&&", "==", "!=", "<=", ">=", "<<", ">>",
+	"|", "^", "&", "<", ">", "+", "-", "*", "/", "%", "!", "~", "(", ")", "[", "]",
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	val  int64
+	pos  int
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '$' || c == '%' && !followsOperand(tokens) || isDigit(c):
+			start := i
+			base := 10
+			switch {
+			case c == '$':
+				base, i = 16, i+1
+			case c == '%':
+				base, i = 2, i+1
+			case c == '0' && i+1 < len(src) && (src[i+1] == 'x' || src[i+1] == 'X'):
+				base, i = 16, i+2
+			}
+			digits := i
+			for i < len(src) && (isDigit(src[i]) || isHexLetter(src[i])) {
+				i++
+			}
+			v, err := strconv.ParseInt(src[digits:i], base, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad number %q at column %d", src[start:i], start+1)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[start:i], val: v, pos: start})
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[start:i], pos: start})
+		default:
+			op := ""
+			for _, candidate := range exprOperators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at column %d", c, i+1)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+// followsOperand reports whether the last token ends an operand, in which case a '%' is the
+// modulo operator rather than the start of a binary number
+func followsOperand(tokens []token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.kind != tokenOperator || last.text == ")" || last.text == "]"
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexLetter(c byte) bool {
+	return c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '.'
+}
+
+// exprParser is a small precedence climbing parser for breakpoint conditions
+type exprParser struct {
+	tokens  []token
+	pos     int
+	symbols *symbols
+}
+
+func parseExpr(src string, syms *symbols) (exprNode, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, symbols: syms}
+	n, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at column %d", t.text, t.pos+1)
+	}
+	return n, nil
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) expect(op string) error {
+	t := p.next()
+	if t.kind != tokenOperator || t.text != op {
+		if t.kind == tokenEOF {
+			return fmt.Errorf("expected %q at end of expression", op)
+		}
+		return fmt.Errorf("expected %q at column %d, got %q", op, t.pos+1, t.text)
+	}
+	return nil
+}
+
+func (p *exprParser) parseBinary(level int) (exprNode, error) {
+	if level == len(binaryPrecedence) {
+		return p.parseUnary()
+	}
+	l, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenOperator || !containsOp(binaryPrecedence[level], t.text) {
+			return l, nil
+		}
+		p.next()
+		r, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l = binaryNode{op: t.text, l: l, r: r}
+	}
+}
+
+func containsOp(ops []string, op string) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	t := p.peek()
+	if t.kind == tokenOperator && (t.text == "!" || t.text == "-" || t.text == "~") {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: t.text, x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return numberNode(t.val), nil
+	case tokenIdent:
+		name := strings.ToLower(t.text)
+		if name == "mem" {
+			if err := p.expect("["); err != nil {
+				return nil, err
+			}
+			addr, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			return memNode{addr: addr}, nil
+		}
+		if ident, ok := exprIdents[name]; ok {
+			return ident, nil
+		}
+		if addr, ok := p.symbols.resolve(t.text); ok {
+			return numberNode(addr), nil
+		}
+		return nil, fmt.Errorf("unknown identifier %q at column %d", t.text, t.pos+1)
+	case tokenOperator:
+		if t.text == "(" {
+			n, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		}
+		return nil, fmt.Errorf("unexpected %q at column %d", t.text, t.pos+1)
+	}
+	return nil, errors.New("unexpected end of expression")
+}
@@ -0,0 +1,185 @@
+package vm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	vm := newFlatVM()
+	vm.cpu.a, vm.cpu.x, vm.cpu.y = 0x8D, 3, 0xFF
+	vm.cpu.sp, vm.cpu.pc = 0xFD, 0x0280
+	vm.cpu.ps = flagDefault | flagCarry | flagNegative
+	vm.cycles = 1234
+	vm.mem[0x24] = 0x10
+	vm.mem[0x0013] = 0x77
+	vm.symbols.add("START", 0x0280)
+
+	tests := []struct {
+		expr string
+		want int64
+	}{
+		// Numbers
+		{"141", 141},
+		{"$8D", 0x8D},
+		{"0x8d", 0x8D},
+		{"%10001101", 0x8D},
+
+		// Precedence and associativity
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"100 / 10 / 5", 2},
+		{"7 % 4 + 1", 4},
+		{"1 << 2 + 1", 8},
+		{"1 + 1 == 2", 1},
+		{"1 < 2 == 1", 1},
+		{"6 & 3 == 3", 0},
+		{"1 | 2 ^ 3 & 1", 3},
+		{"0 && 1 || 1", 1},
+		{"1 || 0 && 0", 1},
+
+		// Unary operators
+		{"-5 + 10", 5},
+		{"!0", 1},
+		{"!7", 0},
+		{"~0 & $FF", 0xFF},
+		{"--3", 3},
+		{"!(1 == 2)", 1},
+
+		// Division by zero evaluates to 0 rather than failing
+		{"5 / 0", 0},
+		{"5 % 0", 0},
+
+		// Registers, flags and the cycle count, in any case
+		{"A", 0x8D},
+		{"a == $8D && X > 2", 1},
+		{"Y", 0xFF},
+		{"SP", 0xFD},
+		{"pc", 0x0280},
+		{"P", int64(flagDefault | flagCarry | flagNegative)},
+		{"C", 1},
+		{"N + V + Z", 1},
+		{"cycles > 1000", 1},
+
+		// Memory, with computed addresses
+		{"mem[$24]", 0x10},
+		{"mem[$10 + X]", 0x77},
+		{"mem[mem[$24] + 3]", 0x77},
+
+		// Labels
+		{"PC == START", 1},
+		{"start + 1", 0x0281},
+		{"ECHO", 0xFFEF},
+	}
+	for _, tt := range tests {
+		got, err := vm.Evaluate(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "unexpected end of expression"},
+		{"1 +", "unexpected end of expression"},
+		{"(1 + 2", `expected ")" at end of expression`},
+		{"mem[1", `expected "]" at end of expression`},
+		{"mem 1", `expected "[" at column 5, got "1"`},
+		{"1 2", `unexpected "2" at column 3`},
+		{"A == NOWHERE", `unknown identifier "NOWHERE" at column 6`},
+		{"A @ 1", `unexpected '@' at column 3`},
+		{"$", `bad number "$" at column 1`},
+		{"%102", `bad number "%102" at column 1`},
+		{"* 2", `unexpected "*" at column 1`},
+	}
+	vm := newFlatVM()
+	for _, tt := range tests {
+		_, err := vm.Evaluate(tt.expr)
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got error %q, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestBreakpointEdgeTriggered(t *testing.T) {
+	vm := newFlatVM()
+	vm.SetClockSpeed(0)
+	// loop: INX; JMP loop
+	vm.load(0x0200, []byte{0xE8, 0x4C, 0x00, 0x02})
+	vm.cpu.pc = 0x0200
+	if err := vm.AddBreakpoint("cycles > 100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.AddBreakpoint("X == 200"); err != nil {
+		t.Fatal(err)
+	}
+
+	halt := func() string {
+		t.Helper()
+		h, ok := vm.Run(context.Background()).(*Halt)
+		if !ok {
+			t.Fatalf("expected a breakpoint to halt the vm")
+		}
+		return h.Breakpoint
+	}
+
+	if bp := halt(); bp != "cycles > 100" || vm.cycles > 105 {
+		t.Fatalf("halted on %q after %d cycles, want cycles > 100 after about 100", bp, vm.cycles)
+	}
+	// The cycle condition still holds, so resuming runs on to the next one to become true
+	if bp := halt(); bp != "X == 200" {
+		t.Fatalf("halted on %q, want X == 200", bp)
+	}
+	// X comes back around to 200 after wrapping, and the breakpoint fires again
+	before := vm.cycles
+	if bp := halt(); bp != "X == 200" || vm.cycles-before != 256*5 {
+		t.Fatalf("halted on %q after %d cycles, want X == 200 after %d", bp, vm.cycles-before, 256*5)
+	}
+}
+
+func TestRunCyclesHonoursBreakpoints(t *testing.T) {
+	vm := newFlatVM()
+	// loop: INX; JMP loop
+	vm.load(0x0200, []byte{0xE8, 0x4C, 0x00, 0x02})
+	vm.cpu.pc = 0x0200
+	if err := vm.AddBreakpoint("X == 10"); err != nil {
+		t.Fatal(err)
+	}
+	ran, err := vm.RunCycles(100000)
+	if _, ok := err.(*Halt); !ok {
+		t.Fatalf("got %v, want a breakpoint halt", err)
+	}
+	if vm.cpu.x != 10 || ran != 9*5+2 {
+		t.Errorf("halted with X=%d after %d cycles, want X=10 after %d", vm.cpu.x, ran, 9*5+2)
+	}
+}
+
+func TestBreakpointLevelTriggered(t *testing.T) {
+	vm := newFlatVM()
+	vm.SetClockSpeed(0)
+	// loop: INX; JMP loop
+	vm.load(0x0200, []byte{0xE8, 0x4C, 0x00, 0x02})
+	vm.cpu.pc = 0x0200
+	if err := vm.AddLevelBreakpoint("PC >= $0200 && PC <= $0201"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []uint16{0x0201, 0x0200, 0x0201} {
+		if _, ok := vm.Run(context.Background()).(*Halt); !ok || vm.cpu.pc != want {
+			t.Fatalf("halted at $%04X, want every instruction in the range to halt, next $%04X", vm.cpu.pc, want)
+		}
+	}
+}
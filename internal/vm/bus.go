@@ -0,0 +1,185 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Device is memory mapped hardware attached to the vm's address space. A device is handed
+// every access to the pages it is attached to and does its own address decoding.
+type Device interface {
+	Read(addr uint16) byte
+	Write(addr uint16, b byte)
+}
+
+// Peeker is implemented by devices whose reads have side effects, such as clearing a status
+// flag. Debuggers read through Peek so that inspecting memory doesn't disturb the device.
+type Peeker interface {
+	Peek(addr uint16) byte
+}
+
+// pageKind describes what responds to accesses within a 256 byte page
+type pageKind int
+
+const (
+	pageRAM pageKind = iota
+	pageROM
+	pageUnmapped
+	pageDevice
+)
+
+// page is one entry in the vm's 256 entry page table
+type page struct {
+	kind   pageKind
+	device Device
+}
+
+// read returns the byte at addr as seen by the cpu, logging data reads for the code/data log
+// and watchpoints
+func (vm *VM) read(addr uint16) byte {
+	if (vm.coverage != nil || vm.watchpoints != nil) && addr-vm.instr >= vm.instrSize {
+		vm.dataAccess(addr, false)
+	}
+	return vm.busRead(addr)
+}
+
+// write stores b at addr as the cpu would, logging it for the code/data log and watchpoints
+func (vm *VM) write(addr uint16, b byte) {
+	if vm.coverage != nil || vm.watchpoints != nil {
+		vm.dataAccess(addr, true)
+	}
+	vm.busWrite(addr, b)
+}
+
+// dataAccess records a data read or write made by the executing instruction. Fetching the
+// instruction's own opcode and operand isn't a data access.
+func (vm *VM) dataAccess(addr uint16, store bool) {
+	if vm.coverage != nil {
+		if store {
+			vm.coverage.flags[addr] |= CDLWrite
+		} else {
+			vm.coverage.flags[addr] |= CDLRead
+		}
+	}
+	if vm.watchHit == nil {
+		vm.watchHit = vm.watchpointHit(addr, store)
+	}
+}
+
+// busRead returns the byte at addr as seen by the cpu. Nothing drives the data bus when an
+// unmapped address is read, so the value last on it is read back.
+func (vm *VM) busRead(addr uint16) byte {
+	p := &vm.pages[addr>>8]
+	switch p.kind {
+	case pageDevice:
+		vm.dataBus = p.device.Read(addr)
+	case pageRAM, pageROM:
+		vm.dataBus = vm.mem[addr]
+	}
+	return vm.dataBus
+}
+
+// busWrite stores b at addr as the cpu would, ignoring writes to ROM and unmapped pages
+func (vm *VM) busWrite(addr uint16, b byte) {
+	vm.dataBus = b
+	p := &vm.pages[addr>>8]
+	switch p.kind {
+	case pageRAM:
+		vm.mem[addr] = b
+	case pageDevice:
+		p.device.Write(addr, b)
+	}
+}
+
+// peek returns the byte at addr without triggering device side effects where possible
+func (vm *VM) peek(addr uint16) byte {
+	p := &vm.pages[addr>>8]
+	switch p.kind {
+	case pageDevice:
+		if peeker, ok := p.device.(Peeker); ok {
+			return peeker.Peek(addr)
+		}
+		return p.device.Read(addr)
+	case pageUnmapped:
+		return vm.dataBus
+	}
+	return vm.mem[addr]
+}
+
+// Read returns the byte at addr exactly as the cpu would see it, device side effects included
+func (vm *VM) Read(addr uint16) byte {
+	return vm.busRead(addr)
+}
+
+// Write stores b at addr exactly as the cpu would, so writes to ROM are ignored
+func (vm *VM) Write(addr uint16, b byte) {
+	vm.busWrite(addr, b)
+}
+
+// Peek returns the byte at addr without disturbing devices that implement Peeker
+func (vm *VM) Peek(addr uint16) byte {
+	return vm.peek(addr)
+}
+
+// Load copies data into RAM and ROM starting at addr, bypassing write protection. Pages that
+// are unmapped or belong to a device are skipped.
+func (vm *VM) Load(addr uint16, data []byte) {
+	for i, b := range data {
+		a := int(addr) + i
+		if a > 0xFFFF {
+			return
+		}
+		if kind := vm.pages[a>>8].kind; kind == pageRAM || kind == pageROM {
+			vm.mem[a] = b
+		}
+	}
+}
+
+// SetRAMSize limits RAM to the first size bytes of the address space, rounded up to a whole
+// page. Pages above it that hold neither ROM nor a device become unmapped.
+func (vm *VM) SetRAMSize(size int) error {
+	if size < 0x200 || size > 0x10000 {
+		return fmt.Errorf("ram size %d out of range, need room for the zero page and stack up to 64KiB", size)
+	}
+	top := (size + 0xFF) >> 8
+	for i := range vm.pages {
+		switch {
+		case i < top && vm.pages[i].kind == pageUnmapped:
+			vm.pages[i].kind = pageRAM
+		case i >= top && vm.pages[i].kind == pageRAM:
+			vm.pages[i].kind = pageUnmapped
+		}
+	}
+	return nil
+}
+
+// MapROM maps data as read-only memory starting at addr, which must be page aligned. The
+// last page is entirely read-only even if data doesn't fill it.
+func (vm *VM) MapROM(addr uint16, data []byte) error {
+	if addr&0xFF != 0 {
+		return fmt.Errorf("rom at $%04X must start on a page boundary", addr)
+	}
+	if len(data) == 0 || int(addr)+len(data) > 0x10000 {
+		return fmt.Errorf("rom of %d bytes doesn't fit at $%04X", len(data), addr)
+	}
+	copy(vm.mem[addr:], data)
+	last := (int(addr) + len(data) - 1) >> 8
+	for i := int(addr >> 8); i <= last; i++ {
+		vm.pages[i] = page{kind: pageROM}
+	}
+	return nil
+}
+
+// Attach maps d over every page from start to end inclusive, replacing whatever was there
+func (vm *VM) Attach(start, end uint16, d Device) error {
+	if d == nil {
+		return errors.New("cannot attach a nil device")
+	}
+	if end < start {
+		return fmt.Errorf("device range $%04X-$%04X is empty", start, end)
+	}
+	for i := int(start >> 8); i <= int(end>>8); i++ {
+		vm.pages[i] = page{kind: pageDevice, device: d}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package vm
+
+import "fmt"
+
+// Frame is one subroutine call on the vm's call stack
+type Frame struct {
+	Caller uint16 // address of the JSR or BRK that made the call
+	Entry  uint16 // address the call jumped to
+	SP     byte   // stack pointer once the return address was pushed, the frame returns once SP rises above it
+}
+
+// Opcodes that enter a subroutine or interrupt handler
+const (
+	opJSR byte = 0x20
+	opBRK byte = 0x00
+)
+
+// trackCalls updates the call stack after the instruction at pc executed. Calls are pushed on
+// JSR and BRK. A frame is dropped once the stack pointer rises above where its return address
+// was pushed, so returns, routines that discard their return address with PLA and programs
+// that reset the stack with TXS all unwind it.
+func (vm *VM) trackCalls(pc uint16, opcode byte) {
+	for n := len(vm.calls); n > 0 && vm.calls[n-1].SP < vm.cpu.sp; n-- {
+		vm.calls = vm.calls[:n-1]
+		vm.callGen++
+	}
+	if opcode == opJSR || opcode == opBRK {
+		vm.calls = append(vm.calls, Frame{Caller: pc, Entry: vm.cpu.pc, SP: vm.cpu.sp})
+		vm.callGen++
+	}
+}
+
+// CallStack returns the subroutine calls in progress, outermost first. It is reconstructed by
+// watching JSR, BRK and the stack pointer, so code that jumps through pushed addresses can
+// confuse it.
+func (vm *VM) CallStack() []Frame {
+	return append([]Frame(nil), vm.calls...)
+}
+
+// ReturnCondition returns a breakpoint condition that holds once the stack pointer has risen
+// above sp, as it does when a call whose return address was pushed at sp returns. The stack
+// wraps within page one, so SP counts as above sp when it is up to 128 bytes higher modulo 256.
+func ReturnCondition(sp byte) string {
+	return fmt.Sprintf("((SP - $%02X - 1) & $FF) < $80", sp)
+}
@@ -0,0 +1,117 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// irqVector holds the address of the IRQ and BRK handler
+const irqVector uint16 = 0xFFFE
+
+// Range is an inclusive range of addresses
+type Range struct {
+	Start uint16
+	End   uint16
+}
+
+// Card is a card plugged into the Apple 1's expansion slot. The slot brings out the whole
+// address and data bus, so a card can decode any addresses it likes, as well as the reset
+// and IRQ lines and the clock.
+type Card interface {
+	Device
+
+	// Ranges returns the addresses the card decodes. Every page they touch is handed to the
+	// card, which does its own finer decoding.
+	Ranges() []Range
+
+	// Reset is called when the machine is reset
+	Reset()
+
+	// Tick is called after every instruction with the number of cycles it took
+	Tick(cycles int)
+
+	// IRQ reports whether the card is holding the IRQ line low
+	IRQ() bool
+}
+
+// BusMaster is implemented by cards that read and write memory themselves, as a card driving
+// the slot's address and data lines can. InsertCard hands them the bus to do it through.
+type BusMaster interface {
+	SetBus(bus Device)
+}
+
+// Exiter is implemented by cards that can end the emulation, such as a debug port with an
+// exit code register. A request is reported once.
+type Exiter interface {
+	ExitRequested() (code int, ok bool)
+}
+
+// InsertCard plugs c into the expansion slot, mapping it over the pages of its ranges. Cards
+// inserted later take precedence where ranges overlap.
+func (vm *VM) InsertCard(c Card) error {
+	if c == nil {
+		return errors.New("cannot insert a nil card")
+	}
+	ranges := c.Ranges()
+	if len(ranges) == 0 {
+		return errors.New("card doesn't decode any addresses")
+	}
+	for _, r := range ranges {
+		if r.End < r.Start {
+			return fmt.Errorf("card range $%04X-$%04X is empty", r.Start, r.End)
+		}
+	}
+	for _, r := range ranges {
+		vm.Attach(r.Start, r.End, c)
+	}
+	if m, ok := c.(BusMaster); ok {
+		m.SetBus(vm)
+	}
+	if x, ok := c.(Exiter); ok {
+		vm.exiters = append(vm.exiters, x)
+	}
+	vm.cards = append(vm.cards, c)
+	return nil
+}
+
+// Cards returns the cards in the expansion slot in the order they were inserted
+func (vm *VM) Cards() []Card {
+	return append([]Card(nil), vm.cards...)
+}
+
+// tickCards clocks the cards through an instruction and takes an interrupt if one of them is
+// requesting it and interrupts are enabled. It returns an *Exit if a card asks to exit.
+func (vm *VM) tickCards(cycles int) error {
+	irq := false
+	for _, c := range vm.cards {
+		c.Tick(cycles)
+		irq = irq || c.IRQ()
+	}
+	if irq && vm.getFlag(flagDisableInterrupts) == 0 {
+		vm.interrupt(irqVector)
+	}
+	for _, x := range vm.exiters {
+		if code, ok := x.ExitRequested(); ok {
+			return &Exit{Code: code}
+		}
+	}
+	return nil
+}
+
+// interrupt performs the 6502's interrupt sequence: pushing PC and the status register with
+// the break flag clear, disabling interrupts and jumping through vector
+func (vm *VM) interrupt(vector uint16) {
+	pc := vm.cpu.pc
+	vm.pushDWordToStack(pc)
+	vm.pushWordToStack(vm.cpu.ps&^flagBreak | flagDefault&^flagBreak)
+
+	vm.setFlag(flagDisableInterrupts)
+	if vm.variant == CMOS65C02 {
+		vm.clearFlag(flagDecimalMode)
+	}
+	vm.cpu.pc = uint16(vm.read(vector+1))<<8 | uint16(vm.read(vector))
+	vm.cycles += 7
+
+	vm.calls = append(vm.calls, Frame{Caller: pc, Entry: vm.cpu.pc, SP: vm.cpu.sp})
+	vm.callGen++
+}
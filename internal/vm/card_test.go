@@ -0,0 +1,126 @@
+package vm
+
+import (
+	"context"
+	"testing"
+)
+
+// testCard is a card answering every read in its range with id
+type testCard struct {
+	ranges []Range
+	id     byte
+	irq    bool
+	ticks  int
+	exit   int // exit code to request once, or -1
+}
+
+func (c *testCard) Ranges() []Range           { return c.ranges }
+func (c *testCard) Read(addr uint16) byte     { return c.id }
+func (c *testCard) Write(addr uint16, b byte) {}
+func (c *testCard) Reset()                    {}
+func (c *testCard) Tick(cycles int)           { c.ticks += cycles }
+func (c *testCard) IRQ() bool                 { return c.irq }
+
+func (c *testCard) ExitRequested() (int, bool) {
+	code := c.exit
+	c.exit = -1
+	return code, code >= 0
+}
+
+func newTestCard(id byte, start, end uint16) *testCard {
+	return &testCard{ranges: []Range{{Start: start, End: end}}, id: id, exit: -1}
+}
+
+func TestInsertCard(t *testing.T) {
+	vm := New()
+	first, second := newTestCard(1, 0xC000, 0xC1FF), newTestCard(2, 0xC100, 0xC2FF)
+	for _, c := range []*testCard{first, second} {
+		if err := vm.InsertCard(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func() {
+		t.Helper()
+		for addr, want := range map[uint16]byte{0xC000: 1, 0xC0FF: 1, 0xC100: 2, 0xC2FF: 2} {
+			if got := vm.Read(addr); got != want {
+				t.Errorf("$%04X read card %d, want card %d", addr, got, want)
+			}
+		}
+	}
+	check()
+
+	// Cards stay mapped over a new memory map
+	if err := vm.SetMemoryMap(MemoryMap{{Kind: RegionRAM, Start: 0x0000, End: 0xFFFF}}); err != nil {
+		t.Fatal(err)
+	}
+	check()
+
+	if err := vm.InsertCard(&testCard{}); err == nil {
+		t.Error("expected an error for a card without ranges")
+	}
+	if err := vm.InsertCard(newTestCard(3, 0xC200, 0xC100)); err == nil {
+		t.Error("expected an error for an empty range")
+	}
+	if n := len(vm.Cards()); n != 2 {
+		t.Errorf("%d cards inserted, want 2", n)
+	}
+}
+
+func TestCardIRQ(t *testing.T) {
+	vm := newFlatVM()
+	card := newTestCard(0, 0xC000, 0xC0FF)
+	if err := vm.InsertCard(card); err != nil {
+		t.Fatal(err)
+	}
+	// SEI; CLI; loop: JMP loop, with the IRQ handler at $0300
+	vm.load(0x0200, []byte{0x78, 0x58, 0x4C, 0x02, 0x02})
+	vm.mem[0xFFFE], vm.mem[0xFFFF] = 0x00, 0x03
+	vm.cpu.pc = 0x0200
+	card.irq = true
+
+	step := func() {
+		t.Helper()
+		if _, err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Masked while interrupts are disabled
+	step()
+	if vm.cpu.pc != 0x0201 {
+		t.Fatalf("PC=$%04X after SEI, want $0201", vm.cpu.pc)
+	}
+	step()
+	if vm.cpu.pc != 0x0300 {
+		t.Fatalf("PC=$%04X after CLI with IRQ held, want the handler at $0300", vm.cpu.pc)
+	}
+	if vm.getFlag(flagDisableInterrupts) == 0 {
+		t.Error("interrupts still enabled in the handler")
+	}
+	pushed := vm.mem[StackBottom+uint16(vm.cpu.sp)+1]
+	if pushed&flagBreak != 0 {
+		t.Errorf("pushed P=$%02X with the break flag set", pushed)
+	}
+	if ret := uint16(vm.mem[StackBottom+0xFF])<<8 | uint16(vm.mem[StackBottom+0xFE]); ret != 0x0202 {
+		t.Errorf("pushed return address $%04X, want $0202", ret)
+	}
+	if card.ticks == 0 {
+		t.Error("the card wasn't clocked")
+	}
+}
+
+func TestCardExit(t *testing.T) {
+	vm := newFlatVM()
+	vm.SetClockSpeed(0)
+	card := newTestCard(0, 0xC000, 0xC0FF)
+	if err := vm.InsertCard(card); err != nil {
+		t.Fatal(err)
+	}
+	vm.load(0x0200, []byte{0x4C, 0x00, 0x02}) // JMP *
+	vm.cpu.pc = 0x0200
+	card.exit = 3
+
+	exit, ok := vm.Run(context.Background()).(*Exit)
+	if !ok || exit.Code != 3 {
+		t.Errorf("Run returned %v, want exit code 3", exit)
+	}
+}
@@ -0,0 +1,150 @@
+package vm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Flags recorded for each byte of memory by the code/data logger. Written out one byte per
+// address they make a CDL map in the spirit of emulators like FCEUX and Mesen.
+const (
+	CDLOpcode  byte = 0x01 // executed as the first byte of an instruction
+	CDLOperand byte = 0x02 // fetched as an instruction's operand
+	CDLRead    byte = 0x04 // read as data
+	CDLWrite   byte = 0x08 // written
+)
+
+// coverage is the code/data log: how each byte of memory has been used, and how many times
+// each address was executed
+type coverage struct {
+	flags [0x10000]byte
+	hits  [0x10000]uint64 // wide enough not to wrap however long a program runs
+}
+
+// StartCoverage starts logging how each byte of memory is used, discarding any earlier log
+func (vm *VM) StartCoverage() {
+	vm.coverage = &coverage{}
+}
+
+// execute logs the instruction at pc before it executes
+func (c *coverage) execute(pc uint16, size byte) {
+	c.flags[pc] |= CDLOpcode
+	c.hits[pc]++
+	for i := uint16(1); i < uint16(size); i++ {
+		c.flags[pc+i] |= CDLOperand
+	}
+}
+
+// CDL returns the code/data log, one byte of CDL flags per address
+func (vm *VM) CDL() []byte {
+	if vm.coverage == nil {
+		return nil
+	}
+	return append([]byte(nil), vm.coverage.flags[:]...)
+}
+
+// WriteCDL writes the code/data log as a 64KiB binary map holding each address's CDL flags
+func (vm *VM) WriteCDL(w io.Writer) error {
+	if vm.coverage == nil {
+		return errors.New("coverage wasn't started")
+	}
+	_, err := w.Write(vm.coverage.flags[:])
+	return err
+}
+
+// SourceLine is a line of assembly source
+type SourceLine struct {
+	File string
+	Line int
+}
+
+// LineMap maps the address of each assembled instruction to the source line it came from
+type LineMap map[uint16]SourceLine
+
+// LoadLineMap reads a line map from path. Each line holds an address in hex and the source
+// line assembled there, `$0280 hello.s:12`. Blank lines and lines starting with ; or # are
+// ignored.
+func LoadLineMap(path string) (LineMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := make(LineMap)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected an address and file:line", path, n)
+		}
+		addr, err := parseSymbolAddr(strings.TrimPrefix(strings.TrimPrefix(fields[0], "$"), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		sep := strings.LastIndexByte(fields[1], ':')
+		if sep < 0 {
+			return nil, fmt.Errorf("%s:%d: expected file:line, got %q", path, n, fields[1])
+		}
+		num, err := strconv.Atoi(fields[1][sep+1:])
+		if err != nil || num < 1 {
+			return nil, fmt.Errorf("%s:%d: invalid line number in %q", path, n, fields[1])
+		}
+		m[addr] = SourceLine{File: fields[1][:sep], Line: num}
+	}
+	return m, scanner.Err()
+}
+
+// WriteLCOV writes an lcov tracefile giving how many times the instruction on each source
+// line in lines was executed, for genhtml and coverage dashboards
+func (vm *VM) WriteLCOV(w io.Writer, lines LineMap) error {
+	if vm.coverage == nil {
+		return errors.New("coverage wasn't started")
+	}
+
+	// Several addresses can map to one source line, e.g. a macro, so hits are summed per line
+	files := make(map[string]map[int]uint64)
+	for addr, src := range lines {
+		if files[src.File] == nil {
+			files[src.File] = make(map[int]uint64)
+		}
+		files[src.File][src.Line] += vm.coverage.hits[addr]
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "TN:")
+	for _, name := range names {
+		hits := files[name]
+		nums := make([]int, 0, len(hits))
+		for n := range hits {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+
+		fmt.Fprintf(bw, "SF:%s\n", name)
+		covered := 0
+		for _, n := range nums {
+			fmt.Fprintf(bw, "DA:%d,%d\n", n, hits[n])
+			if hits[n] > 0 {
+				covered++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(nums), covered)
+	}
+	return bw.Flush()
+}
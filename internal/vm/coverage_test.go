@@ -0,0 +1,142 @@
+package vm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runTo steps vm until it reaches addr
+func runTo(t *testing.T, vm *VM, addr uint16) {
+	t.Helper()
+	for i := 0; vm.cpu.pc != addr; i++ {
+		if i == 1000 {
+			t.Fatalf("didn't reach $%04X", addr)
+		}
+		if _, err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCDL(t *testing.T) {
+	vm := newFlatVM()
+	vm.load(0x0300, []byte{0xAD, 0x10, 0x00, 0x8D, 0x11, 0x00}) // LDA $0010; STA $0011
+	vm.cpu.pc = 0x0300
+	if err := vm.WriteCDL(ioutil.Discard); err == nil {
+		t.Error("expected an error writing a log that wasn't started")
+	}
+	vm.StartCoverage()
+	runTo(t, vm, 0x0306)
+
+	want := map[uint16]byte{
+		0x0300: CDLOpcode, 0x0301: CDLOperand, 0x0302: CDLOperand,
+		0x0303: CDLOpcode, 0x0304: CDLOperand, 0x0305: CDLOperand,
+		0x0010: CDLRead, 0x0011: CDLWrite,
+	}
+	cdl := vm.CDL()
+	for addr, flags := range cdl {
+		if flags != want[uint16(addr)] {
+			t.Errorf("$%04X has flags $%02X, want $%02X", addr, flags, want[uint16(addr)])
+		}
+	}
+
+	var out bytes.Buffer
+	if err := vm.WriteCDL(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), cdl) || out.Len() != 0x10000 {
+		t.Errorf("wrote %d bytes, want the 64KiB log", out.Len())
+	}
+}
+
+// writeLineMap writes a line map file and returns its path
+func writeLineMap(t *testing.T, text string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "linemap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "prog.lines")
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLineMap(t *testing.T) {
+	path := writeLineMap(t, "; comment\n# another\n\n$0300 a.s:1\n0x0302 src/m.s:5\n0303 src/m.s:5\n")
+	m, err := LoadLineMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LineMap{0x0300: {"a.s", 1}, 0x0302: {"src/m.s", 5}, 0x0303: {"src/m.s", 5}}
+	if len(m) != len(want) {
+		t.Errorf("got %v, want %v", m, want)
+	}
+	for addr, src := range want {
+		if m[addr] != src {
+			t.Errorf("$%04X maps to %v, want %v", addr, m[addr], src)
+		}
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"$0300", "prog.lines:1: expected an address and file:line"},
+		{"$0300 a.s:1 extra", "prog.lines:1: expected an address and file:line"},
+		{"\n$XYZ a.s:1", "prog.lines:2: "},
+		{"$0300 a.s", `prog.lines:1: expected file:line, got "a.s"`},
+		{"$0300 a.s:x", `prog.lines:1: invalid line number in "a.s:x"`},
+		{"$0300 a.s:0", `prog.lines:1: invalid line number in "a.s:0"`},
+	}
+	for _, tt := range tests {
+		_, err := LoadLineMap(writeLineMap(t, tt.text))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got error %v, want %s", tt.text, err, tt.want)
+		}
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+	vm := newFlatVM()
+	vm.load(0x0300, []byte{0xA2, 0x03, 0xCA, 0xD0, 0xFD}) // LDX #3; loop: DEX; BNE loop
+	vm.cpu.pc = 0x0300
+	if err := vm.WriteLCOV(ioutil.Discard, nil); err == nil {
+		t.Error("expected an error writing coverage that wasn't started")
+	}
+	vm.StartCoverage()
+	runTo(t, vm, 0x0305)
+
+	// DEX and BNE share a line, as a macro's instructions would, so their hits are summed
+	lines := LineMap{0x0300: {"a.s", 1}, 0x0305: {"a.s", 4}, 0x0302: {"m.s", 5}, 0x0303: {"m.s", 5}}
+	var out bytes.Buffer
+	if err := vm.WriteLCOV(&out, lines); err != nil {
+		t.Fatal(err)
+	}
+	want := "TN:\n" +
+		"SF:a.s\nDA:1,1\nDA:4,0\nLF:2\nLH:1\nend_of_record\n" +
+		"SF:m.s\nDA:5,6\nLF:1\nLH:1\nend_of_record\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	// Counts carry on past 32 bits
+	vm.coverage.hits[0x0300] = 1<<32 - 1
+	vm.cpu.pc = 0x0300
+	if _, err := vm.Step(); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := vm.WriteLCOV(&out, LineMap{0x0300: {"a.s", 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "DA:1,4294967296\n") {
+		t.Errorf("got\n%s\nwant 4294967296 hits on line 1", out.String())
+	}
+}
@@ -16,6 +16,8 @@
 // zpg		....	zeropage                OPC $LL         operand is zeropage address (hi-byte is zero, address = $00LL)
 // zpg,X	....	zeropage, X-indexed     OPC $LL,X       operand is zeropage address; effective address is address incremented by X without carry **
 // zpg,Y	....	zeropage, Y-indexed     OPC $LL,Y       operand is zeropage address; effective address is address incremented by Y without carry **
+// (zpg)	....	zeropage, indirect      OPC ($LL)       operand is zeropage address; effective address is word in (LL, LL + 1) (65C02 only)
+// (abs,X)	....	X-indexed, indirect     OPC ($LLHH,X)   operand is address; effective address is word at address incremented by X (65C02 JMP only)
 //
 // 16-bit address words are little endian, lo(w)-byte first, followed by the hi(gh)-byte.
 //
@@ -25,6 +27,8 @@
 // 6502 instructions have the general form AAABBBCC, where AAA and CC define the opcode, and BBB defines the addressing mode
 package vm
 
+import "fmt"
+
 // addrMode is a type alias for a string, used below for defining addressing modes
 type addrMode int
 
@@ -42,8 +46,33 @@ const (
 	zeroPage
 	zeroPageXIndexed
 	zeroPageYIndexed
+	zeroPageIndirect
+	absoluteXIndexedIndirect
+)
+
+// Variant selects which member of the 6502 family the vm emulates
+type Variant int
+
+const (
+	// NMOS6502 is the original MOS Technology 6502 the Apple 1 shipped with
+	NMOS6502 Variant = iota
+
+	// CMOS65C02 is the 65C02 many Apple 1 replicas use. It adds instructions and an addressing
+	// mode, fixes the JMP ($xxFF) bug and sets N and Z correctly in decimal mode. The Rockwell
+	// and WDC bit manipulation instructions are not emulated.
+	CMOS65C02
 )
 
+func (v Variant) String() string {
+	switch v {
+	case NMOS6502:
+		return "6502"
+	case CMOS65C02:
+		return "65c02"
+	}
+	return fmt.Sprintf("Variant(%d)", int(v))
+}
+
 // Available cpu flags written as binary integer literals
 // https://wiki.nesdev.com/w/index.php/Status_flags
 // 7     bit     0
@@ -81,6 +110,16 @@ type Mos6502 struct {
 	ps byte   // register - processor status
 }
 
+// Registers is a snapshot of the cpu's registers
+type Registers struct {
+	A  byte   // accumulator
+	X  byte   // x index
+	Y  byte   // y index
+	SP byte   // stack pointer
+	PC uint16 // program counter
+	P  byte   // processor status
+}
+
 // newCPU initializes and returns a new Mos6502 CPU
 func newCPU() *Mos6502 {
 	return &Mos6502{
@@ -0,0 +1,85 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+)
+
+// Disassemble decodes the instruction at addr and returns it in assembler syntax along with
+// the address of the following instruction. Operand addresses with a known label are shown
+// by name.
+func (vm *VM) Disassemble(addr uint16) (string, uint16) {
+	o, err := vm.operation(vm.peek(addr))
+	if err != nil {
+		return fmt.Sprintf(".byte $%02X", vm.peek(addr)), addr + 1
+	}
+
+	lo := vm.peek(addr + 1)
+	word := uint16(vm.peek(addr+2))<<8 | uint16(lo)
+	next := addr + uint16(o.size)
+
+	var operand string
+	switch o.addrMode {
+	case accumulator:
+		operand = "A"
+	case absolute:
+		operand = vm.symbolOr(word, "$%04X")
+	case absoluteXIndexed:
+		operand = vm.symbolOr(word, "$%04X") + ",X"
+	case absoluteYIndexed:
+		operand = vm.symbolOr(word, "$%04X") + ",Y"
+	case immediate:
+		operand = fmt.Sprintf("#$%02X", lo)
+	case implied:
+		return o.name, next
+	case indirect:
+		operand = "(" + vm.symbolOr(word, "$%04X") + ")"
+	case indirectXIndexed:
+		operand = "(" + vm.symbolOr(uint16(lo), "$%02X") + ",X)"
+	case indirectYIndexed:
+		operand = "(" + vm.symbolOr(uint16(lo), "$%02X") + "),Y"
+	case relative:
+		operand = vm.symbolOr(next+uint16(int8(lo)), "$%04X")
+	case zeroPage:
+		operand = vm.symbolOr(uint16(lo), "$%02X")
+	case zeroPageXIndexed:
+		operand = vm.symbolOr(uint16(lo), "$%02X") + ",X"
+	case zeroPageYIndexed:
+		operand = vm.symbolOr(uint16(lo), "$%02X") + ",Y"
+	case zeroPageIndirect:
+		operand = "(" + vm.symbolOr(uint16(lo), "$%02X") + ")"
+	case absoluteXIndexedIndirect:
+		operand = "(" + vm.symbolOr(word, "$%04X") + ",X)"
+	}
+	return o.name + " " + operand, next
+}
+
+// symbolOr returns the label for addr, or addr formatted with format when it has none
+func (vm *VM) symbolOr(addr uint16, format string) string {
+	if name, ok := vm.symbols.lookup(addr); ok {
+		return name
+	}
+	return fmt.Sprintf(format, addr)
+}
+
+// SetTrace writes a line per executed instruction to w, or turns tracing off when w is nil
+func (vm *VM) SetTrace(w io.Writer) {
+	vm.trace = w
+}
+
+// traceInstruction writes the instruction about to execute at pc along with the registers
+func (vm *VM) traceInstruction(pc uint16) {
+	text, next := vm.Disassemble(pc)
+
+	var raw string
+	for addr := pc; addr != next; addr++ {
+		raw += fmt.Sprintf("%02X ", vm.peek(addr))
+	}
+	label, _ := vm.symbols.lookup(pc)
+
+	fmt.Fprintf(
+		vm.trace,
+		"%04X %-10s %-9s %-16s A=%02X X=%02X Y=%02X SP=%02X P=%02X cycles=%d\n",
+		pc, label, raw, text, vm.cpu.a, vm.cpu.x, vm.cpu.y, vm.cpu.sp, vm.cpu.ps, vm.cycles,
+	)
+}
@@ -0,0 +1,92 @@
+package vm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Klaus Dormann's 6502 test suites, https://github.com/Klaus2m5/6502_65C02_functional_tests
+// The binaries are vendored under testdata, see testdata/README.md for how they were built.
+const (
+	functionalTestStart   uint16 = 0x0400
+	functionalTestSuccess uint16 = 0x3469
+	functionalTestCase    uint16 = 0x0200 // current test number
+
+	decimalTestStart uint16 = 0x0200
+	decimalTestError uint16 = 0x000B // 0 once every combination passed
+	decimalTestN1    uint16 = 0x0000 // first operand of the failing combination
+	decimalTestN2    uint16 = 0x0001 // second operand of the failing combination
+
+	maxTestCycles = 200000000
+)
+
+func TestFunctional(t *testing.T) {
+	vm := loadTestBinary(t, "6502_functional_test.bin", 0x0000)
+	vm.cpu.pc = functionalTestStart
+
+	trap, err := runUntilTrap(vm, maxTestCycles)
+	if err != nil {
+		t.Fatalf("test case %d: %v\n%s", vm.mem[functionalTestCase], err, vm.DumpState())
+	}
+	if trap != functionalTestSuccess {
+		t.Fatalf(
+			"test case %d failed, trapped at $%04X instead of $%04X\n%s",
+			vm.mem[functionalTestCase], trap, functionalTestSuccess, vm.DumpState(),
+		)
+	}
+}
+
+func TestDecimalSuite(t *testing.T) {
+	vm := loadTestBinary(t, "6502_decimal_test.bin", decimalTestStart)
+	vm.cpu.pc = decimalTestStart
+
+	// The suite ends in either a JMP * trap or a STP ($DB), which an NMOS 6502 doesn't decode
+	if _, err := runUntilTrap(vm, maxTestCycles); err != nil {
+		if f, ok := err.(*Fault); !ok || f.Opcode != 0xDB {
+			t.Fatalf("%v\n%s", err, vm.DumpState())
+		}
+	}
+	if vm.mem[decimalTestError] != 0 {
+		t.Fatalf(
+			"decimal test failed with N1=$%02X N2=$%02X\n%s",
+			vm.mem[decimalTestN1], vm.mem[decimalTestN2], vm.DumpState(),
+		)
+	}
+}
+
+// loadTestBinary returns a vm with the named testdata binary loaded at addr
+func loadTestBinary(t *testing.T, name string, addr uint16) *VM {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("%v: the test binaries are vendored, run `make testdata` to fetch them again", err)
+	}
+	vm := newFlatVM()
+	vm.load(addr, data)
+	return vm
+}
+
+// newFlatVM returns a vm with RAM across the whole address space and no ROM or devices
+func newFlatVM() *VM {
+	vm := New()
+	vm.pages = [256]page{}
+	return vm
+}
+
+// runUntilTrap executes instructions until one jumps or branches to itself, returning its
+// address, or until maxCycles have run
+func runUntilTrap(vm *VM, maxCycles uint64) (uint16, error) {
+	for vm.cycles < maxCycles {
+		pc := vm.cpu.pc
+		if err := vm.emulateCycle(); err != nil {
+			return pc, err
+		}
+		if vm.cpu.pc == pc {
+			return pc, nil
+		}
+	}
+	return vm.cpu.pc, fmt.Errorf("no trap after %d cycles", maxCycles)
+}
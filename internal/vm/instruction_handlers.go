@@ -3,22 +3,23 @@ package vm
 // interrupt,                       N Z C I D V
 // push PC+2, push SR               - - - 1 - -
 func execBRK(vm *VM, o operation) error {
-	// set processer status flag to BRK
-	vm.cpu.ps = flagBreak
-
+	// BRK skips a padding byte, so the return address is the BRK + 2
 	vm.pushDWordToStack(vm.cpu.pc + 1)
-	vm.pushWordToStack(vm.cpu.ps)
+	vm.pushWordToStack(vm.cpu.ps | flagDefault)
 
 	vm.setFlag(flagDisableInterrupts)
-	vm.cpu.pc = uint16(vm.mem[0xFFFF])<<8 | uint16(vm.mem[0xFFFE])
+	if vm.variant == CMOS65C02 {
+		vm.clearFlag(flagDecimalMode)
+	}
+	vm.cpu.pc = uint16(vm.read(0xFFFF))<<8 | uint16(vm.read(0xFFFE))
 
 	return nil
 }
 
 // pull SR, pull PC                 N Z C I D V
-// from stack
+// from stack                       from stack
 func execRTI(vm *VM, o operation) error {
-	vm.cpu.ps = vm.popStackWord()
+	vm.cpu.ps = vm.popStackWord() | flagDefault
 	vm.cpu.pc = vm.popStackDWord()
 	return nil
 }
@@ -26,30 +27,42 @@ func execRTI(vm *VM, o operation) error {
 // M - 1 -> M                       N Z C I D V
 //                                  + + - - - -
 func execDEC(vm *VM, o operation) error {
+	if o.addrMode == accumulator {
+		vm.cpu.a--
+		vm.maybeSetFlagZero(vm.cpu.a)
+		vm.maybeSetFlagNegative(vm.cpu.a)
+		return nil
+	}
 	addr, err := vm.getAddr(o)
 	if err != nil {
 		return err
 	}
-	b := vm.mem[addr]
+	b := vm.read(addr)
 	b--
-	vm.mem[addr] = b
+	vm.write(addr, b)
 	vm.maybeSetFlagZero(b)
-	vm.maybeSetFlagOverflow(b)
+	vm.maybeSetFlagNegative(b)
 	return nil
 }
 
 // M + 1 -> M                       N Z C I D V
 //                                  + + - - - -
 func execINC(vm *VM, o operation) error {
+	if o.addrMode == accumulator {
+		vm.cpu.a++
+		vm.maybeSetFlagZero(vm.cpu.a)
+		vm.maybeSetFlagNegative(vm.cpu.a)
+		return nil
+	}
 	addr, err := vm.getAddr(o)
 	if err != nil {
 		return err
 	}
-	b := vm.mem[addr]
+	b := vm.read(addr)
 	b++
-	vm.mem[addr] = b
+	vm.write(addr, b)
 	vm.maybeSetFlagZero(b)
-	vm.maybeSetFlagOverflow(b)
+	vm.maybeSetFlagNegative(b)
 	return nil
 }
 
@@ -58,7 +71,7 @@ func execINC(vm *VM, o operation) error {
 func execINX(vm *VM, o operation) error {
 	vm.cpu.x++
 	vm.maybeSetFlagZero(vm.cpu.x)
-	vm.maybeSetFlagOverflow(vm.cpu.x)
+	vm.maybeSetFlagNegative(vm.cpu.x)
 	return nil
 }
 
@@ -67,7 +80,7 @@ func execINX(vm *VM, o operation) error {
 func execINY(vm *VM, o operation) error {
 	vm.cpu.y++
 	vm.maybeSetFlagZero(vm.cpu.y)
-	vm.maybeSetFlagOverflow(vm.cpu.y)
+	vm.maybeSetFlagNegative(vm.cpu.y)
 	return nil
 }
 
@@ -76,7 +89,7 @@ func execINY(vm *VM, o operation) error {
 func execTAX(vm *VM, o operation) error {
 	vm.cpu.x = vm.cpu.a
 	vm.maybeSetFlagZero(vm.cpu.x)
-	vm.maybeSetFlagOverflow(vm.cpu.x)
+	vm.maybeSetFlagNegative(vm.cpu.x)
 	return nil
 }
 
@@ -85,7 +98,7 @@ func execTAX(vm *VM, o operation) error {
 func execTAY(vm *VM, o operation) error {
 	vm.cpu.y = vm.cpu.a
 	vm.maybeSetFlagZero(vm.cpu.y)
-	vm.maybeSetFlagOverflow(vm.cpu.y)
+	vm.maybeSetFlagNegative(vm.cpu.y)
 	return nil
 }
 
@@ -94,7 +107,7 @@ func execTAY(vm *VM, o operation) error {
 func execDEX(vm *VM, o operation) error {
 	vm.cpu.x--
 	vm.maybeSetFlagZero(vm.cpu.x)
-	vm.maybeSetFlagOverflow(vm.cpu.x)
+	vm.maybeSetFlagNegative(vm.cpu.x)
 	return nil
 }
 
@@ -103,7 +116,7 @@ func execDEX(vm *VM, o operation) error {
 func execDEY(vm *VM, o operation) error {
 	vm.cpu.y--
 	vm.maybeSetFlagZero(vm.cpu.y)
-	vm.maybeSetFlagOverflow(vm.cpu.y)
+	vm.maybeSetFlagNegative(vm.cpu.y)
 	return nil
 }
 
@@ -116,7 +129,7 @@ func execLDA(vm *VM, o operation) error {
 	}
 	vm.cpu.a = operand
 	vm.maybeSetFlagZero(vm.cpu.a)
-	vm.maybeSetFlagOverflow(vm.cpu.a)
+	vm.maybeSetFlagNegative(vm.cpu.a)
 	return nil
 }
 
@@ -129,7 +142,7 @@ func execLDX(vm *VM, o operation) error {
 	}
 	vm.cpu.x = operand
 	vm.maybeSetFlagZero(vm.cpu.x)
-	vm.maybeSetFlagOverflow(vm.cpu.x)
+	vm.maybeSetFlagNegative(vm.cpu.x)
 	return nil
 }
 
@@ -142,7 +155,7 @@ func execLDY(vm *VM, o operation) error {
 	}
 	vm.cpu.y = operand
 	vm.maybeSetFlagZero(vm.cpu.y)
-	vm.maybeSetFlagOverflow(vm.cpu.y)
+	vm.maybeSetFlagNegative(vm.cpu.y)
 	return nil
 }
 
@@ -153,6 +166,32 @@ func execADC(vm *VM, o operation) error {
 	if err != nil {
 		return err
 	}
+	if vm.getFlag(flagDecimalMode) != 0 {
+		vm.addDecimal(b)
+		return nil
+	}
+	vm.addBinary(b)
+	return nil
+}
+
+// A - M - C -> A                   N Z C I D V
+//                                  + + + - - +
+func execSBC(vm *VM, o operation) error {
+	operand, err := vm.getOperand(o)
+	if err != nil {
+		return err
+	}
+	if vm.getFlag(flagDecimalMode) != 0 {
+		vm.subtractDecimal(operand)
+		return nil
+	}
+	// Binary subtraction is addition of the operand's ones' complement
+	vm.addBinary(^operand)
+	return nil
+}
+
+// addBinary adds b and the carry to the accumulator, setting N, Z, C and V
+func (vm *VM) addBinary(b byte) {
 	operand := uint16(b)
 	regA := uint16(vm.cpu.a)
 	sum := regA + operand + uint16(vm.getFlag(flagCarry))
@@ -170,43 +209,83 @@ func execADC(vm *VM, o operation) error {
 	}
 
 	vm.maybeSetFlagZero(vm.cpu.a)
-	vm.maybeSetFlagOverflow(vm.cpu.a)
-
-	return nil
+	vm.maybeSetFlagNegative(vm.cpu.a)
 }
 
-// A - M - C -> A                   N Z C I D V
-//                                  + + + - - +
-func execSBC(vm *VM, o operation) error {
-	operand, err := vm.getOperand(o)
-	if err != nil {
-		return err
+// addDecimal is ADC with the decimal flag set. On the NMOS 6502 the Z flag comes from the
+// binary sum while N and V come from the sum before the high nibble is adjusted. The 65C02
+// takes an extra cycle to set N and Z from the decimal result.
+// http://www.6502.org/tutorials/decimal_mode.html#A
+func (vm *VM) addDecimal(b byte) {
+	a := vm.cpu.a
+	carry := int(vm.getFlag(flagCarry))
+
+	lo := int(a&0x0F) + int(b&0x0F) + carry
+	if lo >= 0x0A {
+		lo = ((lo + 0x06) & 0x0F) + 0x10
 	}
+	sum := int(a&0xF0) + int(b&0xF0) + lo
+	signed := int(int8(a&0xF0)) + int(int8(b&0xF0)) + lo
 
-	carry := uint16(1 - vm.getFlag(flagCarry))
-	regA := vm.cpu.a
-	sum := uint16(regA) - carry - uint16(operand)
-	vm.cpu.a = byte(sum)
 	vm.clearFlag(flagOverflow)
-
-	if byte(regA)>>7 != vm.cpu.a>>7 {
+	if signed < -128 || signed > 127 {
 		vm.setFlag(flagOverflow)
 	}
+	vm.maybeSetFlagNegative(byte(signed))
+	vm.maybeSetFlagZero(a + b + byte(carry))
 
-	if uint16(sum) < 256 {
+	if sum >= 0xA0 {
+		sum += 0x60
+	}
+	vm.clearFlag(flagCarry)
+	if sum >= 0x100 {
 		vm.setFlag(flagCarry)
-	} else {
-		vm.clearFlag(flagCarry)
 	}
+	vm.cpu.a = byte(sum)
 
-	vm.clearFlag(flagOverflow)
-	if ((255-operand)^vm.cpu.a)&(regA^vm.cpu.a)&0x80 != 0 {
-		vm.setFlag(flagOverflow)
+	if vm.variant == CMOS65C02 {
+		vm.maybeSetFlagZero(vm.cpu.a)
+		vm.maybeSetFlagNegative(vm.cpu.a)
+		vm.extraCycles++
 	}
+}
 
-	vm.maybeSetFlagZero(vm.cpu.a)
-	vm.maybeSetFlagOverflow(vm.cpu.a)
-	return nil
+// subtractDecimal is SBC with the decimal flag set. On the NMOS 6502 every flag comes from
+// the equivalent binary subtraction, only the accumulator is decimal adjusted. The 65C02
+// adjusts differently and takes an extra cycle to set N and Z from the decimal result.
+// http://www.6502.org/tutorials/decimal_mode.html#A
+func (vm *VM) subtractDecimal(b byte) {
+	a := vm.cpu.a
+	carry := int(vm.getFlag(flagCarry))
+
+	lo := int(a&0x0F) - int(b&0x0F) + carry - 1
+	var diff int
+	if vm.variant == CMOS65C02 {
+		diff = int(a) - int(b) + carry - 1
+		if diff < 0 {
+			diff -= 0x60
+		}
+		if lo < 0 {
+			diff -= 0x06
+		}
+	} else {
+		if lo < 0 {
+			lo = ((lo - 0x06) & 0x0F) - 0x10
+		}
+		diff = int(a&0xF0) - int(b&0xF0) + lo
+		if diff < 0 {
+			diff -= 0x60
+		}
+	}
+
+	vm.addBinary(^b)
+	vm.cpu.a = byte(diff)
+
+	if vm.variant == CMOS65C02 {
+		vm.maybeSetFlagZero(vm.cpu.a)
+		vm.maybeSetFlagNegative(vm.cpu.a)
+		vm.extraCycles++
+	}
 }
 
 // X -> M                           N Z C I D V
@@ -216,7 +295,7 @@ func execSTX(vm *VM, o operation) error {
 	if err != nil {
 		return err
 	}
-	vm.mem[addr] = vm.cpu.x
+	vm.write(addr, vm.cpu.x)
 	return nil
 }
 
@@ -227,7 +306,7 @@ func execSTY(vm *VM, o operation) error {
 	if err != nil {
 		return err
 	}
-	vm.mem[addr] = vm.cpu.y
+	vm.write(addr, vm.cpu.y)
 	return nil
 }
 
@@ -238,7 +317,7 @@ func execSTA(vm *VM, o operation) error {
 	if err != nil {
 		return err
 	}
-	vm.mem[addr] = vm.cpu.a
+	vm.write(addr, vm.cpu.a)
 	return nil
 }
 
@@ -280,19 +359,23 @@ func execBVS(vm *VM, o operation) error {
 
 // bits 7 and 6 of operand are transfered to bit 7 and 6 of SR (N,V);
 // the zeroflag is set to the result of operand AND accumulator.
+// The 65C02's BIT #oper only sets the zeroflag.
 func execBIT(vm *VM, o operation) error {
 	operand, err := vm.getOperand(o)
 	if err != nil {
 		return err
 	}
 	vm.maybeSetFlagZero(vm.cpu.a & operand)
+	if o.addrMode == immediate {
+		return nil
+	}
 	vm.clearFlag(flagOverflow)
 
 	if operand&flagOverflow != 0 {
 		vm.setFlag(flagOverflow)
 	}
 
-	vm.maybeSetFlagOverflow(operand)
+	vm.maybeSetFlagNegative(operand)
 	return nil
 }
 
@@ -351,7 +434,7 @@ func execEOR(vm *VM, o operation) error {
 		return err
 	}
 	vm.cpu.a ^= operand
-	vm.maybeSetFlagOverflow(vm.cpu.a)
+	vm.maybeSetFlagNegative(vm.cpu.a)
 	vm.maybeSetFlagZero(vm.cpu.a)
 	return nil
 }
@@ -436,12 +519,18 @@ func execNOP(vm *VM, o operation) error {
 // (PC+1) -> PCL                    N Z C I D V
 // (PC+2) -> PCH                    - - - - - -
 func execJMP(vm *VM, o operation) error {
-	if o.addrMode == indirect {
+	if o.addrMode == indirect || o.addrMode == absoluteXIndexedIndirect {
 		addr, err := vm.getAddr(o)
 		if err != nil {
 			return err
 		}
-		vm.cpu.pc = vm.littleEndianToUint16(vm.mem[addr+1], vm.mem[addr])
+		// The NMOS 6502 fetches the high byte without carrying into the page, so
+		// JMP ($10FF) reads its target from $10FF and $1000
+		hi := addr + 1
+		if vm.variant == NMOS6502 {
+			hi = addr&0xFF00 | (addr+1)&0x00FF
+		}
+		vm.cpu.pc = vm.littleEndianToUint16(vm.read(hi), vm.read(addr))
 		return nil
 	}
 	addr, err := vm.getAddr(o)
@@ -463,7 +552,7 @@ func execPHA(vm *VM, o operation) error {
 //                                  + + - - - -
 func execTXA(vm *VM, o operation) error {
 	vm.cpu.a = vm.cpu.x
-	vm.maybeSetFlagOverflow(vm.cpu.a)
+	vm.maybeSetFlagNegative(vm.cpu.a)
 	vm.maybeSetFlagZero(vm.cpu.a)
 	return nil
 }
@@ -472,7 +561,7 @@ func execTXA(vm *VM, o operation) error {
 //                                  + + - - - -
 func execTYA(vm *VM, o operation) error {
 	vm.cpu.a = vm.cpu.y
-	vm.maybeSetFlagOverflow(vm.cpu.a)
+	vm.maybeSetFlagNegative(vm.cpu.a)
 	vm.maybeSetFlagZero(vm.cpu.a)
 	return nil
 }
@@ -481,7 +570,7 @@ func execTYA(vm *VM, o operation) error {
 //                                  + + - - - -
 func execTSX(vm *VM, o operation) error {
 	vm.cpu.x = vm.cpu.sp
-	vm.maybeSetFlagOverflow(vm.cpu.x)
+	vm.maybeSetFlagNegative(vm.cpu.x)
 	vm.maybeSetFlagZero(vm.cpu.x)
 	return nil
 }
@@ -490,23 +579,22 @@ func execTSX(vm *VM, o operation) error {
 //                                  + + - - - -
 func execPLA(vm *VM, o operation) error {
 	vm.cpu.a = vm.popStackWord()
-	vm.maybeSetFlagOverflow(vm.cpu.a)
+	vm.maybeSetFlagNegative(vm.cpu.a)
 	vm.maybeSetFlagZero(vm.cpu.a)
 	return nil
 }
 
-// pull SR from stack                  N Z C I D V
+// pull SR                          N Z C I D V
+//                                  from stack
 func execPLP(vm *VM, o operation) error {
-	vm.cpu.ps = vm.popStackWord() | 0B_00110000
-	vm.maybeSetFlagOverflow(vm.cpu.a)
-	vm.maybeSetFlagZero(vm.cpu.a)
+	vm.cpu.ps = vm.popStackWord() | flagDefault
 	return nil
 }
 
 // push SR                          N Z C I D V
 //                                  - - - - - -
 func execPHP(vm *VM, o operation) error {
-	vm.pushWordToStack(vm.cpu.ps)
+	vm.pushWordToStack(vm.cpu.ps | flagDefault)
 	return nil
 }
 
@@ -548,7 +636,7 @@ func execLSR(vm *VM, o operation) error {
 	}
 
 	vm.maybeSetFlagZero(operand)
-	vm.maybeSetFlagOverflow(operand)
+	vm.maybeSetFlagNegative(operand)
 
 	if o.addrMode == accumulator {
 		vm.cpu.a = operand
@@ -588,7 +676,7 @@ func execROL(vm *VM, o operation) error {
 	}
 
 	vm.maybeSetFlagZero(operand)
-	vm.maybeSetFlagOverflow(operand)
+	vm.maybeSetFlagNegative(operand)
 
 	if o.addrMode == accumulator {
 		vm.cpu.a = operand
@@ -608,7 +696,7 @@ func execTXS(vm *VM, o operation) error {
 	vm.cpu.sp = vm.cpu.x
 	// TODO: needed?
 	// vm.maybeSetFlagZero(vm.cpu.sp)
-	// vm.maybeSetFlagOverflow(vm.cpu.sp)
+	// vm.maybeSetFlagNegative(vm.cpu.sp)
 	return nil
 }
 
@@ -638,7 +726,7 @@ func execROR(vm *VM, o operation) error {
 	}
 
 	vm.maybeSetFlagZero(operand)
-	vm.maybeSetFlagOverflow(operand)
+	vm.maybeSetFlagNegative(operand)
 
 	if o.addrMode == accumulator {
 		vm.cpu.a = operand
@@ -669,7 +757,7 @@ func execASL(vm *VM, o operation) error {
 	operand <<= 1
 
 	vm.maybeSetFlagZero(operand)
-	vm.maybeSetFlagOverflow(operand)
+	vm.maybeSetFlagNegative(operand)
 
 	if o.addrMode == accumulator {
 		vm.cpu.a = operand
@@ -692,7 +780,7 @@ func execAND(vm *VM, o operation) error {
 	}
 	vm.cpu.a &= operand
 	vm.maybeSetFlagZero(vm.cpu.a)
-	vm.maybeSetFlagOverflow(vm.cpu.a)
+	vm.maybeSetFlagNegative(vm.cpu.a)
 	return nil
 }
 
@@ -705,6 +793,74 @@ func execORA(vm *VM, o operation) error {
 	}
 	vm.cpu.a |= operand
 	vm.maybeSetFlagZero(vm.cpu.a)
-	vm.maybeSetFlagOverflow(vm.cpu.a)
+	vm.maybeSetFlagNegative(vm.cpu.a)
+	return nil
+}
+
+// 65C02 only instructions
+
+// branch always                    N Z C I D V
+//                                  - - - - - -
+func execBRA(vm *VM, o operation) error {
+	return vm.branch(o)
+}
+
+// 0 -> M                           N Z C I D V
+//                                  - - - - - -
+func execSTZ(vm *VM, o operation) error {
+	return vm.setMem(o, 0)
+}
+
+// push X                           N Z C I D V
+//                                  - - - - - -
+func execPHX(vm *VM, o operation) error {
+	vm.pushWordToStack(vm.cpu.x)
+	return nil
+}
+
+// push Y                           N Z C I D V
+//                                  - - - - - -
+func execPHY(vm *VM, o operation) error {
+	vm.pushWordToStack(vm.cpu.y)
 	return nil
 }
+
+// pull X                           N Z C I D V
+//                                  + + - - - -
+func execPLX(vm *VM, o operation) error {
+	vm.cpu.x = vm.popStackWord()
+	vm.maybeSetFlagNegative(vm.cpu.x)
+	vm.maybeSetFlagZero(vm.cpu.x)
+	return nil
+}
+
+// pull Y                           N Z C I D V
+//                                  + + - - - -
+func execPLY(vm *VM, o operation) error {
+	vm.cpu.y = vm.popStackWord()
+	vm.maybeSetFlagNegative(vm.cpu.y)
+	vm.maybeSetFlagZero(vm.cpu.y)
+	return nil
+}
+
+// A AND M -> Z, M OR A -> M        N Z C I D V
+//                                  - + - - - -
+func execTSB(vm *VM, o operation) error {
+	operand, err := vm.getOperand(o)
+	if err != nil {
+		return err
+	}
+	vm.maybeSetFlagZero(vm.cpu.a & operand)
+	return vm.setMem(o, operand|vm.cpu.a)
+}
+
+// A AND M -> Z, M AND NOT A -> M   N Z C I D V
+//                                  - + - - - -
+func execTRB(vm *VM, o operation) error {
+	operand, err := vm.getOperand(o)
+	if err != nil {
+		return err
+	}
+	vm.maybeSetFlagZero(vm.cpu.a & operand)
+	return vm.setMem(o, operand&^vm.cpu.a)
+}
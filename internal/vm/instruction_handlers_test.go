@@ -0,0 +1,198 @@
+package vm
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testProgramAddr is where test programs are loaded and started
+const testProgramAddr uint16 = 0x0200
+
+// runProgram loads program at testProgramAddr on a flat vm, lets setup prepare registers and
+// memory, then executes n instructions
+func runProgram(t *testing.T, program []byte, n int, setup func(vm *VM)) *VM {
+	t.Helper()
+
+	vm := newFlatVM()
+	vm.load(testProgramAddr, program)
+	vm.cpu.pc = testProgramAddr
+	if setup != nil {
+		setup(vm)
+	}
+	for i := 0; i < n; i++ {
+		if err := vm.emulateCycle(); err != nil {
+			t.Fatalf("%v\n%s", err, vm.DumpState())
+		}
+	}
+	return vm
+}
+
+func TestNegativeFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		setup   func(vm *VM)
+	}{
+		{"LDA", []byte{0xA9, 0x80}, nil},
+		{"LDX", []byte{0xA2, 0x80}, nil},
+		{"LDY", []byte{0xA0, 0x80}, nil},
+		{"TAX", []byte{0xAA}, func(vm *VM) { vm.cpu.a = 0x80 }},
+		{"TAY", []byte{0xA8}, func(vm *VM) { vm.cpu.a = 0x80 }},
+		{"TXA", []byte{0x8A}, func(vm *VM) { vm.cpu.x = 0x80 }},
+		{"TYA", []byte{0x98}, func(vm *VM) { vm.cpu.y = 0x80 }},
+		{"INX", []byte{0xE8}, func(vm *VM) { vm.cpu.x = 0x7F }},
+		{"DEY", []byte{0x88}, func(vm *VM) { vm.cpu.y = 0x00 }},
+		{"INC", []byte{0xE6, 0x10}, func(vm *VM) { vm.mem[0x10] = 0x7F }},
+		{"EOR", []byte{0x49, 0xFF}, func(vm *VM) { vm.cpu.a = 0x01 }},
+		{"ASL", []byte{0x0A}, func(vm *VM) { vm.cpu.a = 0x40 }},
+		{"CMP", []byte{0xC9, 0x01}, func(vm *VM) { vm.cpu.a = 0x00 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := runProgram(t, tt.program, 1, tt.setup)
+			if vm.getFlag(flagNegative) == 0 {
+				t.Errorf("N clear, P=$%02X", vm.cpu.ps)
+			}
+			if vm.getFlag(flagOverflow) != 0 {
+				t.Errorf("V set, P=$%02X", vm.cpu.ps)
+			}
+		})
+	}
+}
+
+func TestStatusOnStack(t *testing.T) {
+	t.Run("PHP", func(t *testing.T) {
+		vm := runProgram(t, []byte{0x08}, 1, func(vm *VM) { vm.cpu.ps = flagCarry })
+		if got := vm.mem[StackBottom+0xFF]; got != flagCarry|flagDefault {
+			t.Errorf("pushed $%02X, want $%02X", got, flagCarry|flagDefault)
+		}
+	})
+
+	t.Run("PLP", func(t *testing.T) {
+		vm := runProgram(t, []byte{0xA9, 0x00, 0x48, 0x28}, 3, nil)
+		if vm.cpu.ps != flagDefault {
+			t.Errorf("P=$%02X, want $%02X", vm.cpu.ps, flagDefault)
+		}
+	})
+
+	t.Run("BRK", func(t *testing.T) {
+		vm := runProgram(t, []byte{0x00}, 1, func(vm *VM) {
+			vm.cpu.ps = flagDefault | flagZero
+			vm.mem[0xFFFE], vm.mem[0xFFFF] = 0x00, 0x30
+		})
+		if vm.cpu.pc != 0x3000 {
+			t.Errorf("PC=$%04X, want $3000", vm.cpu.pc)
+		}
+		if got := vm.mem[StackBottom+0xFD]; got != flagDefault|flagZero {
+			t.Errorf("pushed P=$%02X, want $%02X", got, flagDefault|flagZero)
+		}
+		if ret := uint16(vm.mem[StackBottom+0xFF])<<8 | uint16(vm.mem[StackBottom+0xFE]); ret != testProgramAddr+2 {
+			t.Errorf("pushed return address $%04X, want $%04X", ret, testProgramAddr+2)
+		}
+		if vm.getFlag(flagDisableInterrupts) == 0 {
+			t.Error("interrupts still enabled")
+		}
+	})
+
+	t.Run("RTI", func(t *testing.T) {
+		vm := runProgram(t, []byte{0x40}, 1, func(vm *VM) {
+			vm.cpu.sp = 0xFC
+			vm.mem[StackBottom+0xFD] = flagCarry
+			vm.mem[StackBottom+0xFE] = 0x34
+			vm.mem[StackBottom+0xFF] = 0x12
+		})
+		if vm.cpu.pc != 0x1234 || vm.cpu.ps != flagCarry|flagDefault {
+			t.Errorf("PC=$%04X P=$%02X, want $1234 and $%02X", vm.cpu.pc, vm.cpu.ps, flagCarry|flagDefault)
+		}
+	})
+}
+
+func TestIndirectWrapping(t *testing.T) {
+	t.Run("JMP ($10FF)", func(t *testing.T) {
+		vm := runProgram(t, []byte{0x6C, 0xFF, 0x10}, 1, func(vm *VM) {
+			vm.mem[0x10FF] = 0x34
+			vm.mem[0x1000] = 0x12
+			vm.mem[0x1100] = 0x56
+		})
+		if vm.cpu.pc != 0x1234 {
+			t.Errorf("PC=$%04X, want $1234", vm.cpu.pc)
+		}
+	})
+
+	t.Run("LDA ($FF,X)", func(t *testing.T) {
+		vm := runProgram(t, []byte{0xA1, 0xFE}, 1, func(vm *VM) {
+			vm.cpu.x = 1
+			vm.mem[0xFF], vm.mem[0x00] = 0x00, 0x30
+			vm.mem[0x3000] = 0x42
+		})
+		if vm.cpu.a != 0x42 {
+			t.Errorf("A=$%02X, want $42", vm.cpu.a)
+		}
+	})
+
+	t.Run("LDA ($FF),Y", func(t *testing.T) {
+		vm := runProgram(t, []byte{0xB1, 0xFF}, 1, func(vm *VM) {
+			vm.cpu.y = 2
+			vm.mem[0xFF], vm.mem[0x00] = 0x00, 0x30
+			vm.mem[0x3002] = 0x42
+		})
+		if vm.cpu.a != 0x42 {
+			t.Errorf("A=$%02X, want $42", vm.cpu.a)
+		}
+	})
+}
+
+// TestDecimal runs ADC and SBC in decimal mode with every pair of valid BCD operands and
+// both carries. The accumulator and carry are checked against decimal arithmetic, and the
+// flags the NMOS 6502 takes from the binary result against the same operation in binary.
+func TestDecimal(t *testing.T) {
+	bcd := func(n int) byte { return byte(n/10<<4 | n%10) }
+	vm := newFlatVM()
+
+	exec := func(opcode, a, b, carry, decimal byte) (byte, byte) {
+		vm.load(testProgramAddr, []byte{opcode, b})
+		vm.cpu.pc, vm.cpu.a = testProgramAddr, a
+		vm.cpu.ps = flagDefault | carry | decimal
+		if err := vm.emulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+		return vm.cpu.a, vm.cpu.ps
+	}
+
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 100; y++ {
+			for c := 0; c < 2; c++ {
+				a, b, carry := bcd(x), bcd(y), byte(c)
+
+				sum := x + y + c
+				gotA, gotP := exec(0x69, a, b, carry, flagDecimalMode)
+				_, binP := exec(0x69, a, b, carry, 0)
+				if err := checkDecimal(gotA, gotP, bcd(sum%100), sum >= 100, binP, flagZero); err != nil {
+					t.Fatalf("$%02X + $%02X + %d: %v", a, b, c, err)
+				}
+
+				diff := x - y - (1 - c)
+				gotA, gotP = exec(0xE9, a, b, carry, flagDecimalMode)
+				_, binP = exec(0xE9, a, b, carry, 0)
+				if err := checkDecimal(gotA, gotP, bcd((diff+100)%100), diff >= 0, binP, flagNegative|flagOverflow|flagZero); err != nil {
+					t.Fatalf("$%02X - $%02X - %d: %v", a, b, 1-c, err)
+				}
+			}
+		}
+	}
+}
+
+// checkDecimal compares the result of a decimal mode operation with the expected accumulator
+// and carry, and the given flags with those of the binary operation
+func checkDecimal(a, p, wantA byte, wantCarry bool, binP, binFlags byte) error {
+	if a != wantA {
+		return fmt.Errorf("A=$%02X, want $%02X", a, wantA)
+	}
+	if carry := p&flagCarry != 0; carry != wantCarry {
+		return fmt.Errorf("C=%t, want %t", carry, wantCarry)
+	}
+	if p&binFlags != binP&binFlags {
+		return fmt.Errorf("P=$%02X, want flags $%02X from the binary result P=$%02X", p, binFlags, binP)
+	}
+	return nil
+}
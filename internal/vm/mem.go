@@ -7,11 +7,8 @@ func newBlock() [64 * 1024]byte {
 	return [64 * 1024]byte{}
 }
 
-// load loads a program into memory at the provided address space
-func (b block) load(addr uint16, data []byte) {
-	end := int(addr) + len(data)
-
-	for i := int(addr); i < end; i++ {
-		b[int(addr)+i] = data[i]
-	}
+// load loads a program into memory at the provided address space. Data running past the
+// end of the address space is dropped.
+func (b *block) load(addr uint16, data []byte) {
+	copy(b[addr:], data)
 }
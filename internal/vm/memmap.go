@@ -0,0 +1,242 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RegionKind is what occupies a region of a memory map
+type RegionKind int
+
+const (
+	// RegionRAM is read/write memory
+	RegionRAM RegionKind = iota
+
+	// RegionROM is read-only memory, writes to it are ignored
+	RegionROM
+
+	// RegionUnmapped is address space nothing answers to. Reads return whatever was last on
+	// the data bus and writes are ignored.
+	RegionUnmapped
+
+	// RegionPIA is the keyboard and display PIA, partially decoded as on the Apple 1: it
+	// answers wherever A4 is set, so its four registers repeat every four bytes in the
+	// second half of every 32 bytes of the region. The rest of the region is open bus.
+	RegionPIA
+)
+
+var regionKindNames = map[RegionKind]string{
+	RegionRAM:      "ram",
+	RegionROM:      "rom",
+	RegionUnmapped: "unmapped",
+	RegionPIA:      "pia",
+}
+
+func (k RegionKind) String() string {
+	if name, ok := regionKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("RegionKind(%d)", int(k))
+}
+
+// Region is a range of whole pages in a memory map
+type Region struct {
+	Kind  RegionKind
+	Start uint16 // first address, at the start of a page
+	End   uint16 // last address, at the end of a page
+	ROM   []byte // contents of a ROM region, repeated to fill it like a partially decoded chip
+}
+
+// MemoryMap describes what answers to each part of the address space. Regions mustn't overlap,
+// and anything not covered is unmapped.
+type MemoryMap []Region
+
+// defaultMemoryMap returns the map a new vm starts with: RAM across the address space but for
+// the PIA's page at $D000, decoded as on the Apple 1, and the Woz Monitor at $FF00
+func defaultMemoryMap() MemoryMap {
+	return MemoryMap{
+		{Kind: RegionRAM, Start: 0x0000, End: 0xCFFF},
+		{Kind: RegionPIA, Start: 0xD000, End: 0xD0FF},
+		{Kind: RegionRAM, Start: 0xD100, End: wozMonitorAddr - 1},
+		{Kind: RegionROM, Start: wozMonitorAddr, End: 0xFFFF, ROM: wozMonitor[:]},
+	}
+}
+
+// wozMonitorROM names the built-in Woz Monitor in memory map ROM regions
+const wozMonitorROM = "wozmon"
+
+// SetMemoryMap replaces the vm's memory map, including any devices attached so far, though
+// cards in the expansion slot stay mapped over it. RAM keeps its contents.
+func (vm *VM) SetMemoryMap(m MemoryMap) error {
+	var pages [256]page
+	var owner [256]*Region
+	for i := range pages {
+		pages[i].kind = pageUnmapped
+	}
+	mem := vm.mem
+
+	for n := range m {
+		r := &m[n]
+		if r.Start&0xFF != 0 || r.End&0xFF != 0xFF || r.End < r.Start {
+			return fmt.Errorf("%v region $%04X-$%04X must cover whole pages", r.Kind, r.Start, r.End)
+		}
+		first, last := int(r.Start>>8), int(r.End>>8)
+		for i := first; i <= last; i++ {
+			if o := owner[i]; o != nil {
+				return fmt.Errorf("%v region $%04X-$%04X overlaps %v region $%04X-$%04X", r.Kind, r.Start, r.End, o.Kind, o.Start, o.End)
+			}
+			owner[i] = r
+		}
+
+		var p page
+		switch r.Kind {
+		case RegionRAM:
+			p.kind = pageRAM
+		case RegionROM:
+			size := int(r.End) - int(r.Start) + 1
+			if len(r.ROM) == 0 || size%len(r.ROM) != 0 {
+				return fmt.Errorf("rom of %d bytes doesn't evenly fill $%04X-$%04X", len(r.ROM), r.Start, r.End)
+			}
+			for off := 0; off < size; off += len(r.ROM) {
+				copy(mem[int(r.Start)+off:], r.ROM)
+			}
+			p.kind = pageROM
+		case RegionUnmapped:
+			p.kind = pageUnmapped
+		case RegionPIA:
+			p = page{kind: pageDevice, device: &piaDecoder{vm: vm}}
+		default:
+			return fmt.Errorf("unknown region kind %v", r.Kind)
+		}
+		for i := first; i <= last; i++ {
+			pages[i] = p
+		}
+	}
+
+	vm.pages = pages
+	vm.mem = mem
+	for _, c := range vm.cards {
+		for _, r := range c.Ranges() {
+			vm.Attach(r.Start, r.End, c)
+		}
+	}
+	return nil
+}
+
+// piaDecoder selects the PIA using only A4 and the register select lines A0 and A1, like the
+// Apple 1's address decoding
+type piaDecoder struct {
+	vm *VM
+}
+
+func (d *piaDecoder) Read(addr uint16) byte {
+	if addr&0x10 == 0 {
+		return d.vm.dataBus
+	}
+	return d.vm.pia.Read(addr)
+}
+
+func (d *piaDecoder) Peek(addr uint16) byte {
+	if addr&0x10 == 0 {
+		return d.vm.dataBus
+	}
+	return d.vm.pia.Peek(addr)
+}
+
+func (d *piaDecoder) Write(addr uint16, b byte) {
+	if addr&0x10 != 0 {
+		d.vm.pia.Write(addr, b)
+	}
+}
+
+// ParseRegion parses a memory map line: a kind, a range of whole pages and, for ROM, the
+// file holding its contents relative to dir or "wozmon" for the built-in Woz Monitor.
+//
+//	ram $0000-$0FFF
+//	rom $E000-$EFFF basic.rom
+//	rom $FF00-$FFFF wozmon
+//	pia $D000-$DFFF
+//	unmapped $1000-$DFFF
+func ParseRegion(spec, dir string) (Region, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 2 {
+		return Region{}, fmt.Errorf("expected a kind and an address range, got %q", spec)
+	}
+
+	var r Region
+	found := false
+	for kind, name := range regionKindNames {
+		if strings.EqualFold(fields[0], name) {
+			r.Kind, found = kind, true
+		}
+	}
+	if !found {
+		return Region{}, fmt.Errorf("unknown region kind %q, expected ram, rom, unmapped or pia", fields[0])
+	}
+
+	bounds := strings.SplitN(fields[1], "-", 2)
+	if len(bounds) != 2 {
+		return Region{}, fmt.Errorf("expected an address range such as $0000-$0FFF, got %q", fields[1])
+	}
+	for i, b := range bounds {
+		addr, err := parseSymbolAddr(strings.TrimPrefix(strings.TrimPrefix(b, "$"), "0x"))
+		if err != nil {
+			return Region{}, err
+		}
+		if i == 0 {
+			r.Start = addr
+		} else {
+			r.End = addr
+		}
+	}
+
+	switch {
+	case r.Kind == RegionROM && len(fields) != 3:
+		return Region{}, fmt.Errorf("rom region %s needs a file or %q", fields[1], wozMonitorROM)
+	case r.Kind != RegionROM && len(fields) != 2:
+		return Region{}, fmt.Errorf("unexpected %q after %v region", strings.Join(fields[2:], " "), r.Kind)
+	case r.Kind == RegionROM && fields[2] == wozMonitorROM:
+		r.ROM = wozMonitor[:]
+	case r.Kind == RegionROM:
+		path := fields[2]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Region{}, err
+		}
+		r.ROM = data
+	}
+	return r, nil
+}
+
+// LoadMemoryMap reads a memory map file with one region per line, in the form ParseRegion
+// accepts. Blank lines and lines starting with ; or # are ignored, and ROM files are found
+// relative to the map.
+func LoadMemoryMap(path string) (MemoryMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var m MemoryMap
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		r, err := ParseRegion(line, filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		m = append(m, r)
+	}
+	return m, scanner.Err()
+}
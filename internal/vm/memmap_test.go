@@ -0,0 +1,243 @@
+package vm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDefaultMemoryMap(t *testing.T) {
+	vm := New()
+	var shown []byte
+	vm.pia.display = func(c byte) { shown = append(shown, c) }
+
+	// The PIA answers only where A4 is set, repeating every four bytes
+	vm.Write(0xD012, 'A')
+	vm.Write(0xD0F6, 'B')
+	vm.Write(0xD002, 'C')
+	if string(shown) != "AB" {
+		t.Errorf("display got %q, want the writes to $D012 and $D0F6", shown)
+	}
+	vm.KeyPress('K')
+	if got := vm.Read(0xD0B0); got != 'K'|0x80 {
+		t.Errorf("$D0B0 read $%02X, want the key", got)
+	}
+	vm.Write(0x0300, 0x42)
+	if got := vm.Read(0xD005); got != 0x42 {
+		t.Errorf("$D005 read $%02X, want the last value on the data bus", got)
+	}
+
+	// RAM around it, and the Woz Monitor at the top
+	vm.Write(0xD100, 0x55)
+	if got := vm.Read(0xD100); got != 0x55 {
+		t.Errorf("$D100 read $%02X, want RAM", got)
+	}
+	vm.Write(0xFF00, 0x00)
+	if got := vm.Read(0xFF00); got != wozMonitor[0] {
+		t.Errorf("$FF00 read $%02X, want the Woz Monitor's $%02X", got, wozMonitor[0])
+	}
+}
+
+// writeMapFiles writes files into a new directory and returns its path
+func writeMapFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "memmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParseRegion(t *testing.T) {
+	dir := writeMapFiles(t, map[string]string{"basic.rom": "\x01\x02"})
+	tests := []struct {
+		spec string
+		want Region
+		err  string
+	}{
+		{spec: "ram $0000-$0FFF", want: Region{Kind: RegionRAM, Start: 0x0000, End: 0x0FFF}},
+		{spec: "RAM 0x1000-0x1FFF", want: Region{Kind: RegionRAM, Start: 0x1000, End: 0x1FFF}},
+		{spec: "pia D000-DFFF", want: Region{Kind: RegionPIA, Start: 0xD000, End: 0xDFFF}},
+		{spec: "unmapped $2000-$CFFF", want: Region{Kind: RegionUnmapped, Start: 0x2000, End: 0xCFFF}},
+		{spec: "rom $E000-$EFFF basic.rom", want: Region{Kind: RegionROM, Start: 0xE000, End: 0xEFFF, ROM: []byte{1, 2}}},
+		{spec: "rom $FF00-$FFFF wozmon", want: Region{Kind: RegionROM, Start: 0xFF00, End: 0xFFFF, ROM: wozMonitor[:]}},
+		{spec: "ram", err: `expected a kind and an address range, got "ram"`},
+		{spec: "eeprom $0000-$0FFF", err: `unknown region kind "eeprom", expected ram, rom, unmapped or pia`},
+		{spec: "ram $0000", err: `expected an address range such as $0000-$0FFF, got "$0000"`},
+		{spec: "ram $0000-$XFFF", err: `bad address "XFFF"`},
+		{spec: "ram $0000-$10000", err: `bad address "10000"`},
+		{spec: "ram $0000-$0FFF basic.rom", err: `unexpected "basic.rom" after ram region`},
+		{spec: "rom $E000-$EFFF", err: `rom region $E000-$EFFF needs a file or "wozmon"`},
+		{spec: "rom $E000-$EFFF missing.rom", err: "missing.rom"},
+	}
+	for _, tt := range tests {
+		r, err := ParseRegion(tt.spec, dir)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: got error %v, want %s", tt.spec, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(r, tt.want) {
+			t.Errorf("%q: got %+v, %v, want %+v", tt.spec, r, err, tt.want)
+		}
+	}
+}
+
+func TestLoadMemoryMap(t *testing.T) {
+	dir := writeMapFiles(t, map[string]string{
+		"basic.rom":  "\x01\x02",
+		"apple1.map": "; stock machine\n# with BASIC\n\nram $0000-$0FFF\n  pia $D000-$DFFF\nrom $E000-$EFFF basic.rom\n",
+		"bad.map":    "ram $0000-$0FFF\n\nrom $E000-$EFFF\n",
+	})
+	m, err := LoadMemoryMap(filepath.Join(dir, "apple1.map"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MemoryMap{
+		{Kind: RegionRAM, Start: 0x0000, End: 0x0FFF},
+		{Kind: RegionPIA, Start: 0xD000, End: 0xDFFF},
+		{Kind: RegionROM, Start: 0xE000, End: 0xEFFF, ROM: []byte{1, 2}},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %+v, want %+v", m, want)
+	}
+
+	path := filepath.Join(dir, "bad.map")
+	if _, err := LoadMemoryMap(path); err == nil || !strings.HasPrefix(err.Error(), path+":3: rom region") {
+		t.Errorf("got %v, want the error on line 3", err)
+	}
+}
+
+func TestCustomMemoryMap(t *testing.T) {
+	vm := New()
+	err := vm.SetMemoryMap(MemoryMap{
+		{Kind: RegionRAM, Start: 0x0000, End: 0x0FFF},
+		{Kind: RegionPIA, Start: 0xD000, End: 0xDFFF},
+		{Kind: RegionROM, Start: 0xE000, End: 0xEFFF, ROM: []byte{0x11, 0x22}},
+		{Kind: RegionROM, Start: 0xFF00, End: 0xFFFF, ROM: wozMonitor[:]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ROM is repeated to fill its region and ignores writes
+	vm.Write(0xE000, 0x99)
+	vm.Write(0xEFFF, 0x99)
+	if lo, hi := vm.Read(0xE000), vm.Read(0xEFFF); lo != 0x11 || hi != 0x22 {
+		t.Errorf("rom read $%02X and $%02X after writes, want $11 and $22", lo, hi)
+	}
+
+	// Unmapped addresses ignore writes and read back the last value on the data bus,
+	// however a probe for the top of memory tries them
+	vm.Write(0x0FFF, 0x42)
+	vm.Write(0x1000, 0x55)
+	if got := vm.Read(0x0FFF); got != 0x42 {
+		t.Errorf("$0FFF read $%02X, want RAM", got)
+	}
+	if got := vm.Read(0x1000); got != 0x42 {
+		t.Errorf("$1000 read $%02X, want $42 left on the bus by the last read", got)
+	}
+	if got := vm.Read(0xE001); got != 0x22 {
+		t.Fatalf("$E001 read $%02X, want $22", got)
+	}
+	if got, peeked := vm.Read(0x8000), vm.Peek(0x8000); got != 0x22 || peeked != 0x22 {
+		t.Errorf("$8000 read $%02X and peeked $%02X, want $22 left on the bus by the rom", got, peeked)
+	}
+
+	// The PIA is mirrored across its whole region
+	var shown []byte
+	vm.pia.display = func(c byte) { shown = append(shown, c) }
+	vm.Write(0xDF12, 'A')
+	if string(shown) != "A" {
+		t.Errorf("display got %q, want the write to $DF12", shown)
+	}
+}
+
+func TestSetMemoryMapErrors(t *testing.T) {
+	tests := []struct {
+		m    MemoryMap
+		want string
+	}{
+		{
+			MemoryMap{{Kind: RegionRAM, Start: 0x0010, End: 0x0FFF}},
+			"ram region $0010-$0FFF must cover whole pages",
+		},
+		{
+			MemoryMap{{Kind: RegionRAM, Start: 0x1000, End: 0x0FFF}},
+			"ram region $1000-$0FFF must cover whole pages",
+		},
+		{
+			MemoryMap{{Kind: RegionROM, Start: 0xE000, End: 0xE0FF, ROM: []byte{1, 2, 3}}},
+			"rom of 3 bytes doesn't evenly fill $E000-$E0FF",
+		},
+		{
+			MemoryMap{{Kind: RegionRAM, Start: 0x0000, End: 0xFFFF}, {Kind: RegionPIA, Start: 0xD000, End: 0xD0FF}},
+			"pia region $D000-$D0FF overlaps ram region $0000-$FFFF",
+		},
+		{
+			MemoryMap{{Kind: RegionRAM, Start: 0x0000, End: 0x1FFF}, {Kind: RegionUnmapped, Start: 0x1F00, End: 0x2FFF}},
+			"unmapped region $1F00-$2FFF overlaps ram region $0000-$1FFF",
+		},
+	}
+	for _, tt := range tests {
+		vm := New()
+		vm.Write(0x0300, 0x42)
+		if err := vm.SetMemoryMap(tt.m); err == nil || err.Error() != tt.want {
+			t.Errorf("%+v: got error %v, want %s", tt.m, err, tt.want)
+		}
+		// A rejected map leaves the old one in place
+		if got := vm.Read(0x0300); got != 0x42 {
+			t.Errorf("%+v: $0300 read $%02X after a rejected map, want RAM", tt.m, got)
+		}
+	}
+}
+
+func TestSetRAMSize(t *testing.T) {
+	vm := New()
+	for _, size := range []int{0x100, 0x10001} {
+		if err := vm.SetRAMSize(size); err == nil {
+			t.Errorf("expected an error for %d bytes of ram", size)
+		}
+	}
+
+	// 4KiB and a byte rounds up to a whole page
+	if err := vm.SetRAMSize(0x1001); err != nil {
+		t.Fatal(err)
+	}
+	vm.Write(0x10FF, 0x42)
+	vm.Write(0x1100, 0x55)
+	if got := vm.Read(0x10FF); got != 0x42 {
+		t.Errorf("$10FF read $%02X, want RAM", got)
+	}
+	if got := vm.Read(0x1100); got != 0x42 {
+		t.Errorf("$1100 read $%02X, want the last value on the data bus", got)
+	}
+
+	// The PIA and the Woz Monitor stay
+	vm.KeyPress('K')
+	if got := vm.Read(0xD010); got != 'K'|0x80 {
+		t.Errorf("$D010 read $%02X, want the key", got)
+	}
+	if got := vm.Read(0xFF00); got != wozMonitor[0] {
+		t.Errorf("$FF00 read $%02X, want the Woz Monitor", got)
+	}
+
+	// Growing it again maps the unmapped pages as RAM
+	if err := vm.SetRAMSize(0x8000); err != nil {
+		t.Fatal(err)
+	}
+	vm.Write(0x7FFF, 0x42)
+	if got := vm.Read(0x7FFF); got != 0x42 {
+		t.Errorf("$7FFF read $%02X, want RAM", got)
+	}
+}
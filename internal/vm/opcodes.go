@@ -5,25 +5,52 @@ import (
 )
 
 // operation includes the name of the operation, it's 8 bit hexidecimal opcode, how
-// many bytes it occupies (it's size), as well as it's addressing mode.
+// many bytes it occupies (it's size), how many cycles it takes, as well as it's addressing mode.
 type operation struct {
 	name     string
 	opcode   byte
 	size     byte
+	cycles   byte
 	addrMode addrMode
 	exec     func(a *VM, op operation) error
 }
 
-func newOp(name string, opcode, size byte, addrMode addrMode, exec func(a *VM, op operation) error) operation {
+func newOp(name string, opcode, size, cycles byte, addrMode addrMode, exec func(a *VM, op operation) error) operation {
 	return operation{
 		name:     name,
 		opcode:   opcode,
 		size:     size,
+		cycles:   cycles,
 		addrMode: addrMode,
 		exec:     exec,
 	}
 }
 
+// pageCrossPenalty holds the operations that take an extra cycle when an indexed address
+// crosses a page boundary, marked with a * in the cycle counts below. Stores and read-modify-write
+// operations always take the longer path, so their counts already include it.
+var pageCrossPenalty = map[string]bool{
+	"ADC": true,
+	"AND": true,
+	"CMP": true,
+	"EOR": true,
+	"LDA": true,
+	"LDX": true,
+	"LDY": true,
+	"ORA": true,
+	"SBC": true,
+}
+
+// cmosPageCrossPenalty holds the operations that only take an extra cycle for crossing a page
+// on the 65C02, which shortened its indexed shifts and rotates
+var cmosPageCrossPenalty = map[string]bool{
+	"ASL": true,
+	"BIT": true,
+	"LSR": true,
+	"ROL": true,
+	"ROR": true,
+}
+
 // operationByCode takes an opcode (a single byte/word) and returns the associated operation
 func operationByCode(b byte) (operation, error) {
 	o, ok := opcodes[b]
@@ -33,6 +60,15 @@ func operationByCode(b byte) (operation, error) {
 	return o, nil
 }
 
+// operation returns the operation opcode b decodes to on the vm's cpu variant
+func (vm *VM) operation(b byte) (operation, error) {
+	o, ok := vm.ops[b]
+	if !ok {
+		return operation{}, errors.New("unknown opcode")
+	}
+	return o, nil
+}
+
 // opcodes represent all of the Apple 1 opcodes available. Each 8 bit opcode is mapped to a corresponding
 // "op" which is just a struct holding metadata about the operation.
 var opcodes = map[byte]operation{
@@ -40,13 +76,13 @@ var opcodes = map[byte]operation{
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       BRK          00   1      7
-	0x00: newOp("BRK", 0x00, 1, implied, execBRK),
+	0x00: newOp("BRK", 0x00, 1, 7, implied, execBRK),
 
 	// RTI Return from Interrupt
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       RTI          40   1      6
-	0x40: newOp("RTI", 0x40, 1, implied, execRTI),
+	0x40: newOp("RTI", 0x40, 1, 6, implied, execRTI),
 
 	// DEC Decrement Memory by One
 	// addressing    assembler    opc  bytes  cyles
@@ -55,10 +91,10 @@ var opcodes = map[byte]operation{
 	// zeropage,X    DEC oper,X   D6   2      6
 	// absolute      DEC oper     CE   3      6
 	// absolute,X    DEC oper,X   DE   3      7
-	0xC6: newOp("DEC", 0xC6, 2, zeroPage, execDEC),
-	0xD6: newOp("DEC", 0xD6, 2, zeroPageXIndexed, execDEC),
-	0xCE: newOp("DEC", 0xCE, 3, absolute, execDEC),
-	0xDE: newOp("DEC", 0xDE, 3, absoluteXIndexed, execDEC),
+	0xC6: newOp("DEC", 0xC6, 2, 5, zeroPage, execDEC),
+	0xD6: newOp("DEC", 0xD6, 2, 6, zeroPageXIndexed, execDEC),
+	0xCE: newOp("DEC", 0xCE, 3, 6, absolute, execDEC),
+	0xDE: newOp("DEC", 0xDE, 3, 7, absoluteXIndexed, execDEC),
 
 	// INC Increment Memory by One
 	// addressing    assembler    opc  bytes  cyles
@@ -67,46 +103,46 @@ var opcodes = map[byte]operation{
 	// zeropage,X    INC oper,X   F6   2      6
 	// absolute      INC oper     EE   3      6
 	// absolute,X    INC oper,X   FE   3      7
-	0xE6: newOp("INC", 0xE6, 2, zeroPage, execINC),
-	0xF6: newOp("INC", 0xF6, 2, zeroPageXIndexed, execINC),
-	0xEE: newOp("INC", 0xEE, 3, absolute, execINC),
-	0xFE: newOp("INC", 0xFE, 3, absoluteXIndexed, execINC),
+	0xE6: newOp("INC", 0xE6, 2, 5, zeroPage, execINC),
+	0xF6: newOp("INC", 0xF6, 2, 6, zeroPageXIndexed, execINC),
+	0xEE: newOp("INC", 0xEE, 3, 6, absolute, execINC),
+	0xFE: newOp("INC", 0xFE, 3, 7, absoluteXIndexed, execINC),
 
 	// INX Increment Index X by One
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       INX          E8   1      2
-	0xE8: newOp("INX", 0xE8, 1, implied, execINX),
+	0xE8: newOp("INX", 0xE8, 1, 2, implied, execINX),
 
 	// INY  Increment Index Y by One
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       INY          C8   1      2
-	0xC8: newOp("INY", 0xC8, 1, implied, execINY),
+	0xC8: newOp("INY", 0xC8, 1, 2, implied, execINY),
 
 	// TAX Transfer Accumulator to Index X
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       TAX          AA   1      2
-	0xAA: newOp("TAX", 0xAA, 1, implied, execTAX),
+	0xAA: newOp("TAX", 0xAA, 1, 2, implied, execTAX),
 
 	// TAY Transfer Accumulator to Index Y
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       TAY          A8   1      2
-	0xA8: newOp("TAY", 0xA8, 1, implied, execTAY),
+	0xA8: newOp("TAY", 0xA8, 1, 2, implied, execTAY),
 
 	// DEX Decrement Index X by One
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       DEC          CA   1      2
-	0xCA: newOp("DEX", 0xCA, 1, implied, execDEX),
+	0xCA: newOp("DEX", 0xCA, 1, 2, implied, execDEX),
 
 	// DEY Decrement Index Y by One
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       DEC          88   1      2
-	0x88: newOp("DEY", 0x88, 1, implied, execDEY),
+	0x88: newOp("DEY", 0x88, 1, 2, implied, execDEY),
 
 	// LDA Load Accumulator with Memory
 	// addressing    assembler    opc  bytes  cyles
@@ -119,14 +155,14 @@ var opcodes = map[byte]operation{
 	// absolute,Y    LDA oper,Y   B9   3      4*
 	// (indirect,X)  LDA (oper,X) A1   2      6
 	// (indirect),Y  LDA (oper),Y B1   2      5*
-	0xA9: newOp("LDA", 0xA9, 2, immediate, execLDA),
-	0xA5: newOp("LDA", 0xA5, 2, zeroPage, execLDA),
-	0xB5: newOp("LDA", 0xB5, 2, zeroPageXIndexed, execLDA),
-	0xAD: newOp("LDA", 0xAD, 3, absolute, execLDA),
-	0xBD: newOp("LDA", 0xBD, 3, absoluteXIndexed, execLDA),
-	0xB9: newOp("LDA", 0xB9, 3, absoluteYIndexed, execLDA),
-	0xA1: newOp("LDA", 0xA1, 2, indirectXIndexed, execLDA),
-	0xB1: newOp("LDA", 0xB1, 2, indirectYIndexed, execLDA),
+	0xA9: newOp("LDA", 0xA9, 2, 2, immediate, execLDA),
+	0xA5: newOp("LDA", 0xA5, 2, 3, zeroPage, execLDA),
+	0xB5: newOp("LDA", 0xB5, 2, 4, zeroPageXIndexed, execLDA),
+	0xAD: newOp("LDA", 0xAD, 3, 4, absolute, execLDA),
+	0xBD: newOp("LDA", 0xBD, 3, 4, absoluteXIndexed, execLDA),
+	0xB9: newOp("LDA", 0xB9, 3, 4, absoluteYIndexed, execLDA),
+	0xA1: newOp("LDA", 0xA1, 2, 6, indirectXIndexed, execLDA),
+	0xB1: newOp("LDA", 0xB1, 2, 5, indirectYIndexed, execLDA),
 
 	// LDX Load Index X with Memory
 	// addressing    assembler    opc  bytes  cyles
@@ -136,11 +172,11 @@ var opcodes = map[byte]operation{
 	// zeropage,Y    LDX oper,Y    B6    2     4
 	// absolute      LDX oper      AE    3     4
 	// absolute,Y    LDX oper,Y    BE    3     4*
-	0xA2: newOp("LDX", 0xA2, 2, immediate, execLDX),
-	0xA6: newOp("LDX", 0xA6, 2, zeroPage, execLDX),
-	0xB6: newOp("LDX", 0xB6, 2, zeroPageYIndexed, execLDX),
-	0xAE: newOp("LDX", 0xAE, 3, absolute, execLDX),
-	0xBE: newOp("LDX", 0xBE, 3, absoluteYIndexed, execLDX),
+	0xA2: newOp("LDX", 0xA2, 2, 2, immediate, execLDX),
+	0xA6: newOp("LDX", 0xA6, 2, 3, zeroPage, execLDX),
+	0xB6: newOp("LDX", 0xB6, 2, 4, zeroPageYIndexed, execLDX),
+	0xAE: newOp("LDX", 0xAE, 3, 4, absolute, execLDX),
+	0xBE: newOp("LDX", 0xBE, 3, 4, absoluteYIndexed, execLDX),
 
 	// LDY Load Index Y with Memory
 	// addressing    assembler    opc  bytes  cyles
@@ -150,11 +186,11 @@ var opcodes = map[byte]operation{
 	// zeropage,X    LDY oper,X   B4   2      4
 	// absolute      LDY oper     AC   3      4
 	// absolute,X    LDY oper,X   BC   3      4*
-	0xA0: newOp("LDY", 0xA0, 2, immediate, execLDY),
-	0xA4: newOp("LDY", 0xA4, 2, zeroPage, execLDY),
-	0xB4: newOp("LDY", 0xB4, 2, zeroPageXIndexed, execLDY),
-	0xAC: newOp("LDY", 0xAC, 3, absolute, execLDY),
-	0xBC: newOp("LDY", 0xBC, 3, absoluteXIndexed, execLDY),
+	0xA0: newOp("LDY", 0xA0, 2, 2, immediate, execLDY),
+	0xA4: newOp("LDY", 0xA4, 2, 3, zeroPage, execLDY),
+	0xB4: newOp("LDY", 0xB4, 2, 4, zeroPageXIndexed, execLDY),
+	0xAC: newOp("LDY", 0xAC, 3, 4, absolute, execLDY),
+	0xBC: newOp("LDY", 0xBC, 3, 4, absoluteXIndexed, execLDY),
 
 	// ADC Add Memory to Accumulator with Carry
 	// addressing    assembler     opc  bytes  cyles
@@ -167,14 +203,14 @@ var opcodes = map[byte]operation{
 	// absolute,Y    ADC oper,Y    79   3      4*
 	// (indirect,X)  ADC (oper,X)  61   2      6
 	// (indirect),Y  ADC (oper),Y  71   2      5*
-	0x69: newOp("ADC", 0x69, 2, immediate, execADC),
-	0x65: newOp("ADC", 0x65, 2, zeroPage, execADC),
-	0x75: newOp("ADC", 0x75, 2, zeroPageXIndexed, execADC),
-	0x6D: newOp("ADC", 0x6D, 3, absolute, execADC),
-	0x7D: newOp("ADC", 0x7D, 3, absoluteXIndexed, execADC),
-	0x79: newOp("ADC", 0x79, 3, absoluteYIndexed, execADC),
-	0x61: newOp("ADC", 0x61, 2, indirectXIndexed, execADC),
-	0x71: newOp("ADC", 0x71, 2, indirectYIndexed, execADC),
+	0x69: newOp("ADC", 0x69, 2, 2, immediate, execADC),
+	0x65: newOp("ADC", 0x65, 2, 3, zeroPage, execADC),
+	0x75: newOp("ADC", 0x75, 2, 4, zeroPageXIndexed, execADC),
+	0x6D: newOp("ADC", 0x6D, 3, 4, absolute, execADC),
+	0x7D: newOp("ADC", 0x7D, 3, 4, absoluteXIndexed, execADC),
+	0x79: newOp("ADC", 0x79, 3, 4, absoluteYIndexed, execADC),
+	0x61: newOp("ADC", 0x61, 2, 6, indirectXIndexed, execADC),
+	0x71: newOp("ADC", 0x71, 2, 5, indirectYIndexed, execADC),
 
 	// SBC Subtract Memory from Accumulator with Borrow
 	// addressing    assembler     opc   bytes cyles
@@ -187,14 +223,14 @@ var opcodes = map[byte]operation{
 	// absolute,Y    SBC oper,Y    F9    3     4*
 	// (indirect,X)  SBC (oper,X)  E1    2     6
 	// (indirect),Y  SBC (oper),Y  F1    2     5*
-	0xE9: newOp("SBC", 0xE9, 2, immediate, execSBC),
-	0xE5: newOp("SBC", 0xE5, 2, zeroPage, execSBC),
-	0xF5: newOp("SBC", 0xF5, 2, zeroPageXIndexed, execSBC),
-	0xED: newOp("SBC", 0xED, 3, absolute, execSBC),
-	0xFD: newOp("SBC", 0xFD, 3, absoluteXIndexed, execSBC),
-	0xF9: newOp("SBC", 0xF9, 3, absoluteYIndexed, execSBC),
-	0xE1: newOp("SBC", 0xE1, 2, indirectXIndexed, execSBC),
-	0xF1: newOp("SBC", 0xF1, 2, indirectYIndexed, execSBC),
+	0xE9: newOp("SBC", 0xE9, 2, 2, immediate, execSBC),
+	0xE5: newOp("SBC", 0xE5, 2, 3, zeroPage, execSBC),
+	0xF5: newOp("SBC", 0xF5, 2, 4, zeroPageXIndexed, execSBC),
+	0xED: newOp("SBC", 0xED, 3, 4, absolute, execSBC),
+	0xFD: newOp("SBC", 0xFD, 3, 4, absoluteXIndexed, execSBC),
+	0xF9: newOp("SBC", 0xF9, 3, 4, absoluteYIndexed, execSBC),
+	0xE1: newOp("SBC", 0xE1, 2, 6, indirectXIndexed, execSBC),
+	0xF1: newOp("SBC", 0xF1, 2, 5, indirectYIndexed, execSBC),
 
 	// STX Store Index X in Memory
 	// addressing    assembler    opc  bytes  cyles
@@ -202,9 +238,9 @@ var opcodes = map[byte]operation{
 	// zeropage      STX oper     86   2      3
 	// zeropage,Y    STX oper,Y   96   2      4
 	// absolute      STX oper     8E   3      4
-	0x86: newOp("STX", 0x86, 2, zeroPage, execSTX),
-	0x96: newOp("STX", 0x96, 2, zeroPageYIndexed, execSTX),
-	0x8E: newOp("STX", 0x8E, 3, absolute, execSTX),
+	0x86: newOp("STX", 0x86, 2, 3, zeroPage, execSTX),
+	0x96: newOp("STX", 0x96, 2, 4, zeroPageYIndexed, execSTX),
+	0x8E: newOp("STX", 0x8E, 3, 4, absolute, execSTX),
 
 	// STY Store Index Y in Memory
 	// addressing    assembler    opc  bytes  cyles
@@ -212,9 +248,9 @@ var opcodes = map[byte]operation{
 	// zeropage      STY oper     84   2      3
 	// zeropage,X    STY oper,X   94   2      4
 	// absolute      STY oper     8C   3      4
-	0x84: newOp("STY", 0x84, 2, zeroPage, execSTY),
-	0x94: newOp("STY", 0x94, 2, zeroPageXIndexed, execSTY),
-	0x8C: newOp("STY", 0x8C, 3, absolute, execSTY),
+	0x84: newOp("STY", 0x84, 2, 3, zeroPage, execSTY),
+	0x94: newOp("STY", 0x94, 2, 4, zeroPageXIndexed, execSTY),
+	0x8C: newOp("STY", 0x8C, 3, 4, absolute, execSTY),
 
 	// STA Store Accumulator in Memory
 	// addressing    assembler     opc   bytes  cyles
@@ -226,69 +262,69 @@ var opcodes = map[byte]operation{
 	// absolute,Y    STA oper,Y    99    3      5
 	// (indirect,X)  STA (oper,X)  81    2      6
 	// (indirect),Y  STA (oper),Y  91    2      6
-	0x85: newOp("STA", 0x85, 2, zeroPage, execSTA),
-	0x95: newOp("STA", 0x95, 2, zeroPageXIndexed, execSTA),
-	0x8D: newOp("STA", 0x8D, 3, absolute, execSTA),
-	0x9D: newOp("STA", 0x9D, 3, absoluteXIndexed, execSTA),
-	0x99: newOp("STA", 0x99, 3, absoluteYIndexed, execSTA),
-	0x81: newOp("STA", 0x81, 2, indirectXIndexed, execSTA),
-	0x91: newOp("STA", 0x91, 2, indirectYIndexed, execSTA),
+	0x85: newOp("STA", 0x85, 2, 3, zeroPage, execSTA),
+	0x95: newOp("STA", 0x95, 2, 4, zeroPageXIndexed, execSTA),
+	0x8D: newOp("STA", 0x8D, 3, 4, absolute, execSTA),
+	0x9D: newOp("STA", 0x9D, 3, 5, absoluteXIndexed, execSTA),
+	0x99: newOp("STA", 0x99, 3, 5, absoluteYIndexed, execSTA),
+	0x81: newOp("STA", 0x81, 2, 6, indirectXIndexed, execSTA),
+	0x91: newOp("STA", 0x91, 2, 6, indirectYIndexed, execSTA),
 
 	// BEQ  Branch on Result Zero
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// relative      BEQ oper      F0    2     2**
-	0xF0: newOp("BEQ", 0xF0, 2, relative, execBEQ),
+	0xF0: newOp("BEQ", 0xF0, 2, 2, relative, execBEQ),
 
 	// BNE Branch on Result not Zero
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// relative      BNE oper     D0   2      2**
-	0xD0: newOp("BNE", 0xD0, 2, relative, execBNE),
+	0xD0: newOp("BNE", 0xD0, 2, 2, relative, execBNE),
 
 	// BVC Branch on Overflow Clear
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// relative      BVC oper      50    2     2**
-	0x50: newOp("BVC", 0x50, 2, relative, execBVC),
+	0x50: newOp("BVC", 0x50, 2, 2, relative, execBVC),
 
 	// BVS Branch on Overflow Set
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// relative      BVC oper      70    2     2**
-	0x70: newOp("BVS", 0x70, 2, relative, execBVS),
+	0x70: newOp("BVS", 0x70, 2, 2, relative, execBVS),
 
 	// BIT Test Bits in Memory with Accumulator
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// zeropage      BIT oper     24   2      3
 	// absolute      BIT oper     2C   3      4
-	0x24: newOp("BIT", 0x24, 2, zeroPage, execBIT),
-	0x2C: newOp("BIT", 0x2C, 3, absolute, execBIT),
+	0x24: newOp("BIT", 0x24, 2, 3, zeroPage, execBIT),
+	0x2C: newOp("BIT", 0x2C, 3, 4, absolute, execBIT),
 
 	// BCC Branch on Carry Clear
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// relative      BCC oper     90   2      2**
-	0x90: newOp("BCC", 0x90, 2, relative, execBCC),
+	0x90: newOp("BCC", 0x90, 2, 2, relative, execBCC),
 
 	// BMI Branch on Result Minus
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// relative      BMI oper     30   2      2**
-	0x30: newOp("BMI", 0x30, 2, relative, execBMI),
+	0x30: newOp("BMI", 0x30, 2, 2, relative, execBMI),
 
 	// BPL  Branch on Result Plus
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// relative      BPL oper     10   2      2**
-	0x10: newOp("BPL", 0x10, 2, relative, execBPL),
+	0x10: newOp("BPL", 0x10, 2, 2, relative, execBPL),
 
 	// BCS Branch on Carry Set
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// relative      BCS oper     B0   2      2**
-	0xB0: newOp("BCS", 0xB0, 2, relative, execBCS),
+	0xB0: newOp("BCS", 0xB0, 2, 2, relative, execBCS),
 
 	// CPX Compare Memory and Index X
 	// addressing    assembler    opc  bytes  cyles
@@ -296,9 +332,9 @@ var opcodes = map[byte]operation{
 	// immidiate     CPX #oper    E0   2      2
 	// zeropage      CPX oper     E4   2      3
 	// absolute      CPX oper     EC   3      4
-	0xE0: newOp("CPX", 0xE0, 2, immediate, execCPX),
-	0xE4: newOp("CPX", 0xE4, 2, zeroPage, execCPX),
-	0xEC: newOp("CPX", 0xEC, 3, absolute, execCPX),
+	0xE0: newOp("CPX", 0xE0, 2, 2, immediate, execCPX),
+	0xE4: newOp("CPX", 0xE4, 2, 3, zeroPage, execCPX),
+	0xEC: newOp("CPX", 0xEC, 3, 4, absolute, execCPX),
 
 	// EOR  Exclusive-OR Memory with Accumulator
 	// addressing    assembler     opc   bytes  cyles
@@ -311,14 +347,14 @@ var opcodes = map[byte]operation{
 	// absolute,Y    EOR oper,Y    59    3      4*
 	// (indirect,X)  EOR (oper,X)  41    2      6
 	// (indirect),Y  EOR (oper),Y  51    2      5*
-	0x49: newOp("EOR", 0x49, 2, immediate, execEOR),
-	0x45: newOp("EOR", 0x45, 2, zeroPage, execEOR),
-	0x55: newOp("EOR", 0x55, 2, zeroPageXIndexed, execEOR),
-	0x4D: newOp("EOR", 0x4D, 3, absolute, execEOR),
-	0x5D: newOp("EOR", 0x5D, 3, absoluteXIndexed, execEOR),
-	0x59: newOp("EOR", 0x59, 3, absoluteYIndexed, execEOR),
-	0x41: newOp("EOR", 0x41, 2, indirectXIndexed, execEOR),
-	0x51: newOp("EOR", 0x51, 2, indirectYIndexed, execEOR),
+	0x49: newOp("EOR", 0x49, 2, 2, immediate, execEOR),
+	0x45: newOp("EOR", 0x45, 2, 3, zeroPage, execEOR),
+	0x55: newOp("EOR", 0x55, 2, 4, zeroPageXIndexed, execEOR),
+	0x4D: newOp("EOR", 0x4D, 3, 4, absolute, execEOR),
+	0x5D: newOp("EOR", 0x5D, 3, 4, absoluteXIndexed, execEOR),
+	0x59: newOp("EOR", 0x59, 3, 4, absoluteYIndexed, execEOR),
+	0x41: newOp("EOR", 0x41, 2, 6, indirectXIndexed, execEOR),
+	0x51: newOp("EOR", 0x51, 2, 5, indirectYIndexed, execEOR),
 
 	// CMP Compare Memory with Accumulator
 	// addressing    assembler     opc   bytes cyles
@@ -331,14 +367,14 @@ var opcodes = map[byte]operation{
 	// absolute,Y    CMP oper,Y    D9    3     4*
 	// (indirect,X)  CMP (oper,X)  C1    2     6
 	// (indirect),Y  CMP (oper),Y  D1    2     5*
-	0xC9: newOp("CMP", 0xC9, 2, immediate, execCMP),
-	0xC5: newOp("CMP", 0xC5, 2, zeroPage, execCMP),
-	0xD5: newOp("CMP", 0xD5, 2, zeroPageXIndexed, execCMP),
-	0xCD: newOp("CMP", 0xCD, 3, absolute, execCMP),
-	0xDD: newOp("CMP", 0xDD, 3, absoluteXIndexed, execCMP),
-	0xD9: newOp("CMP", 0xD9, 3, absoluteYIndexed, execCMP),
-	0xC1: newOp("CMP", 0xC1, 2, indirectXIndexed, execCMP),
-	0xD1: newOp("CMP", 0xD1, 2, indirectYIndexed, execCMP),
+	0xC9: newOp("CMP", 0xC9, 2, 2, immediate, execCMP),
+	0xC5: newOp("CMP", 0xC5, 2, 3, zeroPage, execCMP),
+	0xD5: newOp("CMP", 0xD5, 2, 4, zeroPageXIndexed, execCMP),
+	0xCD: newOp("CMP", 0xCD, 3, 4, absolute, execCMP),
+	0xDD: newOp("CMP", 0xDD, 3, 4, absoluteXIndexed, execCMP),
+	0xD9: newOp("CMP", 0xD9, 3, 4, absoluteYIndexed, execCMP),
+	0xC1: newOp("CMP", 0xC1, 2, 6, indirectXIndexed, execCMP),
+	0xD1: newOp("CMP", 0xD1, 2, 5, indirectYIndexed, execCMP),
 
 	// CPY Compare Memory and Index Y
 	// addressing    assembler    opc  bytes  cyles
@@ -346,119 +382,119 @@ var opcodes = map[byte]operation{
 	// immidiate     CPY #oper    C0   2      2
 	// zeropage      CPY oper     C4   2      3
 	// absolute      CPY oper     CC   3      4
-	0xC0: newOp("CPY", 0xC0, 2, immediate, execCPY),
-	0xC4: newOp("CPY", 0xC4, 2, zeroPage, execCPY),
-	0xCC: newOp("CPY", 0xCC, 3, absolute, execCPY),
+	0xC0: newOp("CPY", 0xC0, 2, 2, immediate, execCPY),
+	0xC4: newOp("CPY", 0xC4, 2, 3, zeroPage, execCPY),
+	0xCC: newOp("CPY", 0xCC, 3, 4, absolute, execCPY),
 
 	// CLC Clear Carry Flag
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       CLC          18   1      2
-	0x18: newOp("CLC", 0x18, 1, implied, execCLC),
+	0x18: newOp("CLC", 0x18, 1, 2, implied, execCLC),
 
 	// CLD Clear Decimal Mode
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       CLD          D8   1      2
-	0xD8: newOp("CLD", 0xD8, 1, implied, execCLD),
+	0xD8: newOp("CLD", 0xD8, 1, 2, implied, execCLD),
 
 	// CLI Clear Interrupt Disable Bit
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       CLI          58   1      2
-	0x58: newOp("CLI", 0x58, 1, implied, execCLI),
+	0x58: newOp("CLI", 0x58, 1, 2, implied, execCLI),
 
 	// CLV Clear Overflow Flag
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       CLV          B8   1      2
-	0xB8: newOp("CLV", 0xB8, 1, implied, execCLV),
+	0xB8: newOp("CLV", 0xB8, 1, 2, implied, execCLV),
 
 	// SEC Set Carry Flag
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       SEC          38   1      2
-	0x38: newOp("SEC", 0x38, 1, implied, execSEC),
+	0x38: newOp("SEC", 0x38, 1, 2, implied, execSEC),
 
 	// SED Set Decimal Flag
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       SED          F8   1      2
-	0xF8: newOp("SED", 0xF8, 1, implied, execSED),
+	0xF8: newOp("SED", 0xF8, 1, 2, implied, execSED),
 
 	// SEI Set Interrupt Disable Status
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       SEI          78   1      2
-	0x78: newOp("SEI", 0x78, 1, implied, execSEI),
+	0x78: newOp("SEI", 0x78, 1, 2, implied, execSEI),
 
 	// NOP No Operation
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       NOP          EA   1      2
-	0xEA: newOp("NOP", 0xEA, 1, implied, execNOP),
+	0xEA: newOp("NOP", 0xEA, 1, 2, implied, execNOP),
 
 	// JMP Jump to New Location
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// absolute      JMP oper     4C   3      3
 	// indirect      JMP (oper)   6C   3      5
-	0x4C: newOp("JMP", 0x4C, 3, absolute, execJMP),
-	0x6C: newOp("JMP", 0x6C, 3, indirect, execJMP),
+	0x4C: newOp("JMP", 0x4C, 3, 3, absolute, execJMP),
+	0x6C: newOp("JMP", 0x6C, 3, 5, indirect, execJMP),
 
 	// PHA Push Accumulator on Stack
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       PHA           48    1     3
-	0x48: newOp("PHA", 0x48, 1, implied, execPHA),
+	0x48: newOp("PHA", 0x48, 1, 3, implied, execPHA),
 
 	// TXA Transfer Index X to Accumulator
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       TXA          8A   1      2
-	0x8A: newOp("TXA", 0x8A, 1, implied, execTXA),
+	0x8A: newOp("TXA", 0x8A, 1, 2, implied, execTXA),
 
 	// TYA Transfer Index Y to Accumulator
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       TYA          98   1      2
-	0x98: newOp("TYA", 0x98, 1, implied, execTYA),
+	0x98: newOp("TYA", 0x98, 1, 2, implied, execTYA),
 
 	// TSX Transfer Stack Pointer to Index X
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       TSX          BA   1      2
-	0xBA: newOp("TSX", 0xBA, 1, implied, execTSX),
+	0xBA: newOp("TSX", 0xBA, 1, 2, implied, execTSX),
 
 	// PLA Pull Accumulator from Stack
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       PLA          68   1      4
-	0x68: newOp("PLA", 0x68, 1, implied, execPLA),
+	0x68: newOp("PLA", 0x68, 1, 4, implied, execPLA),
 
 	// PLP Pull Processor Status from Stack
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       PLP          28   1      4
-	0x28: newOp("PLP", 0x28, 1, implied, execPLP),
+	0x28: newOp("PLP", 0x28, 1, 4, implied, execPLP),
 
 	// PHP Push Processor Status on Stack
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       PHP          08   1      3
-	0x08: newOp("PHP", 0x08, 1, implied, execPHP),
+	0x08: newOp("PHP", 0x08, 1, 3, implied, execPHP),
 
 	// JSR Jump to New Location Saving Return Address
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// absolute      JSR oper     20   3      6
-	0x20: newOp("JSR", 0x20, 3, absolute, execJSR),
+	0x20: newOp("JSR", 0x20, 3, 6, absolute, execJSR),
 
 	// RTS Return from Subroutine
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       RTS          60   1      6
-	0x60: newOp("RTS", 0x60, 1, implied, execRTS),
+	0x60: newOp("RTS", 0x60, 1, 6, implied, execRTS),
 
 	// LSR Shift One Bit Right (Memory or Accumulator)
 	// addressing    assembler    opc  bytes  cyles
@@ -468,11 +504,11 @@ var opcodes = map[byte]operation{
 	// zeropage,X    LSR oper,X   56   2      6
 	// absolute      LSR oper     4E   3      6
 	// absolute,X    LSR oper,X   5E   3      7
-	0x4A: newOp("LSR", 0x4A, 1, accumulator, execLSR),
-	0x46: newOp("LSR", 0x46, 2, zeroPage, execLSR),
-	0x56: newOp("LSR", 0x56, 2, zeroPageXIndexed, execLSR),
-	0x4E: newOp("LSR", 0x4E, 3, absolute, execLSR),
-	0x5E: newOp("LSR", 0x5E, 3, absoluteXIndexed, execLSR),
+	0x4A: newOp("LSR", 0x4A, 1, 2, accumulator, execLSR),
+	0x46: newOp("LSR", 0x46, 2, 5, zeroPage, execLSR),
+	0x56: newOp("LSR", 0x56, 2, 6, zeroPageXIndexed, execLSR),
+	0x4E: newOp("LSR", 0x4E, 3, 6, absolute, execLSR),
+	0x5E: newOp("LSR", 0x5E, 3, 7, absoluteXIndexed, execLSR),
 
 	// ROL Rotate One Bit Left (Memory or Accumulator)
 	// addressing    assembler    opc  bytes  cyles
@@ -482,17 +518,17 @@ var opcodes = map[byte]operation{
 	// zeropage,X    ROL oper,X   36   2      6
 	// absolute      ROL oper     2E   3      6
 	// absolute,X    ROL oper,X   3E   3      7
-	0x2A: newOp("ROL", 0x2A, 1, accumulator, execROL),
-	0x26: newOp("ROL", 0x26, 2, zeroPage, execROL),
-	0x36: newOp("ROL", 0x36, 2, zeroPageXIndexed, execROL),
-	0x2E: newOp("ROL", 0x2E, 3, absolute, execROL),
-	0x3E: newOp("ROL", 0x3E, 3, absoluteXIndexed, execROL),
+	0x2A: newOp("ROL", 0x2A, 1, 2, accumulator, execROL),
+	0x26: newOp("ROL", 0x26, 2, 5, zeroPage, execROL),
+	0x36: newOp("ROL", 0x36, 2, 6, zeroPageXIndexed, execROL),
+	0x2E: newOp("ROL", 0x2E, 3, 6, absolute, execROL),
+	0x3E: newOp("ROL", 0x3E, 3, 7, absoluteXIndexed, execROL),
 
 	// TXS Transfer Index X to Stack Register
 	// addressing    assembler    opc  bytes  cyles
 	// --------------------------------------------
 	// implied       TXS          9A   1      2
-	0x9A: newOp("TXS", 0x9A, 1, implied, execTXS),
+	0x9A: newOp("TXS", 0x9A, 1, 2, implied, execTXS),
 
 	// ROR Rotate One Bit Right (Memory or Accumulator)
 	// addressing    assembler    opc  bytes  cyles
@@ -502,11 +538,11 @@ var opcodes = map[byte]operation{
 	// zeropage,X    ROR oper,X   76   2      6
 	// absolute      ROR oper     6E   3      6
 	// absolute,X    ROR oper,X   7E   3      7
-	0x6A: newOp("ROR", 0x6A, 1, accumulator, execROR),
-	0x66: newOp("ROR", 0x66, 2, zeroPage, execROR),
-	0x76: newOp("ROR", 0x76, 2, zeroPageXIndexed, execROR),
-	0x6E: newOp("ROR", 0x6E, 3, absolute, execROR),
-	0x7E: newOp("ROR", 0x7E, 3, absoluteXIndexed, execROR),
+	0x6A: newOp("ROR", 0x6A, 1, 2, accumulator, execROR),
+	0x66: newOp("ROR", 0x66, 2, 5, zeroPage, execROR),
+	0x76: newOp("ROR", 0x76, 2, 6, zeroPageXIndexed, execROR),
+	0x6E: newOp("ROR", 0x6E, 3, 6, absolute, execROR),
+	0x7E: newOp("ROR", 0x7E, 3, 7, absoluteXIndexed, execROR),
 
 	// ASL Shift Left One Bit (Memory or Accumulator)
 	// addressing    assembler    opc  bytes  cyles
@@ -516,11 +552,11 @@ var opcodes = map[byte]operation{
 	// zeropage,X    ASL oper,X   16   2      6
 	// absolute      ASL oper     0E   3      6
 	// absolute,X    ASL oper,X   1E   3      7
-	0x0A: newOp("ASL", 0x0A, 1, accumulator, execASL),
-	0x06: newOp("ASL", 0x06, 2, zeroPage, execASL),
-	0x16: newOp("ASL", 0x16, 2, zeroPageXIndexed, execASL),
-	0x0E: newOp("ASL", 0x0E, 3, absolute, execASL),
-	0x1E: newOp("ASL", 0x1E, 3, absoluteXIndexed, execASL),
+	0x0A: newOp("ASL", 0x0A, 1, 2, accumulator, execASL),
+	0x06: newOp("ASL", 0x06, 2, 5, zeroPage, execASL),
+	0x16: newOp("ASL", 0x16, 2, 6, zeroPageXIndexed, execASL),
+	0x0E: newOp("ASL", 0x0E, 3, 6, absolute, execASL),
+	0x1E: newOp("ASL", 0x1E, 3, 7, absoluteXIndexed, execASL),
 
 	// AND AND Memory with Accumulator
 	// addressing    assembler     opc   bytes  cyles
@@ -533,14 +569,14 @@ var opcodes = map[byte]operation{
 	// absolute,Y    AND oper,Y    39    3      4*
 	// (indirect,X)  AND (oper,X)  21    2      6
 	// (indirect),Y  AND (oper),Y  31    2      5*
-	0x29: newOp("AND", 0x29, 2, immediate, execAND),
-	0x25: newOp("AND", 0x25, 2, zeroPage, execAND),
-	0x35: newOp("AND", 0x35, 2, zeroPageXIndexed, execAND),
-	0x2D: newOp("AND", 0x2D, 3, absolute, execAND),
-	0x3D: newOp("AND", 0x3D, 3, absoluteXIndexed, execAND),
-	0x39: newOp("AND", 0x39, 3, absoluteYIndexed, execAND),
-	0x21: newOp("AND", 0x21, 2, indirectXIndexed, execAND),
-	0x31: newOp("AND", 0x31, 2, indirectYIndexed, execAND),
+	0x29: newOp("AND", 0x29, 2, 2, immediate, execAND),
+	0x25: newOp("AND", 0x25, 2, 3, zeroPage, execAND),
+	0x35: newOp("AND", 0x35, 2, 4, zeroPageXIndexed, execAND),
+	0x2D: newOp("AND", 0x2D, 3, 4, absolute, execAND),
+	0x3D: newOp("AND", 0x3D, 3, 4, absoluteXIndexed, execAND),
+	0x39: newOp("AND", 0x39, 3, 4, absoluteYIndexed, execAND),
+	0x21: newOp("AND", 0x21, 2, 6, indirectXIndexed, execAND),
+	0x31: newOp("AND", 0x31, 2, 5, indirectYIndexed, execAND),
 
 	// ORA OR Memory with Accumulator
 	// addressing    assembler     opc   bytes  cyles
@@ -553,12 +589,159 @@ var opcodes = map[byte]operation{
 	// absolute,Y    ORA oper,Y    19    3      4*
 	// (indirect,X)  ORA (oper,X)  01    2      6
 	// (indirect),Y  ORA (oper),Y  11    2      5*
-	0x09: newOp("ORA", 0x09, 2, immediate, execORA),
-	0x05: newOp("ORA", 0x05, 2, zeroPage, execORA),
-	0x15: newOp("ORA", 0x15, 2, zeroPageXIndexed, execORA),
-	0x0D: newOp("ORA", 0x0D, 3, absolute, execORA),
-	0x1D: newOp("ORA", 0x1D, 3, absoluteXIndexed, execORA),
-	0x19: newOp("ORA", 0x19, 3, absoluteYIndexed, execORA),
-	0x01: newOp("ORA", 0x01, 2, indirectXIndexed, execORA),
-	0x11: newOp("ORA", 0x11, 2, indirectYIndexed, execORA),
+	0x09: newOp("ORA", 0x09, 2, 2, immediate, execORA),
+	0x05: newOp("ORA", 0x05, 2, 3, zeroPage, execORA),
+	0x15: newOp("ORA", 0x15, 2, 4, zeroPageXIndexed, execORA),
+	0x0D: newOp("ORA", 0x0D, 3, 4, absolute, execORA),
+	0x1D: newOp("ORA", 0x1D, 3, 4, absoluteXIndexed, execORA),
+	0x19: newOp("ORA", 0x19, 3, 4, absoluteYIndexed, execORA),
+	0x01: newOp("ORA", 0x01, 2, 6, indirectXIndexed, execORA),
+	0x11: newOp("ORA", 0x11, 2, 5, indirectYIndexed, execORA),
+}
+
+// cmosOpcodes are the opcodes decoded by the 65C02. It keeps every NMOS opcode, adds new
+// instructions and the (zeropage) addressing mode, and turns every remaining opcode into a
+// NOP of a fixed size and duration instead of leaving it undefined.
+var cmosOpcodes = newCMOSOpcodes()
+
+func newCMOSOpcodes() map[byte]operation {
+	ops := make(map[byte]operation, 256)
+	for code, o := range opcodes {
+		ops[code] = o
+	}
+
+	for _, o := range []operation{
+		// BRA Branch Always
+		// addressing    assembler    opc  bytes  cyles
+		// --------------------------------------------
+		// relative      BRA oper     80   2      3**
+		newOp("BRA", 0x80, 2, 2, relative, execBRA),
+
+		// STZ Store Zero in Memory
+		// addressing    assembler    opc  bytes  cyles
+		// --------------------------------------------
+		// zeropage      STZ oper     64   2      3
+		// zeropage,X    STZ oper,X   74   2      4
+		// absolute      STZ oper     9C   3      4
+		// absolute,X    STZ oper,X   9E   3      5
+		newOp("STZ", 0x64, 2, 3, zeroPage, execSTZ),
+		newOp("STZ", 0x74, 2, 4, zeroPageXIndexed, execSTZ),
+		newOp("STZ", 0x9C, 3, 4, absolute, execSTZ),
+		newOp("STZ", 0x9E, 3, 5, absoluteXIndexed, execSTZ),
+
+		// PHX, PHY, PLX, PLY Push and Pull Index Registers
+		// addressing    assembler    opc  bytes  cyles
+		// --------------------------------------------
+		// implied       PHX          DA   1      3
+		// implied       PHY          5A   1      3
+		// implied       PLX          FA   1      4
+		// implied       PLY          7A   1      4
+		newOp("PHX", 0xDA, 1, 3, implied, execPHX),
+		newOp("PHY", 0x5A, 1, 3, implied, execPHY),
+		newOp("PLX", 0xFA, 1, 4, implied, execPLX),
+		newOp("PLY", 0x7A, 1, 4, implied, execPLY),
+
+		// TSB, TRB Test and Set/Reset Memory Bits with Accumulator
+		// addressing    assembler    opc  bytes  cyles
+		// --------------------------------------------
+		// zeropage      TSB oper     04   2      5
+		// absolute      TSB oper     0C   3      6
+		// zeropage      TRB oper     14   2      5
+		// absolute      TRB oper     1C   3      6
+		newOp("TSB", 0x04, 2, 5, zeroPage, execTSB),
+		newOp("TSB", 0x0C, 3, 6, absolute, execTSB),
+		newOp("TRB", 0x14, 2, 5, zeroPage, execTRB),
+		newOp("TRB", 0x1C, 3, 6, absolute, execTRB),
+
+		// INC, DEC Accumulator
+		// addressing    assembler    opc  bytes  cyles
+		// --------------------------------------------
+		// accumulator   INC A        1A   1      2
+		// accumulator   DEC A        3A   1      2
+		newOp("INC", 0x1A, 1, 2, accumulator, execINC),
+		newOp("DEC", 0x3A, 1, 2, accumulator, execDEC),
+
+		// BIT additional addressing modes
+		// addressing    assembler    opc  bytes  cyles
+		// --------------------------------------------
+		// immidiate     BIT #oper    89   2      2
+		// zeropage,X    BIT oper,X   34   2      4
+		// absolute,X    BIT oper,X   3C   3      4*
+		newOp("BIT", 0x89, 2, 2, immediate, execBIT),
+		newOp("BIT", 0x34, 2, 4, zeroPageXIndexed, execBIT),
+		newOp("BIT", 0x3C, 3, 4, absoluteXIndexed, execBIT),
+
+		// (zeropage) addressing mode
+		// addressing    assembler    opc  bytes  cyles
+		// --------------------------------------------
+		// (zeropage)    ORA (oper)   12   2      5
+		// (zeropage)    AND (oper)   32   2      5
+		// (zeropage)    EOR (oper)   52   2      5
+		// (zeropage)    ADC (oper)   72   2      5
+		// (zeropage)    STA (oper)   92   2      5
+		// (zeropage)    LDA (oper)   B2   2      5
+		// (zeropage)    CMP (oper)   D2   2      5
+		// (zeropage)    SBC (oper)   F2   2      5
+		newOp("ORA", 0x12, 2, 5, zeroPageIndirect, execORA),
+		newOp("AND", 0x32, 2, 5, zeroPageIndirect, execAND),
+		newOp("EOR", 0x52, 2, 5, zeroPageIndirect, execEOR),
+		newOp("ADC", 0x72, 2, 5, zeroPageIndirect, execADC),
+		newOp("STA", 0x92, 2, 5, zeroPageIndirect, execSTA),
+		newOp("LDA", 0xB2, 2, 5, zeroPageIndirect, execLDA),
+		newOp("CMP", 0xD2, 2, 5, zeroPageIndirect, execCMP),
+		newOp("SBC", 0xF2, 2, 5, zeroPageIndirect, execSBC),
+
+		// JMP fixed indirect and (absolute,X)
+		// addressing    assembler     opc  bytes  cyles
+		// --------------------------------------------
+		// indirect      JMP (oper)    6C   3      6
+		// (absolute,X)  JMP (oper,X)  7C   3      6
+		newOp("JMP", 0x6C, 3, 6, indirect, execJMP),
+		newOp("JMP", 0x7C, 3, 6, absoluteXIndexedIndirect, execJMP),
+
+		// Shifts and rotates, absolute,X only take an extra cycle when crossing a page
+		// addressing    assembler    opc  bytes  cyles
+		// --------------------------------------------
+		// absolute,X    ASL oper,X   1E   3      6*
+		// absolute,X    LSR oper,X   5E   3      6*
+		// absolute,X    ROL oper,X   3E   3      6*
+		// absolute,X    ROR oper,X   7E   3      6*
+		newOp("ASL", 0x1E, 3, 6, absoluteXIndexed, execASL),
+		newOp("LSR", 0x5E, 3, 6, absoluteXIndexed, execLSR),
+		newOp("ROL", 0x3E, 3, 6, absoluteXIndexed, execROL),
+		newOp("ROR", 0x7E, 3, 6, absoluteXIndexed, execROR),
+
+		// Undefined opcodes that consume operands
+		// addressing    assembler    opc                       bytes  cyles
+		// -----------------------------------------------------------------
+		// immidiate     NOP #oper    02 22 42 62 82 C2 E2      2      2
+		// zeropage      NOP oper     44                        2      3
+		// zeropage,X    NOP oper,X   54 D4 F4                  2      4
+		// absolute      NOP oper     5C                        3      8
+		// absolute      NOP oper     DC FC                     3      4
+		newOp("NOP", 0x02, 2, 2, immediate, execNOP),
+		newOp("NOP", 0x22, 2, 2, immediate, execNOP),
+		newOp("NOP", 0x42, 2, 2, immediate, execNOP),
+		newOp("NOP", 0x62, 2, 2, immediate, execNOP),
+		newOp("NOP", 0x82, 2, 2, immediate, execNOP),
+		newOp("NOP", 0xC2, 2, 2, immediate, execNOP),
+		newOp("NOP", 0xE2, 2, 2, immediate, execNOP),
+		newOp("NOP", 0x44, 2, 3, zeroPage, execNOP),
+		newOp("NOP", 0x54, 2, 4, zeroPageXIndexed, execNOP),
+		newOp("NOP", 0xD4, 2, 4, zeroPageXIndexed, execNOP),
+		newOp("NOP", 0xF4, 2, 4, zeroPageXIndexed, execNOP),
+		newOp("NOP", 0x5C, 3, 8, absolute, execNOP),
+		newOp("NOP", 0xDC, 3, 4, absolute, execNOP),
+		newOp("NOP", 0xFC, 3, 4, absolute, execNOP),
+	} {
+		ops[o.opcode] = o
+	}
+
+	// Every other undefined opcode is a single byte, single cycle NOP
+	for code := 0; code < 0x100; code++ {
+		if _, ok := ops[byte(code)]; !ok {
+			ops[byte(code)] = newOp("NOP", byte(code), 1, 1, implied, execNOP)
+		}
+	}
+	return ops
 }
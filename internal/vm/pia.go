@@ -0,0 +1,107 @@
+package vm
+
+// PIA register addresses as decoded by the Apple 1
+const (
+	kbd     uint16 = 0xD010 // keyboard data, reading it clears the key ready flag
+	kbdCR   uint16 = 0xD011 // keyboard control, bit 7 set while a key is ready
+	dsp     uint16 = 0xD012 // display data, bit 7 set while the display is busy
+	dspCR   uint16 = 0xD013 // display control
+	piaRegs uint16 = 0x0003 // register select bits
+)
+
+// keyBufferSize is how many key presses can queue up before KeyPress blocks
+const keyBufferSize = 4096
+
+// pia emulates the Motorola 6820 Peripheral Interface Adapter connecting the Apple 1's keyboard
+// and display to the cpu. Port A reads the keyboard and port B drives the display.
+type pia struct {
+	keys     chan byte    // key presses waiting to be latched
+	key      byte         // latched key
+	keyReady bool         // whether key hasn't been read yet
+	kbdCR    byte         // keyboard control register
+	dspCR    byte         // display control register
+	display  func(c byte) // receives every character written to the display
+}
+
+func newPIA(display func(c byte)) *pia {
+	return &pia{
+		keys:    make(chan byte, keyBufferSize),
+		display: display,
+	}
+}
+
+// latch moves the next queued key into the keyboard register if it's free
+func (p *pia) latch() {
+	if p.keyReady {
+		return
+	}
+	select {
+	case k := <-p.keys:
+		p.key = k
+		p.keyReady = true
+	default:
+	}
+}
+
+func (p *pia) Read(addr uint16) byte {
+	switch addr & piaRegs {
+	case kbd & piaRegs:
+		p.latch()
+		p.keyReady = false
+		return p.key | 0x80
+	case kbdCR & piaRegs:
+		p.latch()
+		if p.keyReady {
+			return p.kbdCR | 0x80
+		}
+		return p.kbdCR
+	case dsp & piaRegs:
+		// Characters are displayed immediately, so the display is never busy
+		return 0
+	default:
+		return p.dspCR
+	}
+}
+
+// Peek returns what Read would without consuming a key press
+func (p *pia) Peek(addr uint16) byte {
+	switch addr & piaRegs {
+	case kbd & piaRegs:
+		return p.key | 0x80
+	case kbdCR & piaRegs:
+		if p.keyReady {
+			return p.kbdCR | 0x80
+		}
+		return p.kbdCR
+	}
+	return p.Read(addr)
+}
+
+func (p *pia) Write(addr uint16, b byte) {
+	switch addr & piaRegs {
+	case kbdCR & piaRegs:
+		p.kbdCR = b & 0x3F
+	case dsp & piaRegs:
+		// The data direction register isn't modelled, so the $7F the Woz Monitor writes to
+		// it while resetting reaches the display as a DEL, which displays nothing
+		p.display(b & 0x7F)
+	case dspCR & piaRegs:
+		p.dspCR = b & 0x3F
+	}
+}
+
+// KeyPress queues a key for the keyboard register, blocking if too many are already waiting.
+// Keys are 7-bit ASCII, the PIA sets bit 7 itself. It is safe to call while the vm runs.
+func (vm *VM) KeyPress(k byte) {
+	vm.pia.keys <- k & 0x7F
+}
+
+// KeysPending returns how many key presses the running program hasn't read yet, including one
+// latched in the keyboard register. It must not be called while the vm runs.
+func (vm *VM) KeysPending() int {
+	n := len(vm.pia.keys)
+	if vm.pia.keyReady {
+		n++
+	}
+	return n
+}
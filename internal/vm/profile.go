@@ -0,0 +1,113 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bradford-hamilton/apple-1/internal/pprof"
+)
+
+// profiler counts the instructions and cycles spent at each address under each call stack
+type profiler struct {
+	start    time.Time
+	root     uint16                   // where execution was when profiling started
+	counts   map[profileKey]*[2]int64 // instructions and cycles
+	gen      uint64                   // call stack generation stack was built for
+	stack    string                   // the current call stack encoded as a map key
+	stackSet map[string][]Frame       // call stacks seen so far by key
+}
+
+type profileKey struct {
+	stack string
+	pc    uint16
+}
+
+// StartProfile starts counting the instructions and cycles spent in each subroutine, discarding
+// anything counted before
+func (vm *VM) StartProfile() {
+	vm.profile = &profiler{
+		start:    time.Now(),
+		root:     vm.cpu.pc,
+		counts:   make(map[profileKey]*[2]int64),
+		gen:      vm.callGen - 1,
+		stackSet: make(map[string][]Frame),
+	}
+}
+
+// record counts an instruction at pc taking cycles, attributing it to the current call stack
+func (p *profiler) record(vm *VM, pc uint16, cycles byte) {
+	if p.gen != vm.callGen {
+		var b strings.Builder
+		for _, f := range vm.calls {
+			fmt.Fprintf(&b, "%04X%04X", f.Caller, f.Entry)
+		}
+		p.stack = b.String()
+		if _, ok := p.stackSet[p.stack]; !ok {
+			p.stackSet[p.stack] = vm.CallStack()
+		}
+		p.gen = vm.callGen
+	}
+
+	key := profileKey{stack: p.stack, pc: pc}
+	c := p.counts[key]
+	if c == nil {
+		c = new([2]int64)
+		p.counts[key] = c
+	}
+	c[0]++
+	c[1] += int64(cycles)
+}
+
+// WriteProfile writes what has been counted since StartProfile as a gzipped pprof profile.
+// Each subroutine is a function named after the label at its entry point, or the entry
+// address when there is none, so `go tool pprof` can show top lists and flame graphs.
+func (vm *VM) WriteProfile(w io.Writer) error {
+	if vm.profile == nil {
+		return errors.New("profiling wasn't started")
+	}
+	return vm.buildProfile().Write(w)
+}
+
+// buildProfile turns the counts into samples, one for each address under each call stack
+func (vm *VM) buildProfile() *pprof.Profile {
+	p := vm.profile
+	prof := &pprof.Profile{
+		Binary:      "apple1",
+		SampleTypes: []pprof.ValueType{{Type: "instructions", Unit: "count"}, {Type: "cycles", Unit: "count"}},
+		PeriodType:  pprof.ValueType{Type: "cycles", Unit: "count"},
+		Period:      1,
+		Time:        p.start,
+		Duration:    time.Since(p.start),
+	}
+	for key, c := range p.counts {
+		calls := p.stackSet[key.stack]
+
+		// The innermost frame is the instruction itself, inside the routine entered last.
+		// Each call site is inside the routine entered before it.
+		stack := make([]pprof.Frame, 0, len(calls)+1)
+		addr := key.pc
+		for i := len(calls); i >= 0; i-- {
+			entry := p.root
+			if i > 0 {
+				entry = calls[i-1].Entry
+			}
+			stack = append(stack, pprof.Frame{Addr: uint64(addr), Function: vm.routineName(entry)})
+			if i > 0 {
+				addr = calls[i-1].Caller
+			}
+		}
+		prof.Samples = append(prof.Samples, pprof.Sample{Stack: stack, Values: c[:]})
+	}
+	return prof
+}
+
+// routineName names the subroutine entered at addr
+func (vm *VM) routineName(addr uint16) string {
+	if name := vm.symbols.describe(addr); name != "" {
+		return name
+	}
+	return fmt.Sprintf("$%04X", addr)
+}
@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+
+	"github.com/bradford-hamilton/apple-1/internal/pprof"
+)
+
+func TestProfile(t *testing.T) {
+	vm := newFlatVM()
+	vm.load(0x0300, []byte{0x20, 0x10, 0x03, 0x20, 0x20, 0x03, 0x4C, 0x06, 0x03}) // JSR $0310; JSR $0320; JMP *
+	vm.load(0x0310, []byte{0x20, 0x20, 0x03, 0x60})                               // JSR $0320; RTS
+	vm.load(0x0320, []byte{0xEA, 0x60})                                           // NOP; RTS
+	vm.cpu.pc = 0x0300
+	vm.StartProfile()
+	for vm.cpu.pc != 0x0306 {
+		if _, err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A JSR counts towards its caller and an RTS towards the routine returning
+	flat := make(map[string][2]int64)
+	cum := make(map[string][2]int64)
+	prof := vm.buildProfile()
+	for _, s := range prof.Samples {
+		add := func(m map[string][2]int64, name string) {
+			v := m[name]
+			v[0] += s.Values[0]
+			v[1] += s.Values[1]
+			m[name] = v
+		}
+		add(flat, s.Stack[0].Function)
+		seen := make(map[string]bool)
+		for _, f := range s.Stack {
+			if !seen[f.Function] {
+				seen[f.Function] = true
+				add(cum, f.Function)
+			}
+		}
+	}
+	wantFlat := map[string][2]int64{"$0300": {2, 12}, "$0310": {2, 12}, "$0320": {4, 16}}
+	wantCum := map[string][2]int64{"$0300": {8, 40}, "$0310": {4, 20}, "$0320": {4, 16}}
+	if !reflect.DeepEqual(flat, wantFlat) {
+		t.Errorf("flat instructions and cycles %v, want %v", flat, wantFlat)
+	}
+	if !reflect.DeepEqual(cum, wantCum) {
+		t.Errorf("cumulative instructions and cycles %v, want %v", cum, wantCum)
+	}
+
+	// Each frame outside the innermost is at the call site in the routine before it
+	want := []pprof.Frame{{Addr: 0x0320, Function: "$0320"}, {Addr: 0x0310, Function: "$0310"}, {Addr: 0x0300, Function: "$0300"}}
+	found := false
+	for _, s := range prof.Samples {
+		if reflect.DeepEqual(s.Stack, want) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no sample for the NOP called through $0310 with stack %v", want)
+	}
+
+	var out bytes.Buffer
+	if err := vm.WriteProfile(&out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gzip.NewReader(&out); err != nil {
+		t.Errorf("the profile isn't gzipped: %v", err)
+	}
+	if err := New().WriteProfile(&out); err == nil {
+		t.Error("expected an error writing a profile that wasn't started")
+	}
+}
@@ -0,0 +1,97 @@
+package vm
+
+import "strings"
+
+// Dimensions of the Apple 1's display in characters
+const (
+	ScreenWidth  = 40
+	ScreenHeight = 24
+)
+
+// screen mirrors what the Apple 1's terminal section shows. Like the real hardware it only
+// understands printable characters and carriage returns, wraps after 40 columns and scrolls
+// up once the cursor moves past the bottom row.
+type screen struct {
+	cells [ScreenHeight][ScreenWidth]byte
+	row   int
+	col   int
+}
+
+func newScreen() *screen {
+	s := &screen{}
+	s.clear()
+	return s
+}
+
+// clear blanks the screen and homes the cursor, like the CLEAR SCREEN switch
+func (s *screen) clear() {
+	for r := range s.cells {
+		s.blankRow(r)
+	}
+	s.row, s.col = 0, 0
+}
+
+func (s *screen) blankRow(r int) {
+	for c := range s.cells[r] {
+		s.cells[r][c] = ' '
+	}
+}
+
+// put displays a character written to the PIA's display register
+func (s *screen) put(c byte) {
+	c &= 0x7F
+	switch {
+	case c == '\r':
+		s.newline()
+		return
+	case c >= 'a' && c <= 'z':
+		c -= 'a' - 'A'
+	case c < 0x20 || c >= 0x7F:
+		return
+	}
+	s.cells[s.row][s.col] = c
+	if s.col++; s.col == ScreenWidth {
+		s.newline()
+	}
+}
+
+func (s *screen) newline() {
+	s.col = 0
+	if s.row < ScreenHeight-1 {
+		s.row++
+		return
+	}
+	copy(s.cells[:], s.cells[1:])
+	s.blankRow(ScreenHeight - 1)
+}
+
+// lines returns each row of the screen with trailing blanks removed
+func (s *screen) lines() []string {
+	lines := make([]string, ScreenHeight)
+	for r := range s.cells {
+		lines[r] = strings.TrimRight(string(s.cells[r][:]), " ")
+	}
+	return lines
+}
+
+// ScreenLines returns the 24 rows currently on the display, top to bottom, each with its
+// trailing blanks removed
+func (vm *VM) ScreenLines() []string {
+	return vm.screen.lines()
+}
+
+// ScreenText returns the display as text: 24 lines, each with its trailing blanks removed
+// and ending in a new line
+func (vm *VM) ScreenText() string {
+	return strings.Join(vm.screen.lines(), "\n") + "\n"
+}
+
+// ScreenCursor returns the row and column the next character will be displayed at
+func (vm *VM) ScreenCursor() (row, col int) {
+	return vm.screen.row, vm.screen.col
+}
+
+// ClearScreen blanks the display and homes the cursor, like the Apple 1's CLEAR SCREEN switch
+func (vm *VM) ClearScreen() {
+	vm.screen.clear()
+}
@@ -0,0 +1,152 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// singleStepDirEnv names the directory holding the community 65x02 "SingleStepTests" JSON
+// files, one per opcode named after it in hex (a9.json, 6c.json, ...), such as a checkout of
+// https://github.com/SingleStepTests/65x02/tree/main/6502/v1
+const singleStepDirEnv = "SINGLESTEP_DIR"
+
+// singleStepIgnoredFlags are status bits with no storage in the cpu. The vm always holds them
+// set, where the tests record whatever was last pulled from the stack.
+const singleStepIgnoredFlags = flagDefault
+
+type singleStepState struct {
+	PC  uint16   `json:"pc"`
+	S   byte     `json:"s"`
+	A   byte     `json:"a"`
+	X   byte     `json:"x"`
+	Y   byte     `json:"y"`
+	P   byte     `json:"p"`
+	RAM [][2]int `json:"ram"`
+}
+
+type singleStepCase struct {
+	Name    string            `json:"name"`
+	Initial singleStepState   `json:"initial"`
+	Final   singleStepState   `json:"final"`
+	Cycles  []json.RawMessage `json:"cycles"` // one [address, value, "read"|"write"] entry per cycle
+}
+
+// singleStepMaxReported is how many failing cases are reported for each opcode
+const singleStepMaxReported = 5
+
+// TestSingleStep executes every case in the SingleStepTests files found in $SINGLESTEP_DIR,
+// one instruction at a time, comparing registers, RAM and cycle counts. Each opcode is a
+// subtest that reports its first failing cases and how many failed, and opcodes the cpu
+// doesn't implement are skipped.
+func TestSingleStep(t *testing.T) {
+	dir := os.Getenv(singleStepDirEnv)
+	if dir == "" {
+		t.Skipf("set %s to a directory of SingleStepTests JSON files to run the conformance tests", singleStepDirEnv)
+	}
+
+	found := 0
+	vm := newFlatVM()
+	for opcode := 0; opcode < 0x100; opcode++ {
+		o, err := operationByCode(byte(opcode))
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%02x.json", opcode))
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		found++
+
+		t.Run(fmt.Sprintf("%02X_%s", opcode, o.name), func(t *testing.T) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cases []singleStepCase
+			if err := json.Unmarshal(data, &cases); err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+
+			failed := 0
+			for _, c := range cases {
+				diff := runSingleStep(vm, c)
+				if diff == "" {
+					continue
+				}
+				if failed < singleStepMaxReported {
+					t.Errorf("%q: %s", c.Name, diff)
+				}
+				failed++
+			}
+			if failed > 0 {
+				t.Errorf("%d of %d cases failed", failed, len(cases))
+			}
+		})
+	}
+
+	if found == 0 {
+		t.Fatalf("no SingleStepTests files found in %s", dir)
+	}
+}
+
+// runSingleStep executes a single case and returns a description of every difference from
+// the expected final state, or an empty string if it passed
+func runSingleStep(vm *VM, c singleStepCase) string {
+	vm.cpu.pc = c.Initial.PC
+	vm.cpu.sp = c.Initial.S
+	vm.cpu.a = c.Initial.A
+	vm.cpu.x = c.Initial.X
+	vm.cpu.y = c.Initial.Y
+	vm.cpu.ps = c.Initial.P | flagDefault
+	for _, cell := range c.Initial.RAM {
+		vm.mem[cell[0]] = byte(cell[1])
+	}
+	vm.cycles = 0
+
+	var diffs []string
+	if err := vm.emulateCycle(); err != nil {
+		diffs = append(diffs, err.Error())
+	}
+
+	want := c.Final
+	diffs = appendDiff(diffs, "PC", int(vm.cpu.pc), int(want.PC), 4)
+	diffs = appendDiff(diffs, "S", int(vm.cpu.sp), int(want.S), 2)
+	diffs = appendDiff(diffs, "A", int(vm.cpu.a), int(want.A), 2)
+	diffs = appendDiff(diffs, "X", int(vm.cpu.x), int(want.X), 2)
+	diffs = appendDiff(diffs, "Y", int(vm.cpu.y), int(want.Y), 2)
+	diffs = appendDiff(
+		diffs,
+		"P",
+		int(vm.cpu.ps&^singleStepIgnoredFlags),
+		int(want.P&^singleStepIgnoredFlags),
+		2,
+	)
+	for _, cell := range want.RAM {
+		diffs = appendDiff(diffs, fmt.Sprintf("$%04X", cell[0]), int(vm.mem[cell[0]]), cell[1], 2)
+	}
+	if int(vm.cycles) != len(c.Cycles) {
+		diffs = append(diffs, fmt.Sprintf("cycles=%d want %d", vm.cycles, len(c.Cycles)))
+	}
+
+	// Leave memory clean for the next case
+	for _, cell := range c.Initial.RAM {
+		vm.mem[cell[0]] = 0
+	}
+	for _, cell := range want.RAM {
+		vm.mem[cell[0]] = 0
+	}
+
+	return strings.Join(diffs, ", ")
+}
+
+func appendDiff(diffs []string, name string, got, want, width int) []string {
+	if got == want {
+		return diffs
+	}
+	return append(diffs, fmt.Sprintf("%s=$%0*X want $%0*X", name, width, got, width, want))
+}
@@ -0,0 +1,125 @@
+package vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// stateMagic starts every save state
+var stateMagic = [4]byte{'A', '1', 'S', 'T'}
+
+// stateVersion is bumped whenever the save state layout changes
+const stateVersion = 1
+
+// stateHeader is the fixed part of a save state, followed by all 64KiB of memory and the
+// screen's cells row by row. Multi-byte fields are little endian.
+type stateHeader struct {
+	Magic     [4]byte
+	Version   uint8
+	Variant   uint8
+	A         uint8
+	X         uint8
+	Y         uint8
+	SP        uint8
+	P         uint8
+	PC        uint16
+	Cycles    uint64
+	Key       uint8
+	KeyReady  uint8
+	KbdCR     uint8
+	DspCR     uint8
+	ScreenRow uint8
+	ScreenCol uint8
+}
+
+// SaveState writes a snapshot of the cpu, memory, keyboard and display to w. Breakpoints,
+// symbols and keys that haven't reached the keyboard register aren't saved.
+func (vm *VM) SaveState(w io.Writer) error {
+	h := stateHeader{
+		Magic:     stateMagic,
+		Version:   stateVersion,
+		Variant:   uint8(vm.variant),
+		A:         vm.cpu.a,
+		X:         vm.cpu.x,
+		Y:         vm.cpu.y,
+		SP:        vm.cpu.sp,
+		P:         vm.cpu.ps,
+		PC:        vm.cpu.pc,
+		Cycles:    vm.cycles,
+		Key:       vm.pia.key,
+		KeyReady:  boolToByte(vm.pia.keyReady),
+		KbdCR:     vm.pia.kbdCR,
+		DspCR:     vm.pia.dspCR,
+		ScreenRow: uint8(vm.screen.row),
+		ScreenCol: uint8(vm.screen.col),
+	}
+	if err := binary.Write(w, binary.LittleEndian, &h); err != nil {
+		return err
+	}
+	if _, err := w.Write(vm.mem[:]); err != nil {
+		return err
+	}
+	for r := range vm.screen.cells {
+		if _, err := w.Write(vm.screen.cells[r][:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadState restores a snapshot written by SaveState. Only RAM is restored, so ROMs and
+// devices keep the contents the vm was configured with. The call stack is forgotten.
+func (vm *VM) LoadState(r io.Reader) error {
+	var h stateHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return fmt.Errorf("reading save state: %w", err)
+	}
+	if h.Magic != stateMagic {
+		return errors.New("not an Apple 1 save state")
+	}
+	if h.Version != stateVersion {
+		return fmt.Errorf("unsupported save state version %d", h.Version)
+	}
+	if h.ScreenRow >= ScreenHeight || h.ScreenCol >= ScreenWidth {
+		return errors.New("save state has the cursor off the screen")
+	}
+	mem := newBlock()
+	if _, err := io.ReadFull(r, mem[:]); err != nil {
+		return fmt.Errorf("reading save state memory: %w", err)
+	}
+	var cells [ScreenHeight][ScreenWidth]byte
+	for row := range cells {
+		if _, err := io.ReadFull(r, cells[row][:]); err != nil {
+			return fmt.Errorf("reading save state screen: %w", err)
+		}
+	}
+	if err := vm.SetVariant(Variant(h.Variant)); err != nil {
+		return err
+	}
+
+	for i := range vm.pages {
+		if vm.pages[i].kind == pageRAM {
+			copy(vm.mem[i<<8:(i+1)<<8], mem[i<<8:])
+		}
+	}
+	vm.SetRegisters(Registers{A: h.A, X: h.X, Y: h.Y, SP: h.SP, PC: h.PC, P: h.P})
+	vm.cycles = h.Cycles
+	vm.pia.key = h.Key
+	vm.pia.keyReady = h.KeyReady != 0
+	vm.pia.kbdCR = h.KbdCR
+	vm.pia.dspCR = h.DspCR
+	vm.screen.cells = cells
+	vm.screen.row, vm.screen.col = int(h.ScreenRow), int(h.ScreenCol)
+	vm.calls = nil
+	vm.callGen++
+	return nil
+}
+
+func boolToByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,188 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// symbols maps addresses to labels and back so traces, disassembly, fault reports and
+// breakpoints can show and accept names instead of raw addresses
+type symbols struct {
+	byAddr map[uint16]string
+	byName map[string]uint16
+}
+
+// newSymbols returns a symbol table seeded with the Woz Monitor entry points and I/O registers
+func newSymbols() *symbols {
+	s := &symbols{
+		byAddr: make(map[uint16]string),
+		byName: make(map[string]uint16),
+	}
+	for _, sym := range wozMonitorSymbols {
+		s.add(sym.name, sym.addr)
+	}
+	return s
+}
+
+// wozMonitorSymbols are the well known entry points into the Woz Monitor ROM at $FF00 along
+// with the PIA registers it drives
+var wozMonitorSymbols = []struct {
+	name string
+	addr uint16
+}{
+	{"KBD", 0xD010},
+	{"KBDCR", 0xD011},
+	{"DSP", 0xD012},
+	{"DSPCR", 0xD013},
+	{"RESET", 0xFF00},
+	{"NOTCR", 0xFF0F},
+	{"ESCAPE", 0xFF1A},
+	{"GETLINE", 0xFF1F},
+	{"BACKSPACE", 0xFF26},
+	{"NEXTCHAR", 0xFF29},
+	{"SETSTOR", 0xFF40},
+	{"SETMODE", 0xFF41},
+	{"BLSKIP", 0xFF43},
+	{"NEXTITEM", 0xFF44},
+	{"NEXTHEX", 0xFF5F},
+	{"DIG", 0xFF6E},
+	{"HEXSHIFT", 0xFF74},
+	{"NOTHEX", 0xFF7F},
+	{"TONEXTITEM", 0xFF91},
+	{"RUN", 0xFF94},
+	{"NOTSTOR", 0xFF97},
+	{"SETADR", 0xFF9B},
+	{"NXTPRNT", 0xFFA4},
+	{"PRDATA", 0xFFBA},
+	{"XAMNEXT", 0xFFC4},
+	{"MOD8CHK", 0xFFD6},
+	{"PRBYTE", 0xFFDC},
+	{"PRHEX", 0xFFE5},
+	{"ECHO", 0xFFEF},
+}
+
+// add records a label for addr. VICE style leading dots are dropped, and a later label for
+// the same address replaces the name shown for it while both names keep resolving.
+func (s *symbols) add(name string, addr uint16) {
+	name = strings.TrimPrefix(name, ".")
+	if name == "" {
+		return
+	}
+	s.byAddr[addr] = name
+	s.byName[strings.ToLower(name)] = addr
+}
+
+// lookup returns the label for exactly addr
+func (s *symbols) lookup(addr uint16) (string, bool) {
+	name, ok := s.byAddr[addr]
+	return name, ok
+}
+
+// resolve returns the address of a label, ignoring case and any leading dot
+func (s *symbols) resolve(name string) (uint16, bool) {
+	addr, ok := s.byName[strings.ToLower(strings.TrimPrefix(name, "."))]
+	return addr, ok
+}
+
+// describe returns addr as "label" or "label+$NN" using the closest label at or below addr
+// within a page, and an empty string if there is none
+func (s *symbols) describe(addr uint16) string {
+	for off := 0; off < 0x100 && off <= int(addr); off++ {
+		if name, ok := s.byAddr[addr-uint16(off)]; ok {
+			if off == 0 {
+				return name
+			}
+			return fmt.Sprintf("%s+$%02X", name, off)
+		}
+	}
+	return ""
+}
+
+// Label returns the label for exactly addr
+func (vm *VM) Label(addr uint16) (string, bool) {
+	return vm.symbols.lookup(addr)
+}
+
+// Describe returns addr as "label" or "label+$NN" using the closest label at or below addr
+// within a page, and an empty string if there is none
+func (vm *VM) Describe(addr uint16) string {
+	return vm.symbols.describe(addr)
+}
+
+// LoadSymbols reads a VICE label file (`al C:0280 .start`) or a ca65/ld65 map file and adds
+// its labels to the vm's symbol table
+func (vm *VM) LoadSymbols(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := vm.symbols.load(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: no symbols found, expected a VICE label file or an ld65 map file", path)
+	}
+	return nil
+}
+
+// load parses labels from r and returns how many were added. VICE `al` lines may appear
+// anywhere, ld65 map entries are only read from its "Exports list" sections.
+func (s *symbols) load(r io.Reader) (int, error) {
+	var n int
+	var inExports bool
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(text)
+
+		switch {
+		case len(fields) > 0 && fields[0] == "al":
+			// al [C:]ADDR .label
+			if len(fields) != 3 {
+				return n, fmt.Errorf("line %d: malformed label %q", line, text)
+			}
+			addr, err := parseSymbolAddr(strings.TrimPrefix(fields[1], "C:"))
+			if err != nil {
+				return n, fmt.Errorf("line %d: %v", line, err)
+			}
+			s.add(fields[2], addr)
+			n++
+		case strings.HasPrefix(text, "Exports list"):
+			inExports = true
+		case inExports && strings.HasPrefix(text, "---"):
+			continue
+		case inExports && text == "":
+			inExports = false
+		case inExports:
+			// Each line holds one or two "name value flags" triples
+			if len(fields)%3 != 0 {
+				return n, fmt.Errorf("line %d: malformed export %q", line, text)
+			}
+			for i := 0; i < len(fields); i += 3 {
+				addr, err := parseSymbolAddr(fields[i+1])
+				if err != nil {
+					return n, fmt.Errorf("line %d: %v", line, err)
+				}
+				s.add(fields[i], addr)
+				n++
+			}
+		}
+	}
+	return n, scanner.Err()
+}
+
+func parseSymbolAddr(s string) (uint16, error) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || v > 0xFFFF {
+		return 0, fmt.Errorf("bad address %q", s)
+	}
+	return uint16(v), nil
+}
@@ -0,0 +1,153 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWozMonitorSymbols(t *testing.T) {
+	s := newSymbols()
+	tests := []struct {
+		addr uint16
+		want string
+	}{
+		{0xFF00, "RESET"},
+		{0xFFEF, "ECHO"},
+		{0xFFDC, "PRBYTE"},
+		{0xD012, "DSP"},
+		{0xFFF0, "ECHO+$01"},
+		{0xD014, "DSPCR+$01"},
+		{0x0300, ""},
+	}
+	for _, tt := range tests {
+		if got := s.describe(tt.addr); got != tt.want {
+			t.Errorf("$%04X described as %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+	if addr, ok := s.resolve("echo"); !ok || addr != 0xFFEF {
+		t.Errorf("echo resolved to $%04X, %t, want $FFEF", addr, ok)
+	}
+}
+
+func TestLoadSymbols(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		n     int
+		names map[string]uint16
+	}{
+		{
+			name:  "vice",
+			text:  "al C:0280 .start\nal 0300 .loop\n\nal C:ff00 .reset_again\n",
+			n:     3,
+			names: map[string]uint16{"start": 0x0280, ".loop": 0x0300, "RESET": 0xFF00, "reset_again": 0xFF00},
+		},
+		{
+			name: "ld65",
+			text: "Modules list:\n-------------\nmain.o:\n    CODE              Offs=000000  Size=000010\n\n" +
+				"Exports list by name:\n---------------------\n" +
+				"main                      000280 RLA    print                     0002A0 RLA    \n" +
+				"table                     000400 RLA    \n\n" +
+				"Imports list:\n-------------\nfoo (main.o):\n",
+			n:     3,
+			names: map[string]uint16{"main": 0x0280, "print": 0x02A0, "table": 0x0400},
+		},
+		{
+			name: "ld65 lists by name and value",
+			text: "Exports list by name:\n---------------------\nmain                      000280 RLA    \n\n" +
+				"Exports list by value:\n----------------------\nmain                      000280 RLA    \n",
+			n:     2,
+			names: map[string]uint16{"main": 0x0280},
+		},
+		{
+			name: "nothing outside the exports",
+			text: "Segment list:\n-------------\nName   Start   End    Size  Align\nCODE   000280  00028F 000010 00001\n",
+		},
+	}
+	for _, tt := range tests {
+		s := newSymbols()
+		n, err := s.load(strings.NewReader(tt.text))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if n != tt.n {
+			t.Errorf("%s: loaded %d symbols, want %d", tt.name, n, tt.n)
+		}
+		for name, want := range tt.names {
+			if addr, ok := s.resolve(name); !ok || addr != want {
+				t.Errorf("%s: %s resolved to $%04X, %t, want $%04X", tt.name, name, addr, ok, want)
+			}
+		}
+	}
+
+	// A later label for an address is the one shown
+	s := newSymbols()
+	if _, err := s.load(strings.NewReader("al C:ff00 .reset_again\n")); err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := s.lookup(0xFF00); name != "reset_again" {
+		t.Errorf("$FF00 shown as %s, want reset_again", name)
+	}
+}
+
+func TestLoadSymbolsMalformed(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"al C:0280", `line 1: malformed label "al C:0280"`},
+		{"al C:0280 .start extra", `line 1: malformed label "al C:0280 .start extra"`},
+		{"\nal C:XYZ .start", `line 2: bad address "XYZ"`},
+		{"al C:10000 .start", `line 1: bad address "10000"`},
+		{"Exports list by name:\n---\nmain 000280", `line 3: malformed export "main 000280"`},
+		{"Exports list by name:\n---\nmain 00QQ80 RLA", `line 3: bad address "00QQ80"`},
+	}
+	for _, tt := range tests {
+		_, err := newSymbols().load(strings.NewReader(tt.text))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got error %v, want %s", tt.text, err, tt.want)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	vm := newFlatVM()
+	vm.symbols.add(".loop", 0x0300)
+	vm.symbols.add("ptr", 0x0010)
+	tests := []struct {
+		code []byte
+		want string
+		size uint16
+	}{
+		{[]byte{0xEA}, "NOP", 1},
+		{[]byte{0x0A}, "ASL A", 1},
+		{[]byte{0xA9, 0x8D}, "LDA #$8D", 2},
+		{[]byte{0x20, 0xEF, 0xFF}, "JSR ECHO", 3},
+		{[]byte{0x8D, 0x12, 0xD0}, "STA DSP", 3},
+		{[]byte{0xAD, 0x34, 0x12}, "LDA $1234", 3},
+		{[]byte{0xBD, 0x00, 0x03}, "LDA loop,X", 3},
+		{[]byte{0xB9, 0x01, 0x03}, "LDA $0301,Y", 3},
+		{[]byte{0x6C, 0x10, 0x00}, "JMP (ptr)", 3},
+		{[]byte{0xA5, 0x10}, "LDA ptr", 2},
+		{[]byte{0xB5, 0x11}, "LDA $11,X", 2},
+		{[]byte{0xB6, 0x10}, "LDX ptr,Y", 2},
+		{[]byte{0xA1, 0x10}, "LDA (ptr,X)", 2},
+		{[]byte{0xB1, 0x20}, "LDA ($20),Y", 2},
+		{[]byte{0xD0, 0xFE}, "BNE $0200", 2}, // branch to itself at $0200
+		{[]byte{0xFF}, ".byte $FF", 1},
+	}
+	for _, tt := range tests {
+		vm.mem.load(0x0200, tt.code)
+		got, next := vm.Disassemble(0x0200)
+		if got != tt.want || next != 0x0200+tt.size {
+			t.Errorf("% X: got %q next $%04X, want %q next $%04X", tt.code, got, next, tt.want, 0x0200+tt.size)
+		}
+	}
+
+	// Branches resolve to the label of their target
+	vm.mem.load(0x0302, []byte{0xD0, 0xFC})
+	if got, _ := vm.Disassemble(0x0302); got != "BNE loop" {
+		t.Errorf("got %q, want BNE loop", got)
+	}
+}
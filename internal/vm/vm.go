@@ -1,62 +1,362 @@
 package vm
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"time"
 )
 
-const clockSpeed = 1 // 1 MHz
+// DefaultClockSpeed is the Apple 1's clock speed in Hz (1 MHz)
+const DefaultClockSpeed = 1000000
+
+// runSlice is how much emulated time Run executes between checking for cancellation and
+// pacing itself against the wall clock
+const runSlice = 10 * time.Millisecond
+
+// unthrottledSliceCycles is how many cycles Run executes between checks for cancellation when
+// the clock speed is unlimited
+const unthrottledSliceCycles = 100000
 
 // VM represents the Apple 1 virutal machine
 type VM struct {
-	cpu       *Mos6502      // virtual mos6502 cpu
-	mem       block         // available memory (64kiB)
-	clock     *time.Ticker  // the "cpu" clock
-	ShutdownC chan struct{} //
+	cpu         *Mos6502           // virtual mos6502 cpu
+	variant     Variant            // which member of the 6502 family is emulated
+	ops         map[byte]operation // opcodes decoded by the variant
+	mem         block              // available memory (64kiB)
+	pages       [256]page          // what responds to accesses in each page of mem
+	dataBus     byte               // last value on the data bus, what unmapped reads return
+	pia         *pia               // keyboard and display interface
+	cards       []Card             // cards in the expansion slot
+	exiters     []Exiter           // cards that can ask to exit
+	display     io.Writer          // receives characters written to the display
+	screen      *screen            // what the display currently shows
+	clockSpeed  int                // emulated clock speed in Hz, 0 for unthrottled
+	cycles      uint64             // cycles executed since the vm was created
+	extraCycles byte               // cycles the current instruction takes beyond its base count
+	breakpoints []breakpoint       // conditions that halt the vm once they hold
+	symbols     *symbols           // labels shown in traces, disassembly and fault reports
+	trace       io.Writer          // destination for instruction traces, nil when disabled
+	cycleLimit  uint64             // cycle count Run stops at, 0 for no limit
+	calls       []Frame            // subroutine calls in progress, outermost first
+	callGen     uint64             // incremented whenever calls changes
+	profile     *profiler          // cycle counts per call stack, nil when not profiling
+	coverage    *coverage          // code/data log, nil when not logging
+	watchpoints []watchpoint       // memory ranges that halt the vm when accessed
+	watchHit    *Halt              // the watchpoint the current instruction hit, if any
+	instr       uint16             // address of the instruction executing
+	instrSize   uint16             // its length, so fetching its operand isn't a data access
 }
 
-// New returns a pointer to an initialized VM with a brand spankin new CPU
+// ErrCycleLimit is returned by Run when the vm reaches the limit set with SetCycleLimit
+var ErrCycleLimit = errors.New("cycle limit reached")
+
+// New returns a pointer to an initialized Apple 1 with a brand spankin new CPU, RAM across the
+// address space, the Woz Monitor ROM at $FF00 and the keyboard and display PIA at $D010
 func New() *VM {
-	return &VM{
-		cpu:   newCPU(),
-		mem:   newBlock(),
-		clock: time.NewTicker(time.Second / time.Duration(clockSpeed)),
+	vm := &VM{
+		cpu:        newCPU(),
+		ops:        opcodes,
+		mem:        newBlock(),
+		clockSpeed: DefaultClockSpeed,
+		symbols:    newSymbols(),
+		screen:     newScreen(),
+	}
+	vm.pia = newPIA(vm.displayChar)
+	vm.SetMemoryMap(defaultMemoryMap())
+	return vm
+}
+
+// SetDisplay sends every character written to the display to w as 7-bit ASCII, with a
+// carriage return ending each line
+func (vm *VM) SetDisplay(w io.Writer) {
+	vm.display = w
+}
+
+func (vm *VM) displayChar(c byte) {
+	vm.screen.put(c)
+	if vm.display != nil {
+		vm.display.Write([]byte{c})
+	}
+}
+
+// SetClockSpeed sets how many cycles per second Run emulates, 0 runs as fast as possible
+func (vm *VM) SetClockSpeed(hz int) {
+	vm.clockSpeed = hz
+}
+
+// SetCycleLimit makes Run and RunCycles stop with ErrCycleLimit once the vm has executed n
+// cycles in total, 0 removes the limit
+func (vm *VM) SetCycleLimit(n uint64) {
+	vm.cycleLimit = n
+}
+
+// Fault describes an error raised while executing the instruction at PC
+type Fault struct {
+	PC     uint16 // address of the faulting instruction
+	Opcode byte   // opcode found at PC
+	Symbol string // closest label at or below PC, if any
+	Err    error  // underlying error
+}
+
+func (f *Fault) Error() string {
+	if f.Symbol != "" {
+		return fmt.Sprintf("fault at $%04X (%s) opcode $%02X: %v", f.PC, f.Symbol, f.Opcode, f.Err)
+	}
+	return fmt.Sprintf("fault at $%04X opcode $%02X: %v", f.PC, f.Opcode, f.Err)
+}
+
+// Halt is returned by Run when a breakpoint's condition holds or a watchpoint is hit
+type Halt struct {
+	Breakpoint string // condition of the breakpoint, or description of the watchpoint, hit
+	Watch      bool   // whether a watchpoint was hit
+	Addr       uint16 // address whose access hit the watchpoint
+	Store      bool   // whether that access was a write
+}
+
+func (h *Halt) Error() string {
+	if h.Watch {
+		return fmt.Sprintf("watchpoint hit: %s", h.Breakpoint)
 	}
+	return fmt.Sprintf("breakpoint hit: %s", h.Breakpoint)
+}
+
+// Exit is returned by Run when a card asks for the emulator to exit, such as a program writing
+// to a debug port's exit register
+type Exit struct {
+	Code int // exit code for the process
 }
 
-// Run starts the vm and emulates a clock that runs by default at 60MHz
-// This can be changed with a flag.
-func (vm *VM) Run() {
+func (e *Exit) Error() string {
+	return fmt.Sprintf("program exited with code %d", e.Code)
+}
+
+// Run executes instructions at the vm's clock speed until ctx is done, returning ctx.Err(),
+// a breakpoint or watchpoint halts the vm, returning a *Halt, an instruction faults, returning a *Fault,
+// a card asks to exit, returning an *Exit, or the cycle limit is reached, returning ErrCycleLimit.
+// The vm is left as it was after the last instruction so it can be inspected or resumed.
+func (vm *VM) Run(ctx context.Context) error {
+	start := time.Now()
+	startCycles := vm.cycles
+
 	for {
 		select {
-		case <-vm.clock.C:
-			vm.emulateCycle()
-			continue
-		case <-vm.ShutdownC:
-			break
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		// A clock too slow to fill a slice still runs an instruction each time round, with
+		// the wait below keeping it to time
+		slice := uint64(unthrottledSliceCycles)
+		if vm.clockSpeed > 0 {
+			slice = uint64(vm.clockSpeed) * uint64(runSlice) / uint64(time.Second)
+			if slice == 0 {
+				slice = 1
+			}
+		}
+		for end := vm.cycles + slice; vm.cycles < end; {
+			if vm.cycleLimit > 0 && vm.cycles >= vm.cycleLimit {
+				return ErrCycleLimit
+			}
+			if err := vm.execute(); err != nil {
+				return err
+			}
+		}
+
+		if vm.clockSpeed > 0 {
+			elapsed := time.Duration(float64(vm.cycles-startCycles) / float64(vm.clockSpeed) * float64(time.Second))
+			if ahead := elapsed - time.Since(start); ahead > 0 {
+				timer := time.NewTimer(ahead)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
 		}
-		break
 	}
-	vm.sigTerm("gracefully shutting down...")
 }
 
-func (vm *VM) emulateCycle() {
-	operation, err := operationByCode(vm.mem[vm.cpu.pc])
+// execute executes the instruction at pc like emulateCycle, then returns a *Halt if it hit a
+// watchpoint or made a breakpoint's condition true
+func (vm *VM) execute() error {
+	if err := vm.emulateCycle(); err != nil {
+		return err
+	}
+	if vm.watchHit != nil {
+		return vm.watchHit
+	}
+	if bp := vm.breakpointHit(); bp != nil {
+		return &Halt{Breakpoint: bp.cond}
+	}
+	return nil
+}
+
+// emulateCycle executes the instruction at pc, returning a *Fault if it can't be executed or
+// an *Exit if a card asks to exit
+func (vm *VM) emulateCycle() error {
+	pc := vm.cpu.pc
+	vm.extraCycles = 0
+	vm.watchHit = nil
+	operation, err := vm.operation(vm.busRead(pc))
 	if err != nil {
-		fmt.Println("TODO")
+		return vm.fault(pc, err)
+	}
+
+	if vm.trace != nil {
+		vm.traceInstruction(pc)
+	}
+
+	vm.instr, vm.instrSize = pc, uint16(operation.size)
+	if vm.coverage != nil {
+		vm.coverage.execute(pc, operation.size)
 	}
 
 	vm.cpu.pc += uint16(operation.size)
 
 	if err := operation.exec(vm, operation); err != nil {
-		fmt.Println("TODO")
+		return vm.fault(pc, err)
+	}
+
+	cycles := operation.cycles + vm.extraCycles
+	vm.cycles += uint64(cycles)
+	if vm.profile != nil {
+		vm.profile.record(vm, pc, cycles)
 	}
+	vm.trackCalls(pc, operation.opcode)
+	if vm.cards != nil {
+		return vm.tickCards(int(cycles))
+	}
+	return nil
 }
 
-func (vm *VM) sigTerm(msg string) {
-	fmt.Println(msg)
-	vm.ShutdownC <- struct{}{}
+// Step executes a single instruction and returns how many cycles it took
+func (vm *VM) Step() (int, error) {
+	before := vm.cycles
+	err := vm.emulateCycle()
+	return int(vm.cycles - before), err
+}
+
+// RunCycles executes instructions until at least n cycles have passed, and returns how many
+// cycles actually ran. Like Run, it stops early with a *Fault, *Halt, *Exit or ErrCycleLimit.
+// The last instruction may overshoot n.
+func (vm *VM) RunCycles(n int) (int, error) {
+	start := vm.cycles
+	for vm.cycles-start < uint64(n) {
+		if vm.cycleLimit > 0 && vm.cycles >= vm.cycleLimit {
+			return int(vm.cycles - start), ErrCycleLimit
+		}
+		if err := vm.execute(); err != nil {
+			return int(vm.cycles - start), err
+		}
+	}
+	return int(vm.cycles - start), nil
+}
+
+// Cycles returns how many cycles have been executed since the vm was created
+func (vm *VM) Cycles() uint64 {
+	return vm.cycles
+}
+
+// Registers returns a snapshot of the cpu's registers
+func (vm *VM) Registers() Registers {
+	return Registers{
+		A:  vm.cpu.a,
+		X:  vm.cpu.x,
+		Y:  vm.cpu.y,
+		SP: vm.cpu.sp,
+		PC: vm.cpu.pc,
+		P:  vm.cpu.ps,
+	}
+}
+
+// SetRegisters replaces the cpu's registers. The unused and break bits of P always read set.
+func (vm *VM) SetRegisters(r Registers) {
+	vm.cpu.a = r.A
+	vm.cpu.x = r.X
+	vm.cpu.y = r.Y
+	vm.cpu.sp = r.SP
+	vm.cpu.pc = r.PC
+	vm.cpu.ps = r.P | flagDefault
+}
+
+// Reset performs the 6502 reset sequence, disabling interrupts and jumping through the reset
+// vector at $FFFC, and resets the cards in the expansion slot
+func (vm *VM) Reset() {
+	vm.cpu.sp -= 3
+	vm.setFlag(flagDisableInterrupts)
+	if vm.variant == CMOS65C02 {
+		vm.clearFlag(flagDecimalMode)
+	}
+	vm.cpu.pc = uint16(vm.read(0xFFFD))<<8 | uint16(vm.read(0xFFFC))
+	vm.cycles += 7
+	for _, c := range vm.cards {
+		c.Reset()
+	}
+}
+
+// SetVariant selects the member of the 6502 family the vm emulates
+func (vm *VM) SetVariant(v Variant) error {
+	switch v {
+	case NMOS6502:
+		vm.ops = opcodes
+	case CMOS65C02:
+		vm.ops = cmosOpcodes
+	default:
+		return fmt.Errorf("unsupported cpu variant %v", v)
+	}
+	vm.variant = v
+	return nil
+}
+
+func (vm *VM) fault(pc uint16, err error) *Fault {
+	return &Fault{PC: pc, Opcode: vm.peek(pc), Symbol: vm.symbols.describe(pc), Err: err}
+}
+
+// DumpState returns a human readable snapshot of the registers, flags, cycle count, the next
+// instruction, zero page and stack page
+func (vm *VM) DumpState() string {
+	var b strings.Builder
+
+	flags := []byte("NV-BDIZC")
+	for i := range flags {
+		if vm.cpu.ps&(0x80>>uint(i)) == 0 {
+			flags[i] = '.'
+		}
+	}
+	fmt.Fprintf(
+		&b,
+		"PC=$%04X A=$%02X X=$%02X Y=$%02X SP=$%02X P=$%02X [%s] cycles=%d\n",
+		vm.cpu.pc, vm.cpu.a, vm.cpu.x, vm.cpu.y, vm.cpu.sp, vm.cpu.ps, flags, vm.cycles,
+	)
+	text, _ := vm.Disassemble(vm.cpu.pc)
+	if sym := vm.symbols.describe(vm.cpu.pc); sym != "" {
+		fmt.Fprintf(&b, "next: %s  (%s)\n", text, sym)
+	} else {
+		fmt.Fprintf(&b, "next: %s\n", text)
+	}
+
+	b.WriteString("zero page:\n")
+	vm.hexDump(&b, 0x0000, 0x100)
+	b.WriteString("stack:\n")
+	vm.hexDump(&b, StackBottom, 0x100)
+
+	return b.String()
+}
+
+// hexDump writes n bytes of memory starting at addr, 16 bytes per line
+func (vm *VM) hexDump(b *strings.Builder, addr uint16, n int) {
+	for i := 0; i < n; i += 16 {
+		fmt.Fprintf(b, "%04X:", int(addr)+i)
+		for j := 0; j < 16 && i+j < n; j++ {
+			fmt.Fprintf(b, " %02X", vm.peek(addr+uint16(i+j)))
+		}
+		b.WriteString("\n")
+	}
 }
 
 // load puts the provided data into the apple1's memory block starting at the provided address
@@ -75,20 +375,18 @@ func (vm *VM) getAddr(o operation) (uint16, error) {
 	case absolute:
 		return vm.nextDWord(), nil
 	case absoluteXIndexed:
-		return vm.nextDWord() + uint16(vm.cpu.x), nil
+		return vm.indexed(o, vm.nextDWord(), vm.cpu.x), nil
 	case absoluteYIndexed:
-		return vm.nextDWord() + uint16(vm.cpu.y), nil
+		return vm.indexed(o, vm.nextDWord(), vm.cpu.y), nil
 	case immediate:
 		return vm.cpu.pc - 1, nil
 	case indirect:
-		return uint16(vm.nextWord()), nil
+		return vm.nextDWord(), nil
 	case indirectXIndexed:
 		addr := (uint16(vm.nextWord()) + uint16(vm.cpu.x)) & 0xFF
-		return vm.littleEndianToUint16(vm.mem[addr+1], vm.mem[addr]), nil
+		return vm.zeroPageWord(addr), nil
 	case indirectYIndexed:
-		addr := uint16(vm.nextWord())
-		val := vm.littleEndianToUint16(vm.mem[addr+1], vm.mem[addr])
-		return val + uint16(vm.cpu.y), nil
+		return vm.indexed(o, vm.zeroPageWord(uint16(vm.nextWord())), vm.cpu.y), nil
 	case relative:
 		return vm.cpu.pc - 1, nil
 	case zeroPage:
@@ -97,11 +395,26 @@ func (vm *VM) getAddr(o operation) (uint16, error) {
 		return (uint16(vm.nextWord()) + uint16(vm.cpu.x)) & 0xFF, nil
 	case zeroPageYIndexed:
 		return (uint16(vm.nextWord()) + uint16(vm.cpu.y)) & 0xFF, nil
+	case zeroPageIndirect:
+		return vm.zeroPageWord(uint16(vm.nextWord())), nil
+	case absoluteXIndexedIndirect:
+		return vm.nextDWord() + uint16(vm.cpu.x), nil
 	default:
 		return 0, errors.New("unkown addressing mode")
 	}
 }
 
+// indexed returns base + index, charging the extra cycle read operations take when the
+// index carries into the next page
+func (vm *VM) indexed(o operation, base uint16, index byte) uint16 {
+	addr := base + uint16(index)
+	penalty := pageCrossPenalty[o.name] || vm.variant == CMOS65C02 && cmosPageCrossPenalty[o.name]
+	if addr&0xFF00 != base&0xFF00 && penalty {
+		vm.extraCycles = 1
+	}
+	return addr
+}
+
 func (vm *VM) getOperand(o operation) (byte, error) {
 	if o.addrMode == accumulator {
 		return vm.cpu.a, nil
@@ -110,16 +423,16 @@ func (vm *VM) getOperand(o operation) (byte, error) {
 	if err != nil {
 		return 0, err
 	}
-	return vm.mem[b], nil
+	return vm.read(b), nil
 }
 
 func (vm *VM) littleEndianToUint16(big, little byte) uint16 {
-	return uint16(vm.mem[big])<<8 | uint16(vm.mem[little])
+	return uint16(big)<<8 | uint16(little)
 }
 
 // pushWordToStack pushes the given word (byte) into memory and sets the new stack pointer
 func (vm *VM) pushWordToStack(b byte) {
-	vm.mem[StackBottom+uint16(vm.cpu.sp)] = b
+	vm.write(StackBottom+uint16(vm.cpu.sp), b)
 	vm.cpu.sp = byte((uint16(vm.cpu.sp) - 1) & 0xFF)
 }
 
@@ -134,7 +447,7 @@ func (vm *VM) pushDWordToStack(data uint16) {
 // popStackWord sets the new stack pointer and returns the appropriate byte in memory
 func (vm *VM) popStackWord() byte {
 	vm.cpu.sp = byte((uint16(vm.cpu.sp) + 1) & 0xFF)
-	return vm.mem[StackBottom+uint16(vm.cpu.sp)]
+	return vm.read(StackBottom + uint16(vm.cpu.sp))
 }
 
 // popStackDWord pops two stack words (a double word - uint16) off the stack
@@ -146,12 +459,20 @@ func (vm *VM) popStackDWord() uint16 {
 
 // nextWord returns the next byte in memory
 func (vm *VM) nextWord() byte {
-	return vm.mem[vm.cpu.pc-1]
+	return vm.read(vm.cpu.pc - 1)
 }
 
-// nextDWord returns the next two bytes (double word)
+// nextDWord returns the next two bytes (double word), reading the low byte first like the cpu
+// so the high byte is left on the data bus
 func (vm *VM) nextDWord() uint16 {
-	return vm.littleEndianToUint16(vm.mem[vm.cpu.pc-1], vm.mem[vm.cpu.pc-2])
+	little := vm.read(vm.cpu.pc - 2)
+	return vm.littleEndianToUint16(vm.read(vm.cpu.pc-1), little)
+}
+
+// zeroPageWord returns the pointer stored at addr in the zero page, wrapping within it
+func (vm *VM) zeroPageWord(addr uint16) uint16 {
+	little := vm.read(addr)
+	return vm.littleEndianToUint16(vm.read((addr+1)&0xFF), little)
 }
 
 // maybeSetFlagZero takes a single word (byte), clears flagZero, and sets flagZero if word is 0
@@ -174,7 +495,8 @@ func (vm *VM) clearFlag(flag byte) {
 	vm.cpu.ps &^= flag
 }
 
-func (vm *VM) maybeSetFlagOverflow(word byte) {
+// maybeSetFlagNegative takes a single word (byte), clears flagNegative, and sets flagNegative if bit 7 is set
+func (vm *VM) maybeSetFlagNegative(word byte) {
 	vm.clearFlag(flagNegative)
 	if word > 127 {
 		vm.setFlag(flagNegative)
@@ -188,11 +510,18 @@ func (vm *VM) branch(o operation) error {
 	if err != nil {
 		return err
 	}
+	from := vm.cpu.pc
 	if offset > 127 {
 		vm.cpu.pc -= 256 - uint16(offset)
 	} else {
 		vm.cpu.pc += uint16(offset)
 	}
+
+	// A taken branch costs one cycle, and one more if it lands on another page
+	vm.extraCycles = 1
+	if from&0xFF00 != vm.cpu.pc&0xFF00 {
+		vm.extraCycles = 2
+	}
 	return nil
 }
 
@@ -212,7 +541,7 @@ func (vm *VM) compare(b1, b2 byte) {
 	}
 
 	b := byte(uint16(b1) - uint16(b2))
-	vm.maybeSetFlagOverflow(b)
+	vm.maybeSetFlagNegative(b)
 }
 
 func (vm *VM) setMem(o operation, operand byte) error {
@@ -220,7 +549,7 @@ func (vm *VM) setMem(o operation, operand byte) error {
 	if err != nil {
 		return err
 	}
-	vm.mem[addr] = operand
+	vm.write(addr, operand)
 	return nil
 }
 
@@ -0,0 +1,48 @@
+package vm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunSlowClock(t *testing.T) {
+	vm := newFlatVM()
+	vm.load(0x0200, []byte{0xEA, 0x4C, 0x00, 0x02}) // NOP; JMP $0200
+	vm.cpu.pc = 0x0200
+	vm.SetClockSpeed(50)
+
+	// A 10ms slice at 50Hz is less than a cycle, which mustn't stop anything running
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := vm.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Run returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	if vm.cycles == 0 || vm.cycles > 20 {
+		t.Errorf("ran %d cycles in 200ms at 50Hz, want about 10", vm.cycles)
+	}
+}
+
+func TestCycleLimit(t *testing.T) {
+	vm := newFlatVM()
+	vm.load(0x0200, []byte{0xEA, 0x4C, 0x00, 0x02})
+	vm.cpu.pc = 0x0200
+	vm.SetClockSpeed(0)
+	vm.SetCycleLimit(10)
+
+	// NOP and JMP take 2 and 3 cycles, so both stop after the instruction reaching 10
+	if err := vm.Run(context.Background()); err != ErrCycleLimit {
+		t.Fatalf("Run returned %v, want %v", err, ErrCycleLimit)
+	}
+	if vm.cycles != 10 {
+		t.Errorf("Run stopped after %d cycles, want 10", vm.cycles)
+	}
+
+	// Both refuse to go on from the limit
+	if err := vm.Run(context.Background()); err != ErrCycleLimit || vm.cycles != 10 {
+		t.Errorf("Run at the limit returned %v after %d cycles, want %v at 10", err, vm.cycles, ErrCycleLimit)
+	}
+	if n, err := vm.RunCycles(5); err != ErrCycleLimit || n != 0 {
+		t.Errorf("RunCycles at the limit ran %d cycles, %v, want 0 and %v", n, err, ErrCycleLimit)
+	}
+}
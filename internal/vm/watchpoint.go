@@ -0,0 +1,64 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// watchpoint halts the vm after an instruction reads or writes memory within its range
+type watchpoint struct {
+	start, end  uint16
+	load, store bool
+	desc        string
+}
+
+// AddWatchpoint halts the vm after an instruction loads from, when load is set, or stores to,
+// when store is set, any address from start to end inclusive. Fetching instructions doesn't
+// count as a load.
+func (vm *VM) AddWatchpoint(start, end uint16, load, store bool) error {
+	if end < start {
+		return fmt.Errorf("watchpoint range $%04X-$%04X is empty", start, end)
+	}
+	if !load && !store {
+		return errors.New("watchpoint must watch loads, stores or both")
+	}
+
+	kind := "load/store"
+	if !store {
+		kind = "load"
+	} else if !load {
+		kind = "store"
+	}
+	desc := fmt.Sprintf("%s $%04X", kind, start)
+	if end != start {
+		desc = fmt.Sprintf("%s $%04X-$%04X", kind, start, end)
+	}
+	vm.watchpoints = append(vm.watchpoints, watchpoint{start: start, end: end, load: load, store: store, desc: desc})
+	return nil
+}
+
+// ClearWatchpoints removes every watchpoint from the vm
+func (vm *VM) ClearWatchpoints() {
+	vm.watchpoints = nil
+}
+
+// RemoveWatchpoint removes one watchpoint added with exactly these arguments, leaving any
+// others watching the same range
+func (vm *VM) RemoveWatchpoint(start, end uint16, load, store bool) {
+	for i, w := range vm.watchpoints {
+		if w.start == start && w.end == end && w.load == load && w.store == store {
+			vm.watchpoints = append(vm.watchpoints[:i], vm.watchpoints[i+1:]...)
+			return
+		}
+	}
+}
+
+// watchpointHit returns a Halt for the first watchpoint covering an access to addr, or nil
+func (vm *VM) watchpointHit(addr uint16, store bool) *Halt {
+	for _, w := range vm.watchpoints {
+		if addr >= w.start && addr <= w.end && (store && w.store || !store && w.load) {
+			return &Halt{Breakpoint: w.desc, Watch: true, Addr: addr, Store: store}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package vm
+
+// wozMonitorAddr is where the Woz Monitor ROM is mapped
+const wozMonitorAddr uint16 = 0xFF00
+
+// wozMonitor is Steve Wozniak's 256 byte monitor ROM. It initializes the PIA, then reads lines
+// from the keyboard to examine memory (`FF00.FF0F`), deposit bytes (`0280: A9 00`) and run
+// programs (`0280R`). The last six bytes are the NMI, RESET and IRQ vectors.
+var wozMonitor = [256]byte{
+	// FF00 RESET
+	0xD8, 0x58, 0xA0, 0x7F, 0x8C, 0x12, 0xD0, 0xA9, 0xA7, 0x8D, 0x11, 0xD0, 0x8D, 0x13, 0xD0,
+	// FF0F NOTCR
+	0xC9, 0xDF, 0xF0, 0x13, 0xC9, 0x9B, 0xF0, 0x03, 0xC8, 0x10, 0x0F,
+	// FF1A ESCAPE
+	0xA9, 0xDC, 0x20, 0xEF, 0xFF,
+	// FF1F GETLINE
+	0xA9, 0x8D, 0x20, 0xEF, 0xFF, 0xA0, 0x01,
+	// FF26 BACKSPACE
+	0x88, 0x30, 0xF6,
+	// FF29 NEXTCHAR
+	0xAD, 0x11, 0xD0, 0x10, 0xFB, 0xAD, 0x10, 0xD0, 0x99, 0x00, 0x02, 0x20, 0xEF, 0xFF, 0xC9, 0x8D,
+	0xD0, 0xD4, 0xA0, 0xFF, 0xA9, 0x00, 0xAA,
+	// FF40 SETSTOR, FF41 SETMODE, FF43 BLSKIP
+	0x0A, 0x85, 0x2B, 0xC8,
+	// FF44 NEXTITEM
+	0xB9, 0x00, 0x02, 0xC9, 0x8D, 0xF0, 0xD4, 0xC9, 0xAE, 0x90, 0xF4, 0xF0, 0xF0, 0xC9, 0xBA, 0xF0,
+	0xEB, 0xC9, 0xD2, 0xF0, 0x3B, 0x86, 0x28, 0x86, 0x29, 0x84, 0x2A,
+	// FF5F NEXTHEX
+	0xB9, 0x00, 0x02, 0x49, 0xB0, 0xC9, 0x0A, 0x90, 0x06, 0x69, 0x88, 0xC9, 0xFA, 0x90, 0x11,
+	// FF6E DIG
+	0x0A, 0x0A, 0x0A, 0x0A, 0xA2, 0x04,
+	// FF74 HEXSHIFT
+	0x0A, 0x26, 0x28, 0x26, 0x29, 0xCA, 0xD0, 0xF8, 0xC8, 0xD0, 0xE0,
+	// FF7F NOTHEX
+	0xC4, 0x2A, 0xF0, 0x97, 0x24, 0x2B, 0x50, 0x10, 0xA5, 0x28, 0x81, 0x26, 0xE6, 0x26, 0xD0, 0xB5,
+	0xE6, 0x27,
+	// FF91 TONEXTITEM, FF94 RUN
+	0x4C, 0x44, 0xFF, 0x6C, 0x24, 0x00,
+	// FF97 NOTSTOR
+	0x30, 0x2B, 0xA2, 0x02,
+	// FF9B SETADR
+	0xB5, 0x27, 0x95, 0x25, 0x95, 0x23, 0xCA, 0xD0, 0xF7,
+	// FFA4 NXTPRNT
+	0xD0, 0x14, 0xA9, 0x8D, 0x20, 0xEF, 0xFF, 0xA5, 0x25, 0x20, 0xDC, 0xFF, 0xA5, 0x24, 0x20, 0xDC,
+	0xFF, 0xA9, 0xBA, 0x20, 0xEF, 0xFF,
+	// FFBA PRDATA
+	0xA9, 0xA0, 0x20, 0xEF, 0xFF, 0xA1, 0x24, 0x20, 0xDC, 0xFF,
+	// FFC4 XAMNEXT
+	0x86, 0x2B, 0xA5, 0x24, 0xC5, 0x28, 0xA5, 0x25, 0xE5, 0x29, 0xB0, 0xC1, 0xE6, 0x24, 0xD0, 0x02,
+	0xE6, 0x25,
+	// FFD6 MOD8CHK
+	0xA5, 0x24, 0x29, 0x07, 0x10, 0xC8,
+	// FFDC PRBYTE
+	0x48, 0x4A, 0x4A, 0x4A, 0x4A, 0x20, 0xE5, 0xFF, 0x68,
+	// FFE5 PRHEX
+	0x29, 0x0F, 0x09, 0xB0, 0xC9, 0xBA, 0x90, 0x02, 0x69, 0x06,
+	// FFEF ECHO
+	0x2C, 0x12, 0xD0, 0x30, 0xFB, 0x8D, 0x12, 0xD0, 0x60,
+	// FFF8 unused, FFFA NMI, FFFC RESET, FFFE IRQ
+	0x00, 0x00, 0x00, 0x0F, 0x00, 0xFF, 0x00, 0x00,
+}
@@ -0,0 +1,139 @@
+package web
+
+// page is the single page the server serves. It draws the screen frames received over the
+// WebSocket and sends it every key typed while it has focus.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Apple 1</title>
+<style>
+  body {
+    margin: 0;
+    background: #111;
+    color: #ccc;
+    font-family: sans-serif;
+    display: flex;
+    flex-direction: column;
+    align-items: center;
+  }
+  #screen {
+    margin: 24px 0 12px;
+    padding: 16px 20px;
+    background: #020802;
+    border: 12px solid #2a2a2a;
+    border-radius: 16px;
+    color: #33ff66;
+    text-shadow: 0 0 4px #33ff66, 0 0 10px #1a8033;
+    font: 20px/1.15 "Courier New", monospace;
+    white-space: pre;
+    outline: none;
+  }
+  #screen:focus { border-color: #3a3a3a; }
+  .cursor { animation: blink 1s steps(1) infinite; }
+  @keyframes blink { 50% { visibility: hidden; } }
+  #controls { display: flex; gap: 8px; flex-wrap: wrap; align-items: center; }
+  button, label.button {
+    background: #333;
+    color: #eee;
+    border: 1px solid #555;
+    border-radius: 4px;
+    padding: 6px 12px;
+    font-size: 14px;
+    cursor: pointer;
+  }
+  input[type=file] { display: none; }
+  input[type=text] { width: 5em; background: #222; color: #eee; border: 1px solid #555; padding: 5px; }
+  #status { margin-top: 8px; color: #f66; min-height: 1.2em; }
+</style>
+</head>
+<body>
+<div id="screen" tabindex="0"></div>
+<div id="controls">
+  <button id="reset">RESET</button>
+  <button id="clear">CLEAR SCREEN</button>
+  <label>at <input id="addr" type="text" value="$0280"></label>
+  <label class="button">Load program<input id="program" type="file"></label>
+  <a href="/state"><button>Save state</button></a>
+  <label class="button">Load state<input id="state" type="file"></label>
+</div>
+<div id="status"></div>
+<script>
+const screen = document.getElementById("screen");
+const status = document.getElementById("status");
+let ws;
+
+function blank() {
+  const lines = [];
+  for (let i = 0; i < 24; i++) lines.push("");
+  return { lines: lines, row: 0, col: 0, status: "disconnected" };
+}
+
+function draw(f) {
+  screen.textContent = "";
+  f.lines.forEach((line, r) => {
+    line = line.padEnd(40);
+    if (r === f.row) {
+      screen.append(line.slice(0, f.col));
+      const cursor = document.createElement("span");
+      cursor.className = "cursor";
+      cursor.textContent = "@";
+      screen.append(cursor);
+      screen.append(line.slice(f.col + 1));
+    } else {
+      screen.append(line);
+    }
+    if (r < f.lines.length - 1) screen.append("\n");
+  });
+  status.textContent = f.status;
+}
+
+function connect() {
+  ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+  ws.onmessage = (e) => draw(JSON.parse(e.data));
+  ws.onclose = () => {
+    draw(blank());
+    setTimeout(connect, 1000);
+  };
+}
+
+screen.addEventListener("keydown", (e) => {
+  if (e.ctrlKey || e.metaKey || e.altKey) return;
+  let key = null;
+  if (e.key === "Enter") key = "\r";
+  else if (e.key === "Backspace") key = "\b";
+  else if (e.key === "Escape") key = "\x1b";
+  else if (e.key.length === 1) key = e.key;
+  if (key === null) return;
+  e.preventDefault();
+  if (ws && ws.readyState === WebSocket.OPEN) ws.send(key);
+});
+
+async function post(url, body) {
+  const res = await fetch(url, { method: "POST", body: body });
+  if (!res.ok) status.textContent = await res.text();
+  screen.focus();
+}
+
+document.getElementById("reset").onclick = () => post("/reset");
+document.getElementById("clear").onclick = () => post("/clear");
+document.getElementById("program").onchange = (e) => {
+  const body = new FormData();
+  body.append("program", e.target.files[0]);
+  body.append("addr", document.getElementById("addr").value);
+  e.target.value = "";
+  post("/load", body);
+};
+document.getElementById("state").onchange = (e) => {
+  const file = e.target.files[0];
+  e.target.value = "";
+  post("/state", file);
+};
+
+draw(blank());
+connect();
+screen.focus();
+</script>
+</body>
+</html>
+`
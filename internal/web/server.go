@@ -0,0 +1,381 @@
+// Package web serves the emulated Apple 1 to browsers: a single page showing the 40x24
+// display in green phosphor, with the keyboard forwarded over a WebSocket and buttons for the
+// RESET and CLEAR SCREEN switches, loading programs, and saving and restoring the machine.
+//
+// The machine runs on the goroutine calling Server.Run. Everything that changes it other
+// than key presses is queued for that goroutine and done between slices of emulation, and the
+// screen is pushed to every connected page whenever it changes.
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradford-hamilton/apple-1/internal/term"
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// frameInterval is how often the screen is checked for changes while the machine runs
+const frameInterval = 40 * time.Millisecond
+
+// maxUpload is the largest program or save state accepted
+const maxUpload = 1 << 20
+
+// queueLength is how many frames may wait for a page before it's disconnected as too slow
+const queueLength = 64
+
+// frame is the screen as sent to pages
+type frame struct {
+	Lines  []string `json:"lines"`
+	Row    int      `json:"row"`
+	Col    int      `json:"col"`
+	Status string   `json:"status"`
+}
+
+// Server runs a machine for browsers
+type Server struct {
+	machine *vm.VM
+	actions chan func()
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc // interrupts the machine while it runs
+	clients map[*client]bool   // pages watching the screen
+	last    []byte             // the frame most recently sent
+
+	// Owned by the goroutine calling Run
+	stopped bool   // whether the machine halted and is waiting for a reset or load
+	status  string // why it stopped
+}
+
+// New returns a server for machine
+func New(machine *vm.VM) *Server {
+	return &Server{
+		machine: machine,
+		actions: make(chan func(), 16),
+		clients: make(map[*client]bool),
+	}
+}
+
+// client is a page watching the screen. Frames are queued on out for a goroutine of its own,
+// so a page that stops reading never holds up the machine or the other pages.
+type client struct {
+	ws  *websocket
+	out chan []byte
+}
+
+// send queues msg for c, disconnecting it if its queue is full. s.mu must be held.
+func (c *client) send(msg []byte) {
+	select {
+	case c.out <- msg:
+	default:
+		log.Printf("websocket to %s is too slow, disconnecting", c.ws.conn.RemoteAddr())
+		c.ws.close()
+	}
+}
+
+// write sends queued frames until the queue is closed or a write fails
+func (c *client) write() {
+	for msg := range c.out {
+		if err := c.ws.writeText(msg); err != nil {
+			c.ws.close()
+			return
+		}
+	}
+}
+
+// Handler returns the page and the endpoints it uses:
+//
+//	GET  /        the page
+//	GET  /ws      WebSocket of screen frames out and typed keys in
+//	POST /reset   press RESET
+//	POST /clear   press CLEAR SCREEN
+//	POST /load    load the multipart file "program" at "addr" and jump to it
+//	GET  /state   download a save state
+//	POST /state   restore a save state sent as the body
+//
+// Requests from pages served by another origin are refused, so other sites can't type into,
+// reset or load programs into the machine from a visitor's browser.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handlePage)
+	mux.HandleFunc("/ws", s.handleWebSocket)
+	mux.HandleFunc("/reset", s.post(func(r *http.Request) error {
+		s.machine.Reset()
+		s.resume()
+		return nil
+	}))
+	mux.HandleFunc("/clear", s.post(func(r *http.Request) error {
+		s.machine.ClearScreen()
+		return nil
+	}))
+	mux.HandleFunc("/load", s.handleLoad)
+	mux.HandleFunc("/state", s.handleState)
+	return sameOrigin(mux)
+}
+
+// sameOrigin refuses requests whose Origin header names a different host from the one they
+// were sent to. Browsers send Origin with WebSocket handshakes and POSTs from scripts and
+// forms, while clients such as curl that send none are let through.
+func sameOrigin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !strings.EqualFold(u.Host, r.Host) {
+				http.Error(w, "cross-origin request refused", http.StatusForbidden)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Run runs the machine like vm.Run until ctx is done, returning ctx.Err(). When the machine
+// halts or faults it waits, showing why, until the page resets it or loads something else.
+func (s *Server) Run(ctx context.Context) error {
+	for {
+		if s.stopped {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case a := <-s.actions:
+				a()
+			}
+			s.publish()
+			continue
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, frameInterval)
+		s.mu.Lock()
+		s.cancel = cancel
+		s.mu.Unlock()
+		err := s.machine.Run(runCtx)
+		s.mu.Lock()
+		s.cancel = nil
+		s.mu.Unlock()
+		cancel()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != context.DeadlineExceeded && err != context.Canceled {
+			s.stopped = true
+			s.status = err.Error()
+			log.Printf("machine stopped: %v", err)
+		}
+		s.drain()
+		s.publish()
+	}
+}
+
+// drain does every queued action
+func (s *Server) drain() {
+	for {
+		select {
+		case a := <-s.actions:
+			a()
+		default:
+			return
+		}
+	}
+}
+
+// resume lets a stopped machine run again
+func (s *Server) resume() {
+	s.stopped = false
+	s.status = ""
+}
+
+// do has the goroutine calling Run execute f, and returns its error
+func (s *Server) do(ctx context.Context, f func() error) error {
+	done := make(chan error, 1)
+	a := func() { done <- f() }
+	select {
+	case s.actions <- a:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// post returns a handler that does f on the machine for POST requests
+func (s *Server) post(f func(r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := s.do(r.Context(), func() error { return f(r) }); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// publish sends the screen to every page if it changed since it was last sent
+func (s *Server) publish() {
+	f := frame{Lines: s.machine.ScreenLines(), Status: s.status}
+	f.Row, f.Col = s.machine.ScreenCursor()
+	msg, err := json.Marshal(f)
+	if err != nil {
+		log.Printf("encoding screen: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if bytes.Equal(msg, s.last) {
+		return
+	}
+	s.last = msg
+	for c := range s.clients {
+		c.send(msg)
+	}
+}
+
+func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, page)
+}
+
+// handleWebSocket sends the page screen frames and types the keys it sends
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrade(w, r)
+	if err != nil {
+		log.Printf("websocket from %s: %v", r.RemoteAddr, err)
+		return
+	}
+	defer ws.close()
+
+	c := &client{ws: ws, out: make(chan []byte, queueLength)}
+	go c.write()
+	s.mu.Lock()
+	s.clients[c] = true
+	if s.last != nil {
+		c.send(s.last)
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		close(c.out)
+		s.mu.Unlock()
+	}()
+
+	for {
+		msg, err := ws.read()
+		if err != nil {
+			return
+		}
+		for _, b := range msg {
+			if k, ok := term.Key(b); ok {
+				s.machine.KeyPress(k)
+			}
+		}
+	}
+}
+
+// handleLoad loads an uploaded program and jumps to it
+func (s *Server) handleLoad(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseMultipartForm(maxUpload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	addr, err := parseAddr(r.FormValue("addr"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, _, err := r.FormFile("program")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+	program, err := ioutil.ReadAll(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.post(func(r *http.Request) error {
+		s.machine.Load(addr, program)
+		regs := s.machine.Registers()
+		regs.PC = addr
+		s.machine.SetRegisters(regs)
+		s.resume()
+		return nil
+	})(w, r)
+}
+
+// handleState downloads or restores a save state
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var buf bytes.Buffer
+		if err := s.do(r.Context(), func() error { return s.machine.SaveState(&buf) }); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="apple1.state"`)
+		w.Write(buf.Bytes())
+	case http.MethodPost:
+		state, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxUpload))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.post(func(r *http.Request) error {
+			if err := s.machine.LoadState(bytes.NewReader(state)); err != nil {
+				return err
+			}
+			s.resume()
+			return nil
+		})(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// parseAddr parses a 16-bit hex address with an optional $ or 0x prefix, defaulting to $0280
+func parseAddr(s string) (uint16, error) {
+	if s == "" {
+		return 0x0280, nil
+	}
+	hex := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "$"), "0x")
+	addr, err := strconv.ParseUint(hex, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q, expected hex such as $0280", s)
+	}
+	return uint16(addr), nil
+}
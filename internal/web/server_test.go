@@ -0,0 +1,283 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// start serves a stock machine, returning the server and its URL
+func start(t *testing.T) (*Server, *httptest.Server) {
+	machine := vm.New()
+	machine.Reset()
+	s := New(machine)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Run(ctx)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+	})
+	return s, ts
+}
+
+// handshake opens a WebSocket to ts with the given Origin, returning the connection and the
+// response to the handshake
+func handshake(t *testing.T, ts *httptest.Server, origin string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	host := strings.TrimPrefix(ts.URL, "http://")
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req := "GET /ws HTTP/1.1\r\n" +
+		"Host: " + host + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"Origin: " + origin + "\r\n\r\n"
+	if _, err := io.WriteString(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, r, resp
+}
+
+// readFrame reads an unmasked text message from the server
+func readFrame(t *testing.T, r *bufio.Reader) []byte {
+	t.Helper()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatal(err)
+	}
+	if header[0] != 0x80|opText {
+		t.Fatalf("got frame header $%02X, want a final text frame", header[0])
+	}
+	n := uint64(header[1] & 0x7F)
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		io.ReadFull(r, ext)
+		n = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		io.ReadFull(r, ext)
+		n = binary.BigEndian.Uint64(ext)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// writeFrame sends a masked text message as a browser does
+func writeFrame(t *testing.T, w io.Writer, msg string) {
+	t.Helper()
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | opText, 0x80 | byte(len(msg))}, mask...)
+	for i := 0; i < len(msg); i++ {
+		frame = append(frame, msg[i]^mask[i%4])
+	}
+	if _, err := w.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	_, ts := start(t)
+	conn, r, resp := handshake(t, ts, ts.URL)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake got %s, want 101", resp.Status)
+	}
+	// The accept value for this key from RFC 6455
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept is %q", accept)
+	}
+
+	// Keys typed on the page reach the Woz Monitor, whose echo comes back in a frame
+	writeFrame(t, conn, "FF00.FF03\r")
+	for {
+		var f frame
+		if err := json.Unmarshal(readFrame(t, r), &f); err != nil {
+			t.Fatal(err)
+		}
+		if len(f.Lines) != 24 {
+			t.Fatalf("frame has %d lines, want 24", len(f.Lines))
+		}
+		if strings.Contains(strings.Join(f.Lines, "\n"), "FF00: D8 58 A0 7F") {
+			break
+		}
+	}
+}
+
+func TestSlowPage(t *testing.T) {
+	machine := vm.New()
+	machine.Reset()
+	s := New(machine)
+
+	// A page that never reads what it's sent
+	server, page := net.Pipe()
+	defer page.Close()
+	c := &client{ws: &websocket{conn: server, r: bufio.NewReader(server)}, out: make(chan []byte, queueLength)}
+	go c.write()
+	s.clients[c] = true
+
+	// Publishing mustn't wait for it, and it's disconnected once its queue is full
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < queueLength+2; i++ {
+			s.status = strconv.Itoa(i)
+			s.publish()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publishing blocked on a page that isn't reading")
+	}
+	page.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, err := page.Read(make([]byte, 4096)); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("the slow page wasn't disconnected: %v", err)
+		}
+	}
+}
+
+func TestWebSocketRefusesOtherOrigins(t *testing.T) {
+	_, ts := start(t)
+	_, _, resp := handshake(t, ts, "http://example.com")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("handshake from another origin got %s, want 403", resp.Status)
+	}
+}
+
+// program is JMP $0300, loaded at $0300
+var program = []byte{0x4C, 0x00, 0x03}
+
+// upload returns a multipart body for /load
+func upload(t *testing.T, addr string, program []byte) (string, *bytes.Buffer) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("addr", addr)
+	fw, err := mw.CreateFormFile("program", "prog.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(program)
+	mw.Close()
+	return mw.FormDataContentType(), &body
+}
+
+func TestPostEndpoints(t *testing.T) {
+	s, ts := start(t)
+
+	state, err := http.Get(ts.URL + "/state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := ioutil.ReadAll(state.Body)
+	state.Body.Close()
+	if state.StatusCode != http.StatusOK || len(saved) == 0 {
+		t.Fatalf("GET /state got %s and %d bytes", state.Status, len(saved))
+	}
+
+	loadType, loadBody := upload(t, "$0300", program)
+	badType, badBody := upload(t, "nowhere", program)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		contentType string
+		body        io.Reader
+		want        int
+	}{
+		{"reset", http.MethodPost, "/reset", ts.URL, "", nil, http.StatusNoContent},
+		{"reset without an origin", http.MethodPost, "/reset", "", "", nil, http.StatusNoContent},
+		{"reset from another origin", http.MethodPost, "/reset", "http://example.com", "", nil, http.StatusForbidden},
+		{"reset from an opaque origin", http.MethodPost, "/reset", "null", "", nil, http.StatusForbidden},
+		{"reset with GET", http.MethodGet, "/reset", ts.URL, "", nil, http.StatusMethodNotAllowed},
+		{"clear", http.MethodPost, "/clear", ts.URL, "", nil, http.StatusNoContent},
+		{"clear from another origin", http.MethodPost, "/clear", "http://example.com", "", nil, http.StatusForbidden},
+		{"load with a bad address", http.MethodPost, "/load", ts.URL, badType, badBody, http.StatusBadRequest},
+		{"load", http.MethodPost, "/load", ts.URL, loadType, loadBody, http.StatusNoContent},
+		{"load from another origin", http.MethodPost, "/load", "http://example.com", loadType, bytes.NewReader(nil), http.StatusForbidden},
+		{"restore garbage", http.MethodPost, "/state", ts.URL, "", strings.NewReader("garbage"), http.StatusBadRequest},
+		{"restore from another origin", http.MethodPost, "/state", "http://example.com", "", bytes.NewReader(saved), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, ts.URL+tt.path, tt.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: got %s, want %d", tt.name, resp.Status, tt.want)
+		}
+	}
+
+	// The program was loaded and jumped to, and nothing from another origin changed that
+	var pc uint16
+	var loaded byte
+	s.do(context.Background(), func() error {
+		pc, loaded = s.machine.Registers().PC, s.machine.Peek(0x0300)
+		return nil
+	})
+	if pc != 0x0300 || loaded != 0x4C {
+		t.Errorf("PC=$%04X and $0300 holds $%02X, want the program running at $0300", pc, loaded)
+	}
+
+	// Restoring the state saved at the start goes back to the Woz Monitor
+	resp, err := http.Post(ts.URL+"/state", "application/octet-stream", bytes.NewReader(saved))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("restoring the state got %s", resp.Status)
+	}
+	s.do(context.Background(), func() error {
+		pc = s.machine.Registers().PC
+		return nil
+	})
+	if pc < 0xFF00 {
+		t.Errorf("PC=$%04X after restoring, want it in the Woz Monitor", pc)
+	}
+}
@@ -0,0 +1,201 @@
+package web
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// writeTimeout is how long a write may take before the page is taken to be gone
+const writeTimeout = 2 * time.Second
+
+// websocketGUID is appended to the client's key to prove the server understood the handshake
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxMessageSize is the longest message accepted from a client, plenty for typed keys
+const maxMessageSize = 4096
+
+// WebSocket opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// websocket is the server end of a WebSocket connection (RFC 6455). Only what the page needs
+// is implemented: unfragmented text messages out, and text messages, pings and closes in.
+type websocket struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu sync.Mutex // serializes writes
+}
+
+// upgrade completes the WebSocket opening handshake for r and takes over its connection
+func upgrade(w http.ResponseWriter, r *http.Request) (*websocket, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("not a WebSocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported WebSocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "can't upgrade this connection", http.StatusInternalServerError)
+		return nil, errors.New("response can't be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &websocket{conn: conn, r: rw.Reader}, nil
+}
+
+// headerContains reports whether the comma separated header name lists token
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// read returns the next text or binary message, answering pings along the way. It returns
+// io.EOF once the client closes the connection.
+func (ws *websocket) read() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, op, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opClose:
+			ws.writeFrame(opClose, nil)
+			return nil, io.EOF
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		}
+		msg = append(msg, payload...)
+		if len(msg) > maxMessageSize {
+			return nil, errors.New("websocket message too long")
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// readFrame reads one frame, unmasking its payload. Client frames must be masked.
+func (ws *websocket) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(ws.r, head[:]); err != nil {
+		return
+	}
+	fin, op = head[0]&0x80 != 0, head[0]&0x0F
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("unmasked websocket frame from client")
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(ws.r, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(ws.r, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxMessageSize {
+		return false, 0, nil, errors.New("websocket frame too long")
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(ws.r, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// writeText sends msg as a single text frame
+func (ws *websocket) writeText(msg []byte) error {
+	return ws.writeFrame(opText, msg)
+}
+
+// writeFrame sends an unfragmented, unmasked frame as servers must
+func (ws *websocket) writeFrame(op byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|op)
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// close closes the connection without a closing handshake
+func (ws *websocket) close() error {
+	return ws.conn.Close()
+}
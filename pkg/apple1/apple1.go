@@ -0,0 +1,200 @@
+// Package apple1 exposes the appleone emulator so other Go programs can embed and drive an
+// Apple 1 directly: stepping the cpu, inspecting and changing registers and memory, and
+// attaching their own memory mapped devices.
+//
+//	m, err := apple1.New(
+//		apple1.WithCPU(apple1.CPU65C02),
+//		apple1.WithMemorySize(8*1024),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	m.Reset()
+//	cycles, err := m.RunCycles(1000000)
+package apple1
+
+import (
+	"github.com/bradford-hamilton/apple-1/internal/vm"
+)
+
+// CPU selects which member of the 6502 family the machine emulates
+type CPU = vm.Variant
+
+const (
+	// CPU6502 is the original NMOS 6502 the Apple 1 shipped with, and the default
+	CPU6502 = vm.NMOS6502
+
+	// CPU65C02 is the CMOS 65C02 used by many Apple 1 replicas
+	CPU65C02 = vm.CMOS65C02
+)
+
+// Registers is a snapshot of the cpu's registers
+type Registers = vm.Registers
+
+// Device is memory mapped hardware. It is handed every access to the pages it is attached
+// to and does its own address decoding.
+type Device = vm.Device
+
+// Peeker is implemented by devices whose reads have side effects, so that Peek can inspect
+// them without disturbing their state
+type Peeker = vm.Peeker
+
+// MemoryMap describes the RAM, ROM, PIA and unmapped regions of the address space
+type MemoryMap = vm.MemoryMap
+
+// Region is a range of whole pages in a memory map
+type Region = vm.Region
+
+// Kinds of memory map region
+const (
+	RegionRAM      = vm.RegionRAM
+	RegionROM      = vm.RegionROM
+	RegionUnmapped = vm.RegionUnmapped
+	RegionPIA      = vm.RegionPIA
+)
+
+// Machine is an emulated Apple 1. It is not safe for concurrent use.
+type Machine struct {
+	vm *vm.VM
+}
+
+// Option configures a Machine created by New
+type Option func(m *Machine) error
+
+// WithCPU selects the cpu variant
+func WithCPU(cpu CPU) Option {
+	return func(m *Machine) error {
+		return m.vm.SetVariant(cpu)
+	}
+}
+
+// WithMemorySize limits RAM to the first size bytes of the address space, rounded up to a
+// whole page. Anything above it that isn't ROM or a device is unmapped.
+func WithMemorySize(size int) Option {
+	return func(m *Machine) error {
+		return m.vm.SetRAMSize(size)
+	}
+}
+
+// WithMemoryMap replaces the whole memory map, so it should come before options that add
+// ROM or devices
+func WithMemoryMap(regions MemoryMap) Option {
+	return func(m *Machine) error {
+		return m.vm.SetMemoryMap(regions)
+	}
+}
+
+// WithROM maps data as read-only memory at addr, which must be page aligned
+func WithROM(addr uint16, data []byte) Option {
+	return func(m *Machine) error {
+		return m.vm.MapROM(addr, data)
+	}
+}
+
+// WithDevice attaches d to every page from start to end inclusive
+func WithDevice(start, end uint16, d Device) Option {
+	return func(m *Machine) error {
+		return m.vm.Attach(start, end, d)
+	}
+}
+
+// New returns a machine configured by opts. Without options it is a stock Apple 1: an NMOS
+// 6502 with 64KiB of RAM, the Woz Monitor ROM at $FF00 and the keyboard and display PIA at
+// $D010-$D013.
+func New(opts ...Option) (*Machine, error) {
+	m := &Machine{vm: vm.New()}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Reset performs the 6502 reset sequence, jumping through the vector at $FFFC
+func (m *Machine) Reset() {
+	m.vm.Reset()
+}
+
+// Step executes a single instruction and returns how many cycles it took
+func (m *Machine) Step() (cycles int, err error) {
+	return m.vm.Step()
+}
+
+// RunCycles executes instructions until at least n cycles have passed or one faults, and
+// returns how many cycles ran
+func (m *Machine) RunCycles(n int) (cycles int, err error) {
+	return m.vm.RunCycles(n)
+}
+
+// Cycles returns the total number of cycles executed
+func (m *Machine) Cycles() uint64 {
+	return m.vm.Cycles()
+}
+
+// Registers returns a snapshot of the cpu's registers
+func (m *Machine) Registers() Registers {
+	return m.vm.Registers()
+}
+
+// SetRegisters replaces the cpu's registers
+func (m *Machine) SetRegisters(r Registers) {
+	m.vm.SetRegisters(r)
+}
+
+// Read returns the byte at addr as the cpu sees it, device side effects included
+func (m *Machine) Read(addr uint16) byte {
+	return m.vm.Read(addr)
+}
+
+// Write stores b at addr as the cpu would, so writes to ROM are ignored
+func (m *Machine) Write(addr uint16, b byte) {
+	m.vm.Write(addr, b)
+}
+
+// Peek returns the byte at addr without disturbing devices that implement Peeker
+func (m *Machine) Peek(addr uint16) byte {
+	return m.vm.Peek(addr)
+}
+
+// Load copies data into RAM or ROM at addr, bypassing write protection
+func (m *Machine) Load(addr uint16, data []byte) {
+	m.vm.Load(addr, data)
+}
+
+// Attach maps d over every page from start to end inclusive
+func (m *Machine) Attach(start, end uint16, d Device) error {
+	return m.vm.Attach(start, end, d)
+}
+
+// ScreenText returns the display as text: 24 lines, each with its trailing blanks removed
+// and ending in a new line
+func (m *Machine) ScreenText() string {
+	return m.vm.ScreenText()
+}
+
+// Disassemble returns the instruction at addr in assembler syntax and the address of the
+// instruction after it
+func (m *Machine) Disassemble(addr uint16) (string, uint16) {
+	return m.vm.Disassemble(addr)
+}
+
+// Flags recorded for each byte of memory by the code/data log
+const (
+	CDLOpcode  = vm.CDLOpcode  // executed as the first byte of an instruction
+	CDLOperand = vm.CDLOperand // fetched as an instruction's operand
+	CDLRead    = vm.CDLRead    // read as data
+	CDLWrite   = vm.CDLWrite   // written
+)
+
+// StartCoverage starts a code/data log of how each byte of memory is used, discarding any
+// earlier log
+func (m *Machine) StartCoverage() {
+	m.vm.StartCoverage()
+}
+
+// CDL returns the code/data log, one byte of CDL flags per address, or nil if coverage
+// wasn't started
+func (m *Machine) CDL() []byte {
+	return m.vm.CDL()
+}
@@ -0,0 +1,74 @@
+package apple1
+
+import (
+	"strings"
+	"testing"
+)
+
+// hello prints HELLO through the Woz Monitor's ECHO routine and then loops forever
+var hello = []byte{
+	0xA2, 0x00, // LDX #0
+	0xBD, 0x10, 0x03, // loop: LDA msg,X
+	0xF0, 0x07, // BEQ done
+	0x20, 0xEF, 0xFF, // JSR ECHO
+	0xE8,             // INX
+	0x4C, 0x02, 0x03, // JMP loop
+	0x4C, 0x0E, 0x03, // done: JMP done
+	'H' | 0x80, 'E' | 0x80, 'L' | 0x80, 'L' | 0x80, 'O' | 0x80, 0x00, // msg
+}
+
+func TestRunProgram(t *testing.T) {
+	m, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Load(0x0300, hello)
+	regs := m.Registers()
+	regs.PC = 0x0300
+	m.SetRegisters(regs)
+
+	if _, err := m.RunCycles(10000); err != nil {
+		t.Fatal(err)
+	}
+	if pc := m.Registers().PC; pc != 0x030E {
+		t.Errorf("PC = $%04X, want $030E", pc)
+	}
+	if got := strings.SplitN(m.ScreenText(), "\n", 2)[0]; got != "HELLO" {
+		t.Errorf("screen shows %q, want HELLO", got)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	m, err := New(WithCPU(CPU65C02), WithMemorySize(4*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// STZ $10 only decodes on the 65C02
+	m.Write(0x10, 0xAA)
+	m.Load(0x0200, []byte{0x64, 0x10})
+	regs := m.Registers()
+	regs.PC = 0x0200
+	m.SetRegisters(regs)
+	if _, err := m.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if b := m.Peek(0x10); b != 0 {
+		t.Errorf("$10 = $%02X after STZ, want 0", b)
+	}
+
+	// RAM ends at 4KiB, reads above it see the last value on the data bus, and the Woz
+	// Monitor ROM is still mapped and ignores writes
+	m.Write(0x2000, 0x55)
+	m.Write(0x0010, 0x11)
+	if b := m.Read(0x2000); b != 0x11 {
+		t.Errorf("$2000 = $%02X, want $11 left on the data bus", b)
+	}
+	m.Write(0xFF00, 0x00)
+	if b := m.Peek(0xFF00); b != 0xD8 {
+		t.Errorf("$FF00 = $%02X, want the Woz Monitor's CLD ($D8)", b)
+	}
+
+	if _, err := New(WithROM(0xFF01, []byte{0})); err == nil {
+		t.Error("expected an error mapping ROM at an unaligned address")
+	}
+}
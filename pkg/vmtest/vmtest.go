@@ -0,0 +1,162 @@
+// Package vmtest calls 6502 subroutines from Go tests, so routines can be tested one at a time
+// with ordinary table-driven cases.
+//
+//	func TestAdd(t *testing.T) {
+//		m := vmtest.New(t)
+//		m.Load(0x0300, add)
+//		for _, tc := range []struct{ a, x, want byte }{{1, 2, 3}, {255, 1, 0}} {
+//			res := m.Call(0x0300, vmtest.Regs{A: tc.a, X: tc.x})
+//			if res.A != tc.want {
+//				t.Errorf("%d+%d = %d, want %d", tc.a, tc.x, res.A, tc.want)
+//			}
+//		}
+//	}
+package vmtest
+
+import (
+	"testing"
+
+	"github.com/bradford-hamilton/apple-1/pkg/apple1"
+)
+
+// Sentinel is the return address Call pushes before jumping to a subroutine. It is one of
+// the unused bytes before the vectors, so no routine should return there by accident.
+const Sentinel uint16 = 0xFFF8
+
+// DefaultMaxCycles is how many cycles a call may run before it is taken to be a runaway
+const DefaultMaxCycles = 1000000
+
+// Status register bits
+const (
+	flagCarry     = 0x01
+	flagZero      = 0x02
+	flagInterrupt = 0x04
+	flagDecimal   = 0x08
+	flagOverflow  = 0x40
+	flagNegative  = 0x80
+)
+
+// Regs are the registers a subroutine is called with
+type Regs struct {
+	A byte
+	X byte
+	Y byte
+	P byte // processor status, the unused and break bits always read set
+}
+
+// Flags are the processor status flags
+type Flags struct {
+	N bool // negative
+	V bool // overflow
+	D bool // decimal mode
+	I bool // interrupts disabled
+	Z bool // zero
+	C bool // carry
+}
+
+// Result is the state a subroutine returned with
+type Result struct {
+	A      byte
+	X      byte
+	Y      byte
+	SP     byte
+	P      byte
+	Flags  Flags
+	Cycles int // from the routine's first instruction to its RTS, not counting a JSR to it
+
+	// Reads lists the addresses read as data in ascending order, including the stack bytes
+	// the final RTS pulls
+	Reads []uint16
+
+	// Writes holds every address written, with the value it holds after the call
+	Writes map[uint16]byte
+}
+
+// Machine is an Apple 1 for calling subroutines on. Its memory and stack carry over from one
+// call to the next.
+type Machine struct {
+	*apple1.Machine
+
+	// MaxCycles is how many cycles a call may run before it fails the test as a runaway
+	MaxCycles int
+
+	t testing.TB
+}
+
+// New returns a machine configured by opts, failing the test if one of them can't be applied
+func New(t testing.TB, opts ...apple1.Option) *Machine {
+	t.Helper()
+	m, err := apple1.New(opts...)
+	if err != nil {
+		t.Fatalf("vmtest: %v", err)
+	}
+	return &Machine{Machine: m, MaxCycles: DefaultMaxCycles, t: t}
+}
+
+// Call runs the subroutine at addr with the given registers, as if it had been called with
+// JSR, and returns once its matching RTS returns to the Sentinel with the stack back where
+// it started. Calls that fault or run for more than MaxCycles fail the test.
+//
+// Call logs memory accesses with the machine's code/data log, replacing any log started
+// before it.
+func (m *Machine) Call(addr uint16, in Regs) Result {
+	m.t.Helper()
+
+	regs := m.Registers()
+	sp := regs.SP
+	ret := Sentinel - 1 // RTS adds one to the address it pulls
+	m.Write(0x0100|uint16(sp), byte(ret>>8))
+	m.Write(0x0100|uint16(sp-1), byte(ret))
+	regs.A, regs.X, regs.Y, regs.P = in.A, in.X, in.Y, in.P
+	regs.SP, regs.PC = sp-2, addr
+	m.SetRegisters(regs)
+
+	m.StartCoverage()
+	start := m.Cycles()
+	for {
+		if used := m.Cycles() - start; used > uint64(m.MaxCycles) {
+			m.t.Fatalf("vmtest: calling $%04X: still running after %d cycles, at $%04X", addr, used, m.Registers().PC)
+			return Result{}
+		}
+		if _, err := m.Step(); err != nil {
+			m.t.Fatalf("vmtest: calling $%04X: %v", addr, err)
+			return Result{}
+		}
+		if r := m.Registers(); r.PC == Sentinel && r.SP == sp {
+			break
+		}
+	}
+
+	r := m.Registers()
+	res := Result{
+		A:      r.A,
+		X:      r.X,
+		Y:      r.Y,
+		SP:     r.SP,
+		P:      r.P,
+		Flags:  flags(r.P),
+		Cycles: int(m.Cycles() - start),
+		Writes: make(map[uint16]byte),
+	}
+	for a, f := range m.CDL() {
+		if f&apple1.CDLRead != 0 {
+			res.Reads = append(res.Reads, uint16(a))
+		}
+		if f&apple1.CDLWrite != 0 {
+			res.Writes[uint16(a)] = m.Peek(uint16(a))
+		}
+	}
+	return res
+}
+
+// flags decodes the processor status register
+func flags(p byte) Flags {
+	return Flags{
+		N: p&flagNegative != 0,
+		V: p&flagOverflow != 0,
+		D: p&flagDecimal != 0,
+		I: p&flagInterrupt != 0,
+		Z: p&flagZero != 0,
+		C: p&flagCarry != 0,
+	}
+}
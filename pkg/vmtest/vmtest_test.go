@@ -0,0 +1,107 @@
+package vmtest
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// add stores X in $10 and adds it to A: STX $10, CLC, ADC $10, RTS
+var add = []byte{0x86, 0x10, 0x18, 0x65, 0x10, 0x60}
+
+func TestCall(t *testing.T) {
+	m := New(t)
+	m.Load(0x0300, add)
+
+	tests := []struct {
+		a, x byte
+		want byte
+		c, z bool
+	}{
+		{1, 2, 3, false, false},
+		{255, 1, 0, true, true},
+		{0x7F, 0x01, 0x80, false, false},
+	}
+	for _, tc := range tests {
+		res := m.Call(0x0300, Regs{A: tc.a, X: tc.x})
+		if res.A != tc.want || res.Flags.C != tc.c || res.Flags.Z != tc.z {
+			t.Errorf("$%02X+$%02X = $%02X C=%v Z=%v, want $%02X C=%v Z=%v", tc.a, tc.x, res.A, res.Flags.C, res.Flags.Z, tc.want, tc.c, tc.z)
+		}
+		if res.X != tc.x || res.SP != 0xFF {
+			t.Errorf("X=$%02X SP=$%02X, want X=$%02X SP=$FF", res.X, res.SP, tc.x)
+		}
+		if res.Cycles != 14 {
+			t.Errorf("took %d cycles, want 14", res.Cycles)
+		}
+		if len(res.Writes) != 1 || res.Writes[0x10] != tc.x {
+			t.Errorf("wrote %v, want only $10 = $%02X", res.Writes, tc.x)
+		}
+		if fmt.Sprint(res.Reads) != fmt.Sprint([]uint16{0x10, 0x01FE, 0x01FF}) {
+			t.Errorf("read %v, want $10 and the return address", res.Reads)
+		}
+	}
+}
+
+func TestCallNested(t *testing.T) {
+	// JSR $0310, INX, RTS with $0310: INX, RTS
+	m := New(t)
+	m.Load(0x0300, []byte{0x20, 0x10, 0x03, 0xE8, 0x60})
+	m.Load(0x0310, []byte{0xE8, 0x60})
+
+	res := m.Call(0x0300, Regs{X: 5})
+	if res.X != 7 {
+		t.Errorf("X = %d, want 7", res.X)
+	}
+	if res.Cycles != 6+2+6+2+6 {
+		t.Errorf("took %d cycles, want %d", res.Cycles, 6+2+6+2+6)
+	}
+}
+
+// fatalRecorder captures a Fatalf and stops the calling goroutine like testing.T does
+type fatalRecorder struct {
+	testing.TB
+	msg string
+}
+
+func (f *fatalRecorder) Helper() {}
+
+func (f *fatalRecorder) Fatalf(format string, args ...interface{}) {
+	f.msg = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+// callFails calls addr on m with its failures recorded and returns the message
+func callFails(m *Machine, addr uint16) string {
+	rec := &fatalRecorder{TB: m.t}
+	m.t = rec
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Call(addr, Regs{})
+	}()
+	<-done
+	return rec.msg
+}
+
+func TestCallFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		want    string
+	}{
+		{"runaway", []byte{0x4C, 0x00, 0x03}, "still running after"},
+		{"fault", []byte{0x02}, "unknown opcode"},
+		{"unbalanced stack", []byte{0x48, 0x60}, "still running after"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := New(t)
+			m.MaxCycles = 1000
+			m.Load(0x0300, tc.program)
+			if msg := callFails(m, 0x0300); !strings.Contains(msg, tc.want) {
+				t.Errorf("failed with %q, want it to mention %q", msg, tc.want)
+			}
+		})
+	}
+}